@@ -0,0 +1,999 @@
+package adoctest
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Behavior scripts what the containers of an image do after started, by default they print
+// nothing and keep running until stopped
+type Behavior struct {
+	Stdout    string        // written to the logs when started
+	Stderr    string        // written to the logs when started
+	Exit      bool          // exits by itself after the Duration
+	Duration  time.Duration // how long it runs before exiting
+	ExitCode  int           // the exit code when exits by itself
+	OOMKilled bool          // marks the exit as OOM killed
+	// Health is the healthcheck status after the HealthDelay since started, healthy or unhealthy,
+	// default to healthy for the containers with the healthcheck
+	Health      string
+	HealthDelay time.Duration // how long the health is starting
+}
+
+// SetBehavior sets the behavior for the containers created from the image afterwards
+func (s *Server) SetBehavior(imageName string, behavior Behavior) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.behaviors[normalizeImageName(imageName)] = behavior
+}
+
+type containerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Dead       bool
+	Pid        int
+	ExitCode   int
+	Error      string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Health     *healthState `json:",omitempty"`
+}
+
+type healthState struct {
+	Status        string
+	FailingStreak int
+	Log           []interface{}
+}
+
+type logLine struct {
+	stream byte // 1 for stdout, 2 for stderr
+	text   string
+	time   time.Time
+}
+
+type container struct {
+	ID               string
+	Name             string
+	Image            string
+	ImageID          string
+	Config           map[string]interface{}
+	HostConfig       map[string]interface{}
+	NetworkingConfig map[string]interface{}
+	Created          time.Time
+	State            containerState
+	RestartCount     int
+	IPAddress        string
+	ExecIDs          []string
+
+	anonymous  map[string]string // the anonymous volume names by the targets
+	behavior   Behavior
+	output     []logLine
+	generation int
+	exited     chan struct{}
+	changed    chan struct{} // closed when the output or the state changes, for the attached streams
+}
+
+// changes returns the channel closed on the next change, the lock should be held
+func (c *container) changes() chan struct{} {
+	if c.changed == nil {
+		c.changed = make(chan struct{})
+	}
+	return c.changed
+}
+
+// notify wakes up the attached streams, the lock should be held
+func (c *container) notify() {
+	if c.changed != nil {
+		close(c.changed)
+		c.changed = nil
+	}
+}
+
+func (c *container) labels() map[string]string {
+	ret := make(map[string]string)
+	if labels, ok := c.Config["Labels"].(map[string]interface{}); ok {
+		for key, value := range labels {
+			ret[key] = fmt.Sprint(value)
+		}
+	}
+	return ret
+}
+
+func (c *container) tty() bool {
+	tty, _ := c.Config["Tty"].(bool)
+	return tty
+}
+
+func (c *container) command() []string {
+	var cmd []string
+	for _, key := range []string{"Entrypoint", "Cmd"} {
+		if list, ok := c.Config[key].([]interface{}); ok {
+			for _, arg := range list {
+				cmd = append(cmd, fmt.Sprint(arg))
+			}
+		}
+	}
+	return cmd
+}
+
+// health returns the healthcheck status by the behavior, nil if the container has no healthcheck
+func (c *container) health() *healthState {
+	test, _ := c.Config["Healthcheck"].(map[string]interface{})
+	list, _ := test["Test"].([]interface{})
+	if c.behavior.Health == "" && (len(list) == 0 || fmt.Sprint(list[0]) == "NONE") {
+		return nil
+	}
+	status := c.behavior.Health
+	if status == "" {
+		status = "healthy"
+	}
+	switch {
+	case c.State.Status == "created":
+		status = "starting"
+	case !c.State.Running:
+		// the daemon marks the health as unhealthy when stopped
+		status = "unhealthy"
+	case time.Since(c.State.StartedAt) < c.behavior.HealthDelay:
+		status = "starting"
+	}
+	ret := &healthState{Status: status, Log: []interface{}{}}
+	if status == "unhealthy" {
+		ret.FailingStreak = 3
+	}
+	return ret
+}
+
+// healthStatus returns the health like the health filter, none for the container without the healthcheck
+func (c *container) healthStatus() string {
+	if health := c.health(); health != nil {
+		return health.Status
+	}
+	return "none"
+}
+
+func (c *container) statusText() string {
+	switch c.State.Status {
+	case "running":
+		if health := c.health(); health != nil {
+			if health.Status == "starting" {
+				return "Up " + humanDuration(time.Since(c.State.StartedAt)) + " (health: starting)"
+			}
+			return "Up " + humanDuration(time.Since(c.State.StartedAt)) + " (" + health.Status + ")"
+		}
+		return "Up " + humanDuration(time.Since(c.State.StartedAt))
+	case "paused":
+		return "Up " + humanDuration(time.Since(c.State.StartedAt)) + " (Paused)"
+	case "exited":
+		return fmt.Sprintf("Exited (%d) %s ago", c.State.ExitCode, humanDuration(time.Since(c.State.FinishedAt)))
+	}
+	return "Created"
+}
+
+func humanDuration(d time.Duration) string {
+	if secs := int(d.Seconds()); secs < 60 {
+		return fmt.Sprintf("%d seconds", secs)
+	}
+	return fmt.Sprintf("%d minutes", int(d.Minutes()))
+}
+
+func (c *container) ports() []map[string]interface{} {
+	ret := make([]map[string]interface{}, 0)
+	exposed, _ := c.Config["ExposedPorts"].(map[string]interface{})
+	bindings, _ := c.HostConfig["PortBindings"].(map[string]interface{})
+	keys := make([]string, 0, len(exposed))
+	for port := range exposed {
+		keys = append(keys, port)
+	}
+	for port := range bindings {
+		if _, ok := exposed[port]; !ok {
+			keys = append(keys, port)
+		}
+	}
+	sort.Strings(keys)
+	for _, port := range keys {
+		parts := strings.SplitN(port, "/", 2)
+		privatePort, _ := strconv.Atoi(parts[0])
+		proto := "tcp"
+		if len(parts) == 2 {
+			proto = parts[1]
+		}
+		entry := map[string]interface{}{"PrivatePort": privatePort, "Type": proto}
+		if list, ok := bindings[port].([]interface{}); ok && len(list) > 0 && c.State.Running {
+			binding, _ := list[0].(map[string]interface{})
+			hostIp, _ := binding["HostIp"].(string)
+			hostPort, _ := binding["HostPort"].(string)
+			if hostIp == "" {
+				hostIp = "0.0.0.0"
+			}
+			publicPort, _ := strconv.Atoi(hostPort)
+			if publicPort == 0 {
+				publicPort = 32768 + privatePort%1000
+			}
+			entry["IP"] = hostIp
+			entry["PublicPort"] = publicPort
+		}
+		ret = append(ret, entry)
+	}
+	return ret
+}
+
+func (c *container) networkPorts() map[string]interface{} {
+	ret := make(map[string]interface{})
+	for _, port := range c.ports() {
+		key := fmt.Sprintf("%d/%s", port["PrivatePort"], port["Type"])
+		if publicPort, ok := port["PublicPort"]; ok {
+			ret[key] = []map[string]string{{"HostIp": port["IP"].(string), "HostPort": fmt.Sprint(publicPort)}}
+		} else {
+			ret[key] = nil
+		}
+	}
+	return ret
+}
+
+// findContainer looks up the container by id, id prefix or name, the lock should be held
+func (s *Server) findContainer(idOrName string) *container {
+	if c, ok := s.containers[idOrName]; ok {
+		return c
+	}
+	name := "/" + strings.TrimPrefix(idOrName, "/")
+	for _, c := range s.containers {
+		if c.Name == name {
+			return c
+		}
+	}
+	var found *container
+	for id, c := range s.containers {
+		if strings.HasPrefix(id, idOrName) {
+			if found != nil {
+				return nil
+			}
+			found = c
+		}
+	}
+	return found
+}
+
+func (s *Server) routeContainers(w http.ResponseWriter, r *http.Request, segs []string) bool {
+	method := r.Method
+	if len(segs) == 2 {
+		switch {
+		case segs[1] == "json" && method == "GET":
+			s.handleListContainers(w, r)
+		case segs[1] == "create" && method == "POST":
+			s.handleCreateContainer(w, r)
+		case method == "DELETE":
+			s.handleRemoveContainer(w, r, segs[1])
+		default:
+			return false
+		}
+		return true
+	}
+	if len(segs) != 3 {
+		return false
+	}
+	id, action := segs[1], segs[2]
+	switch {
+	case method == "GET" && action == "json":
+		s.handleInspectContainer(w, r, id)
+	case method == "GET" && action == "logs":
+		s.handleLogs(w, r, id)
+	case method == "GET" && action == "stats":
+		s.handleStats(w, r, id)
+	case method == "GET" && action == "top":
+		s.handleTop(w, r, id)
+	case method == "GET" && action == "changes":
+		s.withContainer(w, id, func(c *container) {
+			writeJSON(w, http.StatusOK, []map[string]interface{}{})
+		})
+	case method == "POST" && action == "attach":
+		s.handleAttach(w, r, id)
+	case method == "POST" && action == "wait":
+		s.handleWait(w, r, id)
+	case method == "POST" && action == "exec":
+		s.handleExecCreate(w, r, id)
+	case method == "POST" && action == "update":
+		s.handleUpdate(w, r, id)
+	case method == "POST" && action == "rename":
+		s.handleRename(w, r, id)
+	case method == "POST":
+		s.handleContainerAction(w, r, id, action)
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *Server) withContainer(w http.ResponseWriter, id string, fn func(c *container)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	c := s.findContainer(id)
+	if c == nil {
+		http.Error(w, fmt.Sprintf("No such container: %s", id), http.StatusNotFound)
+		return
+	}
+	fn(c)
+}
+
+func (s *Server) handleListContainers(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	query := r.URL.Query()
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if boolParam(r, "latest") {
+		limit = 1
+	}
+	// the since and before params are the same as the filters
+	for _, key := range []string{"since", "before"} {
+		if value := query.Get(key); value != "" {
+			f[key] = append(f[key], value)
+		}
+	}
+	showAll := boolParam(r, "all") || limit > 0
+	showSize := boolParam(r, "size")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	list := make([]*container, 0, len(s.containers))
+	for _, c := range s.containers {
+		if !showAll && !c.State.Running && len(f["status"]) == 0 {
+			continue
+		}
+		if !f.match("status", c.State.Status) || !f.match("health", c.healthStatus()) || !f.matchAny("id", c.ID) || !f.matchAny("name", c.Name[1:]) ||
+			!f.matchAny("ancestor", c.Image, c.ImageID) || !f.matchLabels(c.labels()) {
+			continue
+		}
+		list = append(list, c)
+	}
+	// newest first, like the daemon
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.After(list[j].Created) })
+	for _, value := range f["before"] {
+		if c := s.findContainer(value); c != nil {
+			list = createdBefore(list, c)
+		}
+	}
+	for _, value := range f["since"] {
+		if c := s.findContainer(value); c != nil {
+			list = createdSince(list, c)
+		}
+	}
+	if limit > 0 && len(list) > limit {
+		list = list[:limit]
+	}
+	ret := make([]map[string]interface{}, 0, len(list))
+	for _, c := range list {
+		entry := map[string]interface{}{
+			"Id":      c.ID,
+			"Names":   []string{c.Name},
+			"Image":   c.Image,
+			"ImageID": c.ImageID,
+			"Command": strings.Join(c.command(), " "),
+			"Created": c.Created.Unix(),
+			"Status":  c.statusText(),
+			"State":   c.State.Status,
+			"Labels":  c.labels(),
+			"Ports":   c.ports(),
+		}
+		if showSize {
+			entry["SizeRw"] = int64(0)
+			entry["SizeRootFs"] = s.images[c.ImageID].Size
+		}
+		ret = append(ret, entry)
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func createdBefore(list []*container, mark *container) []*container {
+	ret := make([]*container, 0, len(list))
+	for _, c := range list {
+		if c.Created.Before(mark.Created) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+func createdSince(list []*container, mark *container) []*container {
+	ret := make([]*container, 0, len(list))
+	for _, c := range list {
+		if c.Created.After(mark.Created) {
+			ret = append(ret, c)
+		}
+	}
+	return ret
+}
+
+func (s *Server) handleCreateContainer(w http.ResponseWriter, r *http.Request) {
+	var config map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid container config: %s", err), http.StatusBadRequest)
+		return
+	}
+	hostConfig, _ := config["HostConfig"].(map[string]interface{})
+	networkingConfig, _ := config["NetworkingConfig"].(map[string]interface{})
+	delete(config, "HostConfig")
+	delete(config, "NetworkingConfig")
+	if hostConfig == nil {
+		hostConfig = make(map[string]interface{})
+	}
+	imageName, _ := config["Image"].(string)
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img := s.findImage(imageName)
+	if img == nil {
+		http.Error(w, fmt.Sprintf("No such image: %s", imageName), http.StatusNotFound)
+		return
+	}
+	id := newID()
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		name = "adoctest_" + id[:8]
+	}
+	name = "/" + strings.TrimPrefix(name, "/")
+	for _, other := range s.containers {
+		if other.Name == name {
+			http.Error(w, fmt.Sprintf("Conflict. The name %q is already in use by container %s. You have to remove (or rename) that container to be able to reuse that name.", name[1:], other.ID), http.StatusConflict)
+			return
+		}
+	}
+	// the image defaults, like the daemon does
+	for _, key := range []string{"Cmd", "Entrypoint", "Env", "WorkingDir", "User", "ExposedPorts", "Labels", "Volumes", "StopSignal", "Healthcheck"} {
+		if _, ok := img.Config[key]; !ok {
+			continue
+		}
+		if value, ok := config[key]; !ok || value == nil || value == "" {
+			config[key] = jsonValue(img.Config[key])
+			continue
+		}
+		switch key {
+		case "Env":
+			config[key] = mergeEnv(config[key], jsonValue(img.Config[key]))
+		case "ExposedPorts", "Labels", "Volumes":
+			merged := copyMap(jsonValue(img.Config[key]))
+			for k, v := range copyMap(config[key]) {
+				merged[k] = v
+			}
+			config[key] = merged
+		}
+	}
+	if hostname, _ := config["Hostname"].(string); hostname == "" {
+		config["Hostname"] = id[:12]
+	}
+	// the swap is twice the memory by default
+	if memory, _ := hostConfig["Memory"].(float64); memory > 0 {
+		if swap, _ := hostConfig["MemorySwap"].(float64); swap == 0 {
+			hostConfig["MemorySwap"] = memory * 2
+		}
+	}
+	c := &container{
+		ID:               id,
+		Name:             name,
+		Image:            imageName,
+		ImageID:          img.ID,
+		Config:           config,
+		HostConfig:       hostConfig,
+		NetworkingConfig: networkingConfig,
+		Created:          time.Now(),
+		State:            containerState{Status: "created"},
+		behavior:         s.behaviors[normalizeImageName(imageName)],
+	}
+	for _, name := range c.volumeNames() {
+		s.addVolume(name, "", nil, nil)
+	}
+	s.addAnonymousVolumes(c)
+	s.containers[id] = c
+	s.containerEvent(c, "create")
+	writeJSON(w, http.StatusCreated, map[string]interface{}{"Id": id, "Warnings": nil})
+}
+
+// jsonValue converts the value into the shape decoded from JSON, e.g. []string into []interface{}
+func jsonValue(value interface{}) interface{} {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value
+	}
+	var ret interface{}
+	json.Unmarshal(data, &ret)
+	return ret
+}
+
+// mergeEnv adds the image env whose names are not in the container env
+func mergeEnv(env interface{}, imageEnv interface{}) []interface{} {
+	list, _ := env.([]interface{})
+	merged := append([]interface{}(nil), list...)
+	names := make(map[string]bool)
+	for _, value := range list {
+		names[strings.SplitN(fmt.Sprint(value), "=", 2)[0]] = true
+	}
+	imageList, _ := imageEnv.([]interface{})
+	for _, value := range imageList {
+		if !names[strings.SplitN(fmt.Sprint(value), "=", 2)[0]] {
+			merged = append(merged, value)
+		}
+	}
+	return merged
+}
+
+// networks returns the endpoints of the container like the daemon, the user defined network has
+// the IPAM config and the aliases from the NetworkingConfig
+func (c *container) networks() map[string]interface{} {
+	mode, _ := c.HostConfig["NetworkMode"].(string)
+	switch {
+	case mode == "" || mode == "default" || mode == "bridge":
+		return map[string]interface{}{
+			"bridge": map[string]interface{}{"IPAddress": c.IPAddress, "Gateway": "172.17.0.1"},
+		}
+	case mode == "host" || mode == "none" || strings.HasPrefix(mode, "container:"):
+		return map[string]interface{}{}
+	}
+	// the other networks of the EndpointsConfig are connected too, like the daemon since v1.44
+	endpoints, _ := c.NetworkingConfig["EndpointsConfig"].(map[string]interface{})
+	ret := map[string]interface{}{mode: nil}
+	for name := range endpoints {
+		ret[name] = nil
+	}
+	for name := range ret {
+		endpoint := map[string]interface{}{"IPAddress": c.IPAddress, "Aliases": []string{c.ID[:12]}}
+		if config, ok := endpoints[name].(map[string]interface{}); ok {
+			if ipam, ok := config["IPAMConfig"].(map[string]interface{}); ok {
+				endpoint["IPAMConfig"] = ipam
+				if ip, _ := ipam["IPv4Address"].(string); ip != "" {
+					endpoint["IPAddress"] = ip
+				}
+			}
+			if aliases, ok := config["Aliases"].([]interface{}); ok {
+				endpoint["Aliases"] = append(aliases, c.ID[:12])
+			}
+		}
+		ret[name] = endpoint
+	}
+	return ret
+}
+
+func (s *Server) handleInspectContainer(w http.ResponseWriter, r *http.Request, id string) {
+	s.withContainer(w, id, func(c *container) {
+		cmd := c.command()
+		var path string
+		var args []string
+		if len(cmd) > 0 {
+			path, args = cmd[0], cmd[1:]
+		}
+		state := c.State
+		state.Health = c.health()
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"Id":           c.ID,
+			"Name":         c.Name,
+			"Created":      c.Created,
+			"Path":         path,
+			"Args":         args,
+			"Config":       c.Config,
+			"HostConfig":   c.HostConfig,
+			"Image":        c.ImageID,
+			"State":        state,
+			"RestartCount": c.RestartCount,
+			"ExecIDs":      c.ExecIDs,
+			"Driver":       "overlay2",
+			"Mounts":       c.mounts(),
+			"NetworkSettings": map[string]interface{}{
+				"IPAddress":   c.IPAddress,
+				"IPPrefixLen": 16,
+				"Gateway":     "172.17.0.1",
+				"Bridge":      "docker0",
+				"Ports":       c.networkPorts(),
+				"Networks":    c.networks(),
+			},
+		})
+	})
+}
+
+// start runs the container, the lock should be held
+func (s *Server) start(c *container) {
+	now := time.Now()
+	c.generation += 1
+	c.exited = make(chan struct{})
+	c.State = containerState{
+		Status:    "running",
+		Running:   true,
+		Pid:       1000 + c.generation,
+		StartedAt: now,
+	}
+	if c.IPAddress == "" {
+		c.IPAddress = fmt.Sprintf("172.17.%d.%d", s.nextIP/250, s.nextIP%250+2)
+		s.nextIP += 1
+	}
+	for _, line := range splitLines(c.behavior.Stdout) {
+		c.output = append(c.output, logLine{1, line, now})
+	}
+	for _, line := range splitLines(c.behavior.Stderr) {
+		c.output = append(c.output, logLine{2, line, now})
+	}
+	s.containerEvent(c, "start")
+	c.notify()
+	if c.behavior.Exit {
+		generation := c.generation
+		time.AfterFunc(c.behavior.Duration, func() {
+			s.lock.Lock()
+			defer s.lock.Unlock()
+			if c.generation == generation && c.State.Running {
+				if c.behavior.OOMKilled {
+					s.containerEvent(c, "oom")
+				}
+				s.stop(c, c.behavior.ExitCode, c.behavior.OOMKilled)
+			}
+		})
+	}
+}
+
+// stop exits the container with the exit code, the lock should be held
+func (s *Server) stop(c *container, exitCode int, oomKilled bool) {
+	c.State.Status = "exited"
+	c.State.Running = false
+	c.State.Paused = false
+	c.State.Pid = 0
+	c.State.ExitCode = exitCode
+	c.State.OOMKilled = oomKilled
+	c.State.FinishedAt = time.Now()
+	close(c.exited)
+	s.containerEvent(c, "die", "exitCode", strconv.Itoa(exitCode))
+	c.notify()
+}
+
+func splitLines(text string) []string {
+	var lines []string
+	for len(text) > 0 {
+		i := strings.Index(text, "\n")
+		if i < 0 {
+			lines = append(lines, text)
+			break
+		}
+		lines = append(lines, text[:i+1])
+		text = text[i+1:]
+	}
+	return lines
+}
+
+func (s *Server) handleContainerAction(w http.ResponseWriter, r *http.Request, id string, action string) {
+	s.withContainer(w, id, func(c *container) {
+		switch action {
+		case "start":
+			if c.State.Running {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			s.start(c)
+		case "stop":
+			if !c.State.Running {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+			s.stop(c, 143, false)
+			s.containerEvent(c, "stop")
+		case "restart":
+			if c.State.Running {
+				s.stop(c, 143, false)
+			}
+			s.start(c)
+			s.containerEvent(c, "restart")
+		case "kill":
+			if !c.State.Running {
+				http.Error(w, fmt.Sprintf("Cannot kill container %s: Container %s is not running", id, c.ID), http.StatusConflict)
+				return
+			}
+			signal := r.URL.Query().Get("signal")
+			if signal == "" {
+				signal = "SIGKILL"
+			}
+			s.containerEvent(c, "kill", "signal", signal)
+			s.stop(c, 137, false)
+		case "pause":
+			if !c.State.Running || c.State.Paused {
+				http.Error(w, fmt.Sprintf("Container %s is not running or already paused", c.ID), http.StatusConflict)
+				return
+			}
+			c.State.Paused = true
+			c.State.Status = "paused"
+			s.containerEvent(c, "pause")
+		case "unpause":
+			if !c.State.Paused {
+				http.Error(w, fmt.Sprintf("Container %s is not paused", c.ID), http.StatusConflict)
+				return
+			}
+			c.State.Paused = false
+			c.State.Status = "running"
+			s.containerEvent(c, "unpause")
+		default:
+			http.Error(w, fmt.Sprintf("page not found: POST containers/%s/%s", id, action), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (s *Server) handleRemoveContainer(w http.ResponseWriter, r *http.Request, id string) {
+	force := boolParam(r, "force")
+	removeVolumes := boolParam(r, "v")
+	s.withContainer(w, id, func(c *container) {
+		if c.State.Running && !force {
+			http.Error(w, fmt.Sprintf("Conflict, You cannot remove a running container %s. Stop the container before attempting removal or use -f", c.ID), http.StatusConflict)
+			return
+		}
+		if c.State.Running {
+			s.containerEvent(c, "kill", "signal", "SIGKILL")
+			s.stop(c, 137, false)
+		}
+		for _, execId := range c.ExecIDs {
+			delete(s.execs, execId)
+		}
+		delete(s.containers, c.ID)
+		if removeVolumes {
+			s.removeAnonymousVolumes(c)
+		}
+		s.containerEvent(c, "destroy")
+		c.notify()
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (s *Server) handleRename(w http.ResponseWriter, r *http.Request, id string) {
+	name := "/" + strings.TrimPrefix(r.URL.Query().Get("name"), "/")
+	s.withContainer(w, id, func(c *container) {
+		for _, other := range s.containers {
+			if other != c && other.Name == name {
+				http.Error(w, fmt.Sprintf("Conflict. The name %q is already in use by container %s.", name[1:], other.ID), http.StatusConflict)
+				return
+			}
+		}
+		oldName := c.Name
+		c.Name = name
+		s.containerEvent(c, "rename", "oldName", oldName)
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (s *Server) handleUpdate(w http.ResponseWriter, r *http.Request, id string) {
+	var update map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&update); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid update config: %s", err), http.StatusBadRequest)
+		return
+	}
+	s.withContainer(w, id, func(c *container) {
+		var warnings []string
+		for key, value := range update {
+			// the zero values are not changed, like the daemon
+			if isZeroValue(value) {
+				continue
+			}
+			if policy, ok := value.(map[string]interface{}); ok && key == "RestartPolicy" && isZeroValue(policy["Name"]) {
+				continue
+			}
+			if key == "MemorySwap" {
+				// the fake host has no swap accounting
+				warnings = append(warnings, "Your kernel does not support swap limit capabilities or the cgroup is not mounted. Memory limited without swap.")
+			}
+			c.HostConfig[key] = value
+		}
+		s.containerEvent(c, "update")
+		writeJSON(w, http.StatusOK, map[string]interface{}{"Warnings": warnings})
+	})
+}
+
+func isZeroValue(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return true
+	case float64:
+		return v == 0
+	case string:
+		return v == ""
+	case bool:
+		return !v
+	case []interface{}:
+		return len(v) == 0
+	}
+	return false
+}
+
+func (s *Server) handleWait(w http.ResponseWriter, r *http.Request, id string) {
+	var c *container
+	var exited chan struct{}
+	var running bool
+	s.withContainer(w, id, func(found *container) {
+		c, exited, running = found, found.exited, found.State.Running
+	})
+	if c == nil {
+		return
+	}
+	if running {
+		select {
+		case <-exited:
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+	s.lock.Lock()
+	exitCode := c.State.ExitCode
+	s.lock.Unlock()
+	writeJSON(w, http.StatusOK, map[string]int{"StatusCode": exitCode})
+}
+
+func (s *Server) handleTop(w http.ResponseWriter, r *http.Request, id string) {
+	s.withContainer(w, id, func(c *container) {
+		if !c.State.Running {
+			http.Error(w, fmt.Sprintf("Container %s is not running", c.ID), http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"Titles":    []string{"UID", "PID", "PPID", "C", "STIME", "TTY", "TIME", "CMD"},
+			"Processes": [][]string{{"root", strconv.Itoa(c.State.Pid), "1", "0", "00:00", "?", "00:00:00", strings.Join(c.command(), " ")}},
+		})
+	})
+}
+
+// writeFrame writes the log line in the multiplexed framing, or raw for the tty
+func writeFrame(w http.ResponseWriter, stream byte, data string, tty bool) error {
+	if !tty {
+		header := make([]byte, 8)
+		header[0] = stream
+		binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+		if _, err := w.Write(header); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write([]byte(data))
+	return err
+}
+
+func (s *Server) handleLogs(w http.ResponseWriter, r *http.Request, id string) {
+	stdout, stderr := boolParam(r, "stdout"), boolParam(r, "stderr")
+	timestamps, follow := boolParam(r, "timestamps"), boolParam(r, "follow")
+	tail := -1
+	if value := r.URL.Query().Get("tail"); value != "" && value != "all" {
+		tail, _ = strconv.Atoi(value)
+	}
+	var lines []logLine
+	var tty, running bool
+	var exited chan struct{}
+	var found bool
+	s.withContainer(w, id, func(c *container) {
+		found = true
+		lines = append(lines, c.output...)
+		tty, running, exited = c.tty(), c.State.Running, c.exited
+	})
+	if !found {
+		return
+	}
+	if tail >= 0 && tail < len(lines) {
+		lines = lines[len(lines)-tail:]
+	}
+	w.WriteHeader(http.StatusOK)
+	for _, line := range lines {
+		if (line.stream == 1 && !stdout) || (line.stream == 2 && !stderr) {
+			continue
+		}
+		text := line.text
+		if timestamps {
+			text = line.time.Format(time.RFC3339Nano) + " " + text
+		}
+		if err := writeFrame(w, line.stream, text, tty); err != nil {
+			return
+		}
+	}
+	if follow && running {
+		if flusher, ok := w.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		select {
+		case <-exited:
+		case <-r.Context().Done():
+		case <-s.done:
+		}
+	}
+}
+
+// handleAttach streams the output since the attach until the container exits, the stdin is not supported
+func (s *Server) handleAttach(w http.ResponseWriter, r *http.Request, id string) {
+	stdout, stderr := boolParam(r, "stdout"), boolParam(r, "stderr")
+	var c *container
+	var offset int
+	s.withContainer(w, id, func(found *container) {
+		c = found
+		if !boolParam(r, "logs") {
+			offset = len(found.output)
+		}
+	})
+	if c == nil {
+		return
+	}
+	w.Header().Set("Content-Type", "application/vnd.docker.raw-stream")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for {
+		s.lock.Lock()
+		lines := append([]logLine(nil), c.output[offset:]...)
+		offset = len(c.output)
+		_, alive := s.containers[c.ID]
+		done := !alive || c.State.Status == "exited" || c.State.Status == "dead"
+		tty, changed := c.tty(), c.changes()
+		s.lock.Unlock()
+		for _, line := range lines {
+			if (line.stream == 1 && !stdout) || (line.stream == 2 && !stderr) {
+				continue
+			}
+			if err := writeFrame(w, line.stream, line.text, tty); err != nil {
+				return
+			}
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request, id string) {
+	stream := r.URL.Query().Get("stream") == "" || boolParam(r, "stream")
+	var found bool
+	s.withContainer(w, id, func(c *container) {
+		found = true
+	})
+	if !found {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for i := uint64(1); ; i += 1 {
+		now := time.Now()
+		stats := map[string]interface{}{
+			"read": now,
+			"network": map[string]uint64{
+				"rx_bytes": 1024 * i, "rx_packets": 10 * i, "tx_bytes": 512 * i, "tx_packets": 5 * i,
+			},
+			"cpu_stats": map[string]interface{}{
+				"cpu_usage": map[string]interface{}{
+					"total_usage":  100000000 * i,
+					"percpu_usage": []uint64{50000000 * i, 50000000 * i},
+				},
+				"system_cpu_usage": 1000000000 * i,
+			},
+			"memory_stats": map[string]uint64{
+				"usage": 8 * 1024 * 1024, "max_usage": 16 * 1024 * 1024, "limit": 1024 * 1024 * 1024,
+			},
+		}
+		if err := encoder.Encode(stats); err != nil || !stream {
+			return
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		select {
+		case <-time.After(s.StatsInterval):
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package adoctest
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type actor struct {
+	ID         string
+	Attributes map[string]string
+}
+
+type event struct {
+	Status   string `json:"status,omitempty"`
+	ID       string `json:"id,omitempty"`
+	From     string `json:"from,omitempty"`
+	Type     string
+	Action   string
+	Actor    actor
+	Time     int64 `json:"time"`
+	TimeNano int64 `json:"timeNano"`
+}
+
+// emit records the event and sends it to the watchers, the lock should be held
+func (s *Server) emit(eventType string, action string, id string, attributes map[string]string) {
+	now := time.Now()
+	e := event{
+		Type:     eventType,
+		Action:   action,
+		Actor:    actor{ID: id, Attributes: attributes},
+		Time:     now.Unix(),
+		TimeNano: now.UnixNano(),
+	}
+	if eventType == "container" || eventType == "image" {
+		e.Status = action
+		e.ID = id
+		if eventType == "container" {
+			e.From = attributes["image"]
+		}
+	}
+	s.events = append(s.events, e)
+	for watcher := range s.watchers {
+		select {
+		case watcher <- e:
+		default:
+			// the slow watcher loses the event, like the daemon does
+		}
+	}
+}
+
+func (s *Server) containerEvent(c *container, action string, extra ...string) {
+	attributes := map[string]string{
+		"image": c.Image,
+		"name":  c.Name[1:],
+	}
+	for key, value := range c.labels() {
+		attributes[key] = value
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		attributes[extra[i]] = extra[i+1]
+	}
+	s.emit("container", action, c.ID, attributes)
+}
+
+func parseTimestamp(value string) (time.Time, bool) {
+	if value == "" {
+		return time.Time{}, false
+	}
+	if secs, err := strconv.ParseFloat(value, 64); err == nil {
+		return time.Unix(0, int64(secs*float64(time.Second))), true
+	}
+	if t, err := time.Parse(time.RFC3339Nano, value); err == nil {
+		return t, true
+	}
+	return time.Time{}, false
+}
+
+func (e event) matches(f filters) bool {
+	return f.match("type", e.Type) &&
+		f.match("event", e.Action) &&
+		f.matchAny("container", e.Actor.ID, e.Actor.Attributes["name"]) &&
+		f.matchAny("image", e.Actor.Attributes["image"], e.Actor.ID) &&
+		f.matchLabels(e.Actor.Attributes)
+}
+
+func (s *Server) handleEvents(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f, err := parseFilters(query.Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	since, hasSince := parseTimestamp(query.Get("since"))
+	until, hasUntil := parseTimestamp(query.Get("until"))
+
+	watcher := make(chan event, 256)
+	s.lock.Lock()
+	var past []event
+	if hasSince {
+		for _, e := range s.events {
+			if e.TimeNano >= since.UnixNano() {
+				past = append(past, e)
+			}
+		}
+	}
+	if !hasUntil {
+		s.watchers[watcher] = struct{}{}
+	}
+	s.lock.Unlock()
+	defer func() {
+		s.lock.Lock()
+		delete(s.watchers, watcher)
+		s.lock.Unlock()
+	}()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	write := func(e event) bool {
+		if hasUntil && e.TimeNano > until.UnixNano() {
+			return false
+		}
+		if e.matches(f) {
+			if err := encoder.Encode(e); err != nil {
+				return false
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		return true
+	}
+	for _, e := range past {
+		if !write(e) {
+			return
+		}
+	}
+	if hasUntil {
+		return
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case e := <-watcher:
+			if !write(e) {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+}
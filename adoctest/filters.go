@@ -0,0 +1,71 @@
+package adoctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// filters is the decoded filters param, both the current {"key":{"value":true}} shape
+// and the legacy {"key":["value"]} shape are accepted
+type filters map[string][]string
+
+func parseFilters(raw string) (filters, error) {
+	f := make(filters)
+	if raw == "" {
+		return f, nil
+	}
+	var decoded map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(raw), &decoded); err != nil {
+		return nil, fmt.Errorf("Invalid filters: %s", err)
+	}
+	for key, value := range decoded {
+		var list []string
+		if err := json.Unmarshal(value, &list); err == nil {
+			f[key] = list
+			continue
+		}
+		var set map[string]bool
+		if err := json.Unmarshal(value, &set); err != nil {
+			return nil, fmt.Errorf("Invalid filter %q: %s", key, err)
+		}
+		for v, on := range set {
+			if on {
+				f[key] = append(f[key], v)
+			}
+		}
+	}
+	return f, nil
+}
+
+func (f filters) match(key string, value string) bool {
+	return f.matchAny(key, value)
+}
+
+// matchAny is true if there is no such filter, or any of the filter values equals one of the values
+func (f filters) matchAny(key string, values ...string) bool {
+	wanted, ok := f[key]
+	if !ok {
+		return true
+	}
+	for _, w := range wanted {
+		for _, v := range values {
+			if v != "" && (v == w || (len(w) >= 12 && strings.HasPrefix(v, w))) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchLabels checks all the label filters like "key" or "key=value"
+func (f filters) matchLabels(labels map[string]string) bool {
+	for _, label := range f["label"] {
+		parts := strings.SplitN(label, "=", 2)
+		value, ok := labels[parts[0]]
+		if !ok || (len(parts) == 2 && value != parts[1]) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,684 @@
+package adoctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ImageSpec describes an image preloaded into the fake daemon
+type ImageSpec struct {
+	Name   string            // repo:tag, the tag defaults to latest
+	Size   int64             // default to 1MB
+	Labels map[string]string // the image labels
+	// Description and Stars are shown in the search results, the local images are the registry of the search
+	Description string
+	Stars       int
+	Config      map[string]interface{} // the image defaults in the Engine API shape, e.g. {"Cmd": ["sh"]}
+	Created     time.Time              // default to now
+}
+
+type image struct {
+	ID        string
+	RepoTags  []string
+	Created   time.Time
+	Size      int64
+	Labels    map[string]string
+	Config    map[string]interface{}
+	Parent    string
+	Container string
+	Comment   string
+	Author    string
+	CreatedBy string
+	Digest    string // the manifest digest of the local image
+	// the current manifest digest in the registry, differs from the Digest after a newer push
+	RegistryDigest string
+	// the repository of the image pulled by the digest, which has no tags
+	Repository  string
+	Description string
+	Stars       int
+	LastTagTime time.Time
+}
+
+// AddImage adds the image into the daemon and returns its id
+func (s *Server) AddImage(spec ImageSpec) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.addImage(spec).ID
+}
+
+func (s *Server) addImage(spec ImageSpec) *image {
+	name := normalizeImageName(spec.Name)
+	if img := s.findImage(name); img != nil {
+		return img
+	}
+	img := &image{
+		ID:          "sha256:" + newID(),
+		RepoTags:    []string{name},
+		Created:     time.Now(),
+		Size:        spec.Size,
+		Labels:      spec.Labels,
+		Config:      spec.Config,
+		CreatedBy:   "/bin/sh -c #(nop) ADD file:" + newID()[:16] + " in / ",
+		Digest:      "sha256:" + newID(),
+		Description: spec.Description,
+		Stars:       spec.Stars,
+	}
+	if i := strings.Index(spec.Name, "@"); i >= 0 {
+		img.RepoTags = nil
+		img.Repository, img.Digest = spec.Name[:i], spec.Name[i+1:]
+	}
+	img.RegistryDigest = img.Digest
+	if !spec.Created.IsZero() {
+		img.Created = spec.Created
+	}
+	if img.Size == 0 {
+		img.Size = 1024 * 1024
+	}
+	if img.Config == nil {
+		img.Config = make(map[string]interface{})
+	}
+	if img.Labels != nil {
+		img.Config["Labels"] = img.Labels
+	}
+	s.images[img.ID] = img
+	return img
+}
+
+func normalizeImageName(name string) string {
+	if strings.HasPrefix(name, "sha256:") {
+		return name
+	}
+	if i := strings.LastIndex(name, ":"); i < 0 || strings.Contains(name[i:], "/") {
+		return name + ":latest"
+	}
+	return name
+}
+
+// findImage looks up the image by name, id or id prefix, the lock should be held
+func (s *Server) findImage(name string) *image {
+	if img, ok := s.images[name]; ok {
+		return img
+	}
+	normalized := normalizeImageName(name)
+	for _, img := range s.images {
+		for _, tag := range img.RepoTags {
+			if tag == normalized {
+				return img
+			}
+		}
+	}
+	if strings.Contains(name, "@") {
+		for _, img := range s.images {
+			if containsString(s.repoDigests(img), name) {
+				return img
+			}
+		}
+	}
+	if len(name) >= 12 {
+		for id, img := range s.images {
+			if strings.HasPrefix(strings.TrimPrefix(id, "sha256:"), strings.TrimPrefix(name, "sha256:")) {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Server) imageInUse(img *image) bool {
+	return s.imageContainers(img) > 0
+}
+
+func (s *Server) imageContainers(img *image) int {
+	count := 0
+	for _, c := range s.containers {
+		if c.ImageID == img.ID {
+			count += 1
+		}
+	}
+	return count
+}
+
+func (s *Server) routeImages(w http.ResponseWriter, r *http.Request, segs []string) bool {
+	method := r.Method
+	switch {
+	case len(segs) == 2 && segs[1] == "json" && method == "GET":
+		s.handleListImages(w, r)
+	case len(segs) == 2 && segs[1] == "create" && method == "POST":
+		s.handlePullImage(w, r)
+	case len(segs) >= 2 && method == "DELETE":
+		s.handleRemoveImage(w, r, strings.Join(segs[1:], "/"))
+	case len(segs) == 2 && segs[1] == "search" && method == "GET":
+		s.handleSearchImages(w, r)
+	case len(segs) >= 3 && method == "GET" && segs[len(segs)-1] == "history":
+		s.handleImageHistory(w, r, strings.Join(segs[1:len(segs)-1], "/"))
+	case len(segs) >= 3 && method == "GET" && segs[len(segs)-1] == "json":
+		s.handleInspectImage(w, r, strings.Join(segs[1:len(segs)-1], "/"))
+	case len(segs) >= 3 && method == "POST" && segs[len(segs)-1] == "tag":
+		s.handleTagImage(w, r, strings.Join(segs[1:len(segs)-1], "/"))
+	case len(segs) >= 3 && method == "POST" && segs[len(segs)-1] == "push":
+		s.handlePushImage(w, r, strings.Join(segs[1:len(segs)-1], "/"))
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *Server) handleListImages(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	digests := boolParam(r, "digests")
+	sharedSize := boolParam(r, "shared-size")
+	nameFilter := r.URL.Query().Get("filter")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]map[string]interface{}, 0, len(s.images))
+	for _, img := range s.images {
+		if nameFilter != "" && !matchRepository(img.RepoTags, nameFilter) {
+			continue
+		}
+		dangling := "false"
+		if len(img.RepoTags) == 0 {
+			dangling = "true"
+		}
+		if !f.match("dangling", dangling) || !f.matchLabels(img.Labels) {
+			continue
+		}
+		repoTags := img.RepoTags
+		if len(repoTags) == 0 {
+			repoTags = []string{"<none>:<none>"}
+		}
+		ret = append(ret, map[string]interface{}{
+			"Id":          img.ID,
+			"RepoTags":    repoTags,
+			"Created":     img.Created.Unix(),
+			"Size":        img.Size,
+			"VirtualSize": img.Size,
+			"Labels":      img.Labels,
+			"SharedSize":  int64(-1),
+			"Containers":  int64(-1),
+		})
+		if digests {
+			ret[len(ret)-1]["RepoDigests"] = s.repoDigests(img)
+		}
+		if sharedSize {
+			ret[len(ret)-1]["SharedSize"] = int64(0)
+			ret[len(ret)-1]["Containers"] = int64(s.imageContainers(img))
+		}
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+// repositoryOf strips the tag, the registry port is kept
+func repositoryOf(name string) string {
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		return name[:i]
+	}
+	return name
+}
+
+func matchRepository(repoTags []string, repository string) bool {
+	for _, tag := range repoTags {
+		if tag == repository || repositoryOf(tag) == repository {
+			return true
+		}
+	}
+	return false
+}
+
+// SetRegistryDigest changes the manifest digest of the image in the registry, like a newer image is pushed
+// by others, the local image is not changed
+func (s *Server) SetRegistryDigest(name string, digest string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if img := s.findImage(name); img != nil {
+		img.RegistryDigest = digest
+	}
+}
+
+func (s *Server) repoDigests(img *image) []string {
+	ret := make([]string, 0, len(img.RepoTags)+1)
+	if img.Repository != "" {
+		ret = append(ret, img.Repository+"@"+img.Digest)
+	}
+	for _, tag := range img.RepoTags {
+		if digest := repositoryOf(tag) + "@" + img.Digest; !containsString(ret, digest) {
+			ret = append(ret, digest)
+		}
+	}
+	return ret
+}
+
+// layers returns the layer digests from the base, one layer per image in the parent chain
+func (s *Server) layers(img *image) []string {
+	var ret []string
+	for ; img != nil; img = s.images[img.Parent] {
+		ret = append([]string{"sha256:" + img.ID[7:]}, ret...)
+	}
+	return ret
+}
+
+func (s *Server) handleImageHistory(w http.ResponseWriter, r *http.Request, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img := s.findImage(name)
+	if img == nil {
+		http.Error(w, fmt.Sprintf("No such image: %s", name), http.StatusNotFound)
+		return
+	}
+	var ret []map[string]interface{}
+	for ; img != nil; img = s.images[img.Parent] {
+		tags := img.RepoTags
+		if tags == nil {
+			tags = []string{}
+		}
+		ret = append(ret, map[string]interface{}{
+			"Id":        img.ID,
+			"Created":   img.Created.Unix(),
+			"CreatedBy": img.CreatedBy,
+			"Tags":      tags,
+			"Size":      img.Size,
+			"Comment":   img.Comment,
+		})
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func (s *Server) handleSearchImages(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f, err := parseFilters(query.Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	term := query.Get("term")
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = 25
+	}
+	minStars := 0
+	for _, value := range f["stars"] {
+		minStars, _ = strconv.Atoi(value)
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	seen := make(map[string]bool)
+	ret := make([]map[string]interface{}, 0)
+	for _, img := range s.images {
+		for _, tag := range img.RepoTags {
+			repo := repositoryOf(tag)
+			official := strconv.FormatBool(!strings.Contains(repo, "/"))
+			if seen[repo] || !strings.Contains(repo, term) || img.Stars < minStars ||
+				!f.match("is-official", official) || !f.match("is-automated", "false") {
+				continue
+			}
+			seen[repo] = true
+			ret = append(ret, map[string]interface{}{
+				"name":         repo,
+				"description":  img.Description,
+				"is_official":  official == "true",
+				"is_automated": false,
+				"star_count":   img.Stars,
+			})
+		}
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i]["star_count"].(int) > ret[j]["star_count"].(int) })
+	if len(ret) > limit {
+		ret = ret[:limit]
+	}
+	writeJSON(w, http.StatusOK, ret)
+}
+
+func (s *Server) handleDistributionInspect(w http.ResponseWriter, r *http.Request, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img := s.findImage(name)
+	if img == nil {
+		http.Error(w, fmt.Sprintf("manifest unknown: manifest for %s not found", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Descriptor": map[string]interface{}{
+			"mediaType": "application/vnd.docker.distribution.manifest.v2+json",
+			"digest":    img.RegistryDigest,
+			"size":      528,
+		},
+		"Platforms": []map[string]string{{"architecture": "amd64", "os": "linux"}},
+	})
+}
+
+func (s *Server) handleInspectImage(w http.ResponseWriter, r *http.Request, name string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img := s.findImage(name)
+	if img == nil {
+		http.Error(w, fmt.Sprintf("No such image: %s", name), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"Id":            img.ID,
+		"RepoTags":      img.RepoTags,
+		"Created":       img.Created,
+		"Size":          img.Size,
+		"VirtualSize":   img.Size,
+		"Os":            "linux",
+		"Architecture":  "amd64",
+		"DockerVersion": kDaemonVersion,
+		"Config":        img.Config,
+		"RepoDigests":   s.repoDigests(img),
+		"Parent":        img.Parent,
+		"Container":     img.Container,
+		"Comment":       img.Comment,
+		"Author":        img.Author,
+		"RootFS":        map[string]interface{}{"Type": "layers", "Layers": s.layers(img)},
+		"GraphDriver": map[string]interface{}{
+			"Name": "overlay2",
+			"Data": map[string]string{"MergedDir": "/var/lib/docker/overlay2/" + img.ID[7:19] + "/merged"},
+		},
+		"Metadata": map[string]interface{}{"LastTagTime": img.LastTagTime},
+	})
+}
+
+func writeProgress(w http.ResponseWriter, messages ...map[string]interface{}) {
+	encoder := json.NewEncoder(w)
+	flusher, _ := w.(http.Flusher)
+	for _, msg := range messages {
+		encoder.Encode(msg)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+}
+
+func (s *Server) handlePullImage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	name := query.Get("fromImage")
+	if tag := query.Get("tag"); strings.HasPrefix(tag, "sha256:") {
+		name = name + "@" + tag
+	} else if tag != "" && !strings.Contains(name, "@") {
+		name = name + ":" + tag
+	}
+	s.lock.Lock()
+	img := s.addImage(ImageSpec{Name: name})
+	layer := img.ID[7:19]
+	s.emit("image", "pull", normalizeImageName(name), map[string]string{"name": normalizeImageName(name)})
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	writeProgress(w,
+		map[string]interface{}{"status": "Pulling from " + name, "id": layer},
+		map[string]interface{}{"status": "Pulling fs layer", "id": layer},
+		map[string]interface{}{"status": "Downloading", "id": layer, "progress": "[==================================================>]",
+			"progressDetail": map[string]int64{"current": img.Size, "total": img.Size}},
+		map[string]interface{}{"status": "Download complete", "id": layer},
+		map[string]interface{}{"status": "Pull complete", "id": layer},
+		map[string]interface{}{"status": "Digest: " + img.Digest},
+		map[string]interface{}{"status": "Status: Downloaded newer image for " + normalizeImageName(name)},
+	)
+}
+
+func (s *Server) handlePushImage(w http.ResponseWriter, r *http.Request, name string) {
+	if tag := r.URL.Query().Get("tag"); tag != "" {
+		name = name + ":" + tag
+	}
+	s.lock.Lock()
+	img := s.findImage(name)
+	if img != nil {
+		s.emit("image", "push", normalizeImageName(name), map[string]string{"name": normalizeImageName(name)})
+	}
+	s.lock.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	if img == nil {
+		// the daemon reports the error inside the stream
+		writeProgress(w, map[string]interface{}{
+			"error":       "An image does not exist locally with the tag: " + name,
+			"errorDetail": map[string]string{"message": "An image does not exist locally with the tag: " + name},
+		})
+		return
+	}
+	layer := img.ID[7:19]
+	writeProgress(w,
+		map[string]interface{}{"status": "The push refers to a repository [" + name + "]"},
+		map[string]interface{}{"status": "Pushing", "id": layer, "progress": "[==================================================>]"},
+		map[string]interface{}{"status": "Pushed", "id": layer},
+		map[string]interface{}{"status": "latest: digest: " + img.Digest + " size: 528"},
+	)
+}
+
+func (s *Server) handleTagImage(w http.ResponseWriter, r *http.Request, name string) {
+	query := r.URL.Query()
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img := s.findImage(name)
+	if img == nil {
+		http.Error(w, fmt.Sprintf("No such image: %s", name), http.StatusNotFound)
+		return
+	}
+	newTag := query.Get("repo")
+	if tag := query.Get("tag"); tag != "" {
+		newTag += ":" + tag
+	}
+	newTag = normalizeImageName(newTag)
+	if other := s.findImage(newTag); other != nil && other != img {
+		other.RepoTags = removeString(other.RepoTags, newTag)
+	}
+	if !containsString(img.RepoTags, newTag) {
+		img.RepoTags = append(img.RepoTags, newTag)
+		img.LastTagTime = time.Now()
+	}
+	s.emit("image", "tag", img.ID, map[string]string{"name": newTag})
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (s *Server) handleRemoveImage(w http.ResponseWriter, r *http.Request, name string) {
+	force := boolParam(r, "force")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	img := s.findImage(name)
+	if img == nil {
+		http.Error(w, fmt.Sprintf("No such image: %s", name), http.StatusNotFound)
+		return
+	}
+	var ret []map[string]string
+	normalized := normalizeImageName(name)
+	if containsString(img.RepoTags, normalized) && len(img.RepoTags) > 1 {
+		// only untag the name
+		img.RepoTags = removeString(img.RepoTags, normalized)
+		s.emit("image", "untag", img.ID, map[string]string{"name": normalized})
+		writeJSON(w, http.StatusOK, []map[string]string{{"Untagged": normalized}})
+		return
+	}
+	if !force && !containsString(img.RepoTags, normalized) && len(imageRepositories(img.RepoTags)) > 1 {
+		http.Error(w, fmt.Sprintf("conflict: unable to delete %s (must be forced) - image is referenced in multiple repositories", img.ID[7:19]), http.StatusConflict)
+		return
+	}
+	if s.imageInUse(img) && !force {
+		http.Error(w, fmt.Sprintf("conflict: unable to remove repository reference %q (must force) - container is using its referenced image %s", name, img.ID[7:19]), http.StatusConflict)
+		return
+	}
+	for _, tag := range img.RepoTags {
+		ret = append(ret, map[string]string{"Untagged": tag})
+		s.emit("image", "untag", img.ID, map[string]string{"name": tag})
+	}
+	ret = append(ret, map[string]string{"Deleted": img.ID})
+	delete(s.images, img.ID)
+	s.emit("image", "delete", img.ID, map[string]string{"name": img.ID})
+	writeJSON(w, http.StatusOK, ret)
+}
+
+// imageRepositories returns the distinct repositories of the tags
+func imageRepositories(repoTags []string) []string {
+	var repos []string
+	for _, tag := range repoTags {
+		repo := tag
+		if i := strings.LastIndex(tag, ":"); i > strings.LastIndex(tag, "/") {
+			repo = tag[:i]
+		}
+		if !containsString(repos, repo) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func removeString(list []string, value string) []string {
+	ret := make([]string, 0, len(list))
+	for _, v := range list {
+		if v != value {
+			ret = append(ret, v)
+		}
+	}
+	return ret
+}
+
+func (s *Server) handleCommit(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	var override map[string]interface{}
+	if r.ContentLength != 0 {
+		json.NewDecoder(r.Body).Decode(&override)
+	}
+	s.withContainer(w, query.Get("container"), func(c *container) {
+		config := make(map[string]interface{})
+		for key, value := range c.Config {
+			config[key] = value
+		}
+		for key, value := range override {
+			if value != nil {
+				config[key] = value
+			}
+		}
+		for _, change := range query["changes"] {
+			if err := applyChange(config, change); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		delete(config, "Image")
+		img := &image{
+			ID:        "sha256:" + newID(),
+			Created:   time.Now(),
+			Size:      s.images[c.ImageID].Size + 1024,
+			Config:    config,
+			Parent:    c.ImageID,
+			Container: c.ID,
+			Comment:   query.Get("comment"),
+			Author:    query.Get("author"),
+			CreatedBy: strings.Join(c.command(), " "),
+			Digest:    "sha256:" + newID(),
+		}
+		img.RegistryDigest = img.Digest
+		if labels, ok := config["Labels"].(map[string]interface{}); ok {
+			img.Labels = make(map[string]string)
+			for key, value := range labels {
+				img.Labels[key] = fmt.Sprint(value)
+			}
+		}
+		if repo := query.Get("repo"); repo != "" {
+			name := repo
+			if tag := query.Get("tag"); tag != "" {
+				name += ":" + tag
+			}
+			name = normalizeImageName(name)
+			if other := s.findImage(name); other != nil {
+				other.RepoTags = removeString(other.RepoTags, name)
+			}
+			img.RepoTags = []string{name}
+			img.LastTagTime = img.Created
+		}
+		s.images[img.ID] = img
+		s.containerEvent(c, "commit")
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": img.ID})
+	})
+}
+
+// applyChange applies the Dockerfile instruction of the commit to the image config
+func applyChange(config map[string]interface{}, change string) error {
+	parts := strings.SplitN(strings.TrimSpace(change), " ", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("dockerfile parse error: %s", change)
+	}
+	instruction, arg := strings.ToUpper(parts[0]), strings.TrimSpace(parts[1])
+	command := func() []interface{} {
+		var list []interface{}
+		if strings.HasPrefix(arg, "[") && json.Unmarshal([]byte(arg), &list) == nil {
+			return list
+		}
+		return []interface{}{"/bin/sh", "-c", arg}
+	}
+	keyValues := func() map[string]string {
+		ret := make(map[string]string)
+		for _, field := range strings.Fields(arg) {
+			kv := strings.SplitN(field, "=", 2)
+			if len(kv) == 2 {
+				ret[kv[0]] = strings.Trim(kv[1], `"`)
+			}
+		}
+		return ret
+	}
+	switch instruction {
+	case "CMD":
+		config["Cmd"] = command()
+	case "ENTRYPOINT":
+		config["Entrypoint"] = command()
+	case "ENV":
+		current, _ := config["Env"].([]interface{})
+		env := append([]interface{}(nil), current...)
+		for key, value := range keyValues() {
+			env = append(env, key+"="+value)
+		}
+		config["Env"] = env
+	case "LABEL":
+		labels := copyMap(config["Labels"])
+		for key, value := range keyValues() {
+			labels[key] = value
+		}
+		config["Labels"] = labels
+	case "EXPOSE":
+		ports := copyMap(config["ExposedPorts"])
+		for _, port := range strings.Fields(arg) {
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			ports[port] = map[string]interface{}{}
+		}
+		config["ExposedPorts"] = ports
+	case "WORKDIR":
+		config["WorkingDir"] = arg
+	case "USER":
+		config["User"] = arg
+	case "STOPSIGNAL":
+		config["StopSignal"] = arg
+	case "VOLUME", "ONBUILD", "HEALTHCHECK":
+	default:
+		return fmt.Errorf("%s is not a valid change command", instruction)
+	}
+	return nil
+}
+
+// copyMap copies the JSON object, so the container config is not changed by the commit
+func copyMap(value interface{}) map[string]interface{} {
+	ret := make(map[string]interface{})
+	if m, ok := value.(map[string]interface{}); ok {
+		for key, v := range m {
+			ret[key] = v
+		}
+	}
+	return ret
+}
@@ -0,0 +1,191 @@
+package adoctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"runtime"
+	"time"
+)
+
+type execInstance struct {
+	ID          string
+	ContainerID string
+	Cmd         []string
+	Tty         bool
+	Running     bool
+	ExitCode    int
+}
+
+func (s *Server) handleVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"ApiVersion":    kApiVersion,
+		"Version":       kDaemonVersion,
+		"GitCommit":     "adoctest",
+		"GoVersion":     runtime.Version(),
+		"Os":            "linux",
+		"Arch":          "amd64",
+		"KernelVersion": "4.19.0-adoctest",
+	})
+}
+
+func (s *Server) handleInfo(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ID":              "ADOC:TEST",
+		"Name":            "adoctest",
+		"Containers":      len(s.containers),
+		"Images":          len(s.images),
+		"Driver":          "overlay2",
+		"DriverStatus":    [][2]string{{"Backing Filesystem", "extfs"}},
+		"DockerRootDir":   "/var/lib/docker",
+		"KernelVersion":   "4.19.0-adoctest",
+		"OperatingSystem": "adoctest",
+		"NCPU":            2,
+		"MemTotal":        2 * 1024 * 1024 * 1024,
+		"SystemTime":      time.Now(),
+	})
+}
+
+func (s *Server) handleExecCreate(w http.ResponseWriter, r *http.Request, id string) {
+	var config struct {
+		Cmd []string
+		Tty bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid exec config: %s", err), http.StatusBadRequest)
+		return
+	}
+	s.withContainer(w, id, func(c *container) {
+		if !c.State.Running {
+			http.Error(w, fmt.Sprintf("Container %s is not running", c.ID), http.StatusConflict)
+			return
+		}
+		e := &execInstance{
+			ID:          newID(),
+			ContainerID: c.ID,
+			Cmd:         config.Cmd,
+			Tty:         config.Tty,
+		}
+		s.execs[e.ID] = e
+		c.ExecIDs = append(c.ExecIDs, e.ID)
+		s.containerEvent(c, "exec_create")
+		writeJSON(w, http.StatusCreated, map[string]string{"Id": e.ID})
+	})
+}
+
+func (s *Server) handleExecStart(w http.ResponseWriter, r *http.Request, execId string) {
+	var config struct {
+		Detach bool
+		Tty    bool
+	}
+	json.NewDecoder(r.Body).Decode(&config)
+
+	s.lock.Lock()
+	e, ok := s.execs[execId]
+	if !ok {
+		s.lock.Unlock()
+		http.Error(w, fmt.Sprintf("No such exec instance: %s", execId), http.StatusNotFound)
+		return
+	}
+	if c := s.containers[e.ContainerID]; c != nil {
+		s.containerEvent(c, "exec_start")
+	}
+	exec := s.Exec
+	s.lock.Unlock()
+
+	var stdout, stderr string
+	var exitCode int
+	if exec != nil {
+		stdout, stderr, exitCode = exec(e.ContainerID, e.Cmd)
+	}
+	s.lock.Lock()
+	e.ExitCode = exitCode
+	s.lock.Unlock()
+
+	if config.Detach {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	tty := config.Tty || e.Tty
+	w.WriteHeader(http.StatusOK)
+	if tty {
+		writeFrame(w, 1, stdout+stderr, true)
+		return
+	}
+	for _, line := range splitLines(stdout) {
+		writeFrame(w, 1, line, false)
+	}
+	for _, line := range splitLines(stderr) {
+		writeFrame(w, 2, line, false)
+	}
+}
+
+func (s *Server) handleExecInspect(w http.ResponseWriter, r *http.Request, execId string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	e, ok := s.execs[execId]
+	if !ok {
+		http.Error(w, fmt.Sprintf("No such exec instance: %s", execId), http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ID":          e.ID,
+		"ContainerID": e.ContainerID,
+		"Running":     e.Running,
+		"ExitCode":    e.ExitCode,
+		"ProcessConfig": map[string]interface{}{
+			"tty":        e.Tty,
+			"entrypoint": firstString(e.Cmd),
+			"arguments":  restStrings(e.Cmd),
+		},
+	})
+}
+
+func firstString(list []string) string {
+	if len(list) == 0 {
+		return ""
+	}
+	return list[0]
+}
+
+func restStrings(list []string) []string {
+	if len(list) == 0 {
+		return []string{}
+	}
+	return list[1:]
+}
+
+// handleNetwork connects or disconnects the container, the endpoint is kept in the NetworkingConfig
+func (s *Server) handleNetwork(w http.ResponseWriter, r *http.Request, network string, action string) {
+	var options struct {
+		Container      string
+		EndpointConfig map[string]interface{}
+		Force          bool
+	}
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid network options: %s", err), http.StatusBadRequest)
+		return
+	}
+	s.withContainer(w, options.Container, func(c *container) {
+		if n := s.findNetwork(network); n != nil && !containsString(kBuiltinNetworks, n.Name) {
+			network = n.Name
+			if c.NetworkingConfig == nil {
+				c.NetworkingConfig = make(map[string]interface{})
+			}
+			endpoints, _ := c.NetworkingConfig["EndpointsConfig"].(map[string]interface{})
+			if endpoints == nil {
+				endpoints = make(map[string]interface{})
+				c.NetworkingConfig["EndpointsConfig"] = endpoints
+			}
+			if action == "connect" {
+				endpoints[network] = options.EndpointConfig
+			} else {
+				delete(endpoints, network)
+			}
+		}
+		s.emit("network", action, network, map[string]string{"container": c.ID, "name": network})
+		w.WriteHeader(http.StatusOK)
+	})
+}
@@ -0,0 +1,487 @@
+package adoctest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// the predefined networks of the daemon, they could not be created or removed
+var kBuiltinNetworks = []string{"bridge", "host", "none"}
+
+type network struct {
+	ID         string
+	Name       string
+	Driver     string
+	Created    time.Time
+	Internal   bool
+	Attachable bool
+	EnableIPv6 bool
+	Options    map[string]string
+	Labels     map[string]string
+	subnet     int
+}
+
+type volume struct {
+	Name    string
+	Driver  string
+	Created time.Time
+	Options map[string]string
+	Labels  map[string]string
+}
+
+// addBuiltinNetworks creates the predefined networks, the lock should be held
+func (s *Server) addBuiltinNetworks() {
+	drivers := map[string]string{"bridge": "bridge", "host": "host", "none": "null"}
+	for _, name := range kBuiltinNetworks {
+		n := &network{ID: newID(), Name: name, Driver: drivers[name], Created: time.Now(), subnet: 17}
+		s.networks[n.ID] = n
+	}
+}
+
+// findNetwork looks up the network by id, id prefix or name, the lock should be held
+func (s *Server) findNetwork(idOrName string) *network {
+	if n, ok := s.networks[idOrName]; ok {
+		return n
+	}
+	for _, n := range s.networks {
+		if n.Name == idOrName {
+			return n
+		}
+	}
+	var found *network
+	for id, n := range s.networks {
+		if strings.HasPrefix(id, idOrName) {
+			if found != nil {
+				return nil
+			}
+			found = n
+		}
+	}
+	return found
+}
+
+// networkContainers returns the running containers attached to the network, the lock should be held
+func (s *Server) networkContainers(n *network) []*container {
+	var list []*container
+	for _, c := range s.containers {
+		if _, ok := c.networks()[n.Name]; ok && c.State.Running {
+			list = append(list, c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list
+}
+
+func (s *Server) networkJSON(n *network) map[string]interface{} {
+	containers := make(map[string]interface{})
+	for _, c := range s.networkContainers(n) {
+		endpoint, _ := c.networks()[n.Name].(map[string]interface{})
+		ip, _ := endpoint["IPAddress"].(string)
+		containers[c.ID] = map[string]string{
+			"Name":        c.Name[1:],
+			"EndpointID":  c.ID[:32],
+			"MacAddress":  "02:42:ac:11:00:02",
+			"IPv4Address": ip + "/16",
+			"IPv6Address": "",
+		}
+	}
+	scope := "local"
+	ipam := map[string]interface{}{"Driver": "default", "Config": []map[string]string{}}
+	if n.Driver == "bridge" {
+		ipam["Config"] = []map[string]string{{
+			"Subnet":  fmt.Sprintf("172.%d.0.0/16", n.subnet),
+			"Gateway": fmt.Sprintf("172.%d.0.1", n.subnet),
+		}}
+	}
+	return map[string]interface{}{
+		"Name":       n.Name,
+		"Id":         n.ID,
+		"Created":    n.Created,
+		"Scope":      scope,
+		"Driver":     n.Driver,
+		"EnableIPv6": n.EnableIPv6,
+		"IPAM":       ipam,
+		"Internal":   n.Internal,
+		"Attachable": n.Attachable,
+		"Containers": containers,
+		"Options":    nonNilMap(n.Options),
+		"Labels":     nonNilMap(n.Labels),
+	}
+}
+
+func nonNilMap(m map[string]string) map[string]string {
+	if m == nil {
+		return map[string]string{}
+	}
+	return m
+}
+
+func (s *Server) routeNetworks(w http.ResponseWriter, r *http.Request, segs []string) bool {
+	method := r.Method
+	switch {
+	case len(segs) == 1 && method == "GET":
+		s.handleListNetworks(w, r)
+	case len(segs) == 2 && segs[1] == "create" && method == "POST":
+		s.handleCreateNetwork(w, r)
+	case len(segs) == 2 && method == "GET":
+		s.withNetwork(w, segs[1], func(n *network) {
+			writeJSON(w, http.StatusOK, s.networkJSON(n))
+		})
+	case len(segs) == 2 && method == "DELETE":
+		s.handleRemoveNetwork(w, r, segs[1])
+	case len(segs) == 3 && method == "POST" && (segs[2] == "connect" || segs[2] == "disconnect"):
+		s.handleNetwork(w, r, segs[1], segs[2])
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *Server) withNetwork(w http.ResponseWriter, id string, fn func(n *network)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	n := s.findNetwork(id)
+	if n == nil {
+		http.Error(w, fmt.Sprintf("network %s not found", id), http.StatusNotFound)
+		return
+	}
+	fn(n)
+}
+
+func (s *Server) handleListNetworks(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]map[string]interface{}, 0, len(s.networks))
+	for _, n := range s.networks {
+		kind := "custom"
+		if containsString(kBuiltinNetworks, n.Name) {
+			kind = "builtin"
+		}
+		if !f.matchAny("id", n.ID) || !matchSubstring(f["name"], n.Name) || !f.match("driver", n.Driver) ||
+			!f.match("scope", "local") || !f.match("type", kind) || !f.matchLabels(n.Labels) {
+			continue
+		}
+		ret = append(ret, s.networkJSON(n))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i]["Name"].(string) < ret[j]["Name"].(string) })
+	writeJSON(w, http.StatusOK, ret)
+}
+
+// matchSubstring is true if there is no such filter, or the value contains any of the filter values,
+// like the name filters of the networks and the volumes
+func matchSubstring(wanted []string, value string) bool {
+	if len(wanted) == 0 {
+		return true
+	}
+	for _, w := range wanted {
+		if strings.Contains(value, w) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) handleCreateNetwork(w http.ResponseWriter, r *http.Request) {
+	var options struct {
+		Name       string
+		Driver     string
+		Internal   bool
+		Attachable bool
+		EnableIPv6 bool
+		Options    map[string]string
+		Labels     map[string]string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid network config: %s", err), http.StatusBadRequest)
+		return
+	}
+	if options.Driver == "" {
+		options.Driver = "bridge"
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	switch {
+	case options.Name == "":
+		http.Error(w, "network name is required", http.StatusBadRequest)
+		return
+	case containsString(kBuiltinNetworks, options.Name):
+		http.Error(w, fmt.Sprintf("%s is a pre-defined network and cannot be created", options.Name), http.StatusForbidden)
+		return
+	}
+	for _, other := range s.networks {
+		if other.Name == options.Name {
+			http.Error(w, fmt.Sprintf("network with name %s already exists", options.Name), http.StatusConflict)
+			return
+		}
+	}
+	s.nextSubnet += 1
+	n := &network{
+		ID:         newID(),
+		Name:       options.Name,
+		Driver:     options.Driver,
+		Created:    time.Now(),
+		Internal:   options.Internal,
+		Attachable: options.Attachable,
+		EnableIPv6: options.EnableIPv6,
+		Options:    options.Options,
+		Labels:     options.Labels,
+		subnet:     s.nextSubnet,
+	}
+	s.networks[n.ID] = n
+	s.emit("network", "create", n.ID, map[string]string{"name": n.Name, "type": n.Driver})
+	writeJSON(w, http.StatusCreated, map[string]string{"Id": n.ID, "Warning": ""})
+}
+
+func (s *Server) handleRemoveNetwork(w http.ResponseWriter, r *http.Request, id string) {
+	s.withNetwork(w, id, func(n *network) {
+		if containsString(kBuiltinNetworks, n.Name) {
+			http.Error(w, fmt.Sprintf("%s is a pre-defined network and cannot be removed", n.Name), http.StatusForbidden)
+			return
+		}
+		if len(s.networkContainers(n)) > 0 {
+			http.Error(w, fmt.Sprintf("error while removing network: network %s id %s has active endpoints", n.Name, n.ID), http.StatusForbidden)
+			return
+		}
+		delete(s.networks, n.ID)
+		s.emit("network", "destroy", n.ID, map[string]string{"name": n.Name, "type": n.Driver})
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+// findVolume looks up the volume by name, the lock should be held
+func (s *Server) findVolume(name string) *volume {
+	return s.volumes[name]
+}
+
+// addVolume creates the volume if not exists, the lock should be held
+func (s *Server) addVolume(name string, driver string, options map[string]string, labels map[string]string) *volume {
+	if v, ok := s.volumes[name]; ok {
+		return v
+	}
+	if driver == "" {
+		driver = "local"
+	}
+	v := &volume{Name: name, Driver: driver, Created: time.Now(), Options: options, Labels: labels}
+	s.volumes[name] = v
+	s.emit("volume", "create", name, map[string]string{"driver": driver})
+	return v
+}
+
+// volumeContainers returns the containers using the volume, in any state, the lock should be held
+func (s *Server) volumeContainers(v *volume) []string {
+	var ids []string
+	for _, c := range s.containers {
+		if containsString(c.volumeNames(), v.Name) {
+			ids = append(ids, c.ID)
+		}
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// volumeNames returns the named volumes of the Binds and the Mounts
+func (c *container) volumeNames() []string {
+	var names []string
+	if binds, ok := c.HostConfig["Binds"].([]interface{}); ok {
+		for _, bind := range binds {
+			parts := strings.SplitN(fmt.Sprint(bind), ":", 2)
+			if len(parts) == 2 && !strings.HasPrefix(parts[0], "/") && !strings.HasPrefix(parts[0], ".") {
+				names = append(names, parts[0])
+			}
+		}
+	}
+	if mounts, ok := c.HostConfig["Mounts"].([]interface{}); ok {
+		for _, m := range mounts {
+			mount, _ := m.(map[string]interface{})
+			if kind, _ := mount["Type"].(string); kind == "volume" {
+				if source, _ := mount["Source"].(string); source != "" {
+					names = append(names, source)
+				}
+			}
+		}
+	}
+	for _, name := range c.anonymous {
+		names = append(names, name)
+	}
+	return names
+}
+
+// mounts returns the mount points of the Binds, the Mounts and the anonymous volumes like the daemon
+func (c *container) mounts() []map[string]interface{} {
+	ret := []map[string]interface{}{}
+	add := func(kind, source, target string, rw bool) {
+		point := map[string]interface{}{"Type": kind, "Source": source, "Destination": target, "RW": rw, "Mode": ""}
+		if kind == "volume" {
+			point["Name"], point["Driver"] = source, "local"
+			point["Source"] = "/var/lib/docker/volumes/" + source + "/_data"
+		}
+		ret = append(ret, point)
+	}
+	if binds, ok := c.HostConfig["Binds"].([]interface{}); ok {
+		for _, bind := range binds {
+			parts := strings.Split(fmt.Sprint(bind), ":")
+			if len(parts) < 2 {
+				continue
+			}
+			kind := "volume"
+			if strings.HasPrefix(parts[0], "/") || strings.HasPrefix(parts[0], ".") {
+				kind = "bind"
+			}
+			add(kind, parts[0], parts[1], len(parts) < 3 || !strings.Contains(parts[2], "ro"))
+		}
+	}
+	if mounts, ok := c.HostConfig["Mounts"].([]interface{}); ok {
+		for _, m := range mounts {
+			mount, _ := m.(map[string]interface{})
+			kind, _ := mount["Type"].(string)
+			source, _ := mount["Source"].(string)
+			target, _ := mount["Target"].(string)
+			readOnly, _ := mount["ReadOnly"].(bool)
+			add(kind, source, target, !readOnly)
+		}
+	}
+	targets := make([]string, 0, len(c.anonymous))
+	for target := range c.anonymous {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	for _, target := range targets {
+		add("volume", c.anonymous[target], target, true)
+	}
+	return ret
+}
+
+// addAnonymousVolumes creates the volumes for the config Volumes which are not mounted by the Binds
+// or the Mounts, the lock should be held
+func (s *Server) addAnonymousVolumes(c *container) {
+	volumes, _ := c.Config["Volumes"].(map[string]interface{})
+	mounted := make(map[string]bool)
+	for _, point := range c.mounts() {
+		mounted[point["Destination"].(string)] = true
+	}
+	for target := range volumes {
+		if mounted[target] {
+			continue
+		}
+		if c.anonymous == nil {
+			c.anonymous = make(map[string]string)
+		}
+		c.anonymous[target] = newID()
+		s.addVolume(c.anonymous[target], "", nil, map[string]string{"com.docker.volume.anonymous": ""})
+	}
+}
+
+// removeAnonymousVolumes removes the anonymous volumes of the removed container which are not used
+// by the other containers, the lock should be held
+func (s *Server) removeAnonymousVolumes(c *container) {
+	for _, name := range c.anonymous {
+		if v := s.findVolume(name); v != nil && len(s.volumeContainers(v)) == 0 {
+			delete(s.volumes, name)
+			s.emit("volume", "destroy", name, map[string]string{"driver": v.Driver})
+		}
+	}
+}
+
+func volumeJSON(v *volume) map[string]interface{} {
+	return map[string]interface{}{
+		"Name":       v.Name,
+		"Driver":     v.Driver,
+		"Mountpoint": "/var/lib/docker/volumes/" + v.Name + "/_data",
+		"CreatedAt":  v.Created.Format(time.RFC3339),
+		"Labels":     nonNilMap(v.Labels),
+		"Options":    nonNilMap(v.Options),
+		"Scope":      "local",
+	}
+}
+
+func (s *Server) routeVolumes(w http.ResponseWriter, r *http.Request, segs []string) bool {
+	method := r.Method
+	switch {
+	case len(segs) == 1 && method == "GET":
+		s.handleListVolumes(w, r)
+	case len(segs) == 2 && segs[1] == "create" && method == "POST":
+		s.handleCreateVolume(w, r)
+	case len(segs) == 2 && method == "GET":
+		s.withVolume(w, segs[1], func(v *volume) {
+			writeJSON(w, http.StatusOK, volumeJSON(v))
+		})
+	case len(segs) == 2 && method == "DELETE":
+		s.withVolume(w, segs[1], func(v *volume) {
+			if ids := s.volumeContainers(v); len(ids) > 0 {
+				http.Error(w, fmt.Sprintf("remove %s: volume is in use - [%s]", v.Name, strings.Join(ids, ", ")), http.StatusConflict)
+				return
+			}
+			delete(s.volumes, v.Name)
+			s.emit("volume", "destroy", v.Name, map[string]string{"driver": v.Driver})
+			w.WriteHeader(http.StatusNoContent)
+		})
+	default:
+		return false
+	}
+	return true
+}
+
+func (s *Server) withVolume(w http.ResponseWriter, name string, fn func(v *volume)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	v := s.findVolume(name)
+	if v == nil {
+		http.Error(w, fmt.Sprintf("get %s: no such volume", name), http.StatusNotFound)
+		return
+	}
+	fn(v)
+}
+
+func (s *Server) handleListVolumes(w http.ResponseWriter, r *http.Request) {
+	f, err := parseFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ret := make([]map[string]interface{}, 0, len(s.volumes))
+	for _, v := range s.volumes {
+		dangling := fmt.Sprint(len(s.volumeContainers(v)) == 0)
+		if !matchSubstring(f["name"], v.Name) || !f.match("driver", v.Driver) || !f.match("dangling", dangling) ||
+			!f.matchLabels(v.Labels) {
+			continue
+		}
+		ret = append(ret, volumeJSON(v))
+	}
+	sort.Slice(ret, func(i, j int) bool { return ret[i]["Name"].(string) < ret[j]["Name"].(string) })
+	writeJSON(w, http.StatusOK, map[string]interface{}{"Volumes": ret, "Warnings": nil})
+}
+
+func (s *Server) handleCreateVolume(w http.ResponseWriter, r *http.Request) {
+	var options struct {
+		Name       string
+		Driver     string
+		DriverOpts map[string]string
+		Labels     map[string]string
+	}
+	if err := json.NewDecoder(r.Body).Decode(&options); err != nil {
+		http.Error(w, fmt.Sprintf("Invalid volume config: %s", err), http.StatusBadRequest)
+		return
+	}
+	if options.Name == "" {
+		options.Name = newID()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if v := s.findVolume(options.Name); v != nil && options.Driver != "" && options.Driver != v.Driver {
+		http.Error(w, fmt.Sprintf("create %s: volume name must be unique", options.Name), http.StatusConflict)
+		return
+	}
+	v := s.addVolume(options.Name, options.Driver, options.DriverOpts, options.Labels)
+	writeJSON(w, http.StatusCreated, volumeJSON(v))
+}
@@ -0,0 +1,212 @@
+package adoctest
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// the fake daemon has no build cache, so its prune deletes nothing
+
+func (s *Server) routePrune(w http.ResponseWriter, r *http.Request, kind string) {
+	f, err := parseFilters(r.URL.Query().Get("filters"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	until, err := parseUntil(f["until"])
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	switch kind {
+	case "containers":
+		s.pruneContainers(w, f, until)
+	case "images":
+		s.pruneImages(w, f, until)
+	case "volumes":
+		s.pruneVolumes(w, f)
+	case "networks":
+		s.pruneNetworks(w, f, until)
+	case "build":
+		writeJSON(w, http.StatusOK, map[string]interface{}{"CachesDeleted": []string{}, "SpaceReclaimed": 0})
+	}
+}
+
+// parseUntil takes the duration before now, the unix timestamp or the RFC3339 time
+func parseUntil(values []string) (time.Time, error) {
+	if len(values) == 0 {
+		return time.Time{}, nil
+	}
+	if d, err := time.ParseDuration(values[0]); err == nil {
+		return time.Now().Add(-d), nil
+	}
+	if t, ok := parseTimestamp(values[0]); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("Invalid until filter %q", values[0])
+}
+
+// matchPrune checks the until and the label, label! filters
+func matchPrune(f filters, until time.Time, created time.Time, labels map[string]string) bool {
+	if !until.IsZero() && !created.Before(until) {
+		return false
+	}
+	if !f.matchLabels(labels) {
+		return false
+	}
+	for _, label := range f["label!"] {
+		parts := strings.SplitN(label, "=", 2)
+		if value, ok := labels[parts[0]]; ok && (len(parts) == 1 || value == parts[1]) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s *Server) pruneContainers(w http.ResponseWriter, f filters, until time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deleted := []string{}
+	for _, c := range s.containers {
+		if c.State.Running || c.State.Paused || !matchPrune(f, until, c.Created, c.labels()) {
+			continue
+		}
+		for _, execId := range c.ExecIDs {
+			delete(s.execs, execId)
+		}
+		delete(s.containers, c.ID)
+		s.containerEvent(c, "destroy")
+		deleted = append(deleted, c.ID)
+	}
+	sort.Strings(deleted)
+	s.emit("container", "prune", "", map[string]string{"reclaimed": "0"})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ContainersDeleted": deleted, "SpaceReclaimed": 0})
+}
+
+func (s *Server) pruneImages(w http.ResponseWriter, f filters, until time.Time) {
+	danglingOnly := !containsString(f["dangling"], "false")
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deleted := []map[string]string{}
+	var reclaimed int64
+	ids := make([]string, 0, len(s.images))
+	for id := range s.images {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		img := s.images[id]
+		if (danglingOnly && len(img.RepoTags) > 0) || s.imageInUse(img) || !matchPrune(f, until, img.Created, img.Labels) {
+			continue
+		}
+		for _, tag := range img.RepoTags {
+			deleted = append(deleted, map[string]string{"Untagged": tag})
+			s.emit("image", "untag", img.ID, map[string]string{"name": tag})
+		}
+		deleted = append(deleted, map[string]string{"Deleted": img.ID})
+		delete(s.images, img.ID)
+		s.emit("image", "delete", img.ID, map[string]string{"name": img.ID})
+		reclaimed += img.Size
+	}
+	s.emit("image", "prune", "", map[string]string{"reclaimed": strconv.FormatInt(reclaimed, 10)})
+	writeJSON(w, http.StatusOK, map[string]interface{}{"ImagesDeleted": deleted, "SpaceReclaimed": reclaimed})
+}
+
+// pruneVolumes removes the volumes not used by any container, the volumes have no until filter
+func (s *Server) pruneVolumes(w http.ResponseWriter, f filters) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deleted := []string{}
+	for _, v := range s.volumes {
+		if len(s.volumeContainers(v)) > 0 || !matchPrune(f, time.Time{}, v.Created, v.Labels) {
+			continue
+		}
+		delete(s.volumes, v.Name)
+		s.emit("volume", "destroy", v.Name, map[string]string{"driver": v.Driver})
+		deleted = append(deleted, v.Name)
+	}
+	sort.Strings(deleted)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"VolumesDeleted": deleted, "SpaceReclaimed": 0})
+}
+
+// pruneNetworks removes the user defined networks without the running containers
+func (s *Server) pruneNetworks(w http.ResponseWriter, f filters, until time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	deleted := []string{}
+	for _, n := range s.networks {
+		if containsString(kBuiltinNetworks, n.Name) || len(s.networkContainers(n)) > 0 || !matchPrune(f, until, n.Created, n.Labels) {
+			continue
+		}
+		delete(s.networks, n.ID)
+		s.emit("network", "destroy", n.ID, map[string]string{"name": n.Name, "type": n.Driver})
+		deleted = append(deleted, n.Name)
+	}
+	sort.Strings(deleted)
+	writeJSON(w, http.StatusOK, map[string]interface{}{"NetworksDeleted": deleted})
+}
+
+func (s *Server) handleDiskUsage(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	var layersSize int64
+	images := make([]map[string]interface{}, 0, len(s.images))
+	for _, img := range s.images {
+		layersSize += img.Size
+		repoTags := img.RepoTags
+		if len(repoTags) == 0 {
+			repoTags = []string{"<none>:<none>"}
+		}
+		images = append(images, map[string]interface{}{
+			"Id":          img.ID,
+			"RepoTags":    repoTags,
+			"RepoDigests": s.repoDigests(img),
+			"Created":     img.Created.Unix(),
+			"Size":        img.Size,
+			"VirtualSize": img.Size,
+			"Labels":      img.Labels,
+			"SharedSize":  int64(0),
+			"Containers":  int64(s.imageContainers(img)),
+		})
+	}
+	sort.Slice(images, func(i, j int) bool { return images[i]["Id"].(string) < images[j]["Id"].(string) })
+	containers := make([]map[string]interface{}, 0, len(s.containers))
+	for _, c := range s.containers {
+		var sizeRootFs int64
+		if img, ok := s.images[c.ImageID]; ok {
+			sizeRootFs = img.Size
+		}
+		containers = append(containers, map[string]interface{}{
+			"Id":         c.ID,
+			"Names":      []string{c.Name},
+			"Image":      c.Image,
+			"ImageID":    c.ImageID,
+			"Command":    strings.Join(c.command(), " "),
+			"Created":    c.Created.Unix(),
+			"Status":     c.statusText(),
+			"State":      c.State.Status,
+			"Labels":     c.labels(),
+			"SizeRw":     int64(0),
+			"SizeRootFs": sizeRootFs,
+		})
+	}
+	sort.Slice(containers, func(i, j int) bool { return containers[i]["Id"].(string) < containers[j]["Id"].(string) })
+	volumes := make([]map[string]interface{}, 0, len(s.volumes))
+	for _, v := range s.volumes {
+		entry := volumeJSON(v)
+		entry["UsageData"] = map[string]int64{"Size": 0, "RefCount": int64(len(s.volumeContainers(v)))}
+		volumes = append(volumes, entry)
+	}
+	sort.Slice(volumes, func(i, j int) bool { return volumes[i]["Name"].(string) < volumes[j]["Name"].(string) })
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"LayersSize": layersSize,
+		"Images":     images,
+		"Containers": containers,
+		"Volumes":    volumes,
+		"BuildCache": []interface{}{},
+	})
+}
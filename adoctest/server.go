@@ -0,0 +1,240 @@
+// Package adoctest provides an in-memory fake Docker daemon for the unit tests, it implements the
+// Engine API surface used by adoc on top of httptest:
+//
+//	server := adoctest.NewServer()
+//	defer server.Close()
+//	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+//	docker, err := adoc.NewClient(server.URL)
+//
+// The containers are following the lifecycle state machine of the daemon, the logs are in the
+// multiplexed framing, and the stats and events are streamed. The faults and latency can be
+// injected by AddFault.
+package adoctest
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	kApiVersion    = "1.18"
+	kDaemonVersion = "1.6.0"
+)
+
+// Fault injects the error or latency into the matched requests
+type Fault struct {
+	Method     string        // empty matches all the methods
+	Path       string        // prefix of the api path without the version, e.g. "containers/create"
+	StatusCode int           // responds the error with the status code if > 0
+	Message    string        // the error message
+	Latency    time.Duration // delays the request before handling
+	Times      int           // how many requests to affect, 0 means forever
+}
+
+func (f *Fault) matches(method string, path string) bool {
+	return (f.Method == "" || f.Method == method) && strings.HasPrefix(path, f.Path)
+}
+
+// Server is the fake Docker daemon
+type Server struct {
+	*httptest.Server
+
+	// StatsInterval is the interval of the streamed stats, default to 100ms
+	StatsInterval time.Duration
+	// Exec runs the command for the exec instances, the default one outputs nothing
+	Exec func(containerId string, cmd []string) (stdout string, stderr string, exitCode int)
+
+	lock       sync.Mutex
+	containers map[string]*container
+	images     map[string]*image
+	networks   map[string]*network
+	volumes    map[string]*volume
+	execs      map[string]*execInstance
+	behaviors  map[string]Behavior
+	faults     []*Fault
+	requests   []string
+	events     []event
+	watchers   map[chan event]struct{}
+	nextIP     int
+	nextSubnet int
+	done       chan struct{}
+	closeOnce  sync.Once
+}
+
+// NewServer starts the fake daemon, the caller should Close it
+func NewServer() *Server {
+	s := &Server{
+		StatsInterval: 100 * time.Millisecond,
+		containers:    make(map[string]*container),
+		images:        make(map[string]*image),
+		networks:      make(map[string]*network),
+		volumes:       make(map[string]*volume),
+		execs:         make(map[string]*execInstance),
+		behaviors:     make(map[string]Behavior),
+		watchers:      make(map[chan event]struct{}),
+		nextIP:        2,
+		nextSubnet:    17,
+		done:          make(chan struct{}),
+	}
+	s.addBuiltinNetworks()
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Close stops all the streaming requests and shuts down the server
+func (s *Server) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+		s.Server.CloseClientConnections()
+		s.Server.Close()
+	})
+}
+
+// AddFault injects the fault for the matched requests, the faults are checked in order
+func (s *Server) AddFault(fault Fault) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = append(s.faults, &fault)
+}
+
+// ClearFaults removes all the faults
+func (s *Server) ClearFaults() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.faults = nil
+}
+
+// Requests returns all the received requests like "POST containers/create"
+func (s *Server) Requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]string(nil), s.requests...)
+}
+
+// Watchers returns the number of the connected events streams, the tests could wait on it
+// before triggering the events for the monitors
+func (s *Server) Watchers() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.watchers)
+}
+
+var versionPrefix = regexp.MustCompile(`^/v[0-9.]+/`)
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := versionPrefix.ReplaceAllString(r.URL.Path, "/")
+	path = strings.Trim(path, "/")
+
+	s.lock.Lock()
+	s.requests = append(s.requests, r.Method+" "+path)
+	var fault Fault
+	for i, f := range s.faults {
+		if f.matches(r.Method, path) {
+			fault = *f
+			if f.Times > 0 {
+				if f.Times -= 1; f.Times == 0 {
+					s.faults = append(s.faults[:i], s.faults[i+1:]...)
+				}
+			}
+			break
+		}
+	}
+	s.lock.Unlock()
+
+	if fault.Latency > 0 {
+		select {
+		case <-time.After(fault.Latency):
+		case <-r.Context().Done():
+			return
+		case <-s.done:
+			return
+		}
+	}
+	if fault.StatusCode > 0 {
+		http.Error(w, fault.Message, fault.StatusCode)
+		return
+	}
+	s.route(w, r, path, strings.Split(path, "/"))
+}
+
+func (s *Server) route(w http.ResponseWriter, r *http.Request, path string, segs []string) {
+	method := r.Method
+	switch {
+	case path == "_ping":
+		fmt.Fprint(w, "OK")
+		return
+	case path == "version" && method == "GET":
+		s.handleVersion(w, r)
+		return
+	case path == "info" && method == "GET":
+		s.handleInfo(w, r)
+		return
+	case path == "events" && method == "GET":
+		s.handleEvents(w, r)
+		return
+	case path == "commit" && method == "POST":
+		s.handleCommit(w, r)
+		return
+	case path == "system/df" && method == "GET":
+		s.handleDiskUsage(w, r)
+		return
+	case len(segs) == 2 && segs[1] == "prune" && method == "POST" &&
+		(segs[0] == "containers" || segs[0] == "images" || segs[0] == "volumes" || segs[0] == "networks" || segs[0] == "build"):
+		s.routePrune(w, r, segs[0])
+		return
+	case segs[0] == "containers":
+		if s.routeContainers(w, r, segs) {
+			return
+		}
+	case segs[0] == "images":
+		if s.routeImages(w, r, segs) {
+			return
+		}
+	case segs[0] == "distribution" && len(segs) >= 3 && segs[len(segs)-1] == "json" && method == "GET":
+		s.handleDistributionInspect(w, r, strings.Join(segs[1:len(segs)-1], "/"))
+		return
+	case segs[0] == "exec" && len(segs) == 3:
+		switch {
+		case segs[2] == "start" && method == "POST":
+			s.handleExecStart(w, r, segs[1])
+			return
+		case segs[2] == "json" && method == "GET":
+			s.handleExecInspect(w, r, segs[1])
+			return
+		}
+	case segs[0] == "networks":
+		if s.routeNetworks(w, r, segs) {
+			return
+		}
+	case segs[0] == "volumes":
+		if s.routeVolumes(w, r, segs) {
+			return
+		}
+	}
+	http.Error(w, fmt.Sprintf("page not found: %s %s", method, path), http.StatusNotFound)
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(v)
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func boolParam(r *http.Request, key string) bool {
+	v := r.URL.Query().Get(key)
+	return v == "1" || v == "true" || v == "True"
+}
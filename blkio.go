@@ -1,6 +1,15 @@
 package adoc
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	kMinBlkioWeight = 10
+	kMaxBlkioWeight = 1000
+)
 
 // WeightDevice is a structure that holds device:weight pair
 type WeightDevice struct {
@@ -21,3 +30,94 @@ type ThrottleDevice struct {
 func (t *ThrottleDevice) String() string {
 	return fmt.Sprintf("%s:%d", t.Path, t.Rate)
 }
+
+// ParseBlkioWeight parses the blkio weight between 10 and 1000, 0 means the default weight
+func ParseBlkioWeight(value string) (uint16, error) {
+	weight, err := parseBlkioWeight(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid blkio weight %q, %s", value, err)
+	}
+	return weight, nil
+}
+
+// ParseWeightDevice parses the device:weight like /dev/sda:200
+func ParseWeightDevice(value string) (*WeightDevice, error) {
+	device, err := parseWeightDevice(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid weight device %q, %s", value, err)
+	}
+	return device, nil
+}
+
+// ParseThrottleDevice parses the device:rate like /dev/sda:10mb, the rate is in bytes per second
+func ParseThrottleDevice(value string) (*ThrottleDevice, error) {
+	device, err := parseThrottleDevice(value, false)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid throttle device %q, %s", value, err)
+	}
+	return device, nil
+}
+
+// ParseThrottleIOpsDevice parses the device:rate like /dev/sda:1000, the rate is in IO per second
+func ParseThrottleIOpsDevice(value string) (*ThrottleDevice, error) {
+	device, err := parseThrottleDevice(value, true)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid throttle device %q, %s", value, err)
+	}
+	return device, nil
+}
+
+func parseBlkioWeight(value string) (uint16, error) {
+	weight, err := strconv.ParseUint(value, 10, 16)
+	if err != nil || (weight != 0 && (weight < kMinBlkioWeight || weight > kMaxBlkioWeight)) {
+		return 0, fmt.Errorf("should be between %d and %d", kMinBlkioWeight, kMaxBlkioWeight)
+	}
+	return uint16(weight), nil
+}
+
+func parseWeightDevice(value string) (*WeightDevice, error) {
+	path, weight, err := splitBlkioDevice(value)
+	if err != nil {
+		return nil, err
+	}
+	n, err := parseBlkioWeight(weight)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, fmt.Errorf("should be between %d and %d", kMinBlkioWeight, kMaxBlkioWeight)
+	}
+	return &WeightDevice{Path: path, Weight: n}, nil
+}
+
+func parseThrottleDevice(value string, iops bool) (*ThrottleDevice, error) {
+	path, rate, err := splitBlkioDevice(value)
+	if err != nil {
+		return nil, err
+	}
+	if iops {
+		n, err := strconv.ParseUint(rate, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid rate %q, should be a number of IO per second", rate)
+		}
+		return &ThrottleDevice{Path: path, Rate: n}, nil
+	}
+	n, err := RAMInBytes(rate)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid rate %q, should be a size like 10mb per second", rate)
+	}
+	return &ThrottleDevice{Path: path, Rate: uint64(n)}, nil
+}
+
+// splitBlkioDevice splits the /dev/sda:value, the path should be a device
+func splitBlkioDevice(value string) (string, string, error) {
+	i := strings.LastIndex(value, ":")
+	if i < 0 {
+		return "", "", fmt.Errorf("should be device-path:value")
+	}
+	path := value[:i]
+	if !strings.HasPrefix(path, "/dev/") {
+		return "", "", fmt.Errorf("the path %q should be a device under /dev", path)
+	}
+	return path, value[i+1:], nil
+}
@@ -2,14 +2,17 @@ package adoc
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"math/rand"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -23,6 +26,9 @@ type AuthConfig struct {
 
 type RequestConfig struct {
 	ExtraTimeout time.Duration
+	Context      context.Context // cancels the request, e.g. the monitors
+	Retry        *RetryPolicy    // overrides the retry policy of the client
+	Replayable   bool            // the non-GET request is safe to replay, e.g. start and stop
 }
 
 func (auth AuthConfig) Encode() string {
@@ -42,14 +48,25 @@ func (e Error) Error() string {
 }
 
 func IsNotFound(err error) bool {
-	if adocErr, ok := err.(Error); ok {
+	var adocErr Error
+	if errors.As(err, &adocErr) {
 		return adocErr.StatusCode == 404
 	}
 	return false
 }
 
+// IsConflict is true for the 409 errors, e.g. the container name is in use
+func IsConflict(err error) bool {
+	var adocErr Error
+	if errors.As(err, &adocErr) {
+		return adocErr.StatusCode == 409
+	}
+	return false
+}
+
 func IsServerInternalError(err error) bool {
-	if adocErr, ok := err.(Error); ok {
+	var adocErr Error
+	if errors.As(err, &adocErr) {
 		return adocErr.StatusCode == 500
 	}
 	return false
@@ -73,9 +90,34 @@ type DockerClient struct {
 	tlsConfig      *tls.Config
 	apiVersion     string
 	isSwarm        bool
+	userAgent      string
+	headers        map[string]string
+	logger         Logger
+	retryPolicy    *RetryPolicy
+	tracer         Tracer
+	dryRun         *DryRun
 
 	monitorLock sync.RWMutex
-	monitors    map[int64]struct{}
+	monitors    map[int64]context.CancelFunc
+}
+
+// NewClient creates the client with the daemon url like tcp://host:port, unix:///var/run/docker.sock
+// or ssh://user@host, and the options, e.g.
+//
+//	NewClient("tcp://127.0.0.1:2375", WithAPIVersion("1.18"), WithUserAgent("deployer/1.0"))
+func NewClient(daemonUrl string, opts ...ClientOption) (*DockerClient, error) {
+	options := defaultClientOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	client, err := newClient(daemonUrl, options)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkApiVersion(client.apiVersion); err != nil {
+		client.logger.Warn("Adoc haven't checked if the remote api version is supported, maybe not stable", "apiVersion", client.apiVersion)
+	}
+	return client, nil
 }
 
 func NewSwarmClient(swarmUrl string, tlsConfig *tls.Config, apiVersion ...string) (*DockerClient, error) {
@@ -86,9 +128,7 @@ func NewSwarmClient(swarmUrl string, tlsConfig *tls.Config, apiVersion ...string
 }
 
 func NewSwarmClientTimeout(swarmUrl string, tlsConfig *tls.Config, timeout time.Duration, rwTimeout time.Duration, apiVersion ...string) (*DockerClient, error) {
-	docker, err := NewDockerClientTimeout(swarmUrl, tlsConfig, timeout, rwTimeout, apiVersion...)
-	docker.isSwarm = true
-	return docker, err
+	return newClientCompat(swarmUrl, tlsConfig, timeout, rwTimeout, true, apiVersion...)
 }
 
 func NewDockerClient(daemonUrl string, tlsConfig *tls.Config, apiVersion ...string) (*DockerClient, error) {
@@ -99,54 +139,195 @@ func NewDockerClient(daemonUrl string, tlsConfig *tls.Config, apiVersion ...stri
 }
 
 func NewDockerClientTimeout(daemonUrl string, tlsConfig *tls.Config, timeout time.Duration, rwTimeout time.Duration, apiVersion ...string) (*DockerClient, error) {
+	return newClientCompat(daemonUrl, tlsConfig, timeout, rwTimeout, false, apiVersion...)
+}
+
+// newClientCompat keeps the behaviours of the positional constructors, the unchecked api version
+// warning is returned as the error together with the usable client.
+func newClientCompat(daemonUrl string, tlsConfig *tls.Config, timeout time.Duration, rwTimeout time.Duration, isSwarm bool, apiVersion ...string) (*DockerClient, error) {
+	opts := []ClientOption{WithTLSConfig(tlsConfig), WithTimeout(timeout, rwTimeout)}
+	if len(apiVersion) > 0 {
+		opts = append(opts, WithAPIVersion(apiVersion[0]))
+	}
+	if isSwarm {
+		opts = append(opts, WithSwarm())
+	}
+	options := defaultClientOptions()
+	for _, opt := range opts {
+		opt(options)
+	}
+	client, err := newClient(daemonUrl, options)
+	if err != nil {
+		return nil, err
+	}
+	return client, checkApiVersion(client.apiVersion)
+}
+
+func newClient(daemonUrl string, options *clientOptions) (*DockerClient, error) {
 	u, err := url.Parse(daemonUrl)
 	if err != nil {
 		return nil, err
 	}
 	if u.Scheme == "" || u.Scheme == "tcp" {
-		if tlsConfig == nil {
+		if options.tlsConfig == nil {
 			u.Scheme = "http"
 		} else {
 			u.Scheme = "https"
 		}
 	}
 	copiedUrl, _ := url.Parse(u.String())
-	httpClient := newHttpClient(u, tlsConfig, timeout, rwTimeout)
-	longpollClient := newHttpClient(copiedUrl, tlsConfig, timeout, 0)
-	clientApiVersion := kDefaultApiVersion
-	if len(apiVersion) > 0 && apiVersion[0] != "" {
-		clientApiVersion = apiVersion[0]
-		if !strings.HasPrefix(clientApiVersion, "v") {
-			clientApiVersion = "v" + clientApiVersion
-		}
+	httpClient, err := newHttpClient(u, options, options.rwTimeout)
+	if err != nil {
+		return nil, err
 	}
-	if _, checked := apiVersions[clientApiVersion]; !checked {
-		err = fmt.Errorf("*WARNING: Adoc haven't check out if the remote api version %s is supported, maybe not stable, but you can keep using the client anyway.", clientApiVersion)
+	longpollClient, err := newHttpClient(copiedUrl, options, 0)
+	if err != nil {
+		return nil, err
 	}
 	return &DockerClient{
 		daemonUrl:      u,
 		httpClient:     httpClient,
 		longpollClient: longpollClient,
-		tlsConfig:      tlsConfig,
-		apiVersion:     clientApiVersion,
-		monitors:       make(map[int64]struct{}),
-	}, err
+		tlsConfig:      options.tlsConfig,
+		apiVersion:     options.apiVersion,
+		isSwarm:        options.isSwarm,
+		userAgent:      options.userAgent,
+		headers:        options.headers,
+		logger:         options.logger,
+		retryPolicy:    options.retryPolicy,
+		tracer:         options.tracer,
+		dryRun:         options.dryRun,
+		monitors:       make(map[int64]context.CancelFunc),
+	}, nil
+}
+
+func checkApiVersion(apiVersion string) error {
+	if _, checked := apiVersions[apiVersion]; !checked {
+		return fmt.Errorf("*WARNING: Adoc haven't check out if the remote api version %s is supported, maybe not stable, but you can keep using the client anyway.", apiVersion)
+	}
+	return nil
+}
+
+// compareApiVersion compares the versions like v1.17 and 1.22, returns -1, 0 or 1
+func compareApiVersion(a string, b string) int {
+	aParts := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	bParts := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i += 1 {
+		var x, y int
+		if i < len(aParts) {
+			x, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			y, _ = strconv.Atoi(bParts[i])
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// Close stops all the monitors and closes the idle connections, the client should not be used after closed
+func (client *DockerClient) Close() error {
+	client.monitorLock.Lock()
+	for monitorId, cancel := range client.monitors {
+		cancel()
+		delete(client.monitors, monitorId)
+	}
+	client.monitorLock.Unlock()
+
+	client.httpClient.CloseIdleConnections()
+	client.longpollClient.CloseIdleConnections()
+	return nil
 }
 
 type responseCallback func(resp *http.Response) error
 
 func (client *DockerClient) sendRequestCallback(method string, path string, body []byte, headers map[string]string, callback responseCallback, rc *RequestConfig, isLongpoll ...bool) error {
+	ctx := context.Background()
+	if rc != nil && rc.Context != nil {
+		ctx = rc.Context
+	}
+	if client.tracer == nil {
+		return client.sendRequestRetry(ctx, method, path, body, headers, callback, rc, isLongpoll...)
+	}
+	ctx, span := client.startSpan(ctx, method, path)
+	defer span.End()
+	err := client.sendRequestRetry(ctx, method, path, body, headers, callback, rc, isLongpoll...)
+	if err != nil {
+		var adocErr Error
+		if errors.As(err, &adocErr) {
+			span.SetAttribute(kTraceStatusCode, adocErr.StatusCode)
+		}
+		span.RecordError(err)
+	}
+	return err
+}
+
+func (client *DockerClient) sendRequestRetry(ctx context.Context, method string, path string, body []byte, headers map[string]string, callback responseCallback, rc *RequestConfig, isLongpoll ...bool) error {
+	policy := client.retryPolicy
+	if rc != nil && rc.Retry != nil {
+		policy = rc.Retry
+	}
+	if policy == nil || !policy.allows(method, rc) {
+		resp, err := client.doRequest(ctx, method, path, body, headers, rc, isLongpoll...)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		return callback(resp)
+	}
+
+	retryErr := &RetryError{}
+	for attempt := 1; ; attempt += 1 {
+		resp, err := client.doRequest(ctx, method, path, body, headers, rc, isLongpoll...)
+		if err == nil {
+			defer resp.Body.Close()
+			return callback(resp)
+		}
+		retryErr.Errors = append(retryErr.Errors, err)
+		if !policy.retriable(err) || attempt >= policy.MaxAttempts {
+			if attempt == 1 {
+				return err
+			}
+			return retryErr
+		}
+		delay := policy.delay(attempt)
+		client.logger.Warn("Request failed, will retry", "method", method, "path", path, "attempt", attempt, "delay", delay, "error", err)
+		SpanFromContext(ctx).AddEvent("retry", map[string]interface{}{
+			"attempt": attempt,
+			"delay":   delay.String(),
+			"error":   err.Error(),
+		})
+		if err := sleepContext(ctx, delay); err != nil {
+			retryErr.Errors = append(retryErr.Errors, err)
+			return retryErr
+		}
+	}
+}
+
+// doRequest returns the response for status code < 400, the caller needs to close the body
+func (client *DockerClient) doRequest(ctx context.Context, method string, path string, body []byte, headers map[string]string, rc *RequestConfig, isLongpoll ...bool) (*http.Response, error) {
 	b := bytes.NewBuffer(body)
 	urlPath := fmt.Sprintf("%s/%s/%s", client.daemonUrl.String(), client.apiVersion, path)
-	logger.Debugf("SendRequest %q, [%s]", method, urlPath)
-	req, err := http.NewRequest(method, urlPath, b)
+	client.logger.Debug("SendRequest", "method", method, "url", urlPath)
+	req, err := http.NewRequestWithContext(ctx, method, urlPath, b)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	req.Header.Add("Content-Type", "application/json")
+	if client.userAgent != "" {
+		req.Header.Set("User-Agent", client.userAgent)
+	}
+	for key, value := range client.headers {
+		req.Header.Set(key, value)
+	}
 	if headers != nil {
 		for key, value := range headers {
-			req.Header.Add(key, value)
+			req.Header.Set(key, value)
 		}
 	}
 	httpClient := client.httpClient
@@ -161,22 +342,22 @@ func (client *DockerClient) sendRequestCallback(method string, path string, body
 	}
 	resp, err := httpClient.Do(req)
 	if err != nil {
-		if !strings.Contains(err.Error(), "connection refused") && client.tlsConfig == nil {
-			return fmt.Errorf("%v. Are you trying to connect to a TLS-enabled daemon without TLS?", err)
+		if !strings.Contains(err.Error(), "connection refused") && client.tlsConfig == nil && client.daemonUrl.Host != "ssh.sock" {
+			return nil, fmt.Errorf("%w. Are you trying to connect to a TLS-enabled daemon without TLS?", err)
 		}
-		return err
+		return nil, err
 	}
 	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
 		var errMsg []byte
 		var cbErr error
 		if errMsg, cbErr = ioutil.ReadAll(resp.Body); cbErr != nil {
-			return Error{resp.StatusCode, resp.Status, cbErr.Error()}
+			return nil, Error{resp.StatusCode, resp.Status, cbErr.Error()}
 		}
-		return Error{resp.StatusCode, resp.Status, strings.TrimSpace(string(errMsg))}
+		return nil, Error{resp.StatusCode, resp.Status, strings.TrimSpace(string(errMsg))}
 	}
-
-	defer resp.Body.Close()
-	return callback(resp)
+	SpanFromContext(ctx).SetAttribute(kTraceStatusCode, resp.StatusCode)
+	return resp, nil
 }
 
 func (client *DockerClient) sendRequest(method string, path string, body []byte, headers map[string]string, rc *RequestConfig, isLongpoll ...bool) ([]byte, error) {
@@ -2,7 +2,12 @@ package adoc
 
 import (
 	"fmt"
+	"net/http"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
 )
 
 func TestVersionAndInfo(t *testing.T) {
@@ -33,14 +38,14 @@ func TestVersionAndInfo(t *testing.T) {
 }
 
 func TestContainers(t *testing.T) {
-	fmt.Println("\n\n\n")
+	fmt.Print("\n\n\n\n")
 	containerConf := ContainerConfig{
 		AttachStdout: true,
 		AttachStderr: true,
 		Cmd:          []string{"python", "app.py"},
 		Image:        "training/webapp",
 	}
-	id, err := docker.CreateContainer(containerConf, HostConfig{})
+	id, err := docker.CreateContainer(containerConf, HostConfig{}, NetworkingConfig{})
 	if err != nil {
 		t.Fatalf("Cannot create the container, %s", err)
 	}
@@ -76,6 +81,9 @@ func TestContainers(t *testing.T) {
 		t.Fatalf("Cannot get logs from the container, %s", err)
 	} else {
 		d("Container Logs", logs)
+		if len(logs) != 1 || logs[0].Output != "stdout" || logs[0].Content != " * Running on http://0.0.0.0:5000/" {
+			t.Fatalf("Wrong logs from the container, %+v", logs)
+		}
 	}
 
 	if err := docker.RemoveContainer(id, true, false); err != nil {
@@ -84,7 +92,7 @@ func TestContainers(t *testing.T) {
 }
 
 func TestContainerCtls(t *testing.T) {
-	fmt.Println("\n\n\n")
+	fmt.Print("\n\n\n\n")
 	containerConf := ContainerConfig{
 		AttachStdout: true,
 		AttachStderr: true,
@@ -98,7 +106,7 @@ func TestContainerCtls(t *testing.T) {
 			},
 		},
 	}
-	id, err := docker.CreateContainer(containerConf, hostConf, "test_container")
+	id, err := docker.CreateContainer(containerConf, hostConf, NetworkingConfig{}, "test_container")
 	if err != nil {
 		t.Fatalf("Cannot create the container, %s", err)
 	}
@@ -125,15 +133,14 @@ func TestContainerCtls(t *testing.T) {
 		t.Fatalf("Cannot unpause the container, %s", err)
 	}
 
-	//if code, err := docker.WaitContainer(id); err != nil {
-	//t.Fatalf("Cannot wait on the container, %s", err)
-	//} else {
-	//d("Container Return", code)
-	//}
-
 	if err := docker.StopContainer(id); err != nil {
 		t.Fatalf("Cannot stop the container, %s", err)
 	}
+	if code, err := docker.WaitContainer(id); err != nil {
+		t.Fatalf("Cannot wait on the container, %s", err)
+	} else {
+		d("Container Return", code)
+	}
 	if err := docker.RestartContainer(id, 5); err != nil {
 		t.Fatalf("Cannot restart the container, %s", err)
 	}
@@ -159,7 +166,7 @@ func TestContainerExec(t *testing.T) {
 			},
 		},
 	}
-	id, err := docker.CreateContainer(containerConf, hostConf)
+	id, err := docker.CreateContainer(containerConf, hostConf, NetworkingConfig{})
 	if err != nil {
 		t.Fatalf("Cannot create the container, %s", err)
 	}
@@ -192,7 +199,7 @@ func TestContainerExec(t *testing.T) {
 }
 
 func TestImages(t *testing.T) {
-	fmt.Println("\n\n\n")
+	fmt.Print("\n\n\n\n")
 	if images, err := docker.ListImages(false); err != nil {
 		t.Fatalf("Cannot list all the images, %s", err)
 	} else {
@@ -218,13 +225,109 @@ func d(msg string, o interface{}) {
 }
 
 var docker *DockerClient
+var server *adoctest.Server
 
 func init() {
-	EnableDebug()
+	server = adoctest.NewServer()
+	server.AddImage(adoctest.ImageSpec{Name: "training/webapp"})
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	server.SetBehavior("training/webapp", adoctest.Behavior{Stdout: " * Running on http://0.0.0.0:5000/\n"})
+	server.Exec = func(containerId string, cmd []string) (string, string, int) {
+		return "total 0\ndrwxr-xr-x 2 root root 4096 app\n", "", 0
+	}
 	var err error
-	//docker, err = NewDockerClient("tcp://192.168.51.21:2375", nil)
-	docker, err = NewSwarmClient("tcp://192.168.51.21:8178", nil)
+	docker, err = NewDockerClient(server.URL, nil)
 	if err != nil {
 		fmt.Println(err)
 	}
 }
+
+func waitForWatchers(t *testing.T, server *adoctest.Server, n int) {
+	for i := 0; server.Watchers() < n; i += 1 {
+		if i >= 500 {
+			t.Fatalf("Timeout when waiting for the events monitor")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestFakeDaemonFaults(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	client, _ := NewClient(server.URL)
+
+	server.AddFault(adoctest.Fault{Path: "containers/create", StatusCode: 500, Message: "disk is full", Times: 1})
+	_, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{})
+	if !IsServerInternalError(err) {
+		t.Fatalf("Should get the injected server error, %v", err)
+	}
+	_, err = client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{})
+	if !IsNotFound(err) {
+		t.Fatalf("Should get the no such image error after the fault is used up, %v", err)
+	}
+
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	if _, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{}); err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	if requests := server.Requests(); len(requests) != 3 || requests[2] != "POST containers/create" {
+		t.Errorf("Wrong recorded requests, %v", requests)
+	}
+}
+
+func TestCommitContainer(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox", Config: map[string]interface{}{"Cmd": []string{"sh"}}})
+	var lastQuery string
+	client, _ := NewClient(server.URL, WithMiddleware(func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			lastQuery = req.URL.RawQuery
+			return next.RoundTrip(req)
+		})
+	}))
+	defer client.Close()
+
+	id, _ := client.CreateContainer(ContainerConfig{Image: "busybox", Env: []string{"A=1"}}, HostConfig{}, NetworkingConfig{})
+	imageId, err := client.CommitContainer(id, CommitOptions{
+		Repo:    "debug/snapshot",
+		Tag:     "v1",
+		Comment: "failing container",
+		Author:  "ops",
+		NoPause: true,
+		Changes: []string{`CMD ["top"]`, "LABEL debug=true", "EXPOSE 8080\n", "STOPSIGNAL SIGQUIT", "HEALTHCHECK --interval=5s CMD wget -q localhost:8080"},
+		Config:  &ContainerConfig{WorkingDir: "/app"},
+	})
+	if err != nil || imageId == "" {
+		t.Fatalf("Cannot commit the container, %q, %v", imageId, err)
+	}
+	image, err := client.InspectImage("debug/snapshot:v1")
+	if err != nil || image.Id != imageId || image.Comment != "failing container" || image.Author != "ops" || image.Config.StopSignal != "SIGQUIT" {
+		t.Fatalf("Wrong committed image, %+v, %v", image, err)
+	}
+	if container, _ := client.InspectContainer(id); container.Config.Labels["debug"] != "" {
+		t.Errorf("The commit should not change the container config, %+v", container.Config)
+	}
+
+	client.CommitContainer(id, CommitOptions{Repo: "debug/snapshot", NoPause: true})
+	if !strings.Contains(lastQuery, "pause=0") {
+		t.Errorf("Should not pause with the NoPause, %s", lastQuery)
+	}
+	client.CommitContainer(id, CommitOptions{Repo: "debug/snapshot"})
+	if strings.Contains(lastQuery, "pause=") {
+		t.Errorf("Should pause by the daemon default, %s", lastQuery)
+	}
+
+	if _, err := client.CommitContainer(id, CommitOptions{Changes: []string{"RUN rm -rf /"}}); err == nil {
+		t.Errorf("Should reject the unsupported change")
+	}
+	if _, err := client.CommitContainer(id, CommitOptions{Changes: []string{"ENV A=1", " \n"}}); err == nil {
+		t.Errorf("Should reject the empty change")
+	}
+	if _, err := client.CommitContainer(id, CommitOptions{Tag: "v1"}); err == nil {
+		t.Errorf("Should reject the tag without the repo")
+	}
+	if _, err := client.CommitContainer("missing", CommitOptions{}); !IsNotFound(err) {
+		t.Errorf("Should be not found, %v", err)
+	}
+}
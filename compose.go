@@ -0,0 +1,407 @@
+package adoc
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This part contains the orchestrator of the compose project, e.g.
+//   project, err := LoadComposeProject("docker-compose.yml")
+//   compose := docker.Compose(project)
+//   err = compose.Up(ctx)
+//   containers, err := compose.Ps()
+//   err = compose.Down(ctx, true)
+// The networks, volumes and containers are labelled like the compose does, so the project could be
+// taken down by the compose cli too, and the other way around.
+
+const (
+	kComposeProjectLabel         = "com.docker.compose.project"
+	kComposeServiceLabel         = "com.docker.compose.service"
+	kComposeContainerNumberLabel = "com.docker.compose.container-number"
+	kComposeOneoffLabel          = "com.docker.compose.oneoff"
+	kComposeNetworkLabel         = "com.docker.compose.network"
+	kComposeVolumeLabel          = "com.docker.compose.volume"
+
+	// the multiple networks could be connected at the creation since v1.44
+	kComposeEndpointsApiVersion = "v1.44"
+	kComposeDefaultPollInterval = 500 * time.Millisecond
+	kComposeDefaultStopTimeout  = 10 * time.Second
+)
+
+// Compose runs the compose project with the client
+type Compose struct {
+	Project      ComposeProject
+	PollInterval time.Duration         // the interval to check the dependency conditions, default to 500ms
+	Auths        map[string]AuthConfig // the auths to pull the images by the registry host, "" for the docker hub
+
+	client *DockerClient
+}
+
+// ComposeContainer is the container of the service
+type ComposeContainer struct {
+	Service   string
+	Number    int
+	Container Container
+}
+
+// Compose returns the orchestrator of the project
+func (client *DockerClient) Compose(project ComposeProject) *Compose {
+	return &Compose{Project: project, PollInterval: kComposeDefaultPollInterval, client: client}
+}
+
+// Up creates the networks and the volumes, and creates and starts the services in the dependency order,
+// each service is started after its dependencies meet the conditions. The existing containers of the
+// services are started but not recreated.
+func (c *Compose) Up(ctx context.Context) error {
+	order, err := c.Project.ServiceOrder()
+	if err != nil {
+		return err
+	}
+	if err := c.upNetworks(); err != nil {
+		return err
+	}
+	if err := c.upVolumes(); err != nil {
+		return err
+	}
+	ids := make(map[string]string)
+	for _, name := range order {
+		service := c.Project.Services[name]
+		for _, dependency := range sortedComposeDependencies(service.DependsOn) {
+			condition := service.DependsOn[dependency].Condition
+			if err := c.waitDependency(ctx, dependency, ids[dependency], condition); err != nil {
+				return fmt.Errorf("Cannot start service %s, %s", name, err)
+			}
+		}
+		id, err := c.upService(service)
+		if err != nil {
+			return fmt.Errorf("Cannot start service %s, %s", name, err)
+		}
+		ids[name] = id
+	}
+	return nil
+}
+
+// usedNetworks returns the keys of the networks used by the services
+func (c *Compose) usedNetworks() []string {
+	used := make(map[string]struct{})
+	for _, service := range c.Project.Services {
+		for key := range service.Networks {
+			used[key] = struct{}{}
+		}
+	}
+	return sortedSetKeys(used)
+}
+
+func (c *Compose) upNetworks() error {
+	for _, key := range c.usedNetworks() {
+		network := c.Project.Networks[key]
+		existing, err := c.client.InspectNetwork(network.Name)
+		if err == nil {
+			if project := existing.Labels[kComposeProjectLabel]; !network.External && project != c.Project.Name {
+				c.client.logger.Warn("The network exists but was not created by the project", "network", network.Name, "project", c.Project.Name)
+			}
+			continue
+		} else if !IsNotFound(err) {
+			return err
+		}
+		if network.External {
+			return fmt.Errorf("Network %s declared as external, but could not be found", network.Name)
+		}
+		labels := copyStringMap(network.Labels)
+		labels[kComposeProjectLabel] = c.Project.Name
+		labels[kComposeNetworkLabel] = key
+		_, err = c.client.CreateNetwork(NetworkCreate{
+			Name:       network.Name,
+			Driver:     network.Driver,
+			Options:    network.DriverOpts,
+			Internal:   network.Internal,
+			Attachable: network.Attachable,
+			EnableIPv6: network.EnableIPv6,
+			Labels:     labels,
+		})
+		if err != nil {
+			return fmt.Errorf("Cannot create network %s, %s", network.Name, err)
+		}
+	}
+	return nil
+}
+
+func (c *Compose) upVolumes() error {
+	keys := make([]string, 0, len(c.Project.Volumes))
+	for key := range c.Project.Volumes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		volume := c.Project.Volumes[key]
+		if _, err := c.client.InspectVolume(volume.Name); err == nil {
+			continue
+		} else if !IsNotFound(err) {
+			return err
+		}
+		if volume.External {
+			return fmt.Errorf("Volume %s declared as external, but could not be found", volume.Name)
+		}
+		labels := copyStringMap(volume.Labels)
+		labels[kComposeProjectLabel] = c.Project.Name
+		labels[kComposeVolumeLabel] = key
+		_, err := c.client.CreateVolume(VolumeCreate{
+			Name:       volume.Name,
+			Driver:     volume.Driver,
+			DriverOpts: volume.DriverOpts,
+			Labels:     labels,
+		})
+		if err != nil {
+			return fmt.Errorf("Cannot create volume %s, %s", volume.Name, err)
+		}
+	}
+	return nil
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	ret := make(map[string]string, len(m))
+	for key, value := range m {
+		ret[key] = value
+	}
+	return ret
+}
+
+// upService starts the existing container of the service, or creates and starts the new one
+func (c *Compose) upService(service ComposeService) (string, error) {
+	filters := NewFilters().Label(kComposeProjectLabel, c.Project.Name).Label(kComposeServiceLabel, service.Name)
+	containers, err := c.client.ListContainersWithOptions(ListContainersOptions{All: true, Filters: filters})
+	if err != nil {
+		return "", err
+	}
+	if len(containers) > 0 {
+		container := containers[0]
+		if container.State != "running" {
+			err = c.client.StartContainer(container.Id)
+		}
+		return container.Id, err
+	}
+
+	var authConfig *AuthConfig
+	if auth, ok := c.Auths[imageRegistry(service.Config.Image)]; ok {
+		authConfig = &auth
+	}
+	if err := c.client.ensureImage(service.Config.Image, service.Pull, authConfig); err != nil {
+		return "", err
+	}
+	config, hostConfig, networkingConfig, extra := c.serviceConfigs(service)
+	id, err := c.client.CreateContainer(config, hostConfig, networkingConfig, service.ContainerName)
+	if err != nil {
+		return "", err
+	}
+	for _, key := range extra {
+		network := c.Project.Networks[key]
+		if err := c.client.connectContainer(network.Name, id, c.endpointConfig(service, key)); err != nil {
+			return id, fmt.Errorf("Cannot connect to network %s, %s", network.Name, err)
+		}
+	}
+	return id, c.client.StartContainer(id)
+}
+
+// serviceConfigs returns the configs to create the container of the service, the networks which are not
+// connected at the creation are returned to be connected before the start
+func (c *Compose) serviceConfigs(service ComposeService) (ContainerConfig, HostConfig, NetworkingConfig, []string) {
+	config, hostConfig := service.Config, service.HostConfig
+	config.Labels = copyStringMap(service.Config.Labels)
+	config.Labels[kComposeProjectLabel] = c.Project.Name
+	config.Labels[kComposeServiceLabel] = service.Name
+	config.Labels[kComposeContainerNumberLabel] = "1"
+	config.Labels[kComposeOneoffLabel] = "False"
+
+	var networkingConfig NetworkingConfig
+	var extra []string
+	keys := make([]string, 0, len(service.Networks))
+	for key := range service.Networks {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	if len(keys) > 0 {
+		hostConfig.NetworkMode = c.Project.Networks[keys[0]].Name
+		networkingConfig.EndpointsConfig = make(map[string]EndpointConfig)
+		for i, key := range keys {
+			if i > 0 && compareApiVersion(c.client.apiVersion, kComposeEndpointsApiVersion) < 0 {
+				extra = append(extra, key)
+				continue
+			}
+			networkingConfig.EndpointsConfig[c.Project.Networks[key].Name] = c.endpointConfig(service, key)
+		}
+	}
+	return config, hostConfig, networkingConfig, extra
+}
+
+// endpointConfig has the service name as the alias, so the service could be reached by its name
+func (c *Compose) endpointConfig(service ComposeService, key string) EndpointConfig {
+	network := service.Networks[key]
+	endpoint := EndpointConfig{Aliases: append([]string{service.Name}, network.Aliases...)}
+	endpoint.IPAMConfig.IPv4Address = network.IPv4Address
+	endpoint.IPAMConfig.IPv6Address = network.IPv6Address
+	return endpoint
+}
+
+// imageRegistry returns the registry host of the image, empty for the docker hub
+func imageRegistry(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return ""
+	}
+	if host := image[:i]; strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host
+	}
+	return ""
+}
+
+func sortedComposeDependencies(dependencies map[string]ComposeDependency) []string {
+	names := make([]string, 0, len(dependencies))
+	for name := range dependencies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// waitDependency polls the container of the dependency until it meets the condition, the planned
+// containers of the dry run are not waited
+func (c *Compose) waitDependency(ctx context.Context, service string, id string, condition string) error {
+	if condition == ComposeServiceStarted || c.client.dryRun != nil {
+		return nil
+	}
+	interval := c.PollInterval
+	if interval <= 0 {
+		interval = kComposeDefaultPollInterval
+	}
+	for {
+		container, err := c.client.InspectContainer(id)
+		if err != nil {
+			return err
+		}
+		state := container.State
+		switch condition {
+		case ComposeServiceHealthy:
+			switch {
+			case state.Health == nil:
+				return fmt.Errorf("dependency %s has no healthcheck configured", service)
+			case strings.EqualFold(state.Health.Status, "healthy"):
+				return nil
+			case strings.EqualFold(state.Health.Status, "unhealthy"):
+				return fmt.Errorf("dependency %s is unhealthy", service)
+			case !state.Running && !state.Restarting:
+				return fmt.Errorf("dependency %s exited with code %d", service, state.ExitCode)
+			}
+		case ComposeServiceCompletedSuccessfully:
+			if !state.Running && !state.Restarting {
+				if state.ExitCode != 0 {
+					return fmt.Errorf("dependency %s didn't complete successfully, exit code %d", service, state.ExitCode)
+				}
+				return nil
+			}
+		default:
+			return fmt.Errorf("unknown condition %q of dependency %s", condition, service)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// Ps returns the containers of the project in any state, sorted by the services and the numbers
+func (c *Compose) Ps() ([]ComposeContainer, error) {
+	filters := NewFilters().Label(kComposeProjectLabel, c.Project.Name)
+	containers, err := c.client.ListContainersWithOptions(ListContainersOptions{All: true, Filters: filters})
+	if err != nil {
+		return nil, err
+	}
+	ret := make([]ComposeContainer, 0, len(containers))
+	for _, container := range containers {
+		number, _ := strconv.Atoi(container.Labels[kComposeContainerNumberLabel])
+		ret = append(ret, ComposeContainer{
+			Service:   container.Labels[kComposeServiceLabel],
+			Number:    number,
+			Container: container,
+		})
+	}
+	sort.Slice(ret, func(i, j int) bool {
+		if ret[i].Service != ret[j].Service {
+			return ret[i].Service < ret[j].Service
+		}
+		return ret[i].Number < ret[j].Number
+	})
+	return ret, nil
+}
+
+// Down stops and removes the containers of the project in the reverse dependency order, the containers
+// of the services not in the project any more are removed first. Then the networks of the project are
+// removed, and the volumes too if removeVolumes, including the anonymous volumes of the containers.
+// The external networks and volumes are kept.
+func (c *Compose) Down(ctx context.Context, removeVolumes bool) error {
+	containers, err := c.Ps()
+	if err != nil {
+		return err
+	}
+	order, err := c.Project.ServiceOrder()
+	if err != nil {
+		return err
+	}
+	rank := make(map[string]int, len(order))
+	for i, name := range order {
+		rank[name] = i + 1
+	}
+	// the orphans are ranked the last, so they are removed first
+	sort.SliceStable(containers, func(i, j int) bool {
+		a, b := rank[containers[i].Service], rank[containers[j].Service]
+		if a == 0 || b == 0 {
+			return a == 0 && b != 0
+		}
+		return a > b
+	})
+	for _, container := range containers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		timeout := kComposeDefaultStopTimeout
+		if service, ok := c.Project.Services[container.Service]; ok && service.StopGracePeriod > 0 {
+			timeout = service.StopGracePeriod
+		}
+		if container.Container.State == "running" || container.Container.State == "paused" || container.Container.State == "restarting" {
+			if err := c.client.StopContainer(container.Container.Id, int(timeout/time.Second)); err != nil && !IsNotFound(err) {
+				return err
+			}
+		}
+		if err := c.client.RemoveContainer(container.Container.Id, true, removeVolumes); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+
+	filters := NewFilters().Label(kComposeProjectLabel, c.Project.Name)
+	networks, err := c.client.ListNetworks(filters)
+	if err != nil {
+		return err
+	}
+	for _, network := range networks {
+		if err := c.client.RemoveNetwork(network.Id); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	if !removeVolumes {
+		return nil
+	}
+	volumes, err := c.client.ListVolumes(filters)
+	if err != nil {
+		return err
+	}
+	for _, volume := range volumes {
+		if err := c.client.RemoveVolume(volume.Name, false); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,873 @@
+package adoc
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This part contains the loader of the docker-compose files, the v2 and v3 formats share the subset of
+// the services, networks, volumes, depends_on, healthcheck and labels, e.g.
+//   services:
+//     db:
+//       image: postgres:13
+//       environment: {POSTGRES_PASSWORD: "${DB_PASSWORD:?the password is required}"}
+//       volumes: ["data:/var/lib/postgresql/data"]
+//       healthcheck: {test: pg_isready -U postgres, interval: 2s}
+//     web:
+//       image: web:${WEB_VERSION:-latest}
+//       ports: ["8080:80"]
+//       depends_on:
+//         db: {condition: service_healthy}
+//   volumes:
+//     data:
+// The unsupported keys like the build are reported as the errors, the x- extension keys are ignored.
+// The variables are interpolated from the environment and the .env file beside the compose file.
+
+const (
+	ComposeServiceStarted               = "service_started"
+	ComposeServiceHealthy               = "service_healthy"
+	ComposeServiceCompletedSuccessfully = "service_completed_successfully"
+
+	kComposeDefaultNetwork = "default"
+)
+
+var (
+	kComposeProjectNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+	kComposeUnsupportedKeys  = []string{"build", "blkio_config", "extends", "profiles", "env_file", "secrets", "configs", "deploy", "links", "external_links", "volumes_from"}
+)
+
+// ComposeProject is the loaded compose file, the services, networks and volumes are by their keys in the file
+type ComposeProject struct {
+	Name     string
+	Services map[string]ComposeService
+	Networks map[string]ComposeNetwork
+	Volumes  map[string]ComposeVolume
+}
+
+// ComposeService is the service of the compose file in the Engine API configs, the named volumes in the
+// Mounts and the NetworkMode of the service:name are resolved into the names on the daemon
+type ComposeService struct {
+	Name            string
+	ContainerName   string                           // default to <project>-<service>-1
+	Pull            string                           // PullMissing (default), PullAlways or PullNever
+	DependsOn       map[string]ComposeDependency     // by the service name
+	Networks        map[string]ComposeServiceNetwork // by the network key of the project
+	StopGracePeriod time.Duration
+	Config          ContainerConfig
+	HostConfig      HostConfig
+}
+
+type ComposeDependency struct {
+	Condition string `json:"condition"` // service_started (default), service_healthy or service_completed_successfully
+}
+
+type ComposeServiceNetwork struct {
+	Aliases     []string `json:"aliases"`
+	IPv4Address string   `json:"ipv4_address"`
+	IPv6Address string   `json:"ipv6_address"`
+}
+
+// ComposeNetwork is the network of the project, the Name is default to <project>_<key>
+type ComposeNetwork struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driver_opts"`
+	External   bool              `json:"external"` // the network is not created or removed by the project
+	Internal   bool              `json:"internal"`
+	Attachable bool              `json:"attachable"`
+	EnableIPv6 bool              `json:"enable_ipv6"`
+	Labels     map[string]string `json:"labels"`
+}
+
+// ComposeVolume is the volume of the project, the Name is default to <project>_<key>
+type ComposeVolume struct {
+	Name       string            `json:"name"`
+	Driver     string            `json:"driver"`
+	DriverOpts map[string]string `json:"driver_opts"`
+	External   bool              `json:"external"` // the volume is not created or removed by the project
+	Labels     map[string]string `json:"labels"`
+}
+
+// ComposeOptions are the options to parse the compose file
+type ComposeOptions struct {
+	ProjectName string                          // overrides the name in the file, default to the name of the WorkingDir
+	WorkingDir  string                          // the relative bind sources are from here, default to the current dir
+	LookupEnv   func(key string) (string, bool) // default to os.LookupEnv
+}
+
+// LoadComposeProject loads the compose file, the project name is the name in the file or the name of its dir.
+// The .env file in the same dir is used for the variables not in the environment.
+func LoadComposeProject(path string) (ComposeProject, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ComposeProject{}, err
+	}
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return ComposeProject{}, err
+	}
+	dotEnv, err := readDotEnv(filepath.Join(dir, ".env"))
+	if err != nil {
+		return ComposeProject{}, err
+	}
+	lookupEnv := func(key string) (string, bool) {
+		if value, ok := os.LookupEnv(key); ok {
+			return value, true
+		}
+		value, ok := dotEnv[key]
+		return value, ok
+	}
+	return ParseComposeProject(filepath.Base(path), data, ComposeOptions{WorkingDir: dir, LookupEnv: lookupEnv})
+}
+
+// readDotEnv reads the KEY=value lines, the missing file is fine
+func readDotEnv(path string) (map[string]string, error) {
+	env := make(map[string]string)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return env, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "export "), "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("Invalid line %q of %s, should be KEY=value", line, path)
+		}
+		value := strings.TrimSpace(parts[1])
+		if unquoted, err := strconv.Unquote(value); err == nil && strings.HasPrefix(value, `"`) {
+			value = unquoted
+		} else if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+			value = value[1 : len(value)-1]
+		}
+		env[strings.TrimSpace(parts[0])] = value
+	}
+	return env, scanner.Err()
+}
+
+// ParseComposeProject parses the compose document, the file is used in the errors.
+// The error is the *SpecErrors if the document is invalid.
+func ParseComposeProject(file string, data []byte, opts ComposeOptions) (ComposeProject, error) {
+	project := ComposeProject{
+		Services: make(map[string]ComposeService),
+		Networks: make(map[string]ComposeNetwork),
+		Volumes:  make(map[string]ComposeVolume),
+	}
+	if opts.WorkingDir == "" {
+		dir, err := os.Getwd()
+		if err != nil {
+			return project, err
+		}
+		opts.WorkingDir = dir
+	}
+	d := &composeDecoder{specDecoder: newSpecDecoder(file, opts.LookupEnv), dir: opts.WorkingDir}
+	root, err := d.parse(data)
+	if err != nil {
+		return project, err
+	}
+	d.decodeProject(root, &project)
+	if opts.ProjectName != "" {
+		project.Name = opts.ProjectName
+	} else if project.Name == "" {
+		project.Name = normalizeProjectName(filepath.Base(opts.WorkingDir))
+	}
+	if !kComposeProjectNameRegex.MatchString(project.Name) {
+		at := root
+		if node := root.lookup("name"); node != nil && opts.ProjectName == "" {
+			at = node
+		}
+		d.fail(at, "name", "the project name %q should match %s", project.Name, kComposeProjectNameRegex)
+	}
+	if len(d.errors) == 0 {
+		d.resolve(root, &project)
+	}
+	return project, d.err()
+}
+
+// normalizeProjectName turns the dir name into the project name like the compose does
+func normalizeProjectName(name string) string {
+	var b strings.Builder
+	for _, c := range strings.ToLower(name) {
+		if (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9') || c == '_' || c == '-' {
+			b.WriteRune(c)
+		}
+	}
+	return strings.TrimLeft(b.String(), "_-")
+}
+
+type composeDecoder struct {
+	*specDecoder
+	dir string
+}
+
+func (d *composeDecoder) decodeProject(root *specNode, project *ComposeProject) {
+	if root.isNull() {
+		d.fail(root, "services", "the services are required")
+		return
+	}
+	for i, key := range root.keys {
+		value := root.items[i]
+		switch {
+		case key.value == "version":
+			// the v2 and v3 files are the same for the subset
+		case key.value == "name":
+			d.decode(value, reflect.ValueOf(&project.Name).Elem(), "name", "")
+		case key.value == "services":
+			if !d.isMap(value, "services") {
+				continue
+			}
+			for j, name := range value.keys {
+				project.Services[name.value] = d.decodeService(name.value, value.items[j])
+			}
+		case key.value == "networks":
+			d.decode(value, reflect.ValueOf(&project.Networks).Elem(), "networks", "")
+		case key.value == "volumes":
+			d.decode(value, reflect.ValueOf(&project.Volumes).Elem(), "volumes", "")
+		case strings.HasPrefix(key.value, "x-"):
+		case key.value == "secrets" || key.value == "configs":
+			d.fail(key, key.value, "is not supported")
+		default:
+			d.fail(key, key.value, "unknown field")
+		}
+	}
+	if len(project.Services) == 0 && len(d.errors) == 0 {
+		d.fail(root, "services", "the services are required")
+	}
+}
+
+func (d *composeDecoder) isMap(node *specNode, field string) bool {
+	if node.kind != kSpecMap {
+		d.fail(node, field, "should be a map, not a %s", node.kindName())
+		return false
+	}
+	return true
+}
+
+// the service keys decoded into the fields, with the names of the fields for the parsers of the spec,
+// like Resources.Memory
+var kComposeServiceFields = map[string]func(s *ComposeService) (interface{}, string){
+	"image":          func(s *ComposeService) (interface{}, string) { return &s.Config.Image, "" },
+	"container_name": func(s *ComposeService) (interface{}, string) { return &s.ContainerName, "" },
+	"pull_policy":    func(s *ComposeService) (interface{}, string) { return &s.Pull, "" },
+	"command":        func(s *ComposeService) (interface{}, string) { return &s.Config.Cmd, "ContainerConfig.Cmd" },
+	"entrypoint": func(s *ComposeService) (interface{}, string) {
+		return &s.Config.Entrypoint, "ContainerConfig.Entrypoint"
+	},
+	"labels": func(s *ComposeService) (interface{}, string) { return &s.Config.Labels, "" },
+	"expose": func(s *ComposeService) (interface{}, string) {
+		return &s.Config.ExposedPorts, "ContainerConfig.ExposedPorts"
+	},
+	"working_dir":       func(s *ComposeService) (interface{}, string) { return &s.Config.WorkingDir, "" },
+	"user":              func(s *ComposeService) (interface{}, string) { return &s.Config.User, "" },
+	"hostname":          func(s *ComposeService) (interface{}, string) { return &s.Config.Hostname, "" },
+	"domainname":        func(s *ComposeService) (interface{}, string) { return &s.Config.Domainname, "" },
+	"mac_address":       func(s *ComposeService) (interface{}, string) { return &s.Config.MacAddress, "" },
+	"tty":               func(s *ComposeService) (interface{}, string) { return &s.Config.Tty, "" },
+	"stdin_open":        func(s *ComposeService) (interface{}, string) { return &s.Config.OpenStdin, "" },
+	"stop_signal":       func(s *ComposeService) (interface{}, string) { return &s.Config.StopSignal, "" },
+	"stop_grace_period": func(s *ComposeService) (interface{}, string) { return &s.StopGracePeriod, "" },
+	"network_mode":      func(s *ComposeService) (interface{}, string) { return &s.HostConfig.NetworkMode, "" },
+	"restart": func(s *ComposeService) (interface{}, string) {
+		return &s.HostConfig.RestartPolicy, "HostConfig.RestartPolicy"
+	},
+	"privileged":   func(s *ComposeService) (interface{}, string) { return &s.HostConfig.Privileged, "" },
+	"read_only":    func(s *ComposeService) (interface{}, string) { return &s.HostConfig.ReadonlyRootfs, "" },
+	"cap_add":      func(s *ComposeService) (interface{}, string) { return &s.HostConfig.CapAdd, "" },
+	"cap_drop":     func(s *ComposeService) (interface{}, string) { return &s.HostConfig.CapDrop, "" },
+	"dns":          func(s *ComposeService) (interface{}, string) { return &s.HostConfig.Dns, "" },
+	"dns_search":   func(s *ComposeService) (interface{}, string) { return &s.HostConfig.DnsSearch, "" },
+	"security_opt": func(s *ComposeService) (interface{}, string) { return &s.HostConfig.SecurityOpt, "" },
+	"ipc":          func(s *ComposeService) (interface{}, string) { return &s.HostConfig.IpcMode, "" },
+	"pid":          func(s *ComposeService) (interface{}, string) { return &s.HostConfig.PidMode, "" },
+	"devices":      func(s *ComposeService) (interface{}, string) { return &s.HostConfig.Devices, "Resources.Devices" },
+	"mem_limit":    func(s *ComposeService) (interface{}, string) { return &s.HostConfig.Memory, "Resources.Memory" },
+	"mem_reservation": func(s *ComposeService) (interface{}, string) {
+		return &s.HostConfig.MemoryReservation, "Resources.MemoryReservation"
+	},
+	"memswap_limit": func(s *ComposeService) (interface{}, string) { return &s.HostConfig.MemorySwap, "Resources.MemorySwap" },
+	"cpu_shares":    func(s *ComposeService) (interface{}, string) { return &s.HostConfig.CPUShares, "" },
+	"cpuset":        func(s *ComposeService) (interface{}, string) { return &s.HostConfig.CpusetCpus, "" },
+	"pids_limit":    func(s *ComposeService) (interface{}, string) { return &s.HostConfig.PidsLimit, "" },
+}
+
+func (d *composeDecoder) decodeService(name string, node *specNode) ComposeService {
+	service := ComposeService{Name: name}
+	field := "services." + name
+	if !d.isMap(node, field) {
+		return service
+	}
+	for i, key := range node.keys {
+		value := node.items[i]
+		keyField := field + "." + key.value
+		if fieldOf, ok := kComposeServiceFields[key.value]; ok {
+			target, goName := fieldOf(&service)
+			d.decode(value, reflect.ValueOf(target).Elem(), keyField, goName)
+			continue
+		}
+		if value.isNull() {
+			continue
+		}
+		switch {
+		case key.value == "environment":
+			if value.kind == kSpecMap {
+				d.decodeEnvMap(value, reflect.ValueOf(&service.Config.Env).Elem(), keyField)
+			} else {
+				d.decodeEnvList(value, &service, keyField)
+			}
+		case key.value == "depends_on":
+			d.decodeDependsOn(value, &service, keyField)
+		case key.value == "cpus":
+			if value.kind != kSpecScalar {
+				d.fail(value, keyField, "should be a number, not a %s", value.kindName())
+			} else {
+				d.decodeParsed(value, reflect.ValueOf(&service.HostConfig.NanoCPUs).Elem(), keyField, kSpecFieldAliases["cpus"].parse)
+			}
+		case key.value == "ports":
+			d.decodePorts(value, &service, keyField)
+		case key.value == "volumes":
+			d.decodeServiceVolumes(value, &service, keyField)
+		case key.value == "tmpfs":
+			d.decodeTmpfs(value, &service, keyField)
+		case key.value == "networks":
+			d.decodeServiceNetworks(value, &service, keyField)
+		case key.value == "healthcheck":
+			d.decodeHealthcheck(value, &service, keyField)
+		case key.value == "ulimits":
+			d.decodeUlimits(value, &service, keyField)
+		case key.value == "extra_hosts":
+			d.decodeExtraHosts(value, &service, keyField)
+		case key.value == "logging":
+			var logging struct {
+				Driver  string            `json:"driver"`
+				Options map[string]string `json:"options"`
+			}
+			d.decode(value, reflect.ValueOf(&logging).Elem(), keyField, "")
+			service.HostConfig.LogConfig = LogConfig{Type: logging.Driver, Config: logging.Options}
+		case strings.HasPrefix(key.value, "x-"):
+		case containsString(kComposeUnsupportedKeys, key.value):
+			d.fail(key, keyField, "is not supported")
+		default:
+			d.fail(key, keyField, "unknown field")
+		}
+	}
+	return service
+}
+
+// decodePorts takes the short syntax like docker run -p, or the long syntax with the target, published,
+// host_ip and protocol
+func (d *composeDecoder) decodePorts(node *specNode, service *ComposeService, field string) {
+	if node.kind != kSpecSeq {
+		d.fail(node, field, "should be a list, not a %s", node.kindName())
+		return
+	}
+	for i, item := range node.items {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		spec := item.value
+		if item.kind == kSpecMap {
+			var port struct {
+				Target    string `json:"target"`
+				Published string `json:"published"`
+				HostIp    string `json:"host_ip"`
+				Protocol  string `json:"protocol"`
+				Mode      string `json:"mode"`
+			}
+			d.decode(item, reflect.ValueOf(&port).Elem(), itemField, "")
+			if port.Target == "" {
+				d.fail(item, itemField, "the target is required")
+				continue
+			}
+			if port.Mode != "" && port.Mode != "host" && port.Mode != "ingress" {
+				d.fail(item.lookup("mode"), itemField+".mode", "should be host or ingress")
+				continue
+			}
+			spec = port.Target
+			if port.Published != "" || port.HostIp != "" {
+				spec = port.Published + ":" + spec
+			}
+			if ip := port.HostIp; ip != "" {
+				if strings.Contains(ip, ":") {
+					ip = "[" + ip + "]"
+				}
+				spec = ip + ":" + spec
+			}
+			if port.Protocol != "" {
+				spec += "/" + port.Protocol
+			}
+		} else if item.kind != kSpecScalar || item.isNull() {
+			d.fail(item, itemField, "should be a port spec or a map")
+			continue
+		}
+		exposed, bindings, err := parsePortSpec(spec)
+		if err != nil {
+			d.fail(item, itemField, "%s", err)
+			continue
+		}
+		if service.Config.ExposedPorts == nil {
+			service.Config.ExposedPorts = make(map[string]struct{})
+			service.HostConfig.PortBindings = make(map[string][]PortBinding)
+		}
+		for _, port := range exposed {
+			service.Config.ExposedPorts[port] = struct{}{}
+		}
+		for port, binding := range bindings {
+			service.HostConfig.PortBindings[port] = append(service.HostConfig.PortBindings[port], binding...)
+		}
+	}
+}
+
+// decodeServiceVolumes takes the short syntax [source:]target[:mode], or the long syntax with the type, source,
+// target and read_only, the source starting with the / or . is the bind, otherwise it is the volume key of
+// the project. The volumes are in the Mounts, the anonymous ones are in the Config.Volumes.
+func (d *composeDecoder) decodeServiceVolumes(node *specNode, service *ComposeService, field string) {
+	if node.kind != kSpecSeq {
+		d.fail(node, field, "should be a list, not a %s", node.kindName())
+		return
+	}
+	for i, item := range node.items {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		var mount Mount
+		relabel := ""
+		switch {
+		case item.kind == kSpecMap:
+			var long struct {
+				Type     string `json:"type"`
+				Source   string `json:"source"`
+				Target   string `json:"target"`
+				ReadOnly bool   `json:"read_only"`
+				Volume   struct {
+					NoCopy bool `json:"nocopy"`
+				} `json:"volume"`
+				Bind struct {
+					Propagation string `json:"propagation"`
+				} `json:"bind"`
+				Tmpfs struct {
+					Size string `json:"size"`
+				} `json:"tmpfs"`
+			}
+			d.decode(item, reflect.ValueOf(&long).Elem(), itemField, "")
+			mount = Mount{Type: long.Type, Source: long.Source, Target: long.Target, ReadOnly: long.ReadOnly}
+			switch long.Type {
+			case "volume":
+				if long.Volume.NoCopy {
+					mount.VolumeOptions = &VolumeOptions{NoCopy: true}
+				}
+			case "bind":
+				if long.Bind.Propagation != "" {
+					mount.BindOptions = &BindOptions{Propagation: long.Bind.Propagation}
+				}
+			case "tmpfs":
+				if long.Tmpfs.Size != "" {
+					size, err := parseSpecSize(long.Tmpfs.Size)
+					if err != nil {
+						d.fail(item, itemField+".tmpfs.size", "%s", err)
+						continue
+					}
+					mount.TmpfsOptions = &TmpfsOptions{SizeBytes: size.(int64)}
+				}
+			default:
+				d.fail(item, itemField+".type", "should be one of volume, bind, tmpfs")
+				continue
+			}
+		case item.kind == kSpecScalar && !item.isNull():
+			parts := strings.Split(item.value, ":")
+			if len(parts) == 1 {
+				mount = Mount{Type: "volume", Target: parts[0]}
+				break
+			}
+			if len(parts) > 3 {
+				d.fail(item, itemField, "should be [source:]target[:mode]")
+				continue
+			}
+			mount = Mount{Type: "volume", Source: parts[0], Target: parts[1]}
+			if len(parts) == 3 {
+				for _, mode := range strings.Split(parts[2], ",") {
+					switch mode {
+					case "ro":
+						mount.ReadOnly = true
+					case "rw":
+					case "nocopy":
+						mount.VolumeOptions = &VolumeOptions{NoCopy: true}
+					case "z", "Z":
+						relabel = mode
+					default:
+						d.fail(item, itemField, "unsupported mode %q", mode)
+					}
+				}
+			}
+		default:
+			d.fail(item, itemField, "should be a volume spec or a map")
+			continue
+		}
+		if !strings.HasPrefix(mount.Target, "/") {
+			d.fail(item, itemField, "the target %q should be an absolute path", mount.Target)
+			continue
+		}
+		if mount.Source == "~" || strings.HasPrefix(mount.Source, "~/") {
+			home, ok := d.lookupEnv("HOME")
+			if !ok || home == "" {
+				var err error
+				if home, err = os.UserHomeDir(); err != nil {
+					d.fail(item, itemField, "cannot expand the source %q, %s", mount.Source, err)
+					continue
+				}
+			}
+			mount.Source = filepath.Join(home, mount.Source[1:])
+		}
+		if mount.Type == "volume" && (strings.HasPrefix(mount.Source, "/") || strings.HasPrefix(mount.Source, ".")) {
+			mount.Type = "bind"
+		}
+		if mount.Type == "bind" && !filepath.IsAbs(mount.Source) {
+			mount.Source = filepath.Join(d.dir, mount.Source)
+		}
+		if relabel != "" {
+			// the mounts api has no selinux relabeling, only the binds have it
+			if mount.Type != "bind" {
+				d.fail(item, itemField, "the %q mode is only supported by the bind mounts", relabel)
+				continue
+			}
+			bind := mount.Source + ":" + mount.Target + ":" + relabel
+			if mount.ReadOnly {
+				bind += ",ro"
+			}
+			service.HostConfig.Binds = append(service.HostConfig.Binds, bind)
+			continue
+		}
+		if mount.Type == "volume" && mount.Source == "" {
+			// the anonymous volume
+			if service.Config.Volumes == nil {
+				service.Config.Volumes = make(map[string]struct{})
+			}
+			service.Config.Volumes[mount.Target] = struct{}{}
+			continue
+		}
+		service.HostConfig.Mounts = append(service.HostConfig.Mounts, mount)
+	}
+}
+
+func (d *composeDecoder) decodeTmpfs(node *specNode, service *ComposeService, field string) {
+	var paths []string
+	if node.kind == kSpecScalar {
+		paths = []string{node.value}
+	} else {
+		d.decode(node, reflect.ValueOf(&paths).Elem(), field, "")
+	}
+	for i, path := range paths {
+		parts := strings.SplitN(path, ":", 2)
+		if !strings.HasPrefix(parts[0], "/") {
+			pathField := field
+			if node.kind == kSpecSeq {
+				pathField = fmt.Sprintf("%s[%d]", field, i)
+			}
+			d.fail(node, pathField, "the path %q should be absolute", parts[0])
+			continue
+		}
+		if len(parts) == 1 {
+			parts = append(parts, "")
+		}
+		if service.HostConfig.Tmpfs == nil {
+			service.HostConfig.Tmpfs = make(map[string]string)
+		}
+		service.HostConfig.Tmpfs[parts[0]] = parts[1]
+	}
+}
+
+// decodeEnvList takes the KEY=value list, the bare KEY is looked up in the environment like the
+// null value in the map form, and dropped if it is not set
+func (d *composeDecoder) decodeEnvList(node *specNode, service *ComposeService, field string) {
+	var env []string
+	d.decode(node, reflect.ValueOf(&env).Elem(), field, "")
+	for _, item := range env {
+		if !strings.Contains(item, "=") {
+			local, ok := d.lookupEnv(item)
+			if !ok {
+				continue
+			}
+			item = item + "=" + local
+		}
+		service.Config.Env = append(service.Config.Env, item)
+	}
+}
+
+// decodeDependsOn takes the list of the services, or the map with the conditions
+func (d *composeDecoder) decodeDependsOn(node *specNode, service *ComposeService, field string) {
+	service.DependsOn = make(map[string]ComposeDependency)
+	if node.kind == kSpecSeq {
+		var names []string
+		d.decode(node, reflect.ValueOf(&names).Elem(), field, "")
+		for _, name := range names {
+			service.DependsOn[name] = ComposeDependency{Condition: ComposeServiceStarted}
+		}
+		return
+	}
+	d.decode(node, reflect.ValueOf(&service.DependsOn).Elem(), field, "")
+}
+
+// decodeServiceNetworks takes the list of the network keys, or the map with the aliases and the addresses
+func (d *composeDecoder) decodeServiceNetworks(node *specNode, service *ComposeService, field string) {
+	service.Networks = make(map[string]ComposeServiceNetwork)
+	if node.kind == kSpecSeq {
+		var keys []string
+		d.decode(node, reflect.ValueOf(&keys).Elem(), field, "")
+		for _, key := range keys {
+			service.Networks[key] = ComposeServiceNetwork{}
+		}
+		return
+	}
+	d.decode(node, reflect.ValueOf(&service.Networks).Elem(), field, "")
+}
+
+func (d *composeDecoder) decodeHealthcheck(node *specNode, service *ComposeService, field string) {
+	var healthcheck struct {
+		Test        []string      `json:"test" spec:"HealthConfig.Test"`
+		Interval    time.Duration `json:"interval"`
+		Timeout     time.Duration `json:"timeout"`
+		Retries     int           `json:"retries"`
+		StartPeriod time.Duration `json:"start_period"`
+		Disable     bool          `json:"disable"`
+	}
+	d.decode(node, reflect.ValueOf(&healthcheck).Elem(), field, "")
+	if healthcheck.Disable {
+		service.Config.Healthcheck = &HealthConfig{Test: []string{"NONE"}}
+		return
+	}
+	if len(healthcheck.Test) > 0 && !containsString([]string{"CMD", "CMD-SHELL", "NONE"}, healthcheck.Test[0]) {
+		d.fail(node.lookup("test"), field+".test", "the list should start with CMD, CMD-SHELL or NONE")
+	}
+	service.Config.Healthcheck = &HealthConfig{
+		Test:        healthcheck.Test,
+		Interval:    healthcheck.Interval,
+		Timeout:     healthcheck.Timeout,
+		Retries:     healthcheck.Retries,
+		StartPeriod: healthcheck.StartPeriod,
+	}
+}
+
+// decodeUlimits takes the map of the name to the limit, or to the soft and hard limits
+func (d *composeDecoder) decodeUlimits(node *specNode, service *ComposeService, field string) {
+	if !d.isMap(node, field) {
+		return
+	}
+	for i, key := range node.keys {
+		value := node.items[i]
+		keyField := field + "." + key.value
+		var soft, hard string
+		switch value.kind {
+		case kSpecScalar:
+			soft, hard = value.value, value.value
+		case kSpecMap:
+			var limits struct {
+				Soft string `json:"soft"`
+				Hard string `json:"hard"`
+			}
+			d.decode(value, reflect.ValueOf(&limits).Elem(), keyField, "")
+			soft, hard = limits.Soft, limits.Hard
+		default:
+			d.fail(value, keyField, "should be a number or a map, not a %s", value.kindName())
+			continue
+		}
+		ulimit, err := parseUlimit(fmt.Sprintf("%s=%s:%s", key.value, soft, hard))
+		if err != nil {
+			d.fail(value, keyField, "%s", err)
+			continue
+		}
+		service.HostConfig.Ulimits = append(service.HostConfig.Ulimits, ulimit)
+	}
+}
+
+// decodeExtraHosts takes the list of host:ip, or the map of the host to the ip
+func (d *composeDecoder) decodeExtraHosts(node *specNode, service *ComposeService, field string) {
+	if node.kind != kSpecMap {
+		d.decode(node, reflect.ValueOf(&service.HostConfig.ExtraHosts).Elem(), field, "")
+		return
+	}
+	var hosts map[string]string
+	d.decode(node, reflect.ValueOf(&hosts).Elem(), field, "")
+	for _, host := range sortedStringKeys(hosts) {
+		service.HostConfig.ExtraHosts = append(service.HostConfig.ExtraHosts, host+":"+hosts[host])
+	}
+}
+
+// resolve checks the references between the services, networks and volumes, and fills the names
+// of the networks, volumes and containers on the daemon
+func (d *composeDecoder) resolve(root *specNode, project *ComposeProject) {
+	at := func(path ...string) *specNode {
+		node := root
+		for _, key := range path {
+			next := node.lookup(key)
+			if next == nil {
+				break
+			}
+			node = next
+		}
+		return node
+	}
+	for key, network := range project.Networks {
+		if network.Name == "" {
+			network.Name = project.Name + "_" + key
+			if network.External {
+				network.Name = key
+			}
+		}
+		project.Networks[key] = network
+	}
+	for key, volume := range project.Volumes {
+		if volume.Name == "" {
+			volume.Name = project.Name + "_" + key
+			if volume.External {
+				volume.Name = key
+			}
+		}
+		project.Volumes[key] = volume
+	}
+
+	for _, name := range sortedComposeServices(project.Services) {
+		service := project.Services[name]
+		field := "services." + name
+		if service.Config.Image == "" {
+			d.fail(at("services", name), field+".image", "the image is required")
+		}
+		if service.ContainerName == "" {
+			service.ContainerName = fmt.Sprintf("%s-%s-1", project.Name, name)
+		} else if !kContainerNameRegex.MatchString(service.ContainerName) {
+			d.fail(at("services", name, "container_name"), field+".container_name", "should match %s", kContainerNameRegex)
+		}
+		switch service.Pull {
+		case "", PullMissing, PullAlways, PullNever:
+		case "if_not_present":
+			service.Pull = PullMissing
+		default:
+			d.fail(at("services", name, "pull_policy"), field+".pull_policy", "should be one of missing, always, never")
+		}
+		for dependency, condition := range service.DependsOn {
+			if _, ok := project.Services[dependency]; !ok {
+				d.fail(at("services", name, "depends_on"), field+".depends_on", "the service %q is not defined", dependency)
+			}
+			if condition.Condition == "" {
+				condition.Condition = ComposeServiceStarted
+				service.DependsOn[dependency] = condition
+			} else if !containsString([]string{ComposeServiceStarted, ComposeServiceHealthy, ComposeServiceCompletedSuccessfully}, condition.Condition) {
+				d.fail(at("services", name, "depends_on", dependency), field+".depends_on."+dependency+".condition",
+					"should be one of service_started, service_healthy, service_completed_successfully")
+			}
+		}
+
+		mode := service.HostConfig.NetworkMode
+		switch {
+		case mode != "" && len(service.Networks) > 0:
+			d.fail(at("services", name, "network_mode"), field+".network_mode", "should not be with the networks")
+		case strings.HasPrefix(mode, "service:"):
+			dependency := strings.TrimPrefix(mode, "service:")
+			if _, ok := project.Services[dependency]; !ok {
+				d.fail(at("services", name, "network_mode"), field+".network_mode", "the service %q is not defined", dependency)
+				break
+			}
+			if service.DependsOn == nil {
+				service.DependsOn = make(map[string]ComposeDependency)
+			}
+			if _, ok := service.DependsOn[dependency]; !ok {
+				service.DependsOn[dependency] = ComposeDependency{Condition: ComposeServiceStarted}
+			}
+		case mode == "" && len(service.Networks) == 0:
+			service.Networks = map[string]ComposeServiceNetwork{kComposeDefaultNetwork: {}}
+		}
+		for key := range service.Networks {
+			if _, ok := project.Networks[key]; !ok {
+				if key != kComposeDefaultNetwork {
+					d.fail(at("services", name, "networks"), field+".networks", "the network %q is not defined", key)
+					continue
+				}
+				project.Networks[key] = ComposeNetwork{Name: project.Name + "_" + key}
+			}
+		}
+		for i, mount := range service.HostConfig.Mounts {
+			if mount.Type != "volume" {
+				continue
+			}
+			volume, ok := project.Volumes[mount.Source]
+			if !ok {
+				d.fail(at("services", name, "volumes"), field+".volumes", "the volume %q is not defined", mount.Source)
+				continue
+			}
+			service.HostConfig.Mounts[i].Source = volume.Name
+		}
+		project.Services[name] = service
+	}
+
+	// the network_mode of the service:name needs the container names of all the services
+	for name, service := range project.Services {
+		if mode := service.HostConfig.NetworkMode; strings.HasPrefix(mode, "service:") {
+			if dependency, ok := project.Services[strings.TrimPrefix(mode, "service:")]; ok {
+				service.HostConfig.NetworkMode = "container:" + dependency.ContainerName
+				project.Services[name] = service
+			}
+		}
+	}
+	if _, err := project.ServiceOrder(); err != nil {
+		d.fail(at("services"), "services", "%s", err)
+	}
+}
+
+func sortedComposeServices(services map[string]ComposeService) []string {
+	names := make([]string, 0, len(services))
+	for name := range services {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ServiceOrder returns the services in the dependency order, the services of the same depth are sorted
+// by their names, the error is for the dependency cycle
+func (project ComposeProject) ServiceOrder() ([]string, error) {
+	var order []string
+	done := make(map[string]bool)
+	visiting := make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("dependency cycle %s", strings.Join(append(path, name), " -> "))
+		}
+		visiting[name] = true
+		dependencies := make([]string, 0, len(project.Services[name].DependsOn))
+		for dependency := range project.Services[name].DependsOn {
+			dependencies = append(dependencies, dependency)
+		}
+		sort.Strings(dependencies)
+		for _, dependency := range dependencies {
+			if _, ok := project.Services[dependency]; !ok {
+				continue
+			}
+			if err := visit(dependency, append(path, name)); err != nil {
+				return err
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		order = append(order, name)
+		return nil
+	}
+	for _, name := range sortedComposeServices(project.Services) {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
@@ -0,0 +1,354 @@
+package adoc
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+const kTestComposeYAML = `version: "3.8"
+services:
+  db:
+    image: postgres:13
+    environment:
+      POSTGRES_PASSWORD: ${DB_PASSWORD:?the password is required}
+    volumes:
+      - data:/var/lib/postgresql/data
+      - /var/run/postgresql
+    healthcheck:
+      test: pg_isready -U postgres
+      interval: 2s
+      retries: 5
+    networks: [backend]
+  migrate:
+    image: web:${WEB_VERSION:-latest}
+    command: ./manage.py migrate
+    depends_on:
+      db: {condition: service_healthy}
+    networks: [backend]
+  web:
+    image: web:${WEB_VERSION:-latest}
+    ports:
+      - "8080:80"
+      - {target: 443, published: 8443, host_ip: 127.0.0.1}
+    environment: [MODE=prod, DB_PASSWORD, SENTRY_DSN]
+    labels: {app: web}
+    volumes: ["./static:/srv/static:ro"]
+    depends_on:
+      db:
+        condition: service_healthy
+      migrate:
+        condition: service_completed_successfully
+    networks:
+      backend:
+        aliases: [api]
+      shared:
+    restart: unless-stopped
+    mem_limit: 512m
+    cpus: 0.5
+    ulimits:
+      nofile: {soft: 1024, hard: 2048}
+    stop_grace_period: 3s
+    x-notes: ignored
+networks:
+  backend:
+  shared:
+    external: true
+volumes:
+  data:
+x-common: {ignored: true}
+`
+
+func TestParseComposeProject(t *testing.T) {
+	project, err := ParseComposeProject("docker-compose.yml", []byte(kTestComposeYAML), ComposeOptions{
+		ProjectName: "shop",
+		WorkingDir:  "/srv/shop",
+		LookupEnv:   testLookupEnv(map[string]string{"DB_PASSWORD": "secret"}),
+	})
+	if err != nil {
+		t.Fatalf("Cannot parse the compose file, %s", err)
+	}
+	if order, _ := project.ServiceOrder(); !reflect.DeepEqual(order, []string{"db", "migrate", "web"}) {
+		t.Errorf("Wrong service order, %v", order)
+	}
+	if project.Networks["backend"].Name != "shop_backend" || project.Networks["shared"].Name != "shared" || project.Volumes["data"].Name != "shop_data" {
+		t.Errorf("Wrong names of the networks and volumes, %+v, %+v", project.Networks, project.Volumes)
+	}
+
+	db := project.Services["db"]
+	if db.ContainerName != "shop-db-1" || !reflect.DeepEqual(db.Config.Env, []string{"POSTGRES_PASSWORD=secret"}) ||
+		!reflect.DeepEqual(db.Config.Healthcheck.Test, []string{"CMD-SHELL", "pg_isready -U postgres"}) || db.Config.Healthcheck.Interval != 2*time.Second {
+		t.Errorf("Wrong db service, %+v", db)
+	}
+	if len(db.HostConfig.Mounts) != 1 || db.HostConfig.Mounts[0] != (Mount{Type: "volume", Source: "shop_data", Target: "/var/lib/postgresql/data"}) {
+		t.Errorf("Wrong db mounts, %+v", db.HostConfig.Mounts)
+	}
+	if _, ok := db.Config.Volumes["/var/run/postgresql"]; !ok {
+		t.Errorf("The anonymous volume should be in the config, %+v", db.Config.Volumes)
+	}
+
+	web := project.Services["web"]
+	if web.Config.Image != "web:latest" || web.Config.Labels["app"] != "web" || web.HostConfig.RestartPolicy.Name != "unless-stopped" ||
+		web.HostConfig.Memory != 512*MiB || web.HostConfig.NanoCPUs != 500000000 || web.StopGracePeriod != 3*time.Second {
+		t.Errorf("Wrong web service, %+v", web)
+	}
+	bindings := map[string][]PortBinding{"80/tcp": {{HostPort: "8080"}}, "443/tcp": {{HostIp: "127.0.0.1", HostPort: "8443"}}}
+	if !reflect.DeepEqual(web.HostConfig.PortBindings, bindings) || len(web.Config.ExposedPorts) != 2 {
+		t.Errorf("Wrong web ports, %+v", web.HostConfig.PortBindings)
+	}
+	if !reflect.DeepEqual(web.Config.Env, []string{"MODE=prod", "DB_PASSWORD=secret"}) {
+		t.Errorf("The bare keys should be from the environment, %q", web.Config.Env)
+	}
+	if mount := web.HostConfig.Mounts[0]; mount != (Mount{Type: "bind", Source: "/srv/shop/static", Target: "/srv/static", ReadOnly: true}) {
+		t.Errorf("The relative bind should be from the working dir, %+v", mount)
+	}
+	if web.DependsOn["migrate"].Condition != ComposeServiceCompletedSuccessfully || !reflect.DeepEqual(web.Networks["backend"].Aliases, []string{"api"}) {
+		t.Errorf("Wrong web dependencies and networks, %+v, %+v", web.DependsOn, web.Networks)
+	}
+	if ulimit := web.HostConfig.Ulimits[0]; *ulimit != (Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}) {
+		t.Errorf("Wrong web ulimits, %+v", ulimit)
+	}
+
+	// the short forms, the default network and the project name from the file
+	project, err = ParseComposeProject("", []byte(`
+name: tools
+services:
+  cache:
+    image: redis
+    ports: [{target: 6379, published: 6379, mode: host}]
+    volumes: ["~/redis:/data", "./conf:/etc/redis:ro,z"]
+    tmpfs: /run:size=64m
+  app:
+    image: app
+    depends_on: [cache]
+    network_mode: service:cache
+`), ComposeOptions{WorkingDir: "/srv/tools", LookupEnv: testLookupEnv(map[string]string{"HOME": "/home/ops"})})
+	if err != nil {
+		t.Fatalf("Cannot parse the compose file, %s", err)
+	}
+	if project.Name != "tools" || project.Networks["default"].Name != "tools_default" || project.Services["app"].HostConfig.NetworkMode != "container:tools-cache-1" {
+		t.Errorf("Wrong project, %+v", project)
+	}
+	if bindings := project.Services["cache"].HostConfig.PortBindings; !reflect.DeepEqual(bindings, map[string][]PortBinding{"6379/tcp": {{HostPort: "6379"}}}) {
+		t.Errorf("Wrong cache ports, %+v", bindings)
+	}
+	cache := project.Services["cache"]
+	if mounts := cache.HostConfig.Mounts; len(mounts) != 1 || mounts[0] != (Mount{Type: "bind", Source: "/home/ops/redis", Target: "/data"}) {
+		t.Errorf("The ~ source should be a bind from the home, %+v", mounts)
+	}
+	if binds := cache.HostConfig.Binds; !reflect.DeepEqual(binds, []string{"/srv/tools/conf:/etc/redis:z,ro"}) {
+		t.Errorf("The relabeled mount should be a bind, %+v", binds)
+	}
+	if tmpfs := cache.HostConfig.Tmpfs; !reflect.DeepEqual(tmpfs, map[string]string{"/run": "size=64m"}) {
+		t.Errorf("Wrong cache tmpfs, %+v", tmpfs)
+	}
+	if project.Services["app"].DependsOn["cache"].Condition != ComposeServiceStarted {
+		t.Errorf("Wrong default condition, %+v", project.Services["app"].DependsOn)
+	}
+}
+
+func TestParseComposeProjectErrors(t *testing.T) {
+	_, err := ParseComposeProject("docker-compose.yml", []byte(`services:
+  web:
+    image: web
+    build: .
+    imgae: web
+    depends_on:
+      db: {condition: service_ready}
+      cache:
+    networks: [frontend]
+    volumes: [logs:/logs, "data"]
+  db:
+    image: postgres
+secrets: {}
+`), ComposeOptions{ProjectName: "shop", LookupEnv: testLookupEnv(nil)})
+	var specErrs *SpecErrors
+	if !errors.As(err, &specErrs) {
+		t.Fatalf("Should return the SpecErrors, %v", err)
+	}
+	var got []string
+	for _, e := range specErrs.Errors {
+		got = append(got, strings.SplitN(e.Error(), ": ", 3)[0]+" "+e.Field)
+	}
+	need := []string{
+		"docker-compose.yml:4:5 services.web.build",
+		"docker-compose.yml:5:5 services.web.imgae",
+		"docker-compose.yml:10:27 services.web.volumes[1]",
+		"docker-compose.yml:13:1 secrets",
+	}
+	if strings.Join(got, "\n") != strings.Join(need, "\n") {
+		t.Errorf("Wrong compose errors,\n%s", strings.Join(got, "\n"))
+	}
+
+	for _, c := range []struct {
+		doc  string
+		need string
+	}{
+		{"services:\n  web: {image: web, depends_on: [db]}\n", "the service \"db\" is not defined"},
+		{"services:\n  web: {image: web, networks: [front]}\n", "the network \"front\" is not defined"},
+		{"services:\n  web: {image: web, volumes: [\"logs:/logs\"]}\n", "the volume \"logs\" is not defined"},
+		{"services:\n  web:\n    image: web\n    depends_on:\n      db: {condition: service_ready}\n  db: {image: db}\n", "5:11: services.web.depends_on.db.condition: should be one of"},
+		{"services:\n  a: {image: a, depends_on: [b]}\n  b: {image: b, depends_on: [a]}\n", "dependency cycle a -> b -> a"},
+		{"services:\n  web: {command: run}\n", "services.web.image: the image is required"},
+		{"services:\n  web: {image: web, network_mode: host, networks: [default]}\n", "should not be with the networks"},
+		{"name: Shop\nservices:\n  web: {image: web}\n", "the project name \"Shop\" should match"},
+		{"version: '2'\n", "the services are required"},
+		{"services:\n  web: {image: web, ports: [{target: 80, mode: swarm}]}\n", "services.web.ports[0].mode: should be host or ingress"},
+		{"services:\n  web: {image: web, volumes: [\"logs:/logs:Z\"]}\n", "the \"Z\" mode is only supported by the bind mounts"},
+		{"services:\n  web: {image: web, tmpfs: [/run, run]}\n", "services.web.tmpfs[1]: the path \"run\" should be absolute"},
+	} {
+		_, err := ParseComposeProject("", []byte(c.doc), ComposeOptions{ProjectName: "", WorkingDir: "/srv/shop", LookupEnv: testLookupEnv(nil)})
+		if err == nil || !strings.Contains(err.Error(), c.need) {
+			t.Errorf("Wrong error of %q, %v", c.doc, err)
+		}
+	}
+}
+
+func TestComposeUpDown(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "postgres:13"})
+	server.AddImage(adoctest.ImageSpec{Name: "web"})
+	server.SetBehavior("postgres:13", adoctest.Behavior{HealthDelay: 100 * time.Millisecond})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+	if _, err := client.CreateNetwork(NetworkCreate{Name: "shared"}); err != nil {
+		t.Fatalf("Cannot create the external network, %s", err)
+	}
+
+	project, err := ParseComposeProject("docker-compose.yml", []byte(kTestComposeYAML), ComposeOptions{
+		ProjectName: "shop",
+		WorkingDir:  "/srv/shop",
+		LookupEnv:   testLookupEnv(map[string]string{"DB_PASSWORD": "secret"}),
+	})
+	if err != nil {
+		t.Fatalf("Cannot parse the compose file, %s", err)
+	}
+	// the migrate is a job which completes at once
+	project.Services["migrate"] = withImage(project.Services["migrate"], "job")
+	server.AddImage(adoctest.ImageSpec{Name: "job"})
+	server.SetBehavior("job", adoctest.Behavior{Exit: true, Duration: 20 * time.Millisecond})
+
+	compose := client.Compose(project)
+	compose.PollInterval = 10 * time.Millisecond
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := compose.Up(ctx); err != nil {
+		t.Fatalf("Cannot up the project, %s", err)
+	}
+
+	containers, err := compose.Ps()
+	if err != nil || len(containers) != 3 {
+		t.Fatalf("Wrong project containers, %+v, %v", containers, err)
+	}
+	for i, service := range []string{"db", "migrate", "web"} {
+		if containers[i].Service != service || containers[i].Number != 1 || containers[i].Container.Names[0] != "/shop-"+service+"-1" {
+			t.Errorf("Wrong project container, %+v", containers[i])
+		}
+	}
+	db, _ := client.InspectContainer("shop-db-1")
+	web, _ := client.InspectContainer("shop-web-1")
+	if web.State.StartedAt.Sub(db.State.StartedAt) < 100*time.Millisecond {
+		t.Errorf("The web should be started after the db is healthy, %s, %s", db.State.StartedAt, web.State.StartedAt)
+	}
+	if db.State.Health == nil || db.State.Health.Status != "healthy" || db.Config.Labels[kComposeServiceLabel] != "db" {
+		t.Errorf("Wrong db container, %+v", db)
+	}
+	if _, ok := web.NetworkSettings.Networks["shared"]; !ok || !containsString(web.NetworkSettings.Networks["shop_backend"].Aliases, "api") {
+		t.Errorf("The web should be on both networks with the aliases, %+v", web.NetworkSettings.Networks)
+	}
+	network, err := client.InspectNetwork("shop_backend")
+	if err != nil || network.Labels[kComposeProjectLabel] != "shop" || network.Labels[kComposeNetworkLabel] != "backend" {
+		t.Errorf("Wrong project network, %+v, %v", network, err)
+	}
+	if volume, err := client.InspectVolume("shop_data"); err != nil || volume.Labels[kComposeVolumeLabel] != "data" {
+		t.Errorf("Wrong project volume, %+v, %v", volume, err)
+	}
+
+	// up again only starts the stopped containers
+	client.StopContainer("shop-web-1")
+	before := len(server.Requests())
+	if err := compose.Up(ctx); err != nil {
+		t.Fatalf("Cannot up the project again, %s", err)
+	}
+	for _, request := range server.Requests()[before:] {
+		if strings.HasSuffix(request, "/create") {
+			t.Errorf("Should not create again, %s", request)
+		}
+	}
+	if web, _ := client.InspectContainer("shop-web-1"); !web.State.Running {
+		t.Errorf("The stopped web should be started")
+	}
+
+	if err := compose.Down(ctx, true); err != nil {
+		t.Fatalf("Cannot down the project, %s", err)
+	}
+	if containers, _ := compose.Ps(); len(containers) != 0 {
+		t.Errorf("The containers should be removed, %+v", containers)
+	}
+	if _, err := client.InspectNetwork("shop_backend"); !IsNotFound(err) {
+		t.Errorf("The project network should be removed, %v", err)
+	}
+	if _, err := client.InspectNetwork("shared"); err != nil {
+		t.Errorf("The external network should be kept, %v", err)
+	}
+	if _, err := client.InspectVolume("shop_data"); !IsNotFound(err) {
+		t.Errorf("The project volume should be removed, %v", err)
+	}
+}
+
+func TestComposeUpFailedDependency(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "db"})
+	server.AddImage(adoctest.ImageSpec{Name: "web"})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+
+	doc := `services:
+  db: {image: db, healthcheck: {test: [CMD, check]}}
+  web: {image: web, depends_on: {db: {condition: service_healthy}}}
+`
+	project, err := ParseComposeProject("", []byte(doc), ComposeOptions{ProjectName: "failed", LookupEnv: testLookupEnv(nil)})
+	if err != nil {
+		t.Fatalf("Cannot parse the compose file, %s", err)
+	}
+	server.SetBehavior("db", adoctest.Behavior{Health: "unhealthy"})
+	compose := client.Compose(project)
+	compose.PollInterval = 10 * time.Millisecond
+	if err := compose.Up(context.Background()); err == nil || !strings.Contains(err.Error(), "dependency db is unhealthy") {
+		t.Errorf("Should fail on the unhealthy dependency, %v", err)
+	}
+	if _, err := client.InspectContainer("failed-web-1"); !IsNotFound(err) {
+		t.Errorf("The web should not be created, %v", err)
+	}
+
+	// the dry run plans the whole project without waiting
+	plan := &DryRun{}
+	dryClient, _ := NewClient(server.URL, WithAPIVersion("v1.25"), WithDryRun(plan))
+	defer dryClient.Close()
+	if project, err = ParseComposeProject("", []byte(doc), ComposeOptions{ProjectName: "planned", LookupEnv: testLookupEnv(nil)}); err != nil {
+		t.Fatalf("Cannot parse the compose file, %s", err)
+	}
+	if err := dryClient.Compose(project).Up(context.Background()); err != nil {
+		t.Fatalf("Cannot dry run the project, %s", err)
+	}
+	var operations []string
+	for _, action := range plan.Plan() {
+		operations = append(operations, action.Operation)
+	}
+	need := []string{"docker.networks.create", "docker.containers.create", "docker.containers.start", "docker.containers.create", "docker.containers.start"}
+	if !reflect.DeepEqual(operations, need) {
+		t.Errorf("Wrong planned operations, %v", operations)
+	}
+}
+
+func withImage(service ComposeService, image string) ComposeService {
+	service.Config.Image = image
+	return service
+}
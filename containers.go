@@ -5,9 +5,16 @@ import (
 	"fmt"
 	"net/http"
 	"net/url"
+	"strconv"
+	"sync"
 	"time"
 )
 
+const (
+	kDefaultPageSize           = 100
+	kDefaultInspectConcurrency = 8
+)
+
 // This part contains apis for the containers listed in
 // https://docs.docker.com/reference/api/docker_remote_api_v1.17/#21-containers
 
@@ -30,6 +37,8 @@ type Container struct {
 	SizeRootFs int64
 	SizeRw     int64
 	Status     string
+	ImageID    string // v1.21
+	State      string // v1.23
 }
 
 type HealthConfig struct {
@@ -72,6 +81,7 @@ type ContainerConfig struct {
 	OpenStdin       bool
 	PortSpecs       []string
 	StdinOnce       bool
+	StopSignal      string `json:",omitempty"`
 	Tty             bool
 	User            string
 	VolumeDriver    string
@@ -95,6 +105,38 @@ type Ulimit struct {
 	Hard int64
 }
 
+// Mount is the mount of the bind, volume or tmpfs, v1.25
+type Mount struct {
+	Type          string // bind, volume or tmpfs
+	Source        string `json:",omitempty"`
+	Target        string
+	ReadOnly      bool           `json:",omitempty"`
+	Consistency   string         `json:",omitempty"`
+	BindOptions   *BindOptions   `json:",omitempty"`
+	VolumeOptions *VolumeOptions `json:",omitempty"`
+	TmpfsOptions  *TmpfsOptions  `json:",omitempty"`
+}
+
+type BindOptions struct {
+	Propagation string `json:",omitempty"`
+}
+
+type VolumeOptions struct {
+	NoCopy       bool              `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	DriverConfig *VolumeDriver     `json:",omitempty"`
+}
+
+type VolumeDriver struct {
+	Name    string            `json:",omitempty"`
+	Options map[string]string `json:",omitempty"`
+}
+
+type TmpfsOptions struct {
+	SizeBytes int64  `json:",omitempty"`
+	Mode      uint32 `json:",omitempty"` // the file mode like 01777
+}
+
 type LogConfig struct {
 	Type   string
 	Config map[string]string
@@ -105,6 +147,7 @@ type Resources struct {
 	// Applicable to all platforms
 	CPUShares int64 `json:"CpuShares"` // CPU shares (relative weight vs. other containers)
 	Memory    int64 // Memory limit (in bytes)
+	NanoCPUs  int64 `json:"NanoCpus"` // CPU quota in units of 1e-9 CPUs, v1.25
 
 	// Applicable to UNIX platforms
 	CgroupParent         string // Parent cgroup.
@@ -156,7 +199,9 @@ type HostConfig struct {
 	RestartPolicy   RestartPolicy
 	SecurityOpt     []string
 	VolumesFrom     []string
-	LogConfig       LogConfig // 1.18
+	LogConfig       LogConfig         // 1.18
+	Tmpfs           map[string]string `json:",omitempty"` // v1.22, the mount options by the path
+	Mounts          []Mount           `json:",omitempty"` // v1.25
 
 	// Contains container's resources (cgroups, ulimits)
 	Resources
@@ -168,8 +213,10 @@ type PortBinding struct {
 }
 
 type Networks struct {
-	Gateway   string
-	IPAddress string
+	Gateway    string
+	IPAddress  string
+	IPAMConfig *IPAMConfig // the static addresses of the user defined network
+	Aliases    []string
 }
 
 type NetworkSettings struct {
@@ -227,6 +274,18 @@ type GraphDriverData struct {
 	Name string `json:"Name"`
 }
 
+// MountPoint is the mount of the inspected container, the Name is of the volume
+type MountPoint struct {
+	Type        string
+	Name        string
+	Source      string
+	Destination string
+	Driver      string
+	Mode        string
+	RW          bool
+	Propagation string
+}
+
 // ContainerDetail defines the detail data of the container from inspection, including the swarm node infor
 type ContainerDetail struct {
 	AppArmorProfile string
@@ -244,6 +303,7 @@ type ContainerDetail struct {
 	Image           string
 	LogPath         string
 	MountLabel      string
+	Mounts          []MountPoint // v1.20
 	Name            string
 	NetworkSettings NetworkSettings
 	Path            string
@@ -269,6 +329,7 @@ type IPAMConfig struct {
 
 type EndpointConfig struct {
 	IPAMConfig IPAMConfig
+	Aliases    []string `json:",omitempty"`
 }
 
 type NetworkingConfig struct {
@@ -281,6 +342,9 @@ func (client *DockerClient) ListContainers(showAll, showSize bool, filters ...st
 	v.Set("all", formatBoolToIntString(showAll))
 	v.Set("size", formatBoolToIntString(showSize))
 	if len(filters) > 0 && filters[0] != "" {
+		if err := checkFilters(filters[0]); err != nil {
+			return nil, err
+		}
 		v.Set("filters", filters[0])
 	}
 	uri := fmt.Sprintf("containers/json?%s", v.Encode())
@@ -293,32 +357,187 @@ func (client *DockerClient) ListContainers(showAll, showSize bool, filters ...st
 	}
 }
 
-// InspectContainer returns container detail data with container id
-func (client *DockerClient) InspectContainer(id string) (ContainerDetail, error) {
-	uri := fmt.Sprintf("containers/%s/json", id)
-	var ret ContainerDetail
+// ListContainersOptions covers all the parameters of the container list
+type ListContainersOptions struct {
+	All     bool
+	Size    bool
+	Limit   int    // the number of the most recently created containers, including the stopped ones
+	Since   string // only the containers created since the container id or name
+	Before  string // only the containers created before the container id or name
+	Latest  bool   // only the latest created container, including the stopped ones
+	Filters Filters
+}
+
+func (client *DockerClient) ListContainersWithOptions(opts ListContainersOptions) ([]Container, error) {
+	v := url.Values{}
+	v.Set("all", formatBoolToIntString(opts.All))
+	v.Set("size", formatBoolToIntString(opts.Size))
+	if opts.Limit > 0 {
+		v.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if opts.Latest {
+		v.Set("latest", "1")
+	}
+	filters := make(Filters)
+	for key, values := range opts.Filters {
+		filters[key] = values
+	}
+	// the since and before params are moved into the filters since v1.22
+	if compareApiVersion(client.apiVersion, kFiltersMapApiVersion) < 0 {
+		if opts.Since != "" {
+			v.Set("since", opts.Since)
+		}
+		if opts.Before != "" {
+			v.Set("before", opts.Before)
+		}
+	} else {
+		if opts.Since != "" {
+			filters.Since(opts.Since)
+		}
+		if opts.Before != "" {
+			filters.Before(opts.Before)
+		}
+	}
+	if encoded := client.EncodeFilters(filters); encoded != "" {
+		v.Set("filters", encoded)
+	}
+	uri := fmt.Sprintf("containers/json?%s", v.Encode())
 	if data, err := client.sendRequest("GET", uri, nil, nil, nil); err != nil {
-		return ret, err
+		return nil, err
 	} else {
+		var ret []Container
 		err := json.Unmarshal(data, &ret)
 		return ret, err
 	}
 }
 
-func (client *DockerClient) CreateContainer(containerConf ContainerConfig, hostConf HostConfig, networkingConf NetworkingConfig, name ...string) (string, error) {
-	var config struct {
-		ContainerConfig
-		HostConfig       HostConfig
-		NetworkingConfig NetworkingConfig
+// EachContainer lists the containers page by page with the page size (default to 100), the callback
+// is called in the list order (newest first) until it returns false. The Limit and Before of the
+// options are used for the paging.
+func (client *DockerClient) EachContainer(opts ListContainersOptions, pageSize int, callback func(container Container) bool) error {
+	if pageSize <= 0 {
+		pageSize = kDefaultPageSize
 	}
-	config.ContainerConfig = containerConf
-	config.HostConfig = hostConf
-	config.NetworkingConfig = networkingConf
+	opts.Limit = pageSize
+	opts.Latest = false
+	for {
+		containers, err := client.ListContainersWithOptions(opts)
+		if err != nil {
+			return err
+		}
+		for _, container := range containers {
+			if !callback(container) {
+				return nil
+			}
+		}
+		if len(containers) < pageSize {
+			return nil
+		}
+		opts.Before = containers[len(containers)-1].Id
+	}
+}
+
+// ContainerDetailResult is the container from the list enriched with the inspect detail, the Err is
+// set if the inspect failed, e.g. the container is already removed
+type ContainerDetailResult struct {
+	Container Container
+	Detail    ContainerDetail
+	Err       error
+}
+
+// EachContainerDetail streams the listed containers with the details, the inspects of every page are
+// running with the bounded concurrency (default to 8), and the callback is called in the list order
+// until it returns false.
+func (client *DockerClient) EachContainerDetail(opts ListContainersOptions, concurrency int, callback func(result ContainerDetailResult) bool) error {
+	var page []Container
+	stopped := false
+	flush := func() {
+		ids := make([]string, len(page))
+		for i, container := range page {
+			ids[i] = container.Id
+		}
+		details, errs := client.inspectContainers(ids, concurrency)
+		for i, container := range page {
+			if !stopped && !callback(ContainerDetailResult{Container: container, Detail: details[i], Err: errs[i]}) {
+				stopped = true
+			}
+		}
+		page = page[:0]
+	}
+	err := client.EachContainer(opts, kDefaultPageSize, func(container Container) bool {
+		page = append(page, container)
+		if len(page) == kDefaultPageSize {
+			flush()
+		}
+		return !stopped
+	})
+	if err == nil && len(page) > 0 && !stopped {
+		flush()
+	}
+	return err
+}
+
+// InspectContainers inspects the containers with the bounded concurrency (default to 8), the details
+// are in the order of the ids, the containers not found are skipped, and the first other error is returned.
+func (client *DockerClient) InspectContainers(ids []string, concurrency int) ([]ContainerDetail, error) {
+	details, errs := client.inspectContainers(ids, concurrency)
+	ret := make([]ContainerDetail, 0, len(ids))
+	for i, err := range errs {
+		if err == nil {
+			ret = append(ret, details[i])
+		} else if !IsNotFound(err) {
+			return ret, err
+		}
+	}
+	return ret, nil
+}
 
+func (client *DockerClient) inspectContainers(ids []string, concurrency int) ([]ContainerDetail, []error) {
+	if concurrency <= 0 {
+		concurrency = kDefaultInspectConcurrency
+	}
+	details := make([]ContainerDetail, len(ids))
+	errs := make([]error, len(ids))
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency && i < len(ids); i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range indexes {
+				details[index], errs[index] = client.InspectContainer(ids[index])
+			}
+		}()
+	}
+	for i := range ids {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
+	return details, errs
+}
+
+// InspectContainer returns container detail data with container id
+func (client *DockerClient) InspectContainer(id string) (ContainerDetail, error) {
+	uri := fmt.Sprintf("containers/%s/json", id)
+	var ret ContainerDetail
+	err := client.sendRequestCallback("GET", uri, nil, nil, func(resp *http.Response) error {
+		if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+			return err
+		}
+		if ret.Node.Name != "" {
+			SpanFromContext(resp.Request.Context()).SetAttribute(kTraceSwarmNode, ret.Node.Name)
+		}
+		return nil
+	}, nil)
+	return ret, err
+}
+
+func (client *DockerClient) CreateContainer(containerConf ContainerConfig, hostConf HostConfig, networkingConf NetworkingConfig, name ...string) (string, error) {
 	// extra time for pull image
 	rc := &RequestConfig{ExtraTimeout: ImagePuSecs}
 
-	if body, err := json.Marshal(config); err != nil {
+	if body, err := createContainerBody(containerConf, hostConf, networkingConf); err != nil {
 		return "", err
 	} else {
 		uri := "containers/create"
@@ -327,26 +546,47 @@ func (client *DockerClient) CreateContainer(containerConf ContainerConfig, hostC
 			v.Set("name", name[0])
 			uri += "?" + v.Encode()
 		}
-		if data, err := client.sendRequest("POST", uri, body, nil, rc); err != nil {
-			return "", err
-		} else {
-			var resp struct {
-				Id       string
-				Warnings []string
-			}
-			err := json.Unmarshal(data, &resp)
-			if len(resp.Warnings) > 0 {
-				logger.Warnf("Create container returns warning from docker daemon: %+v", resp.Warnings)
+		var ret struct {
+			Id       string
+			Warnings []string
+		}
+		err := client.sendRequestCallback("POST", uri, body, nil, func(resp *http.Response) error {
+			if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+				return err
 			}
-			return resp.Id, err
+			span := SpanFromContext(resp.Request.Context())
+			span.SetAttribute(kTraceContainerId, ret.Id)
+			span.SetAttribute(kTraceImageName, containerConf.Image)
+			return nil
+		}, rc)
+		if len(ret.Warnings) > 0 {
+			client.logger.Warn("Create container returns warnings from docker daemon", "container", ret.Id, "warnings", ret.Warnings)
 		}
+		return ret.Id, err
+	}
+}
+
+// createContainerBody returns the body of the containers/create request
+func createContainerBody(containerConf ContainerConfig, hostConf HostConfig, networkingConf NetworkingConfig) ([]byte, error) {
+	var config struct {
+		ContainerConfig
+		HostConfig       HostConfig
+		NetworkingConfig NetworkingConfig
 	}
+	config.ContainerConfig = containerConf
+	config.HostConfig = hostConf
+	config.NetworkingConfig = networkingConf
+	return json.Marshal(config)
 }
 
 func (client *DockerClient) ConnectContainer(networkName string, id string, ipAddr string) error {
-	var nc NetworkOptions
-	nc.Container = id
-	nc.EndpointConfig.IPAMConfig.IPv4Address = ipAddr
+	var endpoint EndpointConfig
+	endpoint.IPAMConfig.IPv4Address = ipAddr
+	return client.connectContainer(networkName, id, endpoint)
+}
+
+func (client *DockerClient) connectContainer(networkName string, id string, endpoint EndpointConfig) error {
+	nc := NetworkOptions{Container: id, EndpointConfig: endpoint}
 	if body, err := json.Marshal(nc); err != nil {
 		return err
 	} else {
@@ -371,7 +611,9 @@ func (client *DockerClient) DisconnectContainer(networkName string, id string, f
 
 func (client *DockerClient) StartContainer(id string) error {
 	uri := fmt.Sprintf("containers/%s/start", id)
-	_, err := client.sendRequest("POST", uri, nil, nil, nil)
+	// starting a started container is fine, so it can be retried
+	rc := &RequestConfig{Replayable: true}
+	_, err := client.sendRequest("POST", uri, nil, nil, rc)
 	return err
 }
 
@@ -386,20 +628,11 @@ func (client *DockerClient) StopContainer(id string, timeout ...int) error {
 	} else {
 		rc = &RequestConfig{ExtraTimeout: 10 * time.Second}
 	}
+	rc.Replayable = true
 	_, err := client.sendRequest("POST", uri, nil, nil, rc)
 	return err
 }
 
-func (client *DockerClient) UpdateContainer(id string, config interface{}) error {
-	uri := fmt.Sprintf("containers/%s/update", id)
-	body, err := json.Marshal(config)
-	if err != nil {
-		return err
-	}
-	_, err = client.sendRequest("POST", uri, body, nil, nil)
-	return err
-}
-
 func (client *DockerClient) RestartContainer(id string, timeout ...int) error {
 	uri := fmt.Sprintf("containers/%s/restart", id)
 	var rc *RequestConfig
@@ -457,21 +690,26 @@ func (client *DockerClient) RenameContainer(id string, name string) error {
 
 // This will block the call routine until the container is stopped
 func (client *DockerClient) WaitContainer(id string) (int, error) {
+	return client.waitContainer(id, nil)
+}
+
+func (client *DockerClient) waitContainer(id string, rc *RequestConfig) (int, error) {
 	uri := fmt.Sprintf("containers/%s/wait", id)
-	if data, err := client.sendRequest("POST", uri, nil, nil, nil, true); err != nil {
-		return 0, err
-	} else {
+	var code int
+	err := client.sendRequestCallback("POST", uri, nil, nil, func(resp *http.Response) error {
 		var ret map[string]int
-		if err := json.Unmarshal(data, &ret); err != nil {
-			return 0, err
+		if err := json.NewDecoder(resp.Body).Decode(&ret); err != nil {
+			return err
 		}
-		if code, ok := ret["StatusCode"]; ok {
-			return code, nil
-		} else {
-			logger.Warnf("There is no StatusCode key inside results map, the API maybe changed, ret=%+v", ret)
-			return 0, fmt.Errorf("Cannot get StatusCode from return data, %+v", ret)
+		var ok bool
+		if code, ok = ret["StatusCode"]; !ok {
+			client.logger.Warn("There is no StatusCode key inside results map, the API maybe changed", "container", id, "result", ret)
+			return fmt.Errorf("Cannot get StatusCode from return data, %+v", ret)
 		}
-	}
+		SpanFromContext(resp.Request.Context()).AddEvent("container exited", map[string]interface{}{"exit_code": code})
+		return nil
+	}, rc, true)
+	return code, err
 }
 
 func (client *DockerClient) ContainerLogs(id string, stdout, stderr, timestamps bool, tail ...int) ([]LogEntry, error) {
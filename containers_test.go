@@ -0,0 +1,136 @@
+package adoc
+
+import (
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func createTestContainers(t *testing.T, client *DockerClient, n int) []string {
+	ids := make([]string, n)
+	for i := range ids {
+		id, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{})
+		if err != nil {
+			t.Fatalf("Cannot create the container, %s", err)
+		}
+		// newest first in the list
+		ids[n-1-i] = id
+		time.Sleep(time.Millisecond)
+	}
+	return ids
+}
+
+func TestListContainersWithOptions(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+
+	for _, apiVersion := range []string{"v1.17", "v1.24"} {
+		client, _ := NewClient(server.URL, WithAPIVersion(apiVersion))
+		ids := createTestContainers(t, client, 5)
+
+		containers, err := client.ListContainersWithOptions(ListContainersOptions{Limit: 2})
+		if err != nil || len(containers) != 2 || containers[0].Id != ids[0] || containers[1].Id != ids[1] {
+			t.Errorf("Wrong limited containers with %s, %+v, %v", apiVersion, containers, err)
+		}
+		containers, err = client.ListContainersWithOptions(ListContainersOptions{Latest: true})
+		if err != nil || len(containers) != 1 || containers[0].Id != ids[0] {
+			t.Errorf("Wrong latest container with %s, %+v, %v", apiVersion, containers, err)
+		}
+		containers, err = client.ListContainersWithOptions(ListContainersOptions{All: true, Before: ids[1], Since: ids[4]})
+		if err != nil || len(containers) != 2 || containers[0].Id != ids[2] || containers[1].Id != ids[3] {
+			t.Errorf("Wrong containers between with %s, %+v, %v", apiVersion, containers, err)
+		}
+
+		var paged []string
+		err = client.EachContainer(ListContainersOptions{All: true}, 2, func(container Container) bool {
+			paged = append(paged, container.Id)
+			return true
+		})
+		if err != nil || len(paged) != 5 || paged[4] != ids[4] {
+			t.Errorf("Wrong paged containers with %s, %v, %v", apiVersion, paged, err)
+		}
+		for _, id := range ids {
+			client.RemoveContainer(id, true, true)
+		}
+		client.Close()
+	}
+}
+
+func TestEachContainerDetail(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+
+	var inflight, maxInflight int32
+	observe := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			n := atomic.AddInt32(&inflight, 1)
+			defer atomic.AddInt32(&inflight, -1)
+			for {
+				max := atomic.LoadInt32(&maxInflight)
+				if n <= max || atomic.CompareAndSwapInt32(&maxInflight, max, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			return next.RoundTrip(req)
+		})
+	}
+	client, _ := NewClient(server.URL, WithMiddleware(observe))
+	defer client.Close()
+	ids := createTestContainers(t, client, 12)
+
+	var got []ContainerDetailResult
+	err := client.EachContainerDetail(ListContainersOptions{All: true}, 3, func(result ContainerDetailResult) bool {
+		got = append(got, result)
+		return true
+	})
+	if err != nil || len(got) != 12 {
+		t.Fatalf("Wrong container details, %d, %v", len(got), err)
+	}
+	for i, result := range got {
+		if result.Err != nil || result.Container.Id != ids[i] || result.Detail.Id != ids[i] {
+			t.Errorf("Wrong container detail at %d, %+v", i, result)
+		}
+	}
+	if maxInflight > 3 || maxInflight < 2 {
+		t.Errorf("The inspects should be bounded by the concurrency, max=%d", maxInflight)
+	}
+
+	got = got[:0]
+	client.EachContainerDetail(ListContainersOptions{All: true}, 3, func(result ContainerDetailResult) bool {
+		got = append(got, result)
+		return len(got) < 5
+	})
+	if len(got) != 5 {
+		t.Errorf("Should stop when the callback returns false, got %d", len(got))
+	}
+
+	client.RemoveContainer(ids[0], true, true)
+	details, err := client.InspectContainers(ids, 4)
+	if err != nil || len(details) != 11 || details[0].Id != ids[1] {
+		t.Errorf("The removed container should be skipped, %d, %v", len(details), err)
+	}
+}
+
+func TestListImagesWithOptions(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	server.AddImage(adoctest.ImageSpec{Name: "localhost:5000/redis:3.0"})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	images, err := client.ListImagesWithOptions(ListImagesOptions{Filter: "localhost:5000/redis", Digests: true})
+	if err != nil || len(images) != 1 || len(images[0].RepoDigests) != 1 || images[0].SharedSize != -1 {
+		t.Fatalf("Wrong filtered images, %+v, %v", images, err)
+	}
+	images, err = client.ListImagesWithOptions(ListImagesOptions{SharedSize: true})
+	if err != nil || len(images) != 2 || images[0].SharedSize != 0 || images[0].Containers != 0 {
+		t.Errorf("Wrong images with the shared size, %+v, %v", images, err)
+	}
+}
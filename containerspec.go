@@ -0,0 +1,653 @@
+package adoc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This part contains the declarative container spec files in YAML or JSON, e.g.
+//   name: web
+//   pull: always
+//   auth: registry
+//   config:
+//     Image: registry.example.com/web:${WEB_VERSION:-latest}
+//     Env: {MODE: prod, WORKERS: 4}
+//     ExposedPorts: ["80"]
+//     Healthcheck: {Test: curl -f http://localhost/, Interval: 30s}
+//   hostConfig:
+//     Memory: 512m
+//     Cpus: 1.5
+//     RestartPolicy: on-failure:3
+//     Ulimits: [nofile=1024:2048]
+// and then
+//   spec, err := LoadContainerSpec("web.yaml")
+//   id, err := docker.CreateContainer(spec.Config, spec.HostConfig, spec.NetworkingConfig, spec.Name)
+// The keys are the field names of the Engine API in any case, the sizes, durations and the docker cli
+// strings like the ulimits are accepted for the fields. The ${VAR}, ${VAR:-default} and ${VAR:?message}
+// are interpolated from the environment in the values, $$ is the literal $.
+
+// ContainerSpec is the declarative container definition
+type ContainerSpec struct {
+	Name             string
+	Pull             string // PullMissing (default), PullAlways or PullNever
+	Auth             string // the name of the registry auth, which is looked up by RunSpec
+	Config           ContainerConfig
+	HostConfig       HostConfig
+	NetworkingConfig NetworkingConfig
+}
+
+// SpecError is the error of the spec document at the line and column
+type SpecError struct {
+	File   string
+	Line   int
+	Column int
+	Field  string // the path of the field, e.g. hostConfig.Memory
+	Err    error
+}
+
+func (e *SpecError) Error() string {
+	position := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.File != "" {
+		position = e.File + ":" + position
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", position, e.Err)
+	}
+	return fmt.Sprintf("%s: %s: %s", position, e.Field, e.Err)
+}
+
+func (e *SpecError) Unwrap() error {
+	return e.Err
+}
+
+// SpecErrors has all the errors of the spec document in the order of their positions
+type SpecErrors struct {
+	Errors []*SpecError
+}
+
+func (e *SpecErrors) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("Invalid spec, %s", strings.Join(msgs, "; "))
+}
+
+// LoadContainerSpec loads the spec file, the .json file or the content starting with { is parsed as JSON,
+// otherwise as YAML, the variables are interpolated from the environment
+func LoadContainerSpec(path string) (ContainerSpec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return ContainerSpec{}, err
+	}
+	return ParseContainerSpec(filepath.Base(path), data, os.LookupEnv)
+}
+
+// ParseContainerSpec parses the spec document, the name is used in the errors, the lookupEnv defaults
+// to os.LookupEnv. The error is the *SpecErrors if the document is invalid.
+func ParseContainerSpec(name string, data []byte, lookupEnv func(string) (string, bool)) (ContainerSpec, error) {
+	var spec ContainerSpec
+	d := newSpecDecoder(name, lookupEnv)
+	root, err := d.parse(data)
+	if err != nil {
+		return spec, err
+	}
+	d.decode(root, reflect.ValueOf(&spec).Elem(), "", "")
+	if len(d.errors) == 0 {
+		d.validate(root, spec)
+	}
+	return spec, d.err()
+}
+
+// CreateBody returns the body of the containers/create request, which is the same as CreateContainer sends
+func (spec ContainerSpec) CreateBody() ([]byte, error) {
+	return createContainerBody(spec.Config, spec.HostConfig, spec.NetworkingConfig)
+}
+
+// RunSpec returns the RunSpec for RunContainer, the auth of the spec is looked up in the auths by its name
+func (spec ContainerSpec) RunSpec(auths map[string]AuthConfig) (RunSpec, error) {
+	ret := RunSpec{
+		Name:             spec.Name,
+		Config:           spec.Config,
+		HostConfig:       spec.HostConfig,
+		NetworkingConfig: spec.NetworkingConfig,
+		Pull:             spec.Pull,
+	}
+	if spec.Auth != "" {
+		auth, ok := auths[spec.Auth]
+		if !ok {
+			return ret, fmt.Errorf("Auth %q of the container spec is not found", spec.Auth)
+		}
+		ret.AuthConfig = &auth
+	}
+	return ret, nil
+}
+
+func (d *specDecoder) validate(root *specNode, spec ContainerSpec) {
+	at := func(key string) *specNode {
+		if node := root.lookup(key); node != nil {
+			return node
+		}
+		return root
+	}
+	if spec.Name != "" && !kContainerNameRegex.MatchString(spec.Name) {
+		d.fail(at("name"), "name", "should match %s", kContainerNameRegex)
+	}
+	if !containsString([]string{"", PullMissing, PullAlways, PullNever}, spec.Pull) {
+		d.fail(at("pull"), "pull", "should be one of missing, always, never")
+	}
+	if spec.Config.Image == "" {
+		d.fail(at("config"), "config.Image", "the image is required")
+	}
+	if mode := spec.HostConfig.NetworkMode; len(spec.NetworkingConfig.EndpointsConfig) > 0 {
+		for network := range spec.NetworkingConfig.EndpointsConfig {
+			if network != mode || !isUserDefinedNetwork(network) {
+				d.fail(at("networkingConfig"), "networkingConfig.EndpointsConfig", "the endpoint %q should be the user defined network of the NetworkMode", network)
+			}
+		}
+	}
+}
+
+// the docker cli strings accepted for the fields by the owner type and the field name, the list fields
+// take them for the items
+var kSpecFieldParsers = map[string]func(value string) (interface{}, error){
+	"Resources.Memory":            parseSpecSize,
+	"Resources.MemorySwap":        parseSpecSize,
+	"Resources.MemoryReservation": parseSpecSize,
+	"Resources.KernelMemory":      parseSpecSize,
+	"Resources.DiskQuota":         parseSpecSize,
+	"TmpfsOptions.SizeBytes":      parseSpecSize,
+	"TmpfsOptions.Mode": func(value string) (interface{}, error) {
+		// the octal mode starts with the 0 like 01777, or it is the decimal number of the Engine API
+		mode, err := strconv.ParseUint(value, 0, 32)
+		if err != nil {
+			return nil, fmt.Errorf("should be the file mode like 01777")
+		}
+		return uint32(mode), nil
+	},
+	"Resources.BlkioWeight": func(value string) (interface{}, error) { return parseBlkioWeight(value) },
+	"HostConfig.RestartPolicy": func(value string) (interface{}, error) {
+		return parseRestartPolicy(value)
+	},
+	"ContainerConfig.Cmd":        func(value string) (interface{}, error) { return splitCommandLine(value) },
+	"ContainerConfig.Entrypoint": func(value string) (interface{}, error) { return splitCommandLine(value) },
+	"HealthConfig.Test": func(value string) (interface{}, error) {
+		if value == "NONE" {
+			return []string{"NONE"}, nil
+		}
+		return []string{"CMD-SHELL", value}, nil
+	},
+	"Resources.Ulimits":              func(value string) (interface{}, error) { return parseUlimit(value) },
+	"Resources.Devices":              func(value string) (interface{}, error) { return parseDevice(value) },
+	"HostConfig.Mounts":              func(value string) (interface{}, error) { return parseMount(value) },
+	"Resources.BlkioWeightDevice":    func(value string) (interface{}, error) { return parseWeightDevice(value) },
+	"Resources.BlkioDeviceReadBps":   func(value string) (interface{}, error) { return parseThrottleDevice(value, false) },
+	"Resources.BlkioDeviceWriteBps":  func(value string) (interface{}, error) { return parseThrottleDevice(value, false) },
+	"Resources.BlkioDeviceReadIOps":  func(value string) (interface{}, error) { return parseThrottleDevice(value, true) },
+	"Resources.BlkioDeviceWriteIOps": func(value string) (interface{}, error) { return parseThrottleDevice(value, true) },
+	"ContainerConfig.ExposedPorts": func(value string) (interface{}, error) {
+		if strings.Contains(value, ":") {
+			return nil, fmt.Errorf("should not have the host port")
+		}
+		ports, _, err := parsePortSpec(value)
+		return ports, err
+	},
+}
+
+// the keys which are not the fields, e.g. Cpus: 1.5 for the NanoCPUs
+var kSpecFieldAliases = map[string]struct {
+	field string
+	parse func(value string) (interface{}, error)
+}{
+	"cpus": {"NanoCPUs", func(value string) (interface{}, error) { return parseCPUs(value) }},
+}
+
+func parseSpecSize(value string) (interface{}, error) {
+	if value == "-1" {
+		return int64(-1), nil
+	}
+	size, err := RAMInBytes(value)
+	if err != nil {
+		return nil, fmt.Errorf("should be a size like 512m")
+	}
+	return size, nil
+}
+
+type specDecoder struct {
+	file      string
+	lookupEnv func(string) (string, bool)
+	errors    []*SpecError
+}
+
+func newSpecDecoder(file string, lookupEnv func(string) (string, bool)) *specDecoder {
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+	return &specDecoder{file: file, lookupEnv: lookupEnv}
+}
+
+// parse parses the document and interpolates the scalar values
+func (d *specDecoder) parse(data []byte) (*specNode, error) {
+	root, err := parseSpecDocument(data)
+	if err != nil {
+		specErr := err.(*SpecError)
+		specErr.File = d.file
+		return nil, &SpecErrors{Errors: []*SpecError{specErr}}
+	}
+	d.interpolate(root)
+	if err := d.err(); err != nil {
+		return nil, err
+	}
+	if root.kind != kSpecMap && !root.isNull() {
+		return nil, &SpecErrors{Errors: []*SpecError{{File: d.file, Line: root.line, Column: root.column, Err: fmt.Errorf("the document should be a map")}}}
+	}
+	return root, nil
+}
+
+func (d *specDecoder) interpolate(node *specNode) {
+	if node.kind == kSpecScalar {
+		value, err := interpolateEnv(node.value, d.lookupEnv)
+		if err != nil {
+			d.fail(node, "", "%s", err)
+		}
+		node.value = value
+		return
+	}
+	for _, item := range node.items {
+		d.interpolate(item)
+	}
+}
+
+func (d *specDecoder) fail(node *specNode, field string, format string, args ...interface{}) {
+	d.errors = append(d.errors, &SpecError{
+		File:   d.file,
+		Line:   node.line,
+		Column: node.column,
+		Field:  field,
+		Err:    fmt.Errorf(format, args...),
+	})
+}
+
+func (d *specDecoder) err() error {
+	if len(d.errors) == 0 {
+		return nil
+	}
+	sort.SliceStable(d.errors, func(i, j int) bool {
+		a, b := d.errors[i], d.errors[j]
+		return a.Line < b.Line || (a.Line == b.Line && a.Column < b.Column)
+	})
+	return &SpecErrors{Errors: d.errors}
+}
+
+// decode decodes the node into the value by its type, the name is the owner type and the go field name
+// like TmpfsOptions.Mode for the parsers of the field, the errors are collected so all of them are reported
+func (d *specDecoder) decode(node *specNode, v reflect.Value, field string, name string) {
+	if node.isNull() {
+		return
+	}
+	if parse, ok := kSpecFieldParsers[name]; ok && node.kind == kSpecScalar && v.Kind() != reflect.Slice {
+		d.decodeParsed(node, v, field, parse)
+		return
+	}
+
+	switch v.Type() {
+	case reflect.TypeOf(time.Duration(0)):
+		if node.kind != kSpecScalar {
+			d.fail(node, field, "should be a duration like 30s, not a %s", node.kindName())
+		} else if n, err := strconv.ParseInt(node.value, 10, 64); err == nil {
+			v.SetInt(n)
+		} else if duration, err := time.ParseDuration(node.value); err == nil {
+			v.SetInt(int64(duration))
+		} else {
+			d.fail(node, field, "should be a duration like 30s")
+		}
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		d.decode(node, v.Elem(), field, name)
+	case reflect.String:
+		if node.kind != kSpecScalar {
+			d.fail(node, field, "should be a string, not a %s", node.kindName())
+			return
+		}
+		v.SetString(node.value)
+	case reflect.Bool:
+		switch {
+		case node.kind == kSpecScalar && strings.EqualFold(node.value, "true"):
+			v.SetBool(true)
+		case node.kind == kSpecScalar && strings.EqualFold(node.value, "false"):
+			v.SetBool(false)
+		default:
+			d.fail(node, field, "should be true or false")
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(node.value, 10, v.Type().Bits())
+		if node.kind != kSpecScalar || err != nil {
+			d.fail(node, field, "should be a number")
+			return
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(node.value, 10, v.Type().Bits())
+		if node.kind != kSpecScalar || err != nil {
+			d.fail(node, field, "should be a positive number")
+			return
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		d.decodeSlice(node, v, field, name)
+	case reflect.Map:
+		d.decodeMap(node, v, field, name)
+	case reflect.Struct:
+		d.decodeStruct(node, v, field)
+	default:
+		d.fail(node, field, "unsupported field type %s", v.Type())
+	}
+}
+
+func (d *specDecoder) decodeParsed(node *specNode, v reflect.Value, field string, parse func(string) (interface{}, error)) {
+	parsed, err := parse(node.value)
+	if err != nil {
+		d.fail(node, field, "%s", err)
+		return
+	}
+	value := reflect.ValueOf(parsed)
+	if v.Kind() == reflect.Ptr && value.Kind() != reflect.Ptr {
+		v.Set(reflect.New(v.Type().Elem()))
+		v = v.Elem()
+	}
+	if value.Kind() != v.Kind() || !value.Type().ConvertibleTo(v.Type()) {
+		d.fail(node, field, "unsupported value %q", node.value)
+		return
+	}
+	v.Set(value.Convert(v.Type()))
+}
+
+func (d *specDecoder) decodeSlice(node *specNode, v reflect.Value, field string, name string) {
+	parse := kSpecFieldParsers[name]
+	if node.kind == kSpecScalar && parse != nil && v.Type().Elem().Kind() == reflect.String {
+		// the whole list in a string, e.g. the Cmd
+		d.decodeParsed(node, v, field, parse)
+		return
+	}
+	if node.kind != kSpecSeq {
+		d.fail(node, field, "should be a list, not a %s", node.kindName())
+		return
+	}
+	slice := reflect.MakeSlice(v.Type(), len(node.items), len(node.items))
+	for i, item := range node.items {
+		itemField := fmt.Sprintf("%s[%d]", field, i)
+		if parse != nil && item.kind == kSpecScalar && !item.isNull() && v.Type().Elem().Kind() != reflect.String {
+			d.decodeParsed(item, slice.Index(i), itemField, parse)
+		} else {
+			d.decode(item, slice.Index(i), itemField, "")
+		}
+	}
+	v.Set(slice)
+}
+
+func (d *specDecoder) decodeMap(node *specNode, v reflect.Value, field string, name string) {
+	mapType := v.Type()
+	if mapType.Key().Kind() != reflect.String {
+		d.fail(node, field, "unsupported field type %s", mapType)
+		return
+	}
+	if v.IsNil() {
+		v.Set(reflect.MakeMap(mapType))
+	}
+	isSet := mapType.Elem() == reflect.TypeOf(struct{}{})
+	if node.kind == kSpecSeq {
+		// the set like the ExposedPorts, or the key=value list like the Labels
+		for i, item := range node.items {
+			itemField := fmt.Sprintf("%s[%d]", field, i)
+			if item.kind != kSpecScalar || item.isNull() {
+				d.fail(item, itemField, "should be a string")
+				continue
+			}
+			switch {
+			case isSet && kSpecFieldParsers[name] != nil:
+				keys, err := kSpecFieldParsers[name](item.value)
+				if err != nil {
+					d.fail(item, itemField, "%s", err)
+					continue
+				}
+				for _, key := range keys.([]string) {
+					v.SetMapIndex(reflect.ValueOf(key), reflect.ValueOf(struct{}{}))
+				}
+			case isSet:
+				v.SetMapIndex(reflect.ValueOf(item.value), reflect.ValueOf(struct{}{}))
+			case mapType.Elem().Kind() == reflect.String:
+				parts := strings.SplitN(item.value, "=", 2)
+				if len(parts) == 1 {
+					parts = append(parts, "")
+				}
+				v.SetMapIndex(reflect.ValueOf(parts[0]), reflect.ValueOf(parts[1]))
+			default:
+				d.fail(node, field, "should be a map, not a list")
+				return
+			}
+		}
+		return
+	}
+	if node.kind != kSpecMap {
+		d.fail(node, field, "should be a map, not a %s", node.kindName())
+		return
+	}
+	for i, key := range node.keys {
+		keyField := field + "." + key.value
+		if isSet {
+			// the Engine API has the {} for the values
+			if value := node.items[i]; !value.isNull() && (value.kind != kSpecMap || len(value.keys) > 0) {
+				d.fail(value, keyField, "should be empty, the keys are the values")
+				continue
+			}
+			keys := []string{key.value}
+			if parse := kSpecFieldParsers[name]; parse != nil {
+				parsed, err := parse(key.value)
+				if err != nil {
+					d.fail(key, keyField, "%s", err)
+					continue
+				}
+				keys = parsed.([]string)
+			}
+			for _, k := range keys {
+				v.SetMapIndex(reflect.ValueOf(k), reflect.ValueOf(struct{}{}))
+			}
+			continue
+		}
+		elem := reflect.New(mapType.Elem()).Elem()
+		d.decode(node.items[i], elem, keyField, "")
+		v.SetMapIndex(reflect.ValueOf(key.value), elem)
+	}
+}
+
+func (d *specDecoder) decodeStruct(node *specNode, v reflect.Value, field string) {
+	if node.kind != kSpecMap {
+		d.fail(node, field, "should be a map, not a %s", node.kindName())
+		return
+	}
+	fields := specStructFields(v.Type())
+	for i, key := range node.keys {
+		keyField := key.value
+		if field != "" {
+			keyField = field + "." + key.value
+		}
+		value := node.items[i]
+		if index, ok := fields[strings.ToLower(key.value)]; ok {
+			fieldValue := v.FieldByIndex(index)
+			if v.Type().FieldByIndex(index).Name == "Env" && value.kind == kSpecMap {
+				d.decodeEnvMap(value, fieldValue, keyField)
+				continue
+			}
+			d.decode(value, fieldValue, keyField, specFieldName(v.Type(), index))
+			continue
+		}
+		if alias, ok := kSpecFieldAliases[strings.ToLower(key.value)]; ok {
+			if index, ok := fields[strings.ToLower(alias.field)]; ok {
+				if value.kind != kSpecScalar || value.isNull() {
+					d.fail(value, keyField, "should be a scalar, not a %s", value.kindName())
+				} else {
+					d.decodeParsed(value, v.FieldByIndex(index), keyField, alias.parse)
+				}
+				continue
+			}
+		}
+		d.fail(key, keyField, "unknown field")
+	}
+}
+
+// decodeEnvMap turns the env map into the KEY=value list, the empty value is looked up in the environment
+func (d *specDecoder) decodeEnvMap(node *specNode, v reflect.Value, field string) {
+	env := make([]string, 0, len(node.keys))
+	for i, key := range node.keys {
+		value := node.items[i]
+		switch {
+		case value.kind != kSpecScalar:
+			d.fail(value, field+"."+key.value, "should be a string, not a %s", value.kindName())
+		case value.isNull():
+			if local, ok := d.lookupEnv(key.value); ok {
+				env = append(env, key.value+"="+local)
+			}
+		default:
+			env = append(env, key.value+"="+value.value)
+		}
+	}
+	v.Set(reflect.ValueOf(env))
+}
+
+// specFieldName returns the name of the field for the parsers, which is the spec tag of the field, or
+// the type owning the field with the field name, e.g. Resources.Memory for the HostConfig.Memory
+func specFieldName(t reflect.Type, index []int) string {
+	f := t.FieldByIndex(index)
+	if name := f.Tag.Get("spec"); name != "" {
+		return name
+	}
+	owner := t
+	for _, i := range index[:len(index)-1] {
+		owner = owner.Field(i).Type
+	}
+	return owner.Name() + "." + f.Name
+}
+
+// specStructFields returns the field indexes by the lower case json names and go names,
+// the embedded structs are flattened like the encoding/json
+func specStructFields(t reflect.Type) map[string][]int {
+	fields := make(map[string][]int)
+	for i := 0; i < t.NumField(); i += 1 {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+		if tag == "-" {
+			continue
+		}
+		if f.Anonymous && tag == "" && f.Type.Kind() == reflect.Struct {
+			for name, index := range specStructFields(f.Type) {
+				if _, ok := fields[name]; !ok {
+					fields[name] = append([]int{i}, index...)
+				}
+			}
+			continue
+		}
+		fields[strings.ToLower(f.Name)] = []int{i}
+		if tag != "" {
+			fields[strings.ToLower(tag)] = []int{i}
+		}
+	}
+	return fields
+}
+
+// interpolateEnv replaces the $VAR, ${VAR}, ${VAR:-default}, ${VAR-default}, ${VAR:?message} and
+// ${VAR?message}, the $$ is the literal $
+func interpolateEnv(value string, lookupEnv func(string) (string, bool)) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i += 1 {
+		if value[i] != '$' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		switch next := value[i+1]; {
+		case next == '$':
+			b.WriteByte('$')
+			i += 1
+		case next == '{':
+			end := strings.IndexByte(value[i:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("the ${ is not closed in %q", value)
+			}
+			expr := value[i+2 : i+end]
+			resolved, err := resolveEnvExpr(expr, lookupEnv)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(resolved)
+			i += end
+		case isEnvNameChar(next, true):
+			end := i + 1
+			for end < len(value) && isEnvNameChar(value[end], end == i+1) {
+				end += 1
+			}
+			local, _ := lookupEnv(value[i+1 : end])
+			b.WriteString(local)
+			i = end - 1
+		default:
+			b.WriteByte('$')
+		}
+	}
+	return b.String(), nil
+}
+
+func resolveEnvExpr(expr string, lookupEnv func(string) (string, bool)) (string, error) {
+	end := 0
+	for end < len(expr) && isEnvNameChar(expr[end], end == 0) {
+		end += 1
+	}
+	name, op := expr[:end], expr[end:]
+	if name == "" {
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+	local, ok := lookupEnv(name)
+	switch {
+	case op == "":
+		return local, nil
+	case strings.HasPrefix(op, ":-"):
+		if local == "" {
+			return op[2:], nil
+		}
+	case strings.HasPrefix(op, "-"):
+		if !ok {
+			return op[1:], nil
+		}
+	case strings.HasPrefix(op, ":?"):
+		if local == "" {
+			return "", fmt.Errorf("the variable %s is required, %s", name, op[2:])
+		}
+	case strings.HasPrefix(op, "?"):
+		if !ok {
+			return "", fmt.Errorf("the variable %s is required, %s", name, op[1:])
+		}
+	default:
+		return "", fmt.Errorf("invalid variable ${%s}", expr)
+	}
+	return local, nil
+}
+
+func isEnvNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
@@ -0,0 +1,281 @@
+package adoc
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+const kTestSpecYAML = `# the web service
+name: web
+pull: always
+auth: registry
+config:
+  Image: "nginx:${WEB_VERSION:-1.19}"
+  Env:
+    MODE: prod
+    WORKERS: 4
+    TOKEN:            # from the environment
+  Labels: [app=web, tier=frontend]
+  ExposedPorts: ["80", 53/udp]
+  Cmd: nginx -g 'daemon off;'
+  Healthcheck:
+    Test: curl -f http://localhost/ || exit 1
+    Interval: 30s
+    Retries: 3
+  StopSignal: SIGQUIT
+  Entrypoint:
+    - /docker-entrypoint.sh
+hostConfig:
+  Memory: 512m
+  MemorySwap: -1
+  Cpus: 1.5
+  RestartPolicy: on-failure:3
+  PortBindings:
+    80/tcp:
+      - HostPort: "8080"
+  Binds:
+    - /srv/data:/data:ro
+  Ulimits: [nofile=1024:2048]
+  Devices:
+    - /dev/fuse
+    - {PathOnHost: /dev/sda, PathInContainer: /dev/xvda, CgroupPermissions: r}
+  BlkioDeviceReadBps: [/dev/sda:10mb]
+  Mounts:
+    - type=volume,source=logs,target=/logs
+    - Type: tmpfs
+      Target: /run
+      TmpfsOptions: {SizeBytes: 64m, Mode: 01777}
+  LogConfig:
+    Type: json-file
+    Config: {max-size: 10m}
+  NetworkMode: backend
+networkingConfig:
+  EndpointsConfig:
+    backend:
+      Aliases: [api]
+      IPAMConfig: {IPv4Address: 10.0.0.5}
+`
+
+const kTestSpecJSON = `{
+  "Name": "web", "Pull": "always", "Auth": "registry",
+  "Config": {
+    "Image": "nginx:1.19",
+    "Env": ["MODE=prod", "WORKERS=4", "TOKEN=secret"],
+    "Labels": {"app": "web", "tier": "frontend"},
+    "ExposedPorts": {"80/tcp": {}, "53/udp": {}},
+    "Cmd": ["nginx", "-g", "daemon off;"],
+    "Healthcheck": {"Test": ["CMD-SHELL", "curl -f http://localhost/ || exit 1"], "Interval": 30000000000, "Retries": 3},
+    "StopSignal": "SIGQUIT",
+    "Entrypoint": ["/docker-entrypoint.sh"]
+  },
+  "HostConfig": {
+    "Memory": 536870912, "MemorySwap": -1, "NanoCpus": 1500000000,
+    "RestartPolicy": {"Name": "on-failure", "MaximumRetryCount": 3},
+    "PortBindings": {"80/tcp": [{"HostPort": "8080"}]},
+    "Binds": ["/srv/data:/data:ro"],
+    "Ulimits": [{"Name": "nofile", "Soft": 1024, "Hard": 2048}],
+    "Devices": [{"PathOnHost": "/dev/fuse", "PathInContainer": "/dev/fuse", "CgroupPermissions": "rwm"},
+      {"PathOnHost": "/dev/sda", "PathInContainer": "/dev/xvda", "CgroupPermissions": "r"}],
+    "BlkioDeviceReadBps": [{"Path": "/dev/sda", "Rate": 10485760}],
+    "Mounts": [{"Type": "volume", "Source": "logs", "Target": "/logs"},
+      {"Type": "tmpfs", "Target": "/run", "TmpfsOptions": {"SizeBytes": 67108864, "Mode": 1023}}],
+    "LogConfig": {"Type": "json-file", "Config": {"max-size": "10m"}},
+    "NetworkMode": "backend"
+  },
+  "NetworkingConfig": {"EndpointsConfig": {"backend": {"Aliases": ["api"], "IPAMConfig": {"IPv4Address": "10.0.0.5"}}}}
+}`
+
+func testLookupEnv(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+func TestParseContainerSpec(t *testing.T) {
+	lookupEnv := testLookupEnv(map[string]string{"TOKEN": "secret"})
+	spec, err := ParseContainerSpec("web.yaml", []byte(kTestSpecYAML), lookupEnv)
+	if err != nil {
+		t.Fatalf("Cannot parse the yaml spec, %s", err)
+	}
+	jsonSpec, err := ParseContainerSpec("web.json", []byte(kTestSpecJSON), lookupEnv)
+	if err != nil {
+		t.Fatalf("Cannot parse the json spec, %s", err)
+	}
+	if !reflect.DeepEqual(spec, jsonSpec) {
+		t.Errorf("The yaml and json specs should be the same,\n%+v\n%+v", spec, jsonSpec)
+	}
+	config, host := spec.Config, spec.HostConfig
+	if config.Image != "nginx:1.19" || !reflect.DeepEqual(config.Env, []string{"MODE=prod", "WORKERS=4", "TOKEN=secret"}) ||
+		config.Healthcheck.Interval != 30*time.Second || host.Memory != 512*MiB || host.NanoCPUs != 1500000000 ||
+		host.Mounts[1].TmpfsOptions.Mode != 01777 {
+		t.Errorf("Wrong spec, %+v", spec)
+	}
+
+	// the same body as the CreateContainer sends
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "nginx:1.19"})
+	var sent []byte
+	capture := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "POST" && strings.HasSuffix(req.URL.Path, "containers/create") {
+				sent, _ = ioutil.ReadAll(req.Body)
+				req.Body = ioutil.NopCloser(bytes.NewReader(sent))
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	client, _ := NewClient(server.URL, WithMiddleware(capture))
+	defer client.Close()
+	if _, err := client.CreateContainer(spec.Config, spec.HostConfig, spec.NetworkingConfig, spec.Name); err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	if body, err := spec.CreateBody(); err != nil || !bytes.Equal(body, sent) {
+		t.Errorf("Wrong create body, %s, %v", body, err)
+	}
+
+	runSpec, err := spec.RunSpec(map[string]AuthConfig{"registry": {UserName: "deploy"}})
+	if err != nil || runSpec.Pull != PullAlways || runSpec.AuthConfig.UserName != "deploy" || runSpec.Name != "web" {
+		t.Errorf("Wrong run spec, %+v, %v", runSpec, err)
+	}
+	if _, err := spec.RunSpec(nil); err == nil {
+		t.Errorf("Should report the missing auth")
+	}
+}
+
+func TestParseContainerSpecYAML(t *testing.T) {
+	spec, err := ParseContainerSpec("job.yaml", []byte(`---
+config:
+  Image: 'busybox'   # the 'quoted' image
+  Cmd:
+  - sh
+  - -c
+  - |
+    echo "$$HOME" # not a comment
+    echo ${GREETING}
+
+  Env: ["A=1", 'B=it''s', "C=é\t#"]
+  Labels:
+    "a.b": >-
+      folded
+      text
+    empty: ""
+    none:
+hostConfig: {CapAdd: [SYS_ADMIN], ReadonlyRootfs: true}
+...
+`), testLookupEnv(map[string]string{"GREETING": "hello"}))
+	if err != nil {
+		t.Fatalf("Cannot parse the yaml spec, %s", err)
+	}
+	config := spec.Config
+	if config.Image != "busybox" || !reflect.DeepEqual(config.Cmd, []string{"sh", "-c", "echo \"$HOME\" # not a comment\necho hello\n"}) {
+		t.Errorf("Wrong cmd, %q", config.Cmd)
+	}
+	if !reflect.DeepEqual(config.Env, []string{"A=1", "B=it's", "C=é\t#"}) {
+		t.Errorf("Wrong env, %q", config.Env)
+	}
+	if !reflect.DeepEqual(config.Labels, map[string]string{"a.b": "folded text", "empty": "", "none": ""}) {
+		t.Errorf("Wrong labels, %q", config.Labels)
+	}
+	if !reflect.DeepEqual(spec.HostConfig.CapAdd, []string{"SYS_ADMIN"}) || !spec.HostConfig.ReadonlyRootfs {
+		t.Errorf("Wrong host config, %+v", spec.HostConfig)
+	}
+}
+
+func TestParseContainerSpecErrors(t *testing.T) {
+	_, err := ParseContainerSpec("web.yaml", []byte(`name: web
+pull: sometimes
+config:
+  Image: nginx
+  Imgae: nginx
+  Tty: yes
+  Healthcheck: {Interval: soon}
+hostConfig:
+  Memory: lots
+  Ulimits: [nofile=2048:1024]
+  BlkioWeightDevice: [/dev/sda:5]
+  RestartPolicy: {Name: always, Retries: 3}
+  Binds: /data:/data
+`), nil)
+	var specErrs *SpecErrors
+	if !errors.As(err, &specErrs) {
+		t.Fatalf("Should return the SpecErrors, %v", err)
+	}
+	var got []string
+	for _, e := range specErrs.Errors {
+		got = append(got, strings.SplitN(e.Error(), ": ", 3)[0]+" "+e.Field)
+	}
+	need := []string{
+		"web.yaml:5:3 config.Imgae",
+		"web.yaml:6:8 config.Tty",
+		"web.yaml:7:27 config.Healthcheck.Interval",
+		"web.yaml:9:11 hostConfig.Memory",
+		"web.yaml:10:13 hostConfig.Ulimits[0]",
+		"web.yaml:11:23 hostConfig.BlkioWeightDevice[0]",
+		"web.yaml:12:33 hostConfig.RestartPolicy.Retries",
+		"web.yaml:13:10 hostConfig.Binds",
+	}
+	if strings.Join(got, "\n") != strings.Join(need, "\n") {
+		t.Errorf("Wrong spec errors,\n%s", strings.Join(got, "\n"))
+	}
+
+	// the validation after the fields are decoded
+	_, err = ParseContainerSpec("web.yaml", []byte("name: web\npull: sometimes\nconfig:\n  Tty: true\n"), nil)
+	if err == nil || !strings.Contains(err.Error(), "web.yaml:2:7: pull: should be one of") || !strings.Contains(err.Error(), "web.yaml:4:3: config.Image: the image is required") {
+		t.Errorf("Wrong validation errors, %v", err)
+	}
+
+	for _, c := range []struct {
+		doc  string
+		need string
+	}{
+		{"config:\n  Image: ${IMAGE:?the image is required}\n", "2:10: the variable IMAGE is required"},
+		{"config:\n  Image: busybox\n    Tty: true\n", "3:5: bad indentation"},
+		{"config:\n\tImage: busybox\n", "2:1: the tabs are not allowed"},
+		{"config:\n  Image: busybox\n  Image: nginx\n", "3:3: duplicate key"},
+		{"config:\n  Cmd: [sh, -c\n", "2:15: the list is not closed"},
+		{"config:\n  Image: \"busybox\n", "2:10: the string is not closed"},
+		{"config: &base\n  Image: busybox\n", "1:9: the anchors, aliases and tags are not supported"},
+		{"{\"config\": {\"Image\": 'busybox'}}", "1:22: the json string should be double quoted"},
+		{"{\"config\": {\"Image\": \"busybox\",}}", "1:32: unexpected '}'"},
+		{"- busybox\n", "1:1: the document should be a map"},
+		{"config:\n  Image: busybox\n---\nname: web\n", "4:1: only one document is supported"},
+	} {
+		_, err := ParseContainerSpec("", []byte(c.doc), testLookupEnv(nil))
+		if err == nil || !strings.Contains(err.Error(), c.need) {
+			t.Errorf("Wrong error of %q, %v", c.doc, err)
+		}
+	}
+}
+
+func TestInterpolateEnv(t *testing.T) {
+	lookupEnv := testLookupEnv(map[string]string{"HOST": "db", "EMPTY": ""})
+	for value, need := range map[string]string{
+		"$HOST:5432":           "db:5432",
+		"${HOST}_1":            "db_1",
+		"${PORT:-5432}":        "5432",
+		"${EMPTY:-default}":    "default",
+		"${EMPTY-default}":     "",
+		"${MISSING-default}":   "default",
+		"$$HOST costs 5$":      "$HOST costs 5$",
+		"${MISSING}$MISSING.x": ".x",
+	} {
+		if got, err := interpolateEnv(value, lookupEnv); err != nil || got != need {
+			t.Errorf("Wrong interpolation of %q, %q, %v", value, got, err)
+		}
+	}
+	for _, value := range []string{"${HOST", "${}", "${HOST:+x}", "${EMPTY:?needed}", "${MISSING?needed}"} {
+		if _, err := interpolateEnv(value, lookupEnv); err == nil {
+			t.Errorf("Should reject the interpolation of %q", value)
+		}
+	}
+}
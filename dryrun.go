@@ -0,0 +1,197 @@
+package adoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// This part contains the dry run mode, the read calls (list, inspect, info, events) are sent to
+// the daemon, but the mutations (create, start, stop, remove, tag, push, update ...) are recorded
+// into the plan and answered with the synthetic responses instead, e.g.
+//   plan := &DryRun{}
+//   docker, _ := NewClient(daemonUrl, WithDryRun(plan))
+//   deploy(docker)
+//   fmt.Print(plan.Report())
+// The synthetic ids don't exist in the daemon, so the inspects on them are still not found.
+
+// PlannedAction is one mutation intercepted by the dry run
+type PlannedAction struct {
+	Operation  string // e.g. docker.containers.create, docker.images.push
+	Method     string
+	Path       string // without the api version prefix
+	Query      url.Values
+	Body       string
+	Attributes map[string]string // the container id, image name ... from the path
+	ResultId   string            // the synthetic id returned for the creations
+	Time       time.Time
+}
+
+func (a PlannedAction) String() string {
+	s := fmt.Sprintf("%s %s %s", a.Operation, a.Method, a.Path)
+	if len(a.Query) > 0 {
+		s += "?" + a.Query.Encode()
+	}
+	if a.ResultId != "" {
+		s += " => " + a.ResultId
+	}
+	if a.Body != "" {
+		s += " " + a.Body
+	}
+	return s
+}
+
+// DryRun keeps the plan of the intercepted mutations
+type DryRun struct {
+	lock    sync.Mutex
+	actions []PlannedAction
+	ids     int
+}
+
+// WithDryRun turns on the dry run mode, the mutations are recorded into the plan.
+// It is the innermost middleware so the other middlewares see the synthetic responses.
+func WithDryRun(plan *DryRun) ClientOption {
+	return func(options *clientOptions) {
+		options.dryRun = plan
+	}
+}
+
+// DryRun returns the plan if the client is in the dry run mode, otherwise nil
+func (client *DockerClient) DryRun() *DryRun {
+	return client.dryRun
+}
+
+// Plan returns the intercepted mutations in order
+func (d *DryRun) Plan() []PlannedAction {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return append([]PlannedAction(nil), d.actions...)
+}
+
+// Report returns the plan as text, one mutation per line
+func (d *DryRun) Report() string {
+	var buffer bytes.Buffer
+	for i, action := range d.Plan() {
+		fmt.Fprintf(&buffer, "%d. %s\n", i+1, action)
+	}
+	return buffer.String()
+}
+
+// Reset clears the plan
+func (d *DryRun) Reset() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.actions = nil
+}
+
+func (d *DryRun) add(action PlannedAction) PlannedAction {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if isDryRunCreation(action.Operation) {
+		d.ids += 1
+		action.ResultId = fmt.Sprintf("dryrun%058x", d.ids)
+	}
+	d.actions = append(d.actions, action)
+	return action
+}
+
+func isDryRunCreation(operation string) bool {
+	return operation == "docker.containers.create" || operation == "docker.containers.exec" || operation == "docker.commit" ||
+		operation == "docker.networks.create"
+}
+
+// middleware intercepts the mutations into the plan, the GET and HEAD requests are passed through
+func (d *DryRun) middleware(logger Logger) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method == "GET" || req.Method == "HEAD" {
+				return next.RoundTrip(req)
+			}
+			var body []byte
+			if req.Body != nil {
+				var err error
+				if body, err = ioutil.ReadAll(req.Body); err != nil {
+					return nil, err
+				}
+				req.Body.Close()
+			}
+			path := stripApiVersion(req.URL.Path)
+			operation, attributes := traceOperation(req.Method, path)
+			action := d.add(PlannedAction{
+				Operation:  operation,
+				Method:     req.Method,
+				Path:       path,
+				Query:      req.URL.Query(),
+				Body:       string(body),
+				Attributes: attributes,
+				Time:       time.Now(),
+			})
+			logger.Info("Dry run", "operation", operation, "method", req.Method, "path", path)
+			return dryRunResponse(req, action), nil
+		})
+	}
+}
+
+// dryRunResponse makes the plausible response for the mutation
+func dryRunResponse(req *http.Request, action PlannedAction) *http.Response {
+	statusCode := http.StatusNoContent
+	var body interface{}
+	switch action.Operation {
+	case "docker.containers.create", "docker.containers.exec":
+		statusCode, body = http.StatusCreated, map[string]interface{}{"Id": action.ResultId, "Warnings": []string{}}
+	case "docker.commit":
+		statusCode, body = http.StatusCreated, map[string]string{"Id": "sha256:" + action.ResultId}
+	case "docker.networks.create":
+		statusCode, body = http.StatusCreated, map[string]interface{}{"Id": action.ResultId, "Warning": ""}
+	case "docker.volumes.create":
+		// the volume is named by the request, or by the daemon
+		var options struct{ Name string }
+		json.Unmarshal([]byte(action.Body), &options)
+		statusCode, body = http.StatusCreated, map[string]interface{}{"Name": options.Name, "Driver": "local", "Scope": "local"}
+	case "docker.containers.wait":
+		statusCode, body = http.StatusOK, map[string]int{"StatusCode": 0}
+	case "docker.containers.update":
+		statusCode, body = http.StatusOK, map[string]interface{}{"Warnings": []string{}}
+	case "docker.images.pull":
+		image := action.Query.Get("fromImage")
+		if tag := action.Query.Get("tag"); tag != "" {
+			image += ":" + tag
+		}
+		statusCode, body = http.StatusOK, map[string]string{"status": "Dry run: pull " + image}
+	case "docker.images.push":
+		statusCode, body = http.StatusOK, map[string]string{"status": "Dry run: push " + action.Attributes[kTraceImageName]}
+	case "docker.images.remove":
+		statusCode, body = http.StatusOK, []map[string]string{{"Untagged": action.Attributes[kTraceImageName]}}
+	case "docker.containers.prune", "docker.images.prune", "docker.volumes.prune", "docker.networks.prune", "docker.build.prune":
+		// nothing is deleted in the dry run
+		statusCode, body = http.StatusOK, map[string]interface{}{"SpaceReclaimed": 0}
+	case "docker.images.tag":
+		statusCode = http.StatusCreated
+	case "docker.exec.start":
+		statusCode = http.StatusOK
+	}
+	var data []byte
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+	header := make(http.Header)
+	if body != nil {
+		header.Set("Content-Type", "application/json")
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewReader(data)),
+		ContentLength: int64(len(data)),
+		Request:       req,
+	}
+}
@@ -0,0 +1,72 @@
+package adoc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestDryRun(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+
+	plan := &DryRun{}
+	client, _ := NewClient(server.URL, WithDryRun(plan))
+	defer client.Close()
+	if client.DryRun() != plan {
+		t.Fatalf("The client should be in the dry run mode")
+	}
+
+	if images, err := client.ListImages(false); err != nil || len(images) != 1 {
+		t.Fatalf("The reads should go to the daemon, %+v, %v", images, err)
+	}
+	if err := client.PullImage("redis", "3.0"); err != nil {
+		t.Fatalf("Cannot dry run the pull, %s", err)
+	}
+	id, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{}, "web")
+	if err != nil || len(id) != 64 {
+		t.Fatalf("Should return the synthetic container id, %q, %v", id, err)
+	}
+	if err := client.StartContainer(id); err != nil {
+		t.Fatalf("Cannot dry run the start, %s", err)
+	}
+	if code, err := client.WaitContainer(id); err != nil || code != 0 {
+		t.Fatalf("Cannot dry run the wait, %d, %v", code, err)
+	}
+	if err := client.RemoveImage("busybox", false, false); err != nil {
+		t.Fatalf("Cannot dry run the image remove, %s", err)
+	}
+
+	for _, request := range server.Requests() {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("The mutation should not be sent to the daemon, %s", request)
+		}
+	}
+	if containers, _ := client.ListContainers(true, false, ""); len(containers) != 0 {
+		t.Errorf("The daemon should not have any containers, %+v", containers)
+	}
+
+	actions := plan.Plan()
+	operations := []string{"docker.images.pull", "docker.containers.create", "docker.containers.start",
+		"docker.containers.wait", "docker.images.remove"}
+	if len(actions) != len(operations) {
+		t.Fatalf("Wrong planned actions, %+v", actions)
+	}
+	for i, operation := range operations {
+		if actions[i].Operation != operation {
+			t.Errorf("Wrong planned action, need=%s, got=%s", operation, actions[i].Operation)
+		}
+	}
+	if actions[1].ResultId != id || actions[1].Query.Get("name") != "web" || !strings.Contains(actions[1].Body, "busybox") {
+		t.Errorf("Wrong planned create, %+v", actions[1])
+	}
+	if actions[2].Attributes[kTraceContainerId] != id {
+		t.Errorf("Wrong planned start, %+v", actions[2])
+	}
+	report := plan.Report()
+	if !strings.HasPrefix(report, "1. docker.images.pull POST /images/create?fromImage=redis&tag=3.0") {
+		t.Errorf("Wrong report, %s", report)
+	}
+}
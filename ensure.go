@@ -0,0 +1,213 @@
+package adoc
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// This part contains the idempotent deployment of a container, e.g.
+//   spec, err := LoadContainerSpec("web.yaml")
+//   result, err := docker.EnsureContainer(EnsureSpec{ContainerSpec: spec, StopTimeout: 30})
+//   fmt.Println(result.Action, result.Id)
+// The hash of the desired config is kept in a label of the container, the container is recreated only
+// when the hash changes, so the deploy loop could ensure the same spec again and again without
+// restarting the containers.
+
+const (
+	kConfigHashLabel = "com.github.mijia.adoc.config-hash"
+
+	// the creations racing for the same name are retried by comparing with the winner
+	kEnsureMaxAttempts = 3
+)
+
+// EnsureAction is what EnsureContainer has done to converge the container
+type EnsureAction string
+
+const (
+	EnsureUnchanged EnsureAction = "unchanged" // the container is up to date and running
+	EnsureStarted   EnsureAction = "started"   // the container is up to date but was not running
+	EnsureCreated   EnsureAction = "created"   // there was no container
+	EnsureRecreated EnsureAction = "recreated" // the old container had a different config, and was removed
+)
+
+// EnsureSpec is the desired container for EnsureContainer, the container is found by the Name, or by
+// the Selector label with the value in the Config.Labels if there is no name
+type EnsureSpec struct {
+	ContainerSpec
+	Selector                 string // the label key to find the container without the name
+	AuthConfig               *AuthConfig
+	PreserveAnonymousVolumes bool // mounts the anonymous volumes of the old container into the new one
+	StopTimeout              int  // the seconds to wait before killing the old container, default to 10
+}
+
+// EnsureResult is the outcome of EnsureContainer
+type EnsureResult struct {
+	Action EnsureAction
+	Id     string
+	Hash   string
+}
+
+// ConfigHash returns the canonical hash of the config to create the container, which is the sha256 of
+// the create body with the map keys sorted. The name, the pull policy and the auth are not included, and
+// neither is the image id, so the moved tag of the image doesn't change the hash.
+func (spec ContainerSpec) ConfigHash() (string, error) {
+	config := spec.Config
+	if _, ok := config.Labels[kConfigHashLabel]; ok {
+		config.Labels = copyStringMap(config.Labels)
+		delete(config.Labels, kConfigHashLabel)
+	}
+	if len(config.Labels) == 0 {
+		config.Labels = nil
+	}
+	body, err := createContainerBody(config, spec.HostConfig, spec.NetworkingConfig)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EnsureContainer converges the container to the spec. The container with the same config hash is
+// started if it's not running, and left alone otherwise. The container with a different hash is stopped,
+// removed and created again, its anonymous volumes are removed unless PreserveAnonymousVolumes.
+// The image is pulled by the Pull policy of the spec only when the container is to be created.
+func (client *DockerClient) EnsureContainer(spec EnsureSpec) (EnsureResult, error) {
+	var result EnsureResult
+	hash, err := spec.ConfigHash()
+	if err != nil {
+		return result, err
+	}
+	result.Hash = hash
+
+	for attempt := 1; ; attempt += 1 {
+		existing, err := client.findEnsureContainer(spec)
+		if err != nil {
+			return result, err
+		}
+		if existing != nil && existing.Config.Labels[kConfigHashLabel] == hash {
+			result.Id = existing.Id
+			state := existing.State
+			if state.Running || state.Restarting || state.Paused {
+				result.Action = EnsureUnchanged
+				return result, nil
+			}
+			result.Action = EnsureStarted
+			return result, client.StartContainer(existing.Id)
+		}
+
+		// pull before removing the old one, so it keeps running if the image is not available
+		if err := client.ensureImage(spec.Config.Image, spec.Pull, spec.AuthConfig); err != nil {
+			return result, err
+		}
+		var volumes []Mount
+		result.Action = EnsureCreated
+		if existing != nil {
+			if spec.PreserveAnonymousVolumes {
+				volumes = anonymousVolumes(*existing, spec.HostConfig)
+			}
+			if err := client.removeEnsureContainer(*existing, spec); err != nil {
+				return result, err
+			}
+			result.Action = EnsureRecreated
+		}
+
+		config, hostConfig := spec.Config, spec.HostConfig
+		config.Labels = copyStringMap(config.Labels)
+		config.Labels[kConfigHashLabel] = hash
+		hostConfig.Mounts = append(append([]Mount(nil), hostConfig.Mounts...), volumes...)
+		id, err := client.CreateContainer(config, hostConfig, spec.NetworkingConfig, spec.Name)
+		if IsConflict(err) && attempt < kEnsureMaxAttempts {
+			client.logger.Warn("The container name is taken by another creation, compare with it again", "container", spec.Name, "attempt", attempt)
+			continue
+		}
+		if err != nil {
+			return result, err
+		}
+		result.Id = id
+		return result, client.StartContainer(id)
+	}
+}
+
+// findEnsureContainer returns the container of the spec, or nil if not found
+func (client *DockerClient) findEnsureContainer(spec EnsureSpec) (*ContainerDetail, error) {
+	id := spec.Name
+	if id == "" {
+		value, ok := spec.Config.Labels[spec.Selector]
+		if spec.Selector == "" || !ok {
+			return nil, fmt.Errorf("Either the name or the selector label in the config labels is required")
+		}
+		filters := NewFilters().Label(spec.Selector, value)
+		containers, err := client.ListContainersWithOptions(ListContainersOptions{All: true, Filters: filters})
+		if err != nil {
+			return nil, err
+		}
+		switch len(containers) {
+		case 0:
+			return nil, nil
+		case 1:
+			id = containers[0].Id
+		default:
+			return nil, fmt.Errorf("There are %d containers with the label %s=%s, expected at most one", len(containers), spec.Selector, value)
+		}
+	}
+	container, err := client.InspectContainer(id)
+	if IsNotFound(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// the inspect by name matches the id prefix too
+	if spec.Name != "" && strings.TrimPrefix(container.Name, "/") != spec.Name {
+		return nil, nil
+	}
+	return &container, nil
+}
+
+// removeEnsureContainer stops and removes the outdated container, the one removed by others is fine
+func (client *DockerClient) removeEnsureContainer(container ContainerDetail, spec EnsureSpec) error {
+	if container.State.Running || container.State.Restarting || container.State.Paused {
+		timeout := spec.StopTimeout
+		if timeout <= 0 {
+			timeout = 10
+		}
+		if err := client.StopContainer(container.Id, timeout); err != nil && !IsNotFound(err) {
+			return err
+		}
+	}
+	err := client.RemoveContainer(container.Id, true, !spec.PreserveAnonymousVolumes)
+	if err != nil && !IsNotFound(err) {
+		return err
+	}
+	return nil
+}
+
+// anonymousVolumes returns the mounts of the anonymous volumes of the container, which are not named in
+// its Binds or Mounts, and whose targets are not mounted by the new host config
+func anonymousVolumes(container ContainerDetail, hostConfig HostConfig) []Mount {
+	named := make(map[string]bool)
+	for _, bind := range container.HostConfig.Binds {
+		named[strings.SplitN(bind, ":", 2)[0]] = true
+	}
+	for _, mount := range container.HostConfig.Mounts {
+		named[mount.Source] = true
+	}
+	mounted := make(map[string]bool)
+	for _, bind := range hostConfig.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) >= 2 {
+			mounted[parts[1]] = true
+		}
+	}
+	for _, mount := range hostConfig.Mounts {
+		mounted[mount.Target] = true
+	}
+	var ret []Mount
+	for _, point := range container.Mounts {
+		if point.Type == "volume" && point.Name != "" && !named[point.Name] && !mounted[point.Destination] {
+			ret = append(ret, Mount{Type: "volume", Source: point.Name, Target: point.Destination})
+		}
+	}
+	return ret
+}
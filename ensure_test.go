@@ -0,0 +1,122 @@
+package adoc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestEnsureContainer(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "web", Config: map[string]interface{}{"Volumes": map[string]interface{}{"/cache": map[string]interface{}{}}}})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+
+	spec := EnsureSpec{ContainerSpec: ContainerSpec{
+		Name:   "web",
+		Config: ContainerConfig{Image: "web", Env: []string{"MODE=prod"}},
+	}}
+	ensure := func(need EnsureAction) EnsureResult {
+		t.Helper()
+		result, err := client.EnsureContainer(spec)
+		if err != nil || result.Action != need {
+			t.Fatalf("Should be %s, %+v, %v", need, result, err)
+		}
+		return result
+	}
+	countRequests := func(from int, suffix string) int {
+		count := 0
+		for _, request := range server.Requests()[from:] {
+			if strings.HasSuffix(strings.SplitN(request, "?", 2)[0], suffix) {
+				count += 1
+			}
+		}
+		return count
+	}
+
+	created := ensure(EnsureCreated)
+	detail, _ := client.InspectContainer("web")
+	if !detail.State.Running || detail.Config.Labels[kConfigHashLabel] != created.Hash || len(detail.Mounts) != 1 {
+		t.Errorf("Wrong created container, %+v", detail)
+	}
+	cache := detail.Mounts[0].Name
+
+	// the same spec again does nothing, even with the hash label in the spec
+	before := len(server.Requests())
+	spec.Config.Labels = map[string]string{kConfigHashLabel: "stale"}
+	if result := ensure(EnsureUnchanged); result.Id != created.Id || result.Hash != created.Hash {
+		t.Errorf("Wrong unchanged result, %+v, %+v", result, created)
+	}
+	if n := countRequests(before, "/stop") + countRequests(before, "/create") + countRequests(before, "/start"); n != 0 {
+		t.Errorf("Should not touch the container, %v", server.Requests()[before:])
+	}
+	client.StopContainer("web")
+	ensure(EnsureStarted)
+
+	// the changed config recreates the container with the anonymous volume of the old one
+	spec.Config.Env = []string{"MODE=debug"}
+	spec.PreserveAnonymousVolumes = true
+	recreated := ensure(EnsureRecreated)
+	detail, _ = client.InspectContainer("web")
+	if recreated.Id == created.Id || recreated.Hash == created.Hash || detail.Id != recreated.Id {
+		t.Errorf("Wrong recreated container, %+v, %+v", recreated, created)
+	}
+	if len(detail.Mounts) != 1 || detail.Mounts[0].Name != cache || detail.Mounts[0].Destination != "/cache" {
+		t.Errorf("The anonymous volume should be preserved, %+v", detail.Mounts)
+	}
+	if _, err := client.InspectContainer(created.Id); !IsNotFound(err) {
+		t.Errorf("The old container should be removed, %v", err)
+	}
+
+	// without preserving, the new container has its own anonymous volume, which is removed with it
+	spec.Config.Env = nil
+	spec.PreserveAnonymousVolumes = false
+	ensure(EnsureRecreated)
+	detail, _ = client.InspectContainer("web")
+	if len(detail.Mounts) != 1 || detail.Mounts[0].Name == cache {
+		t.Fatalf("Should have a new anonymous volume, %+v", detail.Mounts)
+	}
+	spec.Config.Env = []string{"MODE=prod"}
+	ensure(EnsureRecreated)
+	if _, err := client.InspectVolume(detail.Mounts[0].Name); !IsNotFound(err) {
+		t.Errorf("The anonymous volume should be removed, %v", err)
+	}
+}
+
+func TestEnsureContainerSelectorAndRace(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "worker"})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+
+	spec := EnsureSpec{
+		ContainerSpec: ContainerSpec{Config: ContainerConfig{Image: "worker", Labels: map[string]string{"app": "worker"}}},
+		Selector:      "app",
+	}
+	first, err := client.EnsureContainer(spec)
+	if err != nil || first.Action != EnsureCreated {
+		t.Fatalf("Should be created, %+v, %v", first, err)
+	}
+	if result, err := client.EnsureContainer(spec); err != nil || result.Action != EnsureUnchanged || result.Id != first.Id {
+		t.Errorf("Should be unchanged by the selector, %+v, %v", result, err)
+	}
+	spec.Selector = "missing"
+	if _, err := client.EnsureContainer(spec); err == nil {
+		t.Errorf("Should fail without the name or the selector label")
+	}
+
+	// the name conflict of a racing creation is retried by looking up the container again
+	spec = EnsureSpec{ContainerSpec: ContainerSpec{Name: "job", Config: ContainerConfig{Image: "worker"}}}
+	server.AddFault(adoctest.Fault{Path: "containers/create", StatusCode: 409, Message: "Conflict. The name \"/job\" is already in use", Times: 1})
+	if result, err := client.EnsureContainer(spec); err != nil || result.Action != EnsureCreated {
+		t.Errorf("Should retry the conflicted creation, %+v, %v", result, err)
+	}
+	server.AddFault(adoctest.Fault{Path: "containers/create", StatusCode: 409, Message: "Conflict", Times: kEnsureMaxAttempts})
+	spec.Config.Cmd = []string{"run"}
+	if _, err := client.EnsureContainer(spec); !IsConflict(err) {
+		t.Errorf("Should give up after the attempts, %v", err)
+	}
+}
@@ -84,6 +84,9 @@ func (client *DockerClient) EventsSince(filters string, since time.Duration, unt
 
 	v := url.Values{}
 	if filters != "" {
+		if err := checkFilters(filters); err != nil {
+			return nil, err
+		}
 		v.Set("filters", filters)
 	}
 	now := time.Now()
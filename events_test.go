@@ -1,7 +1,6 @@
 package adoc
 
 import (
-	"fmt"
 	"testing"
 	"time"
 )
@@ -15,16 +14,40 @@ func TestEventsPolling(t *testing.T) {
 }
 
 func TestEventsMonitor(t *testing.T) {
+	events := make(chan Event, 10)
 	monitorId := docker.MonitorEvents("", func(event Event, err error) {
 		if err != nil {
 			t.Errorf("Error when calling monitor, %s", err)
 		} else {
 			d("Event", event)
+			events <- event
 		}
 	})
-	fmt.Println("Please do some docker operations")
-	time.Sleep(1 * time.Minute)
-	docker.StopMonitor(monitorId)
+	defer docker.StopMonitor(monitorId)
+	waitForWatchers(t, server, 1)
+
+	containerConf := ContainerConfig{
+		Cmd:   []string{"python", "app.py"},
+		Image: "training/webapp",
+	}
+	id, err := docker.CreateContainer(containerConf, HostConfig{}, NetworkingConfig{})
+	if err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	defer docker.RemoveContainer(id, true, true)
+	if err := docker.StartContainer(id); err != nil {
+		t.Fatalf("Cannot start the container, %s", err)
+	}
+	for _, status := range []string{DockerEventCreate, DockerEventStart} {
+		select {
+		case event := <-events:
+			if event.Status != status || event.ID != id {
+				t.Errorf("Wrong event, need=%s, got=%+v", status, event)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout when waiting for the %s event", status)
+		}
+	}
 }
 
 func TestStatsMonitor(t *testing.T) {
@@ -34,7 +57,7 @@ func TestStatsMonitor(t *testing.T) {
 		Cmd:          []string{"python", "app.py"},
 		Image:        "training/webapp",
 	}
-	id, err := docker.CreateContainer(containerConf, HostConfig{})
+	id, err := docker.CreateContainer(containerConf, HostConfig{}, NetworkingConfig{})
 	if err != nil {
 		t.Fatalf("Cannot create the container, %s", err)
 	}
@@ -42,14 +65,22 @@ func TestStatsMonitor(t *testing.T) {
 		t.Fatalf("Cannot start the container, %s", err)
 	}
 
+	received := make(chan Stats, 10)
 	monitorId := docker.MonitorStats(id, func(stats Stats, err error) {
 		if err != nil {
 			t.Errorf("Error when calling monitor, %s", err)
 		} else {
 			d("Stats CpuUsage.PercpuUsage", stats.CpuStats.CpuUsage.PercpuUsage)
+			received <- stats
 		}
 	})
-	time.Sleep(30 * time.Second)
+	for i := 0; i < 3; i++ {
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Timeout when waiting for the stats")
+		}
+	}
 	docker.StopMonitor(monitorId)
 	docker.RemoveContainer(id, true, true)
 }
@@ -0,0 +1,229 @@
+package adoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// This part contains the typed filters for the list and events endpoints, e.g.
+//   filters := NewFilters().Label("app", "web").Status("running")
+//   containers, err := docker.ListContainers(true, false, docker.EncodeFilters(filters))
+// The daemon before v1.22 takes the filters as {"key":["value"]}, the later ones take {"key":{"value":true}}.
+
+const kFiltersMapApiVersion = "v1.22"
+
+var (
+	kFilterStatuses = []string{"created", "restarting", "running", "removing", "paused", "exited", "dead"}
+	kFilterHealths  = []string{"starting", "healthy", "unhealthy", "none"}
+	kFilterTypes    = []string{"container", "image", "volume", "network", "daemon", "plugin", "node", "service", "secret", "config"}
+)
+
+// Filters is the filter values by key, the values of the same key are ORed by the daemon
+type Filters map[string][]string
+
+func NewFilters() Filters {
+	return make(Filters)
+}
+
+// Add appends the value to the key, the duplicates are ignored
+func (f Filters) Add(key string, value string) Filters {
+	for _, v := range f[key] {
+		if v == value {
+			return f
+		}
+	}
+	f[key] = append(f[key], value)
+	return f
+}
+
+// Label filters by the label key, or the key=value if the value is not empty
+func (f Filters) Label(key string, value string) Filters {
+	if value != "" {
+		key = key + "=" + value
+	}
+	return f.Add("label", key)
+}
+
+// LabelNot filters out the objects with the label key, or the key=value if the value is not empty,
+// it is only supported by the prune endpoints
+func (f Filters) LabelNot(key string, value string) Filters {
+	if value != "" {
+		key = key + "=" + value
+	}
+	return f.Add("label!", key)
+}
+
+// Until filters the objects created before the timestamp or the duration, e.g. "24h", "2017-01-04T10:00:00"
+func (f Filters) Until(until string) Filters {
+	f["until"] = []string{until}
+	return f
+}
+
+// Status filters the containers by status, e.g. running, exited
+func (f Filters) Status(status string) Filters {
+	return f.Add("status", status)
+}
+
+// Ancestor filters the containers created from the image or its descendants
+func (f Filters) Ancestor(image string) Filters {
+	return f.Add("ancestor", image)
+}
+
+// Before filters the containers (or images) created before the given id or name
+func (f Filters) Before(id string) Filters {
+	return f.Add("before", id)
+}
+
+// Since filters the containers (or images) created since the given id or name
+func (f Filters) Since(id string) Filters {
+	return f.Add("since", id)
+}
+
+func (f Filters) Name(name string) Filters {
+	return f.Add("name", name)
+}
+
+func (f Filters) Id(id string) Filters {
+	return f.Add("id", id)
+}
+
+// Exited filters the containers by the exit code
+func (f Filters) Exited(code int) Filters {
+	return f.Add("exited", strconv.Itoa(code))
+}
+
+func (f Filters) Network(network string) Filters {
+	return f.Add("network", network)
+}
+
+func (f Filters) Volume(volume string) Filters {
+	return f.Add("volume", volume)
+}
+
+// Health filters the containers by the healthcheck status, e.g. healthy, unhealthy
+func (f Filters) Health(health string) Filters {
+	return f.Add("health", health)
+}
+
+// Event filters the events by the object type and the action, e.g. Event("container", "start"),
+// the empty type or action matches all
+func (f Filters) Event(eventType string, action string) Filters {
+	if eventType != "" {
+		f.Add("type", eventType)
+	}
+	if action != "" {
+		f.Add("event", action)
+	}
+	return f
+}
+
+// Container filters the events by the container id or name
+func (f Filters) Container(container string) Filters {
+	return f.Add("container", container)
+}
+
+// Image filters the events by the image name
+func (f Filters) Image(image string) Filters {
+	return f.Add("image", image)
+}
+
+// Stars filters the search results with at least the stars
+func (f Filters) Stars(stars int) Filters {
+	f["stars"] = []string{strconv.Itoa(stars)}
+	return f
+}
+
+// IsOfficial filters the search results by the official flag
+func (f Filters) IsOfficial(official bool) Filters {
+	f["is-official"] = []string{strconv.FormatBool(official)}
+	return f
+}
+
+// IsAutomated filters the search results by the automated flag
+func (f Filters) IsAutomated(automated bool) Filters {
+	f["is-automated"] = []string{strconv.FormatBool(automated)}
+	return f
+}
+
+// Dangling filters the untagged images
+func (f Filters) Dangling(dangling bool) Filters {
+	f["dangling"] = []string{strconv.FormatBool(dangling)}
+	return f
+}
+
+// Validate checks the values of the keys with the fixed choices
+func (f Filters) Validate() error {
+	check := func(key string, choices []string) error {
+		for _, value := range f[key] {
+			if !containsString(choices, value) {
+				return fmt.Errorf("Invalid %s filter %q, should be one of %s", key, value, strings.Join(choices, ", "))
+			}
+		}
+		return nil
+	}
+	if err := check("status", kFilterStatuses); err != nil {
+		return err
+	}
+	if err := check("health", kFilterHealths); err != nil {
+		return err
+	}
+	if err := check("type", kFilterTypes); err != nil {
+		return err
+	}
+	for _, key := range []string{"dangling", "is-official", "is-automated"} {
+		if err := check(key, []string{"true", "false"}); err != nil {
+			return err
+		}
+	}
+	for _, key := range []string{"exited", "stars"} {
+		for _, value := range f[key] {
+			if _, err := strconv.Atoi(value); err != nil {
+				return fmt.Errorf("Invalid %s filter %q, should be a number", key, value)
+			}
+		}
+	}
+	return nil
+}
+
+// Encode returns the filters JSON in the shape of the api version, empty string for no filters
+func (f Filters) Encode(apiVersion string) string {
+	if len(f) == 0 {
+		return ""
+	}
+	var data []byte
+	if compareApiVersion(apiVersion, kFiltersMapApiVersion) < 0 {
+		legacy := make(map[string][]string, len(f))
+		for key, values := range f {
+			legacy[key] = append([]string(nil), values...)
+			sort.Strings(legacy[key])
+		}
+		data, _ = json.Marshal(legacy)
+	} else {
+		current := make(map[string]map[string]bool, len(f))
+		for key, values := range f {
+			current[key] = make(map[string]bool, len(values))
+			for _, value := range values {
+				current[key][value] = true
+			}
+		}
+		data, _ = json.Marshal(current)
+	}
+	return string(data)
+}
+
+// checkFilters rejects the malformed filters JSON before sending to the daemon
+func checkFilters(filters string) error {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(filters), &decoded); err != nil {
+		return fmt.Errorf("Invalid filters %q, should be a JSON object, %s", filters, err)
+	}
+	return nil
+}
+
+// EncodeFilters encodes the filters in the shape of the client api version
+func (client *DockerClient) EncodeFilters(f Filters) string {
+	return f.Encode(client.apiVersion)
+}
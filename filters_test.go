@@ -0,0 +1,73 @@
+package adoc
+
+import (
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestFiltersEncode(t *testing.T) {
+	filters := NewFilters().Label("app", "web").Label("tier", "").Status("running").Status("exited").Status("running")
+	if encoded := filters.Encode("v1.17"); encoded != `{"label":["app=web","tier"],"status":["exited","running"]}` {
+		t.Errorf("Wrong legacy filters, %s", encoded)
+	}
+	if encoded := filters.Encode("v1.24"); encoded != `{"label":{"app=web":true,"tier":true},"status":{"exited":true,"running":true}}` {
+		t.Errorf("Wrong filters, %s", encoded)
+	}
+	if encoded := NewFilters().Encode("v1.24"); encoded != "" {
+		t.Errorf("Empty filters should be encoded as empty, %s", encoded)
+	}
+	if encoded := NewFilters().Event("container", "").Dangling(false).Dangling(true).Encode("v1.22"); encoded != `{"dangling":{"true":true},"type":{"container":true}}` {
+		t.Errorf("Wrong filters, %s", encoded)
+	}
+
+	if err := filters.Validate(); err != nil {
+		t.Errorf("Filters should be valid, %s", err)
+	}
+	if err := NewFilters().Status("stopped").Validate(); err == nil {
+		t.Errorf("Should reject the unknown status")
+	}
+	if err := NewFilters().Add("exited", "zero").Validate(); err == nil {
+		t.Errorf("Should reject the non numeric exit code")
+	}
+}
+
+func TestListWithFilters(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	server.AddImage(adoctest.ImageSpec{Name: "redis", Labels: map[string]string{"tier": "cache"}})
+
+	for _, apiVersion := range []string{"v1.17", "v1.24"} {
+		client, _ := NewClient(server.URL, WithAPIVersion(apiVersion))
+		webId, _ := client.CreateContainer(ContainerConfig{Image: "busybox", Labels: map[string]string{"app": "web"}}, HostConfig{}, NetworkingConfig{})
+		dbId, _ := client.CreateContainer(ContainerConfig{Image: "busybox", Labels: map[string]string{"app": "db"}}, HostConfig{}, NetworkingConfig{})
+		client.StartContainer(webId)
+
+		containers, err := client.ListContainers(true, false, client.EncodeFilters(NewFilters().Label("app", "web").Status("running")))
+		if err != nil || len(containers) != 1 || containers[0].Id != webId {
+			t.Errorf("Wrong filtered containers with %s, %+v, %v", apiVersion, containers, err)
+		}
+		images, err := client.ListImages(false, client.EncodeFilters(NewFilters().Label("tier", "")))
+		if err != nil || len(images) != 1 {
+			t.Errorf("Wrong filtered images with %s, %+v, %v", apiVersion, images, err)
+		}
+		client.RemoveContainer(webId, true, true)
+		client.RemoveContainer(dbId, true, true)
+		client.Close()
+	}
+
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+	if _, err := client.ListContainers(true, false, `{"status": ["running"]`); err == nil {
+		t.Errorf("Should reject the malformed filters")
+	}
+	before := len(server.Requests())
+	var errs []error
+	monitorId := client.MonitorEvents(`{"type": ["container"]`, func(event Event, err error) {
+		errs = append(errs, err)
+	})
+	if monitorId != 0 || len(errs) != 1 || errs[0] == nil || len(server.Requests()) != before {
+		t.Errorf("Should reject the malformed filters before monitoring, %d, %v", monitorId, errs)
+	}
+}
@@ -0,0 +1,441 @@
+package adoc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This part contains the policy driven garbage collector of the containers and images, e.g.
+//   gc := NewGarbageCollector(docker, GCPolicy{
+//       ExitedContainersOlderThan: 12 * time.Hour,
+//       ContainerFilters:          NewFilters().Label("ci", ""),
+//       KeepImagesPerRepo:         3,
+//       ImagesUnusedFor:           7 * 24 * time.Hour,
+//       DeleteInterval:            time.Second,
+//   })
+//   gc.Start() // tracks the image usage from the events
+//   report, err := gc.Collect(true) // the dry run
+//   fmt.Print(report)
+// The objects with the protected label are never touched, the images used by any container are kept,
+// and the conflicts from the daemon are reported as skipped instead of failing the collection.
+
+const kDefaultProtectedLabel = "protected"
+
+// GCPolicy is the rules of the collection, the zero rules are disabled
+type GCPolicy struct {
+	ExitedContainersOlderThan time.Duration // removes the exited and dead containers finished before
+	ContainerFilters          Filters       // selects the containers to collect, e.g. the labels
+	KeepImagesPerRepo         int           // keeps the newest tagged images of each repository
+	ImagesUnusedFor           time.Duration // removes the images not used by any container for the duration
+	ImageFilters              Filters       // selects the images to collect, e.g. the labels
+	ProtectedLabel            string        // default to "protected"
+	DeleteInterval            time.Duration // the minimum interval between the deletions
+}
+
+// GCAction is one collected object in the report
+type GCAction struct {
+	Kind    string // container or image
+	Id      string
+	Name    string
+	Reason  string
+	Size    int64
+	Skipped bool  // the object is kept, the reason says why
+	Err     error // the deletion failed
+}
+
+func (a GCAction) String() string {
+	verb := "remove"
+	if a.Skipped {
+		verb = "keep"
+	}
+	s := fmt.Sprintf("%s %s %s", verb, a.Kind, shortId(a.Id))
+	if a.Name != "" {
+		s += " " + a.Name
+	}
+	s += ": " + a.Reason
+	if a.Err != nil {
+		s += fmt.Sprintf(" (failed: %s)", a.Err)
+	}
+	return s
+}
+
+// GCReport is the result of one collection
+type GCReport struct {
+	DryRun         bool
+	Actions        []GCAction
+	SpaceReclaimed int64 // the image sizes, the shared layers could be counted more than once
+}
+
+// Removed returns the objects removed, or to be removed in the dry run
+func (r GCReport) Removed() []GCAction {
+	var ret []GCAction
+	for _, action := range r.Actions {
+		if !action.Skipped && action.Err == nil {
+			ret = append(ret, action)
+		}
+	}
+	return ret
+}
+
+func (r GCReport) String() string {
+	var buffer bytes.Buffer
+	if r.DryRun {
+		buffer.WriteString("Dry run, nothing is removed\n")
+	}
+	for _, action := range r.Actions {
+		fmt.Fprintln(&buffer, action)
+	}
+	fmt.Fprintf(&buffer, "%d removed, %s reclaimed\n", len(r.Removed()), HumanSize(float64(r.SpaceReclaimed)))
+	return buffer.String()
+}
+
+type GarbageCollector struct {
+	client *DockerClient
+	policy GCPolicy
+
+	lock      sync.Mutex
+	lastUsed  map[string]time.Time // by the image id or name
+	since     time.Time            // the usage before is unknown
+	monitorId int64
+	lastTime  time.Time // of the last deletion
+}
+
+func NewGarbageCollector(client *DockerClient, policy GCPolicy) *GarbageCollector {
+	if policy.ProtectedLabel == "" {
+		policy.ProtectedLabel = kDefaultProtectedLabel
+	}
+	return &GarbageCollector{
+		client:   client,
+		policy:   policy,
+		lastUsed: make(map[string]time.Time),
+		since:    time.Now(),
+	}
+}
+
+// Start monitors the container events to track the image usage, the images are thought to be
+// used at the start time if there is no event since, so the ImagesUnusedFor counts from the start.
+func (gc *GarbageCollector) Start() {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	if gc.monitorId != 0 {
+		return
+	}
+	gc.monitorId = gc.client.MonitorEvents("", func(event Event, err error) {
+		if err != nil {
+			return
+		}
+		if event.Type != "" && event.Type != ContainerEventType {
+			return
+		}
+		image := event.From
+		if image == "" {
+			image = event.Actor.Attributes["image"]
+		}
+		if image != "" {
+			gc.MarkImageUsed(image, time.Unix(0, eventTimeNano(event)))
+		}
+	})
+}
+
+func (gc *GarbageCollector) Stop() {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	if gc.monitorId != 0 {
+		gc.client.StopMonitor(gc.monitorId)
+		gc.monitorId = 0
+	}
+}
+
+func eventTimeNano(event Event) int64 {
+	if event.TimeNano > 0 {
+		return event.TimeNano
+	}
+	if event.Time > 0 {
+		return event.Time * int64(time.Second)
+	}
+	return time.Now().UnixNano()
+}
+
+// MarkImageUsed records the image id or name is used at the time, it could be used to restore the
+// usage tracked before the restart of the collector
+func (gc *GarbageCollector) MarkImageUsed(image string, t time.Time) {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	key := normalizeImageTag(image)
+	if t.After(gc.lastUsed[key]) {
+		gc.lastUsed[key] = t
+	}
+}
+
+// ImageLastUsed returns the last used time of the image by its id and tags
+func (gc *GarbageCollector) ImageLastUsed(image Image) time.Time {
+	gc.lock.Lock()
+	defer gc.lock.Unlock()
+	last := gc.since
+	if created := time.Unix(image.Created, 0); created.After(last) {
+		last = created
+	}
+	for _, key := range append([]string{image.Id}, image.RepoTags...) {
+		if t := gc.lastUsed[normalizeImageTag(key)]; t.After(last) {
+			last = t
+		}
+	}
+	return last
+}
+
+// Collect runs the policy once, nothing is removed in the dry run
+func (gc *GarbageCollector) Collect(dryRun bool) (GCReport, error) {
+	report := GCReport{DryRun: dryRun}
+	containers, err := gc.client.ListContainersWithOptions(ListContainersOptions{All: true})
+	if err != nil {
+		return report, err
+	}
+	removed := make(map[string]bool)
+	if gc.policy.ExitedContainersOlderThan > 0 {
+		if err := gc.collectContainers(&report, removed); err != nil {
+			return report, err
+		}
+	}
+	if gc.policy.KeepImagesPerRepo > 0 || gc.policy.ImagesUnusedFor > 0 {
+		inUse := make(map[string]bool)
+		for _, container := range containers {
+			if !removed[container.Id] {
+				inUse[container.ImageID] = true
+				inUse[normalizeImageTag(container.Image)] = true
+			}
+		}
+		if err := gc.collectImages(&report, inUse); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+func (gc *GarbageCollector) isProtected(labels map[string]string) bool {
+	_, ok := labels[gc.policy.ProtectedLabel]
+	return ok
+}
+
+func (gc *GarbageCollector) collectContainers(report *GCReport, removed map[string]bool) error {
+	filters := NewFilters()
+	for key, values := range gc.policy.ContainerFilters {
+		filters[key] = append([]string(nil), values...)
+	}
+	if len(filters["status"]) == 0 {
+		filters.Status("exited").Status("dead")
+	}
+	candidates, err := gc.client.ListContainersWithOptions(ListContainersOptions{All: true, Filters: filters})
+	if err != nil {
+		return err
+	}
+	var ids []string
+	for _, container := range candidates {
+		if gc.isProtected(container.Labels) {
+			report.Actions = append(report.Actions, GCAction{Kind: "container", Id: container.Id,
+				Name: containerName(container.Names), Reason: "protected", Skipped: true})
+			continue
+		}
+		ids = append(ids, container.Id)
+	}
+	details, err := gc.client.InspectContainers(ids, kDefaultInspectConcurrency)
+	if err != nil {
+		return err
+	}
+	deadline := time.Now().Add(-gc.policy.ExitedContainersOlderThan)
+	for _, detail := range details {
+		if detail.State.Running || detail.State.FinishedAt.After(deadline) {
+			continue
+		}
+		action := GCAction{
+			Kind:   "container",
+			Id:     detail.Id,
+			Name:   strings.TrimPrefix(detail.Name, "/"),
+			Reason: fmt.Sprintf("exited %s ago", time.Since(detail.State.FinishedAt).Truncate(time.Minute)),
+		}
+		if !report.DryRun {
+			gc.wait()
+			if err := gc.client.RemoveContainer(detail.Id, false, false); err != nil {
+				gc.failed(&action, err)
+			}
+		}
+		if !action.Skipped && action.Err == nil {
+			removed[detail.Id] = true
+		}
+		report.Actions = append(report.Actions, action)
+	}
+	return nil
+}
+
+func (gc *GarbageCollector) collectImages(report *GCReport, inUse map[string]bool) error {
+	images, err := gc.client.ListImagesWithOptions(ListImagesOptions{Filters: gc.policy.ImageFilters})
+	if err != nil {
+		return err
+	}
+	// newest first, so the older ones in the repository are out of the kept
+	sort.Slice(images, func(i, j int) bool { return images[i].Created > images[j].Created })
+	kept := make(map[string]int)
+	for _, image := range images {
+		reason := ""
+		if gc.policy.KeepImagesPerRepo > 0 {
+			if repos := imageRepositories(image.RepoTags); len(repos) > 0 {
+				outOfKept := true
+				for _, repo := range repos {
+					kept[repo] += 1
+					if kept[repo] <= gc.policy.KeepImagesPerRepo {
+						outOfKept = false
+					}
+				}
+				if outOfKept {
+					reason = fmt.Sprintf("older than the newest %d of %s", gc.policy.KeepImagesPerRepo, strings.Join(repos, ", "))
+				}
+			}
+		}
+		if reason == "" && gc.policy.ImagesUnusedFor > 0 {
+			if unused := time.Since(gc.ImageLastUsed(image)); unused > gc.policy.ImagesUnusedFor {
+				reason = fmt.Sprintf("unused for %s", unused.Truncate(time.Minute))
+			}
+		}
+		if reason == "" {
+			continue
+		}
+		action := GCAction{Kind: "image", Id: image.Id, Name: strings.Join(image.RepoTags, ", "), Reason: reason, Size: image.Size}
+		if gc.isProtected(image.Labels) {
+			action.Reason, action.Skipped = "protected", true
+		} else if gc.imageInUse(image, inUse) {
+			action.Reason, action.Skipped = "in use", true
+		} else if !report.DryRun {
+			gc.wait()
+			if err := gc.removeImage(image); err != nil {
+				gc.failed(&action, err)
+			}
+		}
+		if !action.Skipped && action.Err == nil {
+			report.SpaceReclaimed += image.Size
+		}
+		report.Actions = append(report.Actions, action)
+	}
+	return nil
+}
+
+// removeImage untags the image by its repo tags and the last untag deletes it, because the daemon
+// refuses to delete the image referenced in multiple repositories by the id without force
+func (gc *GarbageCollector) removeImage(image Image) error {
+	var tags []string
+	for _, tag := range image.RepoTags {
+		if tag != "<none>:<none>" {
+			tags = append(tags, tag)
+		}
+	}
+	if len(tags) == 0 {
+		return gc.client.RemoveImage(image.Id, false, false)
+	}
+	for i, tag := range tags {
+		if err := gc.client.RemoveImage(tag, false, false); err != nil {
+			// the tag moved to another image or removed by others, the rest are still to untag
+			if IsNotFound(err) && i < len(tags)-1 {
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func (gc *GarbageCollector) imageInUse(image Image, inUse map[string]bool) bool {
+	if inUse[image.Id] {
+		return true
+	}
+	for _, tag := range image.RepoTags {
+		if inUse[normalizeImageTag(tag)] {
+			return true
+		}
+	}
+	return false
+}
+
+// failed keeps the object if it is gone or conflicted, e.g. the image is used by a new container
+func (gc *GarbageCollector) failed(action *GCAction, err error) {
+	var adocErr Error
+	switch {
+	case IsNotFound(err):
+		action.Reason, action.Skipped = "already removed", true
+	case errors.As(err, &adocErr) && adocErr.StatusCode == 409:
+		action.Reason, action.Skipped = "conflict: "+adocErr.Message, true
+	default:
+		action.Err = err
+	}
+	gc.client.logger.Warn("Garbage collection failed", "kind", action.Kind, "id", action.Id, "error", err)
+}
+
+// wait keeps the DeleteInterval between the deletions, the slot is reserved under the lock but the
+// sleep is not, so the image usages and the events are not blocked by it
+func (gc *GarbageCollector) wait() {
+	gc.lock.Lock()
+	var d time.Duration
+	now := time.Now()
+	if gc.policy.DeleteInterval > 0 && !gc.lastTime.IsZero() {
+		d = gc.policy.DeleteInterval - now.Sub(gc.lastTime)
+	}
+	if d < 0 {
+		d = 0
+	}
+	gc.lastTime = now.Add(d)
+	gc.lock.Unlock()
+	time.Sleep(d)
+}
+
+func containerName(names []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(names[0], "/")
+}
+
+func shortId(id string) string {
+	id = strings.TrimPrefix(id, "sha256:")
+	if len(id) > 12 {
+		return id[:12]
+	}
+	return id
+}
+
+// splitImageTag splits the image name into the repository and the tag, the registry port is kept
+// in the repository, the tag is empty if not given
+func splitImageTag(name string) (string, string) {
+	if i := strings.Index(name, "@"); i >= 0 {
+		name = name[:i]
+	}
+	if i := strings.LastIndex(name, ":"); i >= 0 && !strings.Contains(name[i:], "/") {
+		return name[:i], name[i+1:]
+	}
+	return name, ""
+}
+
+// normalizeImageTag adds the latest tag to the image name, the ids are kept
+func normalizeImageTag(name string) string {
+	if strings.HasPrefix(name, "sha256:") || strings.Contains(name, "@") {
+		return name
+	}
+	if repo, tag := splitImageTag(name); tag == "" {
+		return repo + ":latest"
+	}
+	return name
+}
+
+func imageRepositories(repoTags []string) []string {
+	var repos []string
+	for _, tag := range repoTags {
+		if tag == "<none>:<none>" {
+			continue
+		}
+		if repo, _ := splitImageTag(tag); !containsString(repos, repo) {
+			repos = append(repos, repo)
+		}
+	}
+	return repos
+}
@@ -0,0 +1,187 @@
+package adoc
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestGarbageCollector(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	now := time.Now()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	server.AddImage(adoctest.ImageSpec{Name: "redis:1", Created: now.Add(-3 * time.Hour), Size: 300})
+	server.AddImage(adoctest.ImageSpec{Name: "redis:2", Created: now.Add(-2 * time.Hour), Size: 200})
+	server.AddImage(adoctest.ImageSpec{Name: "redis:3", Created: now.Add(-1 * time.Hour), Size: 100})
+	server.AddImage(adoctest.ImageSpec{Name: "nginx:1", Created: now.Add(-5 * time.Hour), Labels: map[string]string{"protected": "yes"}})
+	server.AddImage(adoctest.ImageSpec{Name: "nginx:2", Created: now.Add(-4 * time.Hour)})
+	server.AddImage(adoctest.ImageSpec{Name: "nginx:3", Created: now.Add(-3 * time.Hour)})
+	server.AddImage(adoctest.ImageSpec{Name: "alpine:1", Created: now.Add(-4 * time.Hour)})
+	server.AddImage(adoctest.ImageSpec{Name: "alpine:2", Created: now.Add(-3 * time.Hour)})
+	server.AddImage(adoctest.ImageSpec{Name: "alpine:3", Created: now.Add(-2 * time.Hour)})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.24"))
+	defer client.Close()
+
+	run := func(name string, image string, labels map[string]string, exited bool) string {
+		id, err := client.CreateContainer(ContainerConfig{Image: image, Labels: labels}, HostConfig{}, NetworkingConfig{}, name)
+		if err == nil {
+			err = client.StartContainer(id)
+		}
+		if err == nil && exited {
+			err = client.StopContainer(id)
+		}
+		if err != nil {
+			t.Fatalf("Cannot run the container %s, %s", name, err)
+		}
+		return id
+	}
+	run("running", "busybox", map[string]string{"ci": "1"}, false)
+	old := run("old", "alpine:1", map[string]string{"ci": "1"}, true)
+	run("protected", "busybox", map[string]string{"ci": "1", "protected": ""}, true)
+	run("other", "busybox", nil, true)
+	time.Sleep(10 * time.Millisecond)
+
+	gc := NewGarbageCollector(client, GCPolicy{
+		ExitedContainersOlderThan: time.Millisecond,
+		ContainerFilters:          NewFilters().Label("ci", ""),
+		KeepImagesPerRepo:         2,
+		DeleteInterval:            20 * time.Millisecond,
+	})
+	requests := len(server.Requests())
+	report, err := gc.Collect(true)
+	if err != nil {
+		t.Fatalf("Cannot collect in the dry run, %s", err)
+	}
+	for _, request := range server.Requests()[requests:] {
+		if !strings.HasPrefix(request, "GET ") {
+			t.Errorf("The dry run should not remove anything, %s", request)
+		}
+	}
+	removed := report.Removed()
+	if len(removed) != 3 || removed[0].Id != old || removed[1].Name != "redis:1" || removed[2].Name != "alpine:1" {
+		t.Fatalf("Wrong dry run report, %s", report)
+	}
+	if report.SpaceReclaimed != 300+1024*1024 {
+		t.Errorf("Wrong space reclaimed, %d", report.SpaceReclaimed)
+	}
+	text := report.String()
+	for _, line := range []string{"keep container", " protected: protected", "keep image", "nginx:1: protected", "3 removed"} {
+		if !strings.Contains(text, line) {
+			t.Errorf("The report should contain %q, %s", line, text)
+		}
+	}
+
+	// the first image deletion is conflicted
+	server.AddFault(adoctest.Fault{Method: "DELETE", Path: "images/", StatusCode: 409, Message: "image is being used", Times: 1})
+	start := time.Now()
+	report, err = gc.Collect(false)
+	if err != nil {
+		t.Fatalf("Cannot collect, %s", err)
+	}
+	if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+		t.Errorf("The deletions should be rate limited, %s", elapsed)
+	}
+	removed = report.Removed()
+	if len(removed) != 2 || removed[0].Id != old || removed[1].Name != "alpine:1" {
+		t.Fatalf("Wrong report, %s", report)
+	}
+	if !strings.Contains(report.String(), "keep image") || !strings.Contains(report.String(), "conflict: image is being used") {
+		t.Errorf("The conflict should be skipped, %s", report)
+	}
+	if _, err := client.InspectContainer(old); !IsNotFound(err) {
+		t.Errorf("The old container should be removed, %v", err)
+	}
+	if _, err := client.InspectImage("alpine:1"); !IsNotFound(err) {
+		t.Errorf("The alpine:1 image should be removed, %v", err)
+	}
+	for _, name := range []string{"redis:1", "nginx:1", "busybox"} {
+		if _, err := client.InspectImage(name); err != nil {
+			t.Errorf("The image %s should be kept, %v", name, err)
+		}
+	}
+}
+
+func TestGarbageCollectorUnusedImages(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox", Created: time.Now().Add(-time.Hour)})
+	server.AddImage(adoctest.ImageSpec{Name: "redis", Created: time.Now().Add(-time.Hour)})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.24"))
+	defer client.Close()
+
+	gc := NewGarbageCollector(client, GCPolicy{ImagesUnusedFor: 100 * time.Millisecond})
+	gc.Start()
+	defer gc.Stop()
+	waitForWatchers(t, server, 1)
+	time.Sleep(150 * time.Millisecond)
+
+	id, _ := client.CreateContainer(ContainerConfig{Image: "redis"}, HostConfig{}, NetworkingConfig{}, "used")
+	client.RemoveContainer(id, true, false)
+	images, _ := client.ListImages(false)
+	for i := 0; ; i += 1 {
+		var redis Image
+		for _, image := range images {
+			if len(image.RepoTags) > 0 && image.RepoTags[0] == "redis:latest" {
+				redis = image
+			}
+		}
+		if time.Since(gc.ImageLastUsed(redis)) < 100*time.Millisecond {
+			break
+		}
+		if i >= 100 {
+			t.Fatalf("The image usage should be tracked from the events")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	report, err := gc.Collect(false)
+	removed := report.Removed()
+	if err != nil || len(removed) != 1 || removed[0].Name != "busybox:latest" || !strings.HasPrefix(removed[0].Reason, "unused for") {
+		t.Fatalf("Should remove the unused busybox only, %s, %v", report, err)
+	}
+}
+
+func TestGarbageCollectorMultiRepoImage(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "app:1", Created: time.Now().Add(-2 * time.Hour)})
+	server.AddImage(adoctest.ImageSpec{Name: "tool:1", Created: time.Now().Add(-2 * time.Hour)})
+	for _, name := range []string{"app:2", "registry.local/app:2", "tool:2"} {
+		server.AddImage(adoctest.ImageSpec{Name: name, Created: time.Now().Add(-time.Hour)})
+	}
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.24"))
+	defer client.Close()
+	client.TagImage("app:1", "registry.local/app", "1", false)
+	client.TagImage("app:1", "app", "stable", false)
+	image, _ := client.InspectImage("registry.local/app:1")
+	if err := client.RemoveImage(image.Id, false, false); !IsConflict(err) {
+		t.Fatalf("The daemon should refuse to delete the image of multiple repositories, %v", err)
+	}
+
+	gc := NewGarbageCollector(client, GCPolicy{KeepImagesPerRepo: 1, DeleteInterval: 300 * time.Millisecond})
+	done := make(chan struct{})
+	var report GCReport
+	var err error
+	go func() {
+		report, err = gc.Collect(false)
+		close(done)
+	}()
+	// the usages are not blocked while the collector waits for the interval
+	time.Sleep(100 * time.Millisecond)
+	start := time.Now()
+	gc.MarkImageUsed("other", time.Now())
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("MarkImageUsed is blocked by the delete interval for %s", elapsed)
+	}
+	<-done
+
+	if err != nil || len(report.Removed()) != 2 {
+		t.Fatalf("Should remove both the images, %s, %v", report, err)
+	}
+	if _, err := client.InspectImage(image.Id); !IsNotFound(err) {
+		t.Errorf("The image of multiple repositories should be removed, %v", err)
+	}
+}
@@ -1,35 +1,63 @@
 package adoc
 
 import (
-	"crypto/tls"
+	"context"
 	"net"
 	"net/http"
 	"net/url"
 	"time"
 )
 
-func newHttpClient(u *url.URL, tlsConfig *tls.Config, timeout time.Duration, rwTimeout time.Duration) *http.Client {
+func newHttpClient(u *url.URL, options *clientOptions, rwTimeout time.Duration) (*http.Client, error) {
 	transport := &http.Transport{
-		TLSClientConfig: tlsConfig,
+		TLSClientConfig:     options.tlsConfig,
+		MaxIdleConns:        options.maxIdleConns,
+		MaxIdleConnsPerHost: options.maxIdleConns,
+		IdleConnTimeout:     options.idleConnTimeout,
+	}
+	timeout := options.timeout
+	dialer := &net.Dialer{
+		Timeout:   timeout,
+		KeepAlive: options.keepAlive,
 	}
 	switch u.Scheme {
 	case "unix":
 		socketPath := u.Path
-		transport.Dial = func(proto, addr string) (net.Conn, error) {
-			return net.DialTimeout("unix", socketPath, timeout)
+		transport.DialContext = func(ctx context.Context, proto, addr string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", socketPath)
 		}
 		u.Scheme = "http"
 		u.Host = "unix.sock"
 		u.Path = ""
-	default:
-		transport.Dial = func(proto, addr string) (net.Conn, error) {
-			return net.DialTimeout(proto, addr, timeout)
+	case "ssh":
+		config, err := parseSSHConfig(u)
+		if err != nil {
+			return nil, err
+		}
+		transport.DialContext = func(ctx context.Context, proto, addr string) (net.Conn, error) {
+			return dialSSH(ctx, config, timeout)
 		}
+		u.Scheme = "http"
+		u.Host = "ssh.sock"
+		u.User = nil
+		u.Path = ""
+		u.RawQuery = ""
+	default:
+		transport.DialContext = dialer.DialContext
 	}
-	return &http.Client{
+	client := &http.Client{
 		Transport: transport,
 		Timeout:   rwTimeout,
 	}
+	if options.transport != nil {
+		client.Transport = options.transport
+	}
+	middlewares := options.middlewares
+	if options.dryRun != nil {
+		middlewares = append(middlewares[:len(middlewares):len(middlewares)], options.dryRun.middleware(options.logger))
+	}
+	client.Transport = chainMiddlewares(client.Transport, middlewares)
+	return client, nil
 }
 
 func formatBoolToIntString(v bool) string {
@@ -38,3 +66,12 @@ func formatBoolToIntString(v bool) string {
 	}
 	return "0"
 }
+
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
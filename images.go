@@ -6,6 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -21,32 +24,88 @@ type Image struct {
 	Size        int64
 	VirtualSize int64
 	RepoDigests []string // v1.18
+	SharedSize  int64    // v1.42, -1 if not requested
+	Containers  int64    // v1.42, -1 if not calculated
 }
 
 type ImageDetail struct {
 	Architecture    string
 	Author          string
 	Comment         string
+	Config          ContainerConfig // the defaults of the containers created from the image
 	Container       string
-	ContainerConfig ContainerConfig
+	ContainerConfig ContainerConfig // the config of the container which the image is committed from
 	Created         time.Time
 	DockerVersion   string
+	GraphDriver     GraphDriverData
 	Id              string
+	Metadata        ImageMetadata
 	Os              string
+	OsVersion       string
 	Parent          string
+	RepoDigests     []string
+	RepoTags        []string
+	RootFS          RootFS
 	Size            int64
+	Variant         string
 	VirtualSize     int64
-	//Config          ContainerConfig // don't know what this is for
+}
+
+type RootFS struct {
+	Type      string
+	Layers    []string
+	BaseLayer string `json:",omitempty"`
+}
+
+type ImageMetadata struct {
+	LastTagTime time.Time
 }
 
 const (
 	ImagePuSecs = 100 * time.Second // 1000M / (10M/s)
 )
 
+// ListImagesOptions covers all the parameters of the image list
+type ListImagesOptions struct {
+	All        bool
+	Digests    bool   // with the RepoDigests
+	SharedSize bool   // with the SharedSize of the layers shared with other images
+	Filter     string // the legacy filter by the repository name, before v1.28
+	Filters    Filters
+}
+
+func (client *DockerClient) ListImagesWithOptions(opts ListImagesOptions) ([]Image, error) {
+	v := url.Values{}
+	v.Set("all", formatBoolToIntString(opts.All))
+	if opts.Digests {
+		v.Set("digests", "1")
+	}
+	if opts.SharedSize {
+		v.Set("shared-size", "1")
+	}
+	if opts.Filter != "" {
+		v.Set("filter", opts.Filter)
+	}
+	if encoded := client.EncodeFilters(opts.Filters); encoded != "" {
+		v.Set("filters", encoded)
+	}
+	uri := fmt.Sprintf("images/json?%s", v.Encode())
+	if data, err := client.sendRequest("GET", uri, nil, nil, nil); err != nil {
+		return nil, err
+	} else {
+		var images []Image
+		err := json.Unmarshal(data, &images)
+		return images, err
+	}
+}
+
 func (client *DockerClient) ListImages(showAll bool, filters ...string) ([]Image, error) {
 	v := url.Values{}
 	v.Set("all", formatBoolToIntString(showAll))
 	if len(filters) > 0 && filters[0] != "" {
+		if err := checkFilters(filters[0]); err != nil {
+			return nil, err
+		}
 		v.Set("filters", filters[0])
 	}
 	uri := fmt.Sprintf("images/json?%s", v.Encode())
@@ -83,15 +142,22 @@ func (client *DockerClient) PullImage(name string, tag string, authConfig ...Aut
 	rc := &RequestConfig{ExtraTimeout: ImagePuSecs}
 
 	err := client.sendRequestCallback("POST", uri, nil, header, func(resp *http.Response) error {
-		var status map[string]interface{}
-		var cbErr error
+		var errMsg interface{}
+		span := SpanFromContext(resp.Request.Context())
 		decoder := json.NewDecoder(resp.Body)
-		for ; cbErr == nil; cbErr = decoder.Decode(&status) {
-		}
-		if cbErr != io.EOF {
-			return cbErr
+		for {
+			var status map[string]interface{}
+			if cbErr := decoder.Decode(&status); cbErr == io.EOF {
+				break
+			} else if cbErr != nil {
+				return cbErr
+			}
+			if msg, ok := status["error"]; ok {
+				errMsg = msg
+			}
+			traceProgress(span, status)
 		}
-		if errMsg, ok := status["error"]; ok {
+		if errMsg != nil {
 			return fmt.Errorf("Pull image error: %s", errMsg)
 		}
 		return nil
@@ -131,15 +197,22 @@ func (client *DockerClient) PushImage(name string, repo string, tag string, auth
 	rc := &RequestConfig{ExtraTimeout: ImagePuSecs}
 
 	err := client.sendRequestCallback("POST", uri, nil, header, func(resp *http.Response) error {
-		var status map[string]interface{}
-		var cbErr error
+		var errMsg interface{}
+		span := SpanFromContext(resp.Request.Context())
 		decoder := json.NewDecoder(resp.Body)
-		for ; cbErr == nil; cbErr = decoder.Decode(&status) {
+		for {
+			var status map[string]interface{}
+			if cbErr := decoder.Decode(&status); cbErr == io.EOF {
+				break
+			} else if cbErr != nil {
+				return cbErr
+			}
+			if msg, ok := status["error"]; ok {
+				errMsg = msg
+			}
+			traceProgress(span, status)
 		}
-		if cbErr != io.EOF {
-			return cbErr
-		}
-		if errMsg, ok := status["error"]; ok {
+		if errMsg != nil {
 			return fmt.Errorf("Push image error: %s", errMsg)
 		}
 		return nil
@@ -147,7 +220,257 @@ func (client *DockerClient) PushImage(name string, repo string, tag string, auth
 	return err
 }
 
+// traceProgress adds the milestones of the pull/push progress into the span, e.g. "Pull complete",
+// but not the "Downloading" ones with progress bars
+func traceProgress(span Span, status map[string]interface{}) {
+	if status["progress"] != nil {
+		return
+	}
+	if msg, ok := status["status"].(string); ok {
+		attributes := make(map[string]interface{})
+		if layer, ok := status["id"].(string); ok {
+			attributes["layer"] = layer
+		}
+		span.AddEvent(msg, attributes)
+	}
+}
+
+const kDistributionApiVersion = "v1.30"
+
+// ImageHistory is one layer of the image history, newest first
+type ImageHistory struct {
+	Id        string // <missing> for the layers built elsewhere
+	Created   int64
+	CreatedBy string
+	Tags      []string
+	Size      int64
+	Comment   string
+}
+
+func (client *DockerClient) ImageHistory(name string) ([]ImageHistory, error) {
+	uri := fmt.Sprintf("images/%s/history", name)
+	if data, err := client.sendRequest("GET", uri, nil, nil, nil); err != nil {
+		return nil, err
+	} else {
+		var ret []ImageHistory
+		err := json.Unmarshal(data, &ret)
+		return ret, err
+	}
+}
+
+type SearchResult struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	IsOfficial  bool   `json:"is_official"`
+	IsAutomated bool   `json:"is_automated"`
+	StarCount   int    `json:"star_count"`
+}
+
+// SearchOptions for searching the images in the registry, the filters are stars, is-official and is-automated
+type SearchOptions struct {
+	Limit   int // default to 25 by the daemon, max 100
+	Filters Filters
+	Auth    *AuthConfig
+}
+
+func (client *DockerClient) SearchImages(term string, opts SearchOptions) ([]SearchResult, error) {
+	v := url.Values{}
+	v.Set("term", term)
+	if opts.Limit > 0 {
+		v.Set("limit", strconv.Itoa(opts.Limit))
+	}
+	if encoded := client.EncodeFilters(opts.Filters); encoded != "" {
+		v.Set("filters", encoded)
+	}
+	header := make(map[string]string)
+	if opts.Auth != nil {
+		header["X-Registry-Auth"] = opts.Auth.Encode()
+	}
+	uri := fmt.Sprintf("images/search?%s", v.Encode())
+	if data, err := client.sendRequest("GET", uri, nil, header, nil); err != nil {
+		return nil, err
+	} else {
+		var ret []SearchResult
+		err := json.Unmarshal(data, &ret)
+		return ret, err
+	}
+}
+
+type Descriptor struct {
+	MediaType string   `json:"mediaType"`
+	Digest    string   `json:"digest"`
+	Size      int64    `json:"size"`
+	URLs      []string `json:"urls,omitempty"`
+}
+
+type Platform struct {
+	Architecture string   `json:"architecture"`
+	OS           string   `json:"os"`
+	OSVersion    string   `json:"os.version,omitempty"`
+	OSFeatures   []string `json:"os.features,omitempty"`
+	Variant      string   `json:"variant,omitempty"`
+}
+
+// DistributionInspect is the manifest descriptor and the platforms of the image in the registry
+type DistributionInspect struct {
+	Descriptor Descriptor
+	Platforms  []Platform
+}
+
+// MatchesDigest checks if any of the local RepoDigests like "busybox@sha256:..." is the registry digest,
+// so the local image is up to date without pulling
+func (d DistributionInspect) MatchesDigest(repoDigests []string) bool {
+	for _, repoDigest := range repoDigests {
+		if i := strings.LastIndex(repoDigest, "@"); i >= 0 && repoDigest[i+1:] == d.Descriptor.Digest {
+			return true
+		}
+	}
+	return false
+}
+
+// DistributionInspect asks the registry for the image manifest digest and the platforms via the daemon, v1.30
+func (client *DockerClient) DistributionInspect(name string, authConfig ...AuthConfig) (DistributionInspect, error) {
+	var ret DistributionInspect
+	if compareApiVersion(client.apiVersion, kDistributionApiVersion) < 0 {
+		return ret, fmt.Errorf("Distribution inspect is not supported by api %s, need %s", client.apiVersion, kDistributionApiVersion)
+	}
+	header := make(map[string]string)
+	if len(authConfig) > 0 {
+		header["X-Registry-Auth"] = authConfig[0].Encode()
+	}
+	uri := fmt.Sprintf("distribution/%s/json", name)
+	if data, err := client.sendRequest("GET", uri, nil, header, nil); err != nil {
+		return ret, err
+	} else {
+		err := json.Unmarshal(data, &ret)
+		return ret, err
+	}
+}
+
+// MergeImageConfig fills the config with the image defaults the way the daemon does when creating
+// the container: the Cmd is inherited only if there is no Entrypoint and Cmd in the config, the Env
+// and Labels are inherited by the missing keys, the ExposedPorts and Volumes are unioned, and the
+// Healthcheck is inherited field by field. The config is not changed.
+func MergeImageConfig(config ContainerConfig, image ContainerConfig) ContainerConfig {
+	merged := config
+	if merged.User == "" {
+		merged.User = image.User
+	}
+	if len(image.ExposedPorts) > 0 {
+		merged.ExposedPorts = make(map[string]struct{})
+		for port := range image.ExposedPorts {
+			merged.ExposedPorts[port] = struct{}{}
+		}
+		for port := range config.ExposedPorts {
+			merged.ExposedPorts[port] = struct{}{}
+		}
+	}
+	if len(image.Env) > 0 {
+		merged.Env = append([]string(nil), config.Env...)
+		keys := make(map[string]bool)
+		for _, env := range config.Env {
+			keys[strings.SplitN(env, "=", 2)[0]] = true
+		}
+		for _, env := range image.Env {
+			if !keys[strings.SplitN(env, "=", 2)[0]] {
+				merged.Env = append(merged.Env, env)
+			}
+		}
+	}
+	if len(image.Labels) > 0 {
+		merged.Labels = make(map[string]string)
+		for key, value := range image.Labels {
+			merged.Labels[key] = value
+		}
+		for key, value := range config.Labels {
+			merged.Labels[key] = value
+		}
+	}
+	if len(config.Entrypoint) == 0 {
+		if len(config.Cmd) == 0 {
+			merged.Cmd = image.Cmd
+		}
+		if config.Entrypoint == nil {
+			merged.Entrypoint = image.Entrypoint
+		}
+	}
+	if image.Healthcheck != nil {
+		if config.Healthcheck == nil {
+			merged.Healthcheck = image.Healthcheck
+		} else {
+			healthcheck := *config.Healthcheck
+			if len(healthcheck.Test) == 0 {
+				healthcheck.Test = image.Healthcheck.Test
+			}
+			if healthcheck.Interval == 0 {
+				healthcheck.Interval = image.Healthcheck.Interval
+			}
+			if healthcheck.Timeout == 0 {
+				healthcheck.Timeout = image.Healthcheck.Timeout
+			}
+			if healthcheck.StartPeriod == 0 {
+				healthcheck.StartPeriod = image.Healthcheck.StartPeriod
+			}
+			if healthcheck.Retries == 0 {
+				healthcheck.Retries = image.Healthcheck.Retries
+			}
+			merged.Healthcheck = &healthcheck
+		}
+	}
+	if len(config.OnBuild) == 0 {
+		merged.OnBuild = image.OnBuild
+	}
+	if merged.WorkingDir == "" {
+		merged.WorkingDir = image.WorkingDir
+	}
+	if len(image.Volumes) > 0 {
+		merged.Volumes = make(map[string]struct{})
+		for volume := range image.Volumes {
+			merged.Volumes[volume] = struct{}{}
+		}
+		for volume := range config.Volumes {
+			merged.Volumes[volume] = struct{}{}
+		}
+	}
+	if merged.StopSignal == "" {
+		merged.StopSignal = image.StopSignal
+	}
+	return merged
+}
+
+// ResolveContainerConfig inspects the image of the config and returns the config merged with the image
+// defaults, it is what the container will run with
+func (client *DockerClient) ResolveContainerConfig(config ContainerConfig) (ContainerConfig, error) {
+	image, err := client.InspectImage(config.Image)
+	if err != nil {
+		return config, err
+	}
+	return MergeImageConfig(config, image.Config), nil
+}
+
+// DeclaredPorts returns the sorted ports exposed by the image, e.g. ["5000/tcp", "53/udp"]
+func (image ImageDetail) DeclaredPorts() []string {
+	ports := make([]string, 0, len(image.Config.ExposedPorts))
+	for port := range image.Config.ExposedPorts {
+		ports = append(ports, port)
+	}
+	sort.Strings(ports)
+	return ports
+}
+
+// DeclaredEnv returns the env declared by the image as the map
+func (image ImageDetail) DeclaredEnv() map[string]string {
+	env := make(map[string]string, len(image.Config.Env))
+	for _, e := range image.Config.Env {
+		kv := strings.SplitN(e, "=", 2)
+		if len(kv) == 2 {
+			env[kv[0]] = kv[1]
+		} else {
+			env[kv[0]] = ""
+		}
+	}
+	return env
+}
+
 // Missing apis for
 // build: Build image from a Dockerfile
-// images/(name)/history
-// images/search
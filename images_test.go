@@ -0,0 +1,157 @@
+package adoc
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestImageHistory(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	baseId := server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	id, _ := client.CreateContainer(ContainerConfig{Image: "busybox", Cmd: []string{"touch", "/debug"}}, HostConfig{}, NetworkingConfig{})
+	imageId, _ := client.CommitContainer(id, CommitOptions{Repo: "snapshot", Comment: "debug"})
+	history, err := client.ImageHistory("snapshot")
+	if err != nil || len(history) != 2 {
+		t.Fatalf("Wrong image history, %+v, %v", history, err)
+	}
+	if history[0].Id != imageId || history[0].CreatedBy != "touch /debug" || history[0].Comment != "debug" || history[1].Id != baseId {
+		t.Errorf("Wrong image layers, %+v", history)
+	}
+	if _, err := client.ImageHistory("missing"); !IsNotFound(err) {
+		t.Errorf("Should be not found, %v", err)
+	}
+}
+
+func TestSearchImages(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "redis", Stars: 9000, Description: "Redis is an open source key-value store"})
+	server.AddImage(adoctest.ImageSpec{Name: "bitnami/redis", Stars: 200})
+	server.AddImage(adoctest.ImageSpec{Name: "someone/redis-exporter", Stars: 3})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	results, err := client.SearchImages("redis", SearchOptions{Filters: NewFilters().Stars(100), Auth: &AuthConfig{UserName: "ops"}})
+	if err != nil || len(results) != 2 || results[0].Name != "redis" || !results[0].IsOfficial || results[0].StarCount != 9000 {
+		t.Fatalf("Wrong search results, %+v, %v", results, err)
+	}
+	results, err = client.SearchImages("redis", SearchOptions{Limit: 1, Filters: NewFilters().IsOfficial(false)})
+	if err != nil || len(results) != 1 || results[0].Name != "bitnami/redis" {
+		t.Errorf("Wrong limited search results, %+v, %v", results, err)
+	}
+}
+
+func TestDistributionInspect(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+
+	client, _ := NewClient(server.URL)
+	if _, err := client.DistributionInspect("busybox"); err == nil {
+		t.Errorf("Should not be supported by the default api version")
+	}
+	client, _ = NewClient(server.URL, WithAPIVersion("v1.30"))
+	defer client.Close()
+
+	images, _ := client.ListImagesWithOptions(ListImagesOptions{Digests: true})
+	distribution, err := client.DistributionInspect("busybox")
+	if err != nil || len(distribution.Platforms) != 1 || distribution.Platforms[0].OS != "linux" {
+		t.Fatalf("Wrong distribution, %+v, %v", distribution, err)
+	}
+	if !distribution.MatchesDigest(images[0].RepoDigests) {
+		t.Errorf("The local image should be up to date, %v, %s", images[0].RepoDigests, distribution.Descriptor.Digest)
+	}
+
+	server.SetRegistryDigest("busybox", "sha256:0123456789abcdef")
+	if distribution, _ = client.DistributionInspect("busybox"); distribution.MatchesDigest(images[0].RepoDigests) {
+		t.Errorf("The local image should be outdated after the newer push")
+	}
+	if _, err := client.DistributionInspect("missing"); !IsNotFound(err) {
+		t.Errorf("Should be not found, %v", err)
+	}
+}
+
+func TestMergeImageConfig(t *testing.T) {
+	image := ContainerConfig{
+		Cmd:          []string{"python", "app.py"},
+		Env:          []string{"PATH=/usr/bin", "PORT=5000"},
+		ExposedPorts: map[string]struct{}{"5000/tcp": {}},
+		Labels:       map[string]string{"tier": "web", "version": "1"},
+		Healthcheck:  &HealthConfig{Test: []string{"CMD", "curl", "localhost:5000"}, Interval: time.Second, Retries: 3},
+		WorkingDir:   "/app",
+		User:         "app",
+		StopSignal:   "SIGINT",
+	}
+	config := ContainerConfig{
+		Image:        "webapp",
+		Env:          []string{"PORT=8080"},
+		ExposedPorts: map[string]struct{}{"9090/tcp": {}},
+		Labels:       map[string]string{"version": "2"},
+		Healthcheck:  &HealthConfig{Retries: 5},
+	}
+	merged := MergeImageConfig(config, image)
+	if !reflect.DeepEqual(merged.Cmd, image.Cmd) || merged.WorkingDir != "/app" || merged.User != "app" || merged.StopSignal != "SIGINT" {
+		t.Errorf("Should inherit the image defaults, %+v", merged)
+	}
+	if !reflect.DeepEqual(merged.Env, []string{"PORT=8080", "PATH=/usr/bin"}) {
+		t.Errorf("Wrong merged env, %v", merged.Env)
+	}
+	if len(merged.ExposedPorts) != 2 || merged.Labels["tier"] != "web" || merged.Labels["version"] != "2" {
+		t.Errorf("Wrong merged ports or labels, %v, %v", merged.ExposedPorts, merged.Labels)
+	}
+	if merged.Healthcheck.Retries != 5 || merged.Healthcheck.Interval != time.Second || len(merged.Healthcheck.Test) != 3 {
+		t.Errorf("Wrong merged healthcheck, %+v", merged.Healthcheck)
+	}
+	if len(config.Labels) != 1 || len(config.Env) != 1 || config.Healthcheck.Interval != 0 {
+		t.Errorf("The config should not be changed, %+v", config)
+	}
+
+	// the Cmd is not inherited with the Entrypoint
+	merged = MergeImageConfig(ContainerConfig{Entrypoint: []string{"sh", "-c"}}, image)
+	if len(merged.Cmd) != 0 {
+		t.Errorf("Should not inherit the Cmd with the Entrypoint, %v", merged.Cmd)
+	}
+	merged = MergeImageConfig(ContainerConfig{Cmd: []string{"sh"}}, ContainerConfig{Entrypoint: []string{"tini", "--"}, Cmd: []string{"run"}})
+	if !reflect.DeepEqual(merged.Cmd, []string{"sh"}) || !reflect.DeepEqual(merged.Entrypoint, []string{"tini", "--"}) {
+		t.Errorf("Should keep the image Entrypoint and the config Cmd, %+v", merged)
+	}
+}
+
+func TestInspectImageDetail(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "webapp:1.0", Config: map[string]interface{}{
+		"Cmd":          []string{"python", "app.py"},
+		"Env":          []string{"PORT=5000"},
+		"ExposedPorts": map[string]interface{}{"5000/tcp": map[string]interface{}{}, "53/udp": map[string]interface{}{}},
+	}})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	image, err := client.InspectImage("webapp:1.0")
+	if err != nil || !reflect.DeepEqual(image.RepoTags, []string{"webapp:1.0"}) || len(image.RepoDigests) != 1 || len(image.RootFS.Layers) != 1 {
+		t.Fatalf("Wrong image detail, %+v, %v", image, err)
+	}
+	if ports := image.DeclaredPorts(); !reflect.DeepEqual(ports, []string{"5000/tcp", "53/udp"}) {
+		t.Errorf("Wrong declared ports, %v", ports)
+	}
+	if env := image.DeclaredEnv(); env["PORT"] != "5000" {
+		t.Errorf("Wrong declared env, %v", env)
+	}
+
+	client.TagImage("webapp:1.0", "webapp", "latest", false)
+	if image, _ = client.InspectImage("webapp"); image.Metadata.LastTagTime.IsZero() {
+		t.Errorf("Should have the last tag time, %+v", image.Metadata)
+	}
+	config, err := client.ResolveContainerConfig(ContainerConfig{Image: "webapp", Env: []string{"DEBUG=1"}})
+	if err != nil || !reflect.DeepEqual(config.Cmd, []string{"python", "app.py"}) || len(config.Env) != 2 {
+		t.Errorf("Wrong resolved config, %+v, %v", config, err)
+	}
+}
@@ -3,102 +3,123 @@ package adoc
 import (
 	"fmt"
 	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
+	"sync/atomic"
 )
 
 const (
 	kCallDepth = 2
 )
 
-type Logger struct {
-	wrapped     *log.Logger
-	debug       bool
-	exitOnFatal bool
-}
-
-var logger *Logger
-
-func init() {
-	logger = &Logger{
-		wrapped: log.New(os.Stderr, "", log.LstdFlags),
+// Logger is the structured logger of the clients, the fields are the key-value pairs, e.g.
+//
+//	logger.Warn("Create container returns warnings", "container", id, "warnings", warnings)
+//
+// The *slog.Logger satisfies it directly. The library never exits or panics through the logger.
+type Logger interface {
+	Debug(msg string, fields ...interface{})
+	Info(msg string, fields ...interface{})
+	Warn(msg string, fields ...interface{})
+	Error(msg string, fields ...interface{})
+}
+
+// NopLogger drops all the messages, it's the default logger of the clients
+type NopLogger struct{}
+
+func (NopLogger) Debug(msg string, fields ...interface{}) {}
+func (NopLogger) Info(msg string, fields ...interface{})  {}
+func (NopLogger) Warn(msg string, fields ...interface{})  {}
+func (NopLogger) Error(msg string, fields ...interface{}) {}
+
+// SlogLogger adapts the slog logger for the clients, nil means the slog.Default()
+func SlogLogger(logger *slog.Logger) Logger {
+	if logger == nil {
+		logger = slog.Default()
 	}
+	return logger
 }
 
-func UnwrappedLogger() *log.Logger {
-	return logger.wrapped
-}
-
-func EnableDebug() {
-	logger.debug = true
-}
-
-func EnableExitOnFatal() {
-	logger.exitOnFatal = true
-}
-
-func (l *Logger) DebugV(v interface{}) {
-	l.Debugf("%+v", v)
+// StdLogger writes the messages with the fields as key=value through the standard logger
+type StdLogger struct {
+	wrapped *log.Logger
+	debug   bool
 }
 
-func (l *Logger) Debug(v ...interface{}) {
-	if l.debug {
-		l.wrapped.Output(kCallDepth, header("DEBUG", fmt.Sprint(v...)))
+// NewStdLogger wraps the standard logger, the debug messages are only printed with debug on
+func NewStdLogger(wrapped *log.Logger, debug bool) *StdLogger {
+	return &StdLogger{
+		wrapped: wrapped,
+		debug:   debug,
 	}
 }
 
-func (l *Logger) Debugf(format string, v ...interface{}) {
+func (l *StdLogger) Debug(msg string, fields ...interface{}) {
 	if l.debug {
-		l.wrapped.Output(kCallDepth, header("DEBUG", fmt.Sprintf(format, v...)))
+		l.wrapped.Output(kCallDepth, header("DEBUG", msg, fields))
 	}
 }
 
-func (l *Logger) Info(v ...interface{}) {
-	l.wrapped.Output(kCallDepth, header("INFO", fmt.Sprint(v...)))
+func (l *StdLogger) Info(msg string, fields ...interface{}) {
+	l.wrapped.Output(kCallDepth, header("INFO", msg, fields))
 }
 
-func (l *Logger) Infof(format string, v ...interface{}) {
-	l.wrapped.Output(kCallDepth, header("INFO", fmt.Sprintf(format, v...)))
+func (l *StdLogger) Warn(msg string, fields ...interface{}) {
+	l.wrapped.Output(kCallDepth, header("WARN", msg, fields))
 }
 
-func (l *Logger) Warn(v ...interface{}) {
-	l.wrapped.Output(kCallDepth, header("WARN", fmt.Sprint(v...)))
+func (l *StdLogger) Error(msg string, fields ...interface{}) {
+	l.wrapped.Output(kCallDepth, header("ERROR", msg, fields))
 }
 
-func (l *Logger) Warnf(format string, v ...interface{}) {
-	l.wrapped.Output(kCallDepth, header("WARN", fmt.Sprintf(format, v...)))
-}
+// defaultLogger holds the logger for the clients created without WithLogger, it could be
+// replaced while the recorders are logging from the other goroutines
+var defaultLogger atomic.Value
 
-func (l *Logger) Error(v ...interface{}) {
-	l.wrapped.Output(kCallDepth, header("ERROR", fmt.Sprint(v...)))
+// loggerHolder keeps the stored type the same for the atomic.Value
+type loggerHolder struct {
+	Logger
 }
 
-func (l *Logger) Errorf(format string, v ...interface{}) {
-	l.wrapped.Output(kCallDepth, header("ERROR", fmt.Sprintf(format, v...)))
+// getDefaultLogger returns the current default logger, the NopLogger if not set
+func getDefaultLogger() Logger {
+	if holder, ok := defaultLogger.Load().(loggerHolder); ok {
+		return holder.Logger
+	}
+	return NopLogger{}
 }
 
-func (l *Logger) Fatal(v ...interface{}) {
-	msg := header("FATAL", fmt.Sprint(v...))
-	l.wrapped.Output(kCallDepth, msg)
-	if l.exitOnFatal {
-		os.Exit(1)
-	} else {
-		panic(msg)
+// SetDefaultLogger sets the logger for the clients created afterwards without WithLogger
+func SetDefaultLogger(l Logger) {
+	if l == nil {
+		l = NopLogger{}
 	}
+	defaultLogger.Store(loggerHolder{l})
+}
+
+// EnableDebug makes the clients created afterwards log everything including the debug
+// messages to the stderr
+func EnableDebug() {
+	SetDefaultLogger(NewStdLogger(log.New(os.Stderr, "", log.LstdFlags), true))
 }
 
-func (l *Logger) Fatalf(format string, v ...interface{}) {
-	msg := header("FATAL", fmt.Sprintf(format, v...))
-	l.wrapped.Output(kCallDepth, msg)
-	if l.exitOnFatal {
-		os.Exit(1)
-	} else {
-		panic(msg)
+// UnwrappedLogger returns the standard logger used by EnableDebug
+func UnwrappedLogger() *log.Logger {
+	if l, ok := getDefaultLogger().(*StdLogger); ok {
+		return l.wrapped
 	}
+	return log.New(os.Stderr, "", log.LstdFlags)
 }
 
-func header(level, msg string) string {
+// EnableExitOnFatal is kept for the compatibility only, the library never exits or panics.
+//
+// Deprecated: there is no fatal logging anymore.
+func EnableExitOnFatal() {}
+
+func header(level, msg string, fields []interface{}) string {
 	_, file, line, ok := runtime.Caller(kCallDepth)
 	if ok {
 		file = filepath.Base(file)
@@ -110,5 +131,14 @@ func header(level, msg string) string {
 		line = 0
 	}
 
-	return fmt.Sprintf("%s %s:%d: %s", level, file, line, msg)
+	var buffer strings.Builder
+	fmt.Fprintf(&buffer, "%s %s:%d: %s", level, file, line, msg)
+	for i := 0; i < len(fields); i += 2 {
+		if i+1 < len(fields) {
+			fmt.Fprintf(&buffer, " %v=%+v", fields[i], fields[i+1])
+		} else {
+			fmt.Fprintf(&buffer, " %v=<missing>", fields[i])
+		}
+	}
+	return buffer.String()
 }
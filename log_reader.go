@@ -1,10 +1,10 @@
 package adoc
 
 import (
-	"bufio"
 	"encoding/binary"
 	"errors"
 	"io"
+	"io/ioutil"
 )
 
 var (
@@ -34,11 +34,11 @@ func ReadAllDockerLogs(reader io.Reader) ([]LogEntry, error) {
 }
 
 func ReadOneDockerLog(reader io.Reader) (LogEntry, error) {
-	bufReader := bufio.NewReader(reader)
+	// no buffering here, the reader is shared by the following entries
 	entry := LogEntry{}
 
 	header := make([]byte, 4)
-	if _, err := io.ReadFull(bufReader, header); err != nil {
+	if _, err := io.ReadFull(reader, header); err != nil {
 		return entry, err
 	}
 
@@ -53,18 +53,51 @@ func ReadOneDockerLog(reader io.Reader) (LogEntry, error) {
 	}
 
 	var length uint32
-	if err := binary.Read(bufReader, binary.BigEndian, &length); err != nil {
+	if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
 		return entry, err
 	}
 
 	data := make([]byte, length)
-	if _, err := io.ReadFull(bufReader, data); err != nil {
+	if _, err := io.ReadFull(reader, data); err != nil {
 		return entry, err
 	}
 	entry.Output = output
-	if data[len(data)-1] == '\n' {
+	if len(data) > 0 && data[len(data)-1] == '\n' {
 		data = data[:len(data)-1]
 	}
 	entry.Content = string(data)
 	return entry, nil
 }
+
+// copyDockerStream demultiplexes the stdout and stderr frames into the writers until EOF,
+// the nil writer discards the stream
+func copyDockerStream(reader io.Reader, stdout io.Writer, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(reader, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var w io.Writer
+		switch header[0] {
+		case 0, 1:
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			return ErrInvalidHeader
+		}
+		if w == nil {
+			w = ioutil.Discard
+		}
+		length := int64(binary.BigEndian.Uint32(header[4:]))
+		if n, err := io.CopyN(w, reader, length); err != nil {
+			if n < length && err == io.EOF {
+				return ErrInvalidData
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package adoc
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStdLogger(t *testing.T) {
+	var buffer bytes.Buffer
+	l := NewStdLogger(log.New(&buffer, "", 0), false)
+	l.Debug("hidden")
+	l.Warn("Create container returns warnings", "container", "c0", "warnings", []string{"w1"}, "dangling")
+	line := buffer.String()
+	if strings.Contains(line, "hidden") {
+		t.Errorf("Debug message should be hidden, %q", line)
+	}
+	for _, expected := range []string{"WARN log_test.go:", "container=c0", "warnings=[w1]", "dangling=<missing>"} {
+		if !strings.Contains(line, expected) {
+			t.Errorf("Missing %q in the log line %q", expected, line)
+		}
+	}
+}
+
+func TestSlogLogger(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Id":"c0","Warnings":["memory limit is ignored"]}`)
+	}))
+	defer server.Close()
+
+	var buffer bytes.Buffer
+	handler := slog.NewJSONHandler(&buffer, &slog.HandlerOptions{Level: slog.LevelDebug})
+	client, err := NewClient(server.URL, WithLogger(SlogLogger(slog.New(handler))))
+	if err != nil {
+		t.Fatalf("Cannot create the client, %s", err)
+	}
+	if _, err := client.CreateContainer(ContainerConfig{}, HostConfig{}, NetworkingConfig{}); err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	output := buffer.String()
+	for _, expected := range []string{`"msg":"SendRequest","method":"POST"`, `"level":"WARN"`, `"container":"c0"`, `"warnings":["memory limit is ignored"]`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Missing %q in the slog output %q", expected, output)
+		}
+	}
+}
+
+func TestSetDefaultLogger(t *testing.T) {
+	defer SetDefaultLogger(nil)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i += 1 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j += 1 {
+				SetDefaultLogger(NopLogger{})
+				defaultClientOptions()
+			}
+		}()
+	}
+	wg.Wait()
+
+	EnableDebug()
+	if _, ok := defaultClientOptions().logger.(*StdLogger); !ok {
+		t.Errorf("The new clients should use the debug logger")
+	}
+	SetDefaultLogger(nil)
+	if _, ok := getDefaultLogger().(NopLogger); !ok {
+		t.Errorf("The nil logger should fall back to the NopLogger")
+	}
+}
@@ -0,0 +1,230 @@
+package adoc
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// This part contains the middlewares wrapping every request sent to the daemon, both the
+// normal and the longpoll requests (monitors, wait) are passing through them, e.g.
+//   NewClient(daemonUrl, WithMiddleware(HeaderMiddleware(authHeaders), LoggingMiddleware(logger, time.Second)))
+// The first middleware is the outermost one.
+
+// Middleware wraps the next RoundTripper, the innermost one is the transport of the client
+type Middleware func(next http.RoundTripper) http.RoundTripper
+
+// RoundTripperFunc is an adapter to use the function as a RoundTripper
+type RoundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f RoundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// WithMiddleware appends the middlewares to the client
+func WithMiddleware(middlewares ...Middleware) ClientOption {
+	return func(options *clientOptions) {
+		options.middlewares = append(options.middlewares, middlewares...)
+	}
+}
+
+func chainMiddlewares(transport http.RoundTripper, middlewares []Middleware) http.RoundTripper {
+	if len(middlewares) == 0 {
+		return transport
+	}
+	chained := transport
+	for i := len(middlewares) - 1; i >= 0; i -= 1 {
+		chained = middlewares[i](chained)
+	}
+	return &chainedTransport{RoundTripper: chained, base: transport}
+}
+
+// chainedTransport keeps the transport under the middlewares, so the client still closes
+// its idle connections
+type chainedTransport struct {
+	http.RoundTripper
+	base http.RoundTripper
+}
+
+func (t *chainedTransport) CloseIdleConnections() {
+	if closer, ok := t.base.(interface{ CloseIdleConnections() }); ok {
+		closer.CloseIdleConnections()
+	}
+}
+
+// RoundTripInfo describes a finished round trip, the Duration is counted until the response
+// headers arrive, so the streamed bodies like events and stats are not included.
+type RoundTripInfo struct {
+	Method     string
+	Path       string
+	BodySize   int64
+	StatusCode int
+	Duration   time.Duration
+	Err        error
+}
+
+// ObserveMiddleware calls the observe func after every round trip
+func ObserveMiddleware(observe func(info RoundTripInfo)) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			resp, err := next.RoundTrip(req)
+			info := RoundTripInfo{
+				Method:   req.Method,
+				Path:     req.URL.Path,
+				BodySize: req.ContentLength,
+				Duration: time.Since(start),
+				Err:      err,
+			}
+			if resp != nil {
+				info.StatusCode = resp.StatusCode
+			}
+			observe(info)
+			return resp, err
+		})
+	}
+}
+
+// LoggingMiddleware logs every round trip in debug, and the ones slower than the threshold
+// or failed as warnings. Zero threshold turns off the slow call warnings.
+func LoggingMiddleware(logger Logger, slowThreshold time.Duration) Middleware {
+	return ObserveMiddleware(func(info RoundTripInfo) {
+		switch {
+		case info.Err != nil:
+			logger.Warn("Request failed", "method", info.Method, "path", info.Path, "duration", info.Duration, "error", info.Err)
+		case slowThreshold > 0 && info.Duration >= slowThreshold:
+			logger.Warn("Slow request", "method", info.Method, "path", info.Path, "bodySize", info.BodySize, "status", info.StatusCode, "duration", info.Duration)
+		default:
+			logger.Debug("Request", "method", info.Method, "path", info.Path, "bodySize", info.BodySize, "status", info.StatusCode, "duration", info.Duration)
+		}
+	})
+}
+
+// HeaderMiddleware sets the headers on every request, e.g. the auth headers for a proxy
+func HeaderMiddleware(headers map[string]string) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			req = req.Clone(req.Context())
+			for key, value := range headers {
+				req.Header.Set(key, value)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// Metrics collects the request counters from the MetricsMiddleware
+type Metrics struct {
+	lock     sync.Mutex
+	counters MetricsSnapshot
+}
+
+type MetricsSnapshot struct {
+	Requests      int64
+	Errors        int64 // transport errors and the responses with status code >= 400
+	TotalDuration time.Duration
+	MaxDuration   time.Duration
+	StatusCodes   map[int]int64
+}
+
+// Snapshot returns a copy of the current counters
+func (m *Metrics) Snapshot() MetricsSnapshot {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	ret := m.counters
+	ret.StatusCodes = make(map[int]int64, len(m.counters.StatusCodes))
+	for code, count := range m.counters.StatusCodes {
+		ret.StatusCodes[code] = count
+	}
+	return ret
+}
+
+func (m *Metrics) observe(info RoundTripInfo) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	c := &m.counters
+	c.Requests += 1
+	if info.Err != nil || info.StatusCode >= 400 {
+		c.Errors += 1
+	}
+	c.TotalDuration += info.Duration
+	if info.Duration > c.MaxDuration {
+		c.MaxDuration = info.Duration
+	}
+	if info.StatusCode > 0 {
+		if c.StatusCodes == nil {
+			c.StatusCodes = make(map[int]int64)
+		}
+		c.StatusCodes[info.StatusCode] += 1
+	}
+}
+
+// MetricsMiddleware counts every round trip into the metrics
+func MetricsMiddleware(metrics *Metrics) Middleware {
+	return ObserveMiddleware(metrics.observe)
+}
+
+// RetryMiddleware retries the GET and HEAD requests on the transport errors and the 502/503
+// responses, with the fixed delay between the attempts.
+func RetryMiddleware(attempts int, delay time.Duration) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if req.Method != "GET" && req.Method != "HEAD" {
+				return next.RoundTrip(req)
+			}
+			var resp *http.Response
+			var err error
+			for attempt := 1; ; attempt += 1 {
+				resp, err = next.RoundTrip(req)
+				retriable := err != nil || resp.StatusCode == 502 || resp.StatusCode == 503
+				if !retriable || attempt >= attempts {
+					return resp, err
+				}
+				if resp != nil {
+					resp.Body.Close()
+				}
+				select {
+				case <-req.Context().Done():
+					return nil, req.Context().Err()
+				case <-time.After(delay):
+				}
+			}
+		})
+	}
+}
+
+// FaultFunc decides the fault for the request, returning both nil passes the request through
+type FaultFunc func(req *http.Request) (*http.Response, error)
+
+// FaultMiddleware injects the faults into the requests, it's for the tests
+func FaultMiddleware(fault FaultFunc) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			resp, err := fault(req)
+			if resp != nil || err != nil {
+				return resp, err
+			}
+			return next.RoundTrip(req)
+		})
+	}
+}
+
+// FaultResponse builds a fake response for the FaultFunc, e.g.
+//
+//	FaultResponse(req, 503, "swarm manager is not ready")
+func FaultResponse(req *http.Request, statusCode int, body string) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", statusCode, http.StatusText(statusCode)),
+		StatusCode:    statusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          ioutil.NopCloser(bytes.NewBufferString(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
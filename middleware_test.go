@@ -0,0 +1,130 @@
+package adoc
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if auth := r.Header.Get("X-Proxy-Auth"); auth != "token" {
+			t.Errorf("Missing the header from middleware, %q", auth)
+		}
+		switch r.URL.Path {
+		case "/v1.17/_ping":
+			fmt.Fprint(w, "OK")
+		case "/v1.17/containers/c0/wait":
+			fmt.Fprint(w, `{"StatusCode":3}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	var metrics Metrics
+	var order []string
+	tag := func(name string) Middleware {
+		return func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				order = append(order, name)
+				return next.RoundTrip(req)
+			})
+		}
+	}
+	client, err := NewClient(server.URL, WithMiddleware(
+		tag("outer"),
+		HeaderMiddleware(map[string]string{"X-Proxy-Auth": "token"}),
+		MetricsMiddleware(&metrics),
+		tag("inner")))
+	if err != nil {
+		t.Fatalf("Cannot create the client, %s", err)
+	}
+	if _, err := client.Ping(); err != nil {
+		t.Fatalf("Cannot ping the docker, %s", err)
+	}
+	if strings.Join(order, ",") != "outer,inner" {
+		t.Errorf("Wrong middleware order, %v", order)
+	}
+	// the longpoll client should also go through the middlewares
+	if code, err := client.WaitContainer("c0"); err != nil || code != 3 {
+		t.Fatalf("Cannot wait the container, code=%d, %v", code, err)
+	}
+	if _, err := client.InspectContainer("missing"); !IsNotFound(err) {
+		t.Fatalf("Should be not found error, %v", err)
+	}
+	snapshot := metrics.Snapshot()
+	if snapshot.Requests != 3 || snapshot.Errors != 1 || snapshot.StatusCodes[200] != 2 || snapshot.StatusCodes[404] != 1 {
+		t.Errorf("Wrong metrics, %+v", snapshot)
+	}
+}
+
+func TestMiddlewareCloseIdleConnections(t *testing.T) {
+	closed := make(chan struct{}, 1)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "OK")
+	}))
+	server.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateClosed {
+			closed <- struct{}{}
+		}
+	}
+	server.Start()
+	defer server.Close()
+
+	client, err := NewClient(server.URL, WithMiddleware(HeaderMiddleware(map[string]string{"X-Proxy-Auth": "token"})))
+	if err != nil {
+		t.Fatalf("Cannot create the client, %s", err)
+	}
+	if _, err := client.Ping(); err != nil {
+		t.Fatalf("Cannot ping the docker, %s", err)
+	}
+	client.Close()
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Errorf("Close should close the idle connections under the middlewares")
+	}
+}
+
+func TestRetryAndFaultMiddleware(t *testing.T) {
+	var served int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&served, 1)
+		fmt.Fprint(w, "OK")
+	}))
+	defer server.Close()
+
+	var faults int32
+	client, err := NewClient(server.URL, WithMiddleware(
+		RetryMiddleware(3, time.Millisecond),
+		FaultMiddleware(func(req *http.Request) (*http.Response, error) {
+			if atomic.AddInt32(&faults, 1) <= 2 {
+				return FaultResponse(req, 503, "swarm manager is not ready"), nil
+			}
+			return nil, nil
+		})))
+	if err != nil {
+		t.Fatalf("Cannot create the client, %s", err)
+	}
+	if pong, err := client.Ping(); err != nil || !pong {
+		t.Fatalf("Ping should succeed after retries, %v", err)
+	}
+	if faults != 3 || served != 1 {
+		t.Errorf("Wrong attempts, faults=%d, served=%d", faults, served)
+	}
+
+	faults = 0
+	err = client.StartContainer("c0")
+	if adocErr, ok := err.(Error); !ok || adocErr.StatusCode != 503 {
+		t.Errorf("POST should not be retried, %v", err)
+	}
+	if faults != 1 {
+		t.Errorf("POST should not be retried, faults=%d", faults)
+	}
+}
@@ -3,6 +3,7 @@ package adoc
 import (
 	"encoding/json"
 	"fmt"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
@@ -125,12 +126,18 @@ func (client *DockerClient) SwarmInfo() (SwarmInfo, error) {
 		}
 	}
 
+	if offset >= len(status) {
+		client.logger.Warn("Cannot find the swarm nodes in the info, the protocol maybe changed", "status", status)
+		return ret, nil
+	}
 	nodeCount, _ := strconv.Atoi(status[offset][1])
-	ret.Nodes = make([]SwarmNodeInfo, nodeCount)
+	ret.Nodes = make([]SwarmNodeInfo, 0, nodeCount)
 	offset += 1
-	for i := 0; i < nodeCount; i += 1 {
+	for i := 0; i < nodeCount && offset+9 <= len(status); i += 1 {
 		if nodeInfo, err := parseSwarmNodeInfo(status[offset : offset+9]); err == nil {
-			ret.Nodes[i] = nodeInfo
+			ret.Nodes = append(ret.Nodes, nodeInfo)
+		} else {
+			client.logger.Warn("Cannot parse the swarm node info", "node", status[offset][0], "error", err)
 		}
 		offset += 9
 	}
@@ -141,7 +148,6 @@ func parseSwarmNodeInfo(data [][2]string) (ret SwarmNodeInfo, parseErr error) {
 	defer func() {
 		if err := recover(); err != nil {
 			parseErr = fmt.Errorf("Paniced when parse swarm node info, the protocol maybe changed, %s", err)
-			logger.Warnf(parseErr.Error())
 		}
 	}()
 	ret.Name = data[0][0]
@@ -210,9 +216,80 @@ func (client *DockerClient) StartExec(execId string, detach, tty bool) ([]byte,
 	}
 }
 
+var kCommitInstructions = []string{"CMD", "ENTRYPOINT", "ENV", "EXPOSE", "HEALTHCHECK", "LABEL", "ONBUILD", "STOPSIGNAL", "USER", "VOLUME", "WORKDIR"}
+
+// CommitOptions for creating a new image from the container's changes
+type CommitOptions struct {
+	Repo    string
+	Tag     string
+	Comment string
+	Author  string           // e.g. "John Hannibal Smith <hannibal@a-team.com>"
+	NoPause bool             // don't pause the container during the commit, the daemon pauses by default
+	Changes []string         // the Dockerfile instructions applied to the image, e.g. `CMD ["sh"]`, "ENV DEBUG=1"
+	Config  *ContainerConfig // overrides the container config for the image
+}
+
+// CommitContainer creates a new image from the container, returns the new image id
+func (client *DockerClient) CommitContainer(id string, opts CommitOptions) (string, error) {
+	v := url.Values{}
+	v.Set("container", id)
+	if opts.Repo != "" {
+		v.Set("repo", opts.Repo)
+	}
+	if opts.Tag != "" {
+		if opts.Repo == "" {
+			return "", fmt.Errorf("Cannot commit with the tag %q but without the repo", opts.Tag)
+		}
+		v.Set("tag", opts.Tag)
+	}
+	if opts.Comment != "" {
+		v.Set("comment", opts.Comment)
+	}
+	if opts.Author != "" {
+		v.Set("author", opts.Author)
+	}
+	if opts.NoPause {
+		v.Set("pause", "0")
+	}
+	for i, change := range opts.Changes {
+		change = strings.TrimSpace(change)
+		if change == "" {
+			return "", fmt.Errorf("Invalid commit change at %d, the change is empty", i)
+		}
+		instruction := strings.ToUpper(strings.Fields(change)[0])
+		if !containsString(kCommitInstructions, instruction) {
+			return "", fmt.Errorf("Invalid commit change %q, only %s are supported", change, strings.Join(kCommitInstructions, ", "))
+		}
+		v.Add("changes", change)
+	}
+	var body []byte
+	if opts.Config != nil {
+		var err error
+		if body, err = json.Marshal(opts.Config); err != nil {
+			return "", err
+		}
+	}
+	uri := fmt.Sprintf("commit?%s", v.Encode())
+	// extra time for writing the layer
+	rc := &RequestConfig{ExtraTimeout: ImagePuSecs}
+	data, err := client.sendRequest("POST", uri, body, nil, rc)
+	if err != nil {
+		return "", err
+	}
+	var ret struct {
+		Id string
+	}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return "", err
+	}
+	if ret.Id == "" {
+		return "", fmt.Errorf("Cannot find Id field inside result object, %s", data)
+	}
+	return ret.Id, nil
+}
+
 // Missing apis for
 // auth
-// commit: Create a new image from a container's changes
 // events: Monitor Docker's events
 // images/(name)/get: Get a tarball containing all images in a repository
 // images/get: Get a tarball containing all images.
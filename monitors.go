@@ -1,6 +1,7 @@
 package adoc
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,10 +12,14 @@ import (
 func (client *DockerClient) StopMonitor(monitorId int64) {
 	client.monitorLock.Lock()
 	defer client.monitorLock.Unlock()
-	delete(client.monitors, monitorId)
+	if cancel, ok := client.monitors[monitorId]; ok {
+		cancel()
+		delete(client.monitors, monitorId)
+		client.logger.Debug("Stop monitoring", "monitor", monitorId)
+	}
 }
 
-func (client *DockerClient) newMonitorItem() int64 {
+func (client *DockerClient) newMonitorItem() (int64, context.Context) {
 	client.monitorLock.Lock()
 	defer client.monitorLock.Unlock()
 
@@ -22,50 +27,60 @@ func (client *DockerClient) newMonitorItem() int64 {
 	for trial := 5; trial > 0; trial -= 1 {
 		monitorId = random.Int63()
 		if _, ok := client.monitors[monitorId]; !ok {
-			client.monitors[monitorId] = struct{}{}
 			break
 		}
 	}
 	// we have some change to conflict, but I think maybe we live with that
-	return monitorId
+	ctx, cancel := context.WithCancel(context.Background())
+	client.monitors[monitorId] = cancel
+	return monitorId, ctx
+}
+
+func (client *DockerClient) isMonitoring(monitorId int64) bool {
+	client.monitorLock.RLock()
+	defer client.monitorLock.RUnlock()
+	_, ok := client.monitors[monitorId]
+	return ok
 }
 
 type EventCallback func(event Event, err error)
 
+// MonitorEvents streams the events into the callback until the monitor is stopped, the malformed
+// filters are reported to the callback once and no monitor is started, the returned id is 0 then.
 func (client *DockerClient) MonitorEvents(filters string, callback EventCallback) int64 {
 	v := url.Values{}
 	if filters != "" {
+		if err := checkFilters(filters); err != nil {
+			callback(Event{}, err)
+			return 0
+		}
 		v.Set("filters", filters)
 	}
 	uri := "events"
 	if len(v) > 0 {
 		uri += "?" + v.Encode()
 	}
-	monitorId := client.newMonitorItem()
-	go client.monitorEvents(monitorId, uri, callback)
+	monitorId, ctx := client.newMonitorItem()
+	client.logger.Debug("Start monitoring events", "monitor", monitorId, "path", uri)
+	go client.monitorEvents(monitorId, ctx, uri, callback)
 	return monitorId
 }
 
 // will be running inside a goroutine
-func (client *DockerClient) monitorEvents(monitorId int64, uri string, callback EventCallback) {
+func (client *DockerClient) monitorEvents(monitorId int64, ctx context.Context, uri string, callback EventCallback) {
 	err := client.sendRequestCallback("GET", uri, nil, nil, func(resp *http.Response) error {
 		decoder := json.NewDecoder(resp.Body)
-		client.monitorLock.RLock()
-		_, toContinue := client.monitors[monitorId]
-		client.monitorLock.RUnlock()
-		for toContinue {
+		for client.isMonitoring(monitorId) {
 			var event Event
 			if err := decoder.Decode(&event); err != nil {
 				return err
 			}
 			callback(event, nil)
-			client.monitorLock.RLock()
-			_, toContinue = client.monitors[monitorId]
-			client.monitorLock.RUnlock()
 		}
 		return nil
-	}, nil, true)
-	if err != nil && err != io.EOF {
+	}, &RequestConfig{Context: ctx}, true)
+	if err != nil && err != io.EOF && client.isMonitoring(monitorId) {
+		client.logger.Warn("Monitoring events failed", "monitor", monitorId, "error", err)
 		callback(Event{}, err)
 	}
 }
@@ -74,30 +89,26 @@ type StatsCallback func(stats Stats, err error)
 
 func (client *DockerClient) MonitorStats(containerId string, callback StatsCallback) int64 {
 	uri := fmt.Sprintf("containers/%s/stats", containerId)
-	monitorId := client.newMonitorItem()
-	go client.monitorStats(monitorId, uri, callback)
+	monitorId, ctx := client.newMonitorItem()
+	client.logger.Debug("Start monitoring stats", "monitor", monitorId, "container", containerId)
+	go client.monitorStats(monitorId, ctx, uri, callback)
 	return monitorId
 }
 
-func (client *DockerClient) monitorStats(monitorId int64, uri string, callback StatsCallback) {
+func (client *DockerClient) monitorStats(monitorId int64, ctx context.Context, uri string, callback StatsCallback) {
 	err := client.sendRequestCallback("GET", uri, nil, nil, func(resp *http.Response) error {
 		decoder := json.NewDecoder(resp.Body)
-		client.monitorLock.RLock()
-		_, toContinue := client.monitors[monitorId]
-		client.monitorLock.RUnlock()
-		for toContinue {
+		for client.isMonitoring(monitorId) {
 			var stats Stats
 			if err := decoder.Decode(&stats); err != nil {
 				return err
 			}
 			callback(stats, nil)
-			client.monitorLock.RLock()
-			_, toContinue = client.monitors[monitorId]
-			client.monitorLock.RUnlock()
 		}
 		return nil
-	}, nil, true)
-	if err != nil && err != io.EOF {
+	}, &RequestConfig{Context: ctx}, true)
+	if err != nil && err != io.EOF && client.isMonitoring(monitorId) {
+		client.logger.Warn("Monitoring stats failed", "monitor", monitorId, "error", err)
 		callback(Stats{}, err)
 	}
 }
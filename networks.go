@@ -0,0 +1,124 @@
+package adoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// This part contains the apis for the user defined networks, v1.21, e.g.
+//   id, err := docker.CreateNetwork(NetworkCreate{Name: "backend", Labels: map[string]string{"app": "web"}})
+//   networks, err := docker.ListNetworks(NewFilters().Label("app", "web"))
+
+type NetworkIPAMPool struct {
+	Subnet     string            `json:",omitempty"`
+	IPRange    string            `json:",omitempty"`
+	Gateway    string            `json:",omitempty"`
+	AuxAddress map[string]string `json:",omitempty"`
+}
+
+type NetworkIPAM struct {
+	Driver  string            `json:",omitempty"`
+	Config  []NetworkIPAMPool `json:",omitempty"`
+	Options map[string]string `json:",omitempty"`
+}
+
+// NetworkEndpoint is the container attached to the network
+type NetworkEndpoint struct {
+	Name        string
+	EndpointID  string
+	MacAddress  string
+	IPv4Address string
+	IPv6Address string
+}
+
+type NetworkResource struct {
+	Name       string
+	Id         string
+	Created    time.Time
+	Scope      string
+	Driver     string
+	EnableIPv6 bool
+	IPAM       NetworkIPAM
+	Internal   bool
+	Attachable bool
+	Containers map[string]NetworkEndpoint // by the container id
+	Options    map[string]string
+	Labels     map[string]string
+}
+
+// NetworkCreate is the options to create the network, the driver is bridge by default
+type NetworkCreate struct {
+	Name           string
+	CheckDuplicate bool              `json:",omitempty"`
+	Driver         string            `json:",omitempty"`
+	Internal       bool              `json:",omitempty"`
+	Attachable     bool              `json:",omitempty"`
+	EnableIPv6     bool              `json:",omitempty"`
+	IPAM           *NetworkIPAM      `json:",omitempty"`
+	Options        map[string]string `json:",omitempty"`
+	Labels         map[string]string `json:",omitempty"`
+}
+
+// ListNetworks returns the networks, the filters are driver, id, label, name and scope
+func (client *DockerClient) ListNetworks(filters Filters) ([]NetworkResource, error) {
+	if err := filters.Validate(); err != nil {
+		return nil, err
+	}
+	uri := "networks"
+	if encoded := client.EncodeFilters(filters); encoded != "" {
+		uri += "?" + url.Values{"filters": {encoded}}.Encode()
+	}
+	if data, err := client.sendRequest("GET", uri, nil, nil, nil); err != nil {
+		return nil, err
+	} else {
+		var networks []NetworkResource
+		err := json.Unmarshal(data, &networks)
+		return networks, err
+	}
+}
+
+func (client *DockerClient) InspectNetwork(name string) (NetworkResource, error) {
+	var ret NetworkResource
+	uri := fmt.Sprintf("networks/%s", name)
+	if data, err := client.sendRequest("GET", uri, nil, nil, nil); err != nil {
+		return ret, err
+	} else {
+		err := json.Unmarshal(data, &ret)
+		return ret, err
+	}
+}
+
+// CreateNetwork creates the network and returns its id
+func (client *DockerClient) CreateNetwork(options NetworkCreate) (string, error) {
+	if options.Name == "" {
+		return "", fmt.Errorf("The network name is required")
+	}
+	body, err := json.Marshal(options)
+	if err != nil {
+		return "", err
+	}
+	data, err := client.sendRequest("POST", "networks/create", body, nil, nil)
+	if err != nil {
+		return "", err
+	}
+	var ret struct {
+		Id      string
+		Warning string
+	}
+	if err := json.Unmarshal(data, &ret); err != nil {
+		return "", err
+	}
+	if ret.Warning != "" {
+		client.logger.Warn("Network created with warning", "network", options.Name, "warning", ret.Warning)
+	}
+	return ret.Id, nil
+}
+
+// RemoveNetwork removes the network by the name or the id, the network should have no containers attached
+func (client *DockerClient) RemoveNetwork(name string) error {
+	uri := fmt.Sprintf("networks/%s", name)
+	_, err := client.sendRequest("DELETE", uri, nil, nil, nil)
+	return err
+}
@@ -0,0 +1,95 @@
+package adoc
+
+import (
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestNetworks(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+
+	id, err := client.CreateNetwork(NetworkCreate{Name: "backend", Labels: map[string]string{"app": "web"}})
+	if err != nil || id == "" {
+		t.Fatalf("Cannot create the network, %q, %v", id, err)
+	}
+	if _, err := client.CreateNetwork(NetworkCreate{Name: "backend"}); !IsConflict(err) {
+		t.Errorf("Should not create the network of the same name, %v", err)
+	}
+	if _, err := client.CreateNetwork(NetworkCreate{}); err == nil {
+		t.Errorf("Should require the network name")
+	}
+	networks, err := client.ListNetworks(NewFilters().Label("app", "web"))
+	if err != nil || len(networks) != 1 || networks[0].Id != id || networks[0].Driver != "bridge" {
+		t.Fatalf("Wrong listed networks, %+v, %v", networks, err)
+	}
+	if networks, _ := client.ListNetworks(nil); len(networks) != 4 {
+		t.Errorf("Should list the predefined networks too, %+v", networks)
+	}
+
+	// the running container is attached
+	containerId, _ := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{NetworkMode: "backend"}, NetworkingConfig{}, "web")
+	client.StartContainer(containerId)
+	network, err := client.InspectNetwork("backend")
+	if err != nil || network.Labels["app"] != "web" || network.Containers[containerId].Name != "web" {
+		t.Errorf("Wrong inspected network, %+v, %v", network, err)
+	}
+	if err := client.RemoveNetwork("backend"); err == nil {
+		t.Errorf("Should not remove the network in use")
+	}
+	client.RemoveContainer(containerId, true, false)
+	if err := client.RemoveNetwork(id); err != nil {
+		t.Errorf("Cannot remove the network, %s", err)
+	}
+	if _, err := client.InspectNetwork("backend"); !IsNotFound(err) {
+		t.Errorf("The network should be removed, %v", err)
+	}
+	if err := client.RemoveNetwork("bridge"); err == nil {
+		t.Errorf("Should not remove the predefined network")
+	}
+}
+
+func TestVolumes(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+
+	volume, err := client.CreateVolume(VolumeCreate{Name: "data", Labels: map[string]string{"app": "web"}})
+	if err != nil || volume.Name != "data" || volume.Driver != "local" || volume.Labels["app"] != "web" {
+		t.Fatalf("Cannot create the volume, %+v, %v", volume, err)
+	}
+	if again, err := client.CreateVolume(VolumeCreate{Name: "data"}); err != nil || again.Labels["app"] != "web" {
+		t.Errorf("Creating the existing volume should return it, %+v, %v", again, err)
+	}
+	if anonymous, err := client.CreateVolume(VolumeCreate{}); err != nil || len(anonymous.Name) != 64 {
+		t.Errorf("The daemon should name the volume, %+v, %v", anonymous, err)
+	}
+
+	// the named volume of the binds is created with the container
+	containerId, _ := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{Binds: []string{"cache:/cache"}}, NetworkingConfig{}, "web")
+	if volume, err := client.InspectVolume("cache"); err != nil || volume.Mountpoint == "" {
+		t.Errorf("The volume of the binds should be created, %+v, %v", volume, err)
+	}
+	if volumes, err := client.ListVolumes(NewFilters().Dangling(true)); err != nil || len(volumes) != 2 {
+		t.Errorf("Wrong dangling volumes, %+v, %v", volumes, err)
+	}
+	if volumes, err := client.ListVolumes(NewFilters().Label("app", "web")); err != nil || len(volumes) != 1 || volumes[0].Name != "data" {
+		t.Errorf("Wrong labelled volumes, %+v, %v", volumes, err)
+	}
+	if err := client.RemoveVolume("cache", true); !IsConflict(err) {
+		t.Errorf("Should not remove the volume in use, %v", err)
+	}
+	client.RemoveContainer(containerId, true, false)
+	if err := client.RemoveVolume("cache", false); err != nil {
+		t.Errorf("Cannot remove the volume, %s", err)
+	}
+	if _, err := client.InspectVolume("cache"); !IsNotFound(err) {
+		t.Errorf("The volume should be removed, %v", err)
+	}
+}
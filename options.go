@@ -0,0 +1,130 @@
+package adoc
+
+import (
+	"crypto/tls"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type clientOptions struct {
+	tlsConfig       *tls.Config
+	timeout         time.Duration
+	rwTimeout       time.Duration
+	apiVersion      string
+	transport       http.RoundTripper
+	userAgent       string
+	headers         map[string]string
+	logger          Logger
+	isSwarm         bool
+	maxIdleConns    int
+	idleConnTimeout time.Duration
+	keepAlive       time.Duration
+	middlewares     []Middleware
+	retryPolicy     *RetryPolicy
+	tracer          Tracer
+	dryRun          *DryRun
+}
+
+func defaultClientOptions() *clientOptions {
+	return &clientOptions{
+		timeout:    time.Duration(kDefaultTimeout * time.Second),
+		rwTimeout:  time.Duration(kDefaultRWTimeout * time.Second),
+		apiVersion: kDefaultApiVersion,
+		logger:     getDefaultLogger(),
+	}
+}
+
+// ClientOption configures the DockerClient created by NewClient
+type ClientOption func(options *clientOptions)
+
+// WithTLSConfig makes the client talk to a TLS-enabled daemon, tcp:// urls will be turned into https
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(options *clientOptions) {
+		options.tlsConfig = tlsConfig
+	}
+}
+
+// WithTimeout sets the dial timeout and the read/write timeout of the normal requests,
+// the longpoll requests like monitors and wait have no read/write timeout at all
+func WithTimeout(timeout time.Duration, rwTimeout time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		options.timeout = timeout
+		options.rwTimeout = rwTimeout
+	}
+}
+
+// WithAPIVersion sets the remote api version, both "1.18" and "v1.18" are accepted
+func WithAPIVersion(apiVersion string) ClientOption {
+	return func(options *clientOptions) {
+		if apiVersion == "" {
+			return
+		}
+		if !strings.HasPrefix(apiVersion, "v") {
+			apiVersion = "v" + apiVersion
+		}
+		options.apiVersion = apiVersion
+	}
+}
+
+// WithTransport replaces the http transport of the client, the dialing and the transport tuning
+// options are ignored since the RoundTripper takes care of the connections itself
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(options *clientOptions) {
+		options.transport = transport
+	}
+}
+
+// WithUserAgent sets the User-Agent header for every request
+func WithUserAgent(userAgent string) ClientOption {
+	return func(options *clientOptions) {
+		options.userAgent = userAgent
+	}
+}
+
+// WithHeaders adds the default headers for every request, the headers of the api call win
+func WithHeaders(headers map[string]string) ClientOption {
+	return func(options *clientOptions) {
+		if options.headers == nil {
+			options.headers = make(map[string]string)
+		}
+		for key, value := range headers {
+			options.headers[key] = value
+		}
+	}
+}
+
+// WithLogger sets the logger of the client instead of the default one, e.g. WithLogger(slog.Default())
+func WithLogger(logger Logger) ClientOption {
+	return func(options *clientOptions) {
+		options.logger = logger
+	}
+}
+
+// WithSwarm marks the client as a swarm client
+func WithSwarm() ClientOption {
+	return func(options *clientOptions) {
+		options.isSwarm = true
+	}
+}
+
+// WithMaxIdleConns sets the max idle connections kept to the daemon
+func WithMaxIdleConns(maxIdleConns int) ClientOption {
+	return func(options *clientOptions) {
+		options.maxIdleConns = maxIdleConns
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept before closing
+func WithIdleConnTimeout(idleConnTimeout time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		options.idleConnTimeout = idleConnTimeout
+	}
+}
+
+// WithKeepAlive sets the tcp keepalive period of the connections
+func WithKeepAlive(keepAlive time.Duration) ClientOption {
+	return func(options *clientOptions) {
+		options.keepAlive = keepAlive
+	}
+}
@@ -0,0 +1,80 @@
+package adoc
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestNewClientOptions(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1.18/_ping" {
+			t.Errorf("Unexpected request path %q", r.URL.Path)
+		}
+		if ua := r.Header.Get("User-Agent"); ua != "deployer/1.0" {
+			t.Errorf("Unexpected user agent %q", ua)
+		}
+		if auth := r.Header.Get("X-Proxy-Auth"); auth != "token" {
+			t.Errorf("Unexpected default header %q", auth)
+		}
+		fmt.Fprint(w, "OK")
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL,
+		WithAPIVersion("1.18"),
+		WithUserAgent("deployer/1.0"),
+		WithHeaders(map[string]string{"X-Proxy-Auth": "token"}),
+		WithTimeout(time.Second, 5*time.Second),
+		WithMaxIdleConns(4),
+		WithSwarm())
+	if err != nil {
+		t.Fatalf("Cannot create the client, %s", err)
+	}
+	defer client.Close()
+	if !client.IsSwarm() {
+		t.Errorf("Client should be a swarm client")
+	}
+	if pong, err := client.Ping(); err != nil || !pong {
+		t.Fatalf("Cannot ping the docker, %s", err)
+	}
+}
+
+func TestClientCloseStopsMonitors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"status":"start","id":"c0"}`)
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	client, err := NewClient(server.URL)
+	if err != nil {
+		t.Fatalf("Cannot create the client, %s", err)
+	}
+	events := make(chan Event)
+	errs := make(chan error, 1)
+	client.MonitorEvents("", func(event Event, err error) {
+		if err != nil {
+			errs <- err
+			return
+		}
+		events <- event
+	})
+	select {
+	case <-events:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timeout when waiting for the event")
+	}
+	client.Close()
+	if len(client.monitors) != 0 {
+		t.Errorf("Close should stop all the monitors")
+	}
+	select {
+	case err := <-errs:
+		t.Errorf("Stopped monitor should not callback with error, %s", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,231 @@
+package adoc
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// This part contains the port specs parser and the resolver of the published ports, e.g.
+//   exposed, bindings, err := ParsePortSpecs("8080:80", "127.0.0.1::53/udp", "3000-3005:3000-3005")
+//   id, err := docker.CreateContainer(ContainerConfig{Image: "web", ExposedPorts: exposed}, HostConfig{PortBindings: bindings})
+//   ...
+//   container, err := docker.InspectContainer(id)
+//   addrs, err := container.HostAddresses("80/tcp") // e.g. [10.0.0.5:8080] on the swarm node
+// The wildcard host ip is substituted by the swarm node ip if the container is on a swarm node.
+
+// HostAddress is the address on the host which serves a container port
+type HostAddress struct {
+	IP   string
+	Port int
+}
+
+func (addr HostAddress) String() string {
+	return net.JoinHostPort(addr.IP, strconv.Itoa(addr.Port))
+}
+
+// ParsePortSpecs parses the port specs like docker run -p, [ip:][hostPort:]containerPort[/protocol],
+// the ports could be ranges, returns the ExposedPorts and PortBindings for creating the container
+func ParsePortSpecs(specs ...string) (map[string]struct{}, map[string][]PortBinding, error) {
+	exposed := make(map[string]struct{})
+	bindings := make(map[string][]PortBinding)
+	for _, spec := range specs {
+		ports, specBindings, err := parsePortSpec(spec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("Invalid port spec %q, %s", spec, err)
+		}
+		for _, port := range ports {
+			exposed[port] = struct{}{}
+		}
+		for port, binding := range specBindings {
+			bindings[port] = append(bindings[port], binding...)
+		}
+	}
+	return exposed, bindings, nil
+}
+
+// ResolvePort returns the host addresses serving the container port like "80/tcp" or "80" (tcp by default),
+// from the NetworkSettings.Ports of the inspected container. The wildcard host ip is replaced by the nodeIp
+// if it is not empty.
+func ResolvePort(ports map[string][]PortBinding, port string, nodeIp string) ([]HostAddress, error) {
+	key, err := normalizePort(port)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []HostAddress
+	for _, binding := range ports[key] {
+		// the host port is not allocated until the container is started
+		hostPort, err := strconv.Atoi(binding.HostPort)
+		if err != nil || hostPort == 0 {
+			continue
+		}
+		addrs = appendHostAddress(addrs, resolveHostIp(binding.HostIp, nodeIp), hostPort)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("Port %s is not published", key)
+	}
+	return addrs, nil
+}
+
+// ResolveListPort is like ResolvePort but from the Ports of the listed container
+func ResolveListPort(ports []Port, port string, nodeIp string) ([]HostAddress, error) {
+	key, err := normalizePort(port)
+	if err != nil {
+		return nil, err
+	}
+	var addrs []HostAddress
+	for _, p := range ports {
+		proto := p.Type
+		if proto == "" {
+			proto = "tcp"
+		}
+		if p.PublicPort == 0 || fmt.Sprintf("%d/%s", p.PrivatePort, proto) != key {
+			continue
+		}
+		addrs = appendHostAddress(addrs, resolveHostIp(p.IP, nodeIp), p.PublicPort)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("Port %s is not published", key)
+	}
+	return addrs, nil
+}
+
+// HostAddresses returns the host addresses serving the container port, with the swarm node ip
+// for the wildcard host ip
+func (container ContainerDetail) HostAddresses(port string) ([]HostAddress, error) {
+	return ResolvePort(container.NetworkSettings.Ports, port, container.Node.IP)
+}
+
+// HostAddresses returns the host addresses serving the container port, the Ports of the listed
+// container has no swarm node, so use ResolveListPort to substitute the wildcard host ip
+func (container Container) HostAddresses(port string) ([]HostAddress, error) {
+	return ResolveListPort(container.Ports, port, "")
+}
+
+// normalizePort turns the port like 80 into 80/tcp and validates it
+func normalizePort(port string) (string, error) {
+	proto := "tcp"
+	if i := strings.LastIndex(port, "/"); i >= 0 {
+		port, proto = port[:i], strings.ToLower(port[i+1:])
+	}
+	if !isValidProtocol(proto) {
+		return "", fmt.Errorf("Invalid protocol %q of port %s", proto, port)
+	}
+	number, err := strconv.Atoi(port)
+	if err != nil || number < 1 || number > 65535 {
+		return "", fmt.Errorf("Invalid port %q", port)
+	}
+	return fmt.Sprintf("%d/%s", number, proto), nil
+}
+
+func resolveHostIp(hostIp string, nodeIp string) string {
+	if hostIp == "" || hostIp == "0.0.0.0" || hostIp == "::" {
+		if nodeIp != "" {
+			return nodeIp
+		}
+		if hostIp == "" {
+			return "0.0.0.0"
+		}
+	}
+	return hostIp
+}
+
+// appendHostAddress skips the duplicates, e.g. the 0.0.0.0 and :: bindings which are both the node ip
+func appendHostAddress(addrs []HostAddress, ip string, port int) []HostAddress {
+	addr := HostAddress{IP: ip, Port: port}
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
+
+func isValidProtocol(proto string) bool {
+	return proto == "tcp" || proto == "udp" || proto == "sctp"
+}
+
+// parsePortSpec parses the [ip:][hostPort:]containerPort[/protocol], the ports could be ranges
+// like 3000-3005:3000-3005, returns the exposed ports and their bindings
+func parsePortSpec(spec string) ([]string, map[string][]PortBinding, error) {
+	protocol := "tcp"
+	if i := strings.LastIndex(spec, "/"); i >= 0 {
+		spec, protocol = spec[:i], strings.ToLower(spec[i+1:])
+	}
+	if !isValidProtocol(protocol) {
+		return nil, nil, fmt.Errorf("invalid protocol %q", protocol)
+	}
+	var ip string
+	if strings.HasPrefix(spec, "[") {
+		// the ipv6 address
+		end := strings.Index(spec, "]")
+		if end < 0 || len(spec) <= end+1 || spec[end+1] != ':' {
+			return nil, nil, fmt.Errorf("invalid ipv6 address")
+		}
+		ip, spec = spec[1:end], spec[end+2:]
+	}
+	parts := strings.Split(spec, ":")
+	var hostPorts, containerPorts string
+	switch {
+	case len(parts) == 1:
+		containerPorts = parts[0]
+	case len(parts) == 2:
+		hostPorts, containerPorts = parts[0], parts[1]
+	case len(parts) == 3 && ip == "":
+		ip, hostPorts, containerPorts = parts[0], parts[1], parts[2]
+	default:
+		return nil, nil, fmt.Errorf("should be [ip:][hostPort:]containerPort[/protocol]")
+	}
+	if ip != "" && net.ParseIP(ip) == nil {
+		return nil, nil, fmt.Errorf("invalid ip address %q", ip)
+	}
+	startPort, endPort, err := parsePortRange(containerPorts)
+	if err != nil {
+		return nil, nil, err
+	}
+	var startHost, endHost int
+	if hostPorts != "" {
+		if startHost, endHost, err = parsePortRange(hostPorts); err != nil {
+			return nil, nil, err
+		}
+		if endHost-startHost != endPort-startPort && endPort != startPort {
+			return nil, nil, fmt.Errorf("the host and the container port ranges should be of the same size")
+		}
+	}
+	var exposed []string
+	bindings := make(map[string][]PortBinding)
+	for port := startPort; port <= endPort; port += 1 {
+		key := fmt.Sprintf("%d/%s", port, protocol)
+		exposed = append(exposed, key)
+		binding := PortBinding{HostIp: ip}
+		switch {
+		case hostPorts == "":
+		case endPort == startPort && endHost != startHost:
+			// a container port could be bound to any port of the host range
+			binding.HostPort = fmt.Sprintf("%d-%d", startHost, endHost)
+		default:
+			binding.HostPort = strconv.Itoa(startHost + port - startPort)
+		}
+		bindings[key] = append(bindings[key], binding)
+	}
+	return exposed, bindings, nil
+}
+
+func parsePortRange(value string) (int, int, error) {
+	parts := strings.SplitN(value, "-", 2)
+	start, err := strconv.Atoi(parts[0])
+	if err != nil || start < 1 || start > 65535 {
+		return 0, 0, fmt.Errorf("invalid port %q", parts[0])
+	}
+	end := start
+	if len(parts) == 2 {
+		if end, err = strconv.Atoi(parts[1]); err != nil || end < 1 || end > 65535 {
+			return 0, 0, fmt.Errorf("invalid port %q", parts[1])
+		}
+		if end < start {
+			return 0, 0, fmt.Errorf("invalid port range %q", value)
+		}
+	}
+	return start, end, nil
+}
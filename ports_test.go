@@ -0,0 +1,82 @@
+package adoc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestParsePortSpecs(t *testing.T) {
+	exposed, bindings, err := ParsePortSpecs("8080:80", "127.0.0.1::53/udp", "3000-3001:3000-3001", "[::1]:9000:9000", "9090")
+	if err != nil {
+		t.Fatalf("Cannot parse the port specs, %s", err)
+	}
+	needBindings := map[string][]PortBinding{
+		"80/tcp":   {{HostPort: "8080"}},
+		"53/udp":   {{HostIp: "127.0.0.1"}},
+		"3000/tcp": {{HostPort: "3000"}},
+		"3001/tcp": {{HostPort: "3001"}},
+		"9000/tcp": {{HostIp: "::1", HostPort: "9000"}},
+		"9090/tcp": {{}},
+	}
+	if !reflect.DeepEqual(bindings, needBindings) || len(exposed) != 6 {
+		t.Errorf("Wrong port specs, %+v, %+v", exposed, bindings)
+	}
+
+	for _, spec := range []string{"80/xtp", "0", "70000", "3005-3000", "8080-8081:80-82", "localhost:80:80", "1:2:3:4", "[::1:80"} {
+		if _, _, err := ParsePortSpecs(spec); err == nil || !strings.Contains(err.Error(), spec) {
+			t.Errorf("Should reject the port spec %q, %v", spec, err)
+		}
+	}
+}
+
+func TestResolvePort(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "web"})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	exposed, bindings, _ := ParsePortSpecs("8080:80", "127.0.0.1:5353:53/udp")
+	id, err := client.CreateContainer(ContainerConfig{Image: "web", ExposedPorts: exposed}, HostConfig{PortBindings: bindings}, NetworkingConfig{})
+	if err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	if container, _ := client.InspectContainer(id); container.NetworkSettings.Ports["80/tcp"] != nil {
+		t.Errorf("The ports should not be published before the start, %+v", container.NetworkSettings.Ports)
+	}
+	client.StartContainer(id)
+	container, _ := client.InspectContainer(id)
+	if addrs, err := container.HostAddresses("80"); err != nil || len(addrs) != 1 || addrs[0].String() != "0.0.0.0:8080" {
+		t.Errorf("Wrong host address of port 80, %v, %v", addrs, err)
+	}
+	if addrs, err := container.HostAddresses("53/udp"); err != nil || addrs[0].String() != "127.0.0.1:5353" {
+		t.Errorf("Wrong host address of port 53/udp, %v, %v", addrs, err)
+	}
+	if _, err := container.HostAddresses("53"); err == nil {
+		t.Errorf("Should not resolve the port 53/tcp")
+	}
+	if _, err := container.HostAddresses("80/xtp"); err == nil {
+		t.Errorf("Should reject the invalid port")
+	}
+
+	// the wildcard is the swarm node ip, the 0.0.0.0 and :: are the same address on the node
+	container.Node.IP = "10.0.0.5"
+	container.NetworkSettings.Ports["80/tcp"] = append(container.NetworkSettings.Ports["80/tcp"], PortBinding{HostIp: "::", HostPort: "8080"})
+	if addrs, err := container.HostAddresses("80/tcp"); err != nil || len(addrs) != 1 || addrs[0].String() != "10.0.0.5:8080" {
+		t.Errorf("Wrong host address on the swarm node, %v, %v", addrs, err)
+	}
+
+	containers, _ := client.ListContainers(false, false, "")
+	if len(containers) != 1 {
+		t.Fatalf("Wrong containers, %+v", containers)
+	}
+	if addrs, err := containers[0].HostAddresses("80/tcp"); err != nil || addrs[0].String() != "0.0.0.0:8080" {
+		t.Errorf("Wrong host address of the listed container, %v, %v", addrs, err)
+	}
+	if addrs, err := ResolveListPort(containers[0].Ports, "80", "10.0.0.5"); err != nil || addrs[0].String() != "10.0.0.5:8080" {
+		t.Errorf("Wrong host address of the listed container on the swarm node, %v, %v", addrs, err)
+	}
+}
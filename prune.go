@@ -0,0 +1,254 @@
+package adoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// This part contains the prune and the disk usage apis, v1.25, e.g.
+//   report, err := docker.PruneImages(true, NewFilters().Until("24h").LabelNot("protected", ""))
+//   fmt.Println(report.Deleted, report.HumanSpaceReclaimed())
+
+const (
+	kPruneApiVersion      = "v1.25"
+	kBuildPruneApiVersion = "v1.31"
+)
+
+// PruneReport is the objects deleted by the prune and the space reclaimed in bytes
+type PruneReport struct {
+	Deleted        []string
+	SpaceReclaimed uint64
+}
+
+// HumanSpaceReclaimed returns the reclaimed space like "1.5GB"
+func (r PruneReport) HumanSpaceReclaimed() string {
+	return HumanSize(float64(r.SpaceReclaimed))
+}
+
+func (client *DockerClient) checkPruneVersion(minVersion string) error {
+	if compareApiVersion(client.apiVersion, minVersion) < 0 {
+		return fmt.Errorf("Prune is not supported by api %s, need %s", client.apiVersion, minVersion)
+	}
+	return nil
+}
+
+func (client *DockerClient) prune(uri string, filters Filters, ret interface{}) error {
+	if err := filters.Validate(); err != nil {
+		return err
+	}
+	if encoded := client.EncodeFilters(filters); encoded != "" {
+		uri += "?" + url.Values{"filters": {encoded}}.Encode()
+	}
+	// pruning could take long to delete the layers
+	rc := &RequestConfig{ExtraTimeout: ImagePuSecs}
+	data, err := client.sendRequest("POST", uri, nil, nil, rc)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, ret)
+}
+
+// PruneContainers removes the stopped containers, the filters are until and label
+func (client *DockerClient) PruneContainers(filters Filters) (PruneReport, error) {
+	if err := client.checkPruneVersion(kPruneApiVersion); err != nil {
+		return PruneReport{}, err
+	}
+	var ret struct {
+		ContainersDeleted []string
+		SpaceReclaimed    uint64
+	}
+	err := client.prune("containers/prune", filters, &ret)
+	return PruneReport{Deleted: ret.ContainersDeleted, SpaceReclaimed: ret.SpaceReclaimed}, err
+}
+
+// PruneImages removes the dangling images, or all the unused images if all is true,
+// the filters are until and label
+func (client *DockerClient) PruneImages(all bool, filters Filters) (PruneReport, error) {
+	if err := client.checkPruneVersion(kPruneApiVersion); err != nil {
+		return PruneReport{}, err
+	}
+	copied := make(Filters)
+	for key, values := range filters {
+		copied[key] = values
+	}
+	copied.Dangling(!all)
+	var ret struct {
+		ImagesDeleted []struct {
+			Untagged string
+			Deleted  string
+		}
+		SpaceReclaimed uint64
+	}
+	err := client.prune("images/prune", copied, &ret)
+	report := PruneReport{SpaceReclaimed: ret.SpaceReclaimed}
+	for _, item := range ret.ImagesDeleted {
+		if item.Deleted != "" {
+			report.Deleted = append(report.Deleted, item.Deleted)
+		}
+	}
+	return report, err
+}
+
+// PruneVolumes removes the volumes not used by any container, the filter is label
+func (client *DockerClient) PruneVolumes(filters Filters) (PruneReport, error) {
+	if err := client.checkPruneVersion(kPruneApiVersion); err != nil {
+		return PruneReport{}, err
+	}
+	var ret struct {
+		VolumesDeleted []string
+		SpaceReclaimed uint64
+	}
+	err := client.prune("volumes/prune", filters, &ret)
+	return PruneReport{Deleted: ret.VolumesDeleted, SpaceReclaimed: ret.SpaceReclaimed}, err
+}
+
+// PruneNetworks removes the networks not used by any container, the filters are until and label,
+// there is no space reclaimed
+func (client *DockerClient) PruneNetworks(filters Filters) (PruneReport, error) {
+	if err := client.checkPruneVersion(kPruneApiVersion); err != nil {
+		return PruneReport{}, err
+	}
+	var ret struct {
+		NetworksDeleted []string
+	}
+	err := client.prune("networks/prune", filters, &ret)
+	return PruneReport{Deleted: ret.NetworksDeleted}, err
+}
+
+// PruneBuildCache removes the build cache, v1.31
+func (client *DockerClient) PruneBuildCache(filters Filters) (PruneReport, error) {
+	if err := client.checkPruneVersion(kBuildPruneApiVersion); err != nil {
+		return PruneReport{}, err
+	}
+	var ret struct {
+		CachesDeleted  []string
+		SpaceReclaimed uint64
+	}
+	err := client.prune("build/prune", filters, &ret)
+	return PruneReport{Deleted: ret.CachesDeleted, SpaceReclaimed: ret.SpaceReclaimed}, err
+}
+
+type VolumeUsageData struct {
+	Size     int64 // -1 if not calculated
+	RefCount int64 // -1 if not calculated
+}
+
+type Volume struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+	CreatedAt  string
+	Labels     map[string]string
+	Scope      string
+	UsageData  *VolumeUsageData
+}
+
+type BuildCache struct {
+	ID          string
+	Type        string
+	Description string
+	InUse       bool
+	Shared      bool
+	Size        int64
+	CreatedAt   time.Time
+	LastUsedAt  *time.Time
+	UsageCount  int
+}
+
+// DiskUsage is the result of /system/df, the images are with the SharedSize and the Containers count,
+// the containers are with the SizeRw and SizeRootFs
+type DiskUsage struct {
+	LayersSize int64
+	Images     []Image
+	Containers []Container
+	Volumes    []Volume
+	BuildCache []BuildCache
+}
+
+// DiskUsageSummary is one row of the `docker system df`
+type DiskUsageSummary struct {
+	Type        string
+	Total       int
+	Active      int
+	Size        int64
+	Reclaimable int64
+}
+
+func (s DiskUsageSummary) String() string {
+	percent := 0
+	if s.Size > 0 {
+		percent = int(s.Reclaimable * 100 / s.Size)
+	}
+	return fmt.Sprintf("%s\t%d\t%d\t%s\t%s (%d%%)", s.Type, s.Total, s.Active,
+		HumanSize(float64(s.Size)), HumanSize(float64(s.Reclaimable)), percent)
+}
+
+func (client *DockerClient) DiskUsage() (DiskUsage, error) {
+	var ret DiskUsage
+	if err := client.checkPruneVersion(kPruneApiVersion); err != nil {
+		return ret, err
+	}
+	data, err := client.sendRequest("GET", "system/df", nil, nil, &RequestConfig{ExtraTimeout: ImagePuSecs})
+	if err != nil {
+		return ret, err
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret, err
+}
+
+// Summary counts the disk usage like `docker system df`. The images size is the LayersSize, the shared
+// layers are counted once, and only the unique size of the images used by the containers is not reclaimable.
+func (du DiskUsage) Summary() []DiskUsageSummary {
+	images := DiskUsageSummary{Type: "Images", Total: len(du.Images), Size: du.LayersSize}
+	var used int64
+	for _, image := range du.Images {
+		if image.Containers > 0 {
+			images.Active += 1
+			if image.SharedSize >= 0 {
+				used += image.Size - image.SharedSize
+			} else {
+				used += image.Size
+			}
+		}
+	}
+	images.Reclaimable = images.Size - used
+	if images.Reclaimable < 0 {
+		images.Reclaimable = 0
+	}
+
+	containers := DiskUsageSummary{Type: "Containers", Total: len(du.Containers)}
+	for _, container := range du.Containers {
+		containers.Size += container.SizeRw
+		if container.State == "running" || container.State == "paused" || container.State == "restarting" {
+			containers.Active += 1
+		} else {
+			containers.Reclaimable += container.SizeRw
+		}
+	}
+
+	volumes := DiskUsageSummary{Type: "Local Volumes", Total: len(du.Volumes)}
+	for _, volume := range du.Volumes {
+		if volume.UsageData == nil || volume.UsageData.Size < 0 {
+			continue
+		}
+		volumes.Size += volume.UsageData.Size
+		if volume.UsageData.RefCount > 0 {
+			volumes.Active += 1
+		} else {
+			volumes.Reclaimable += volume.UsageData.Size
+		}
+	}
+
+	cache := DiskUsageSummary{Type: "Build Cache", Total: len(du.BuildCache)}
+	for _, item := range du.BuildCache {
+		cache.Size += item.Size
+		if item.InUse {
+			cache.Active += 1
+		} else if !item.Shared {
+			cache.Reclaimable += item.Size
+		}
+	}
+	return []DiskUsageSummary{images, containers, volumes, cache}
+}
@@ -0,0 +1,111 @@
+package adoc
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestPrune(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox", Size: 2 * 1024 * 1024})
+	server.AddImage(adoctest.ImageSpec{Name: "redis", Size: 3 * 1024 * 1024})
+	server.AddImage(adoctest.ImageSpec{Name: "nginx", Labels: map[string]string{"protected": "true"}})
+
+	legacy, _ := NewClient(server.URL, WithAPIVersion("v1.24"))
+	defer legacy.Close()
+	if _, err := legacy.PruneContainers(nil); err == nil {
+		t.Fatalf("Prune should not be supported by v1.24")
+	}
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.30"))
+	defer client.Close()
+	if _, err := client.PruneBuildCache(nil); err == nil {
+		t.Fatalf("Build cache prune should not be supported by v1.30")
+	}
+
+	running, _ := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{}, "running")
+	client.StartContainer(running)
+	stopped, _ := client.CreateContainer(ContainerConfig{Image: "busybox", Labels: map[string]string{"app": "web"}}, HostConfig{}, NetworkingConfig{}, "stopped")
+	kept, _ := client.CreateContainer(ContainerConfig{Image: "busybox", Labels: map[string]string{"keep": "yes"}}, HostConfig{}, NetworkingConfig{}, "kept")
+
+	report, err := client.PruneContainers(NewFilters().LabelNot("keep", ""))
+	if err != nil || len(report.Deleted) != 1 || report.Deleted[0] != stopped {
+		t.Fatalf("Should prune only the stopped container, %+v, %v", report, err)
+	}
+	if _, err := client.InspectContainer(kept); err != nil {
+		t.Errorf("The container with the keep label should not be pruned, %s", err)
+	}
+	if report, err = client.PruneContainers(NewFilters().Until("1h")); err != nil || len(report.Deleted) != 0 {
+		t.Fatalf("Should not prune the containers created in the last hour, %+v, %v", report, err)
+	}
+	if _, err := client.PruneContainers(NewFilters().Status("bogus")); err == nil {
+		t.Errorf("Should validate the filters")
+	}
+
+	if report, err = client.PruneImages(false, nil); err != nil || len(report.Deleted) != 0 {
+		t.Fatalf("There are no dangling images, %+v, %v", report, err)
+	}
+	report, err = client.PruneImages(true, NewFilters().LabelNot("protected", "true"))
+	if err != nil || len(report.Deleted) != 1 || report.SpaceReclaimed != 3*1024*1024 {
+		t.Fatalf("Should prune the unused redis image only, %+v, %v", report, err)
+	}
+	if human := report.HumanSpaceReclaimed(); human != HumanSize(3*1024*1024) {
+		t.Errorf("Wrong human space reclaimed, %s", human)
+	}
+	if _, err := client.InspectImage("redis"); err == nil {
+		t.Errorf("The redis image should be pruned")
+	}
+
+	client, _ = NewClient(server.URL, WithAPIVersion("v1.31"))
+	defer client.Close()
+	for _, prune := range []func(Filters) (PruneReport, error){client.PruneVolumes, client.PruneNetworks, client.PruneBuildCache} {
+		if report, err := prune(nil); err != nil || len(report.Deleted) != 0 {
+			t.Errorf("Should prune nothing, %+v, %v", report, err)
+		}
+	}
+
+	du, err := client.DiskUsage()
+	if err != nil || len(du.Images) != 2 || len(du.Containers) != 2 || du.LayersSize != 3*1024*1024 {
+		t.Fatalf("Wrong disk usage, %+v, %v", du, err)
+	}
+	summary := du.Summary()
+	if summary[0].Active != 1 || summary[0].Reclaimable != 1024*1024 {
+		t.Errorf("Only the nginx image should be reclaimable, %+v", summary[0])
+	}
+	if summary[1].Total != 2 || summary[1].Active != 1 {
+		t.Errorf("Wrong containers summary, %+v", summary[1])
+	}
+	if line := summary[0].String(); !strings.HasPrefix(line, "Images\t2\t1\t") || !strings.HasSuffix(line, "(33%)") {
+		t.Errorf("Wrong summary line, %q", line)
+	}
+}
+
+func TestDiskUsageSummary(t *testing.T) {
+	du := DiskUsage{
+		LayersSize: 300,
+		Images: []Image{
+			{Size: 200, SharedSize: 100, Containers: 1},
+			{Size: 150, SharedSize: 100, Containers: 0},
+		},
+		Containers: []Container{{SizeRw: 10, State: "running"}, {SizeRw: 20, State: "exited"}},
+		Volumes: []Volume{
+			{Name: "data", UsageData: &VolumeUsageData{Size: 50, RefCount: 1}},
+			{Name: "old", UsageData: &VolumeUsageData{Size: 30, RefCount: 0}},
+			{Name: "remote", UsageData: &VolumeUsageData{Size: -1, RefCount: -1}},
+		},
+		BuildCache: []BuildCache{{Size: 5, InUse: true}, {Size: 7, Shared: true}, {Size: 9}},
+	}
+	need := []DiskUsageSummary{
+		{Type: "Images", Total: 2, Active: 1, Size: 300, Reclaimable: 200},
+		{Type: "Containers", Total: 2, Active: 1, Size: 30, Reclaimable: 20},
+		{Type: "Local Volumes", Total: 3, Active: 1, Size: 80, Reclaimable: 30},
+		{Type: "Build Cache", Total: 3, Active: 1, Size: 21, Reclaimable: 9},
+	}
+	for i, got := range du.Summary() {
+		if got != need[i] {
+			t.Errorf("Wrong summary, need=%+v, got=%+v", need[i], got)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+package adoc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+// This part contains the record and replay of the api traffic, record a real session once
+// against docker or swarm, and run the regression tests offline with the replayed responses, e.g.
+//   recorder := NewRecorder(file)
+//   docker, _ := NewClient(daemonUrl, WithMiddleware(RecordMiddleware(recorder)))
+//   ...
+//   replayer, _ := NewReplayer(file)
+//   docker, _ := NewClient("tcp://replay:2375", WithTransport(replayer))
+// The streamed bodies like events, logs and pull progress are recorded as far as the client read them.
+
+// Recording is one request/response pair, written as one line of JSON
+type Recording struct {
+	Method      string              `json:"method"`
+	Path        string              `json:"path"` // without the api version prefix
+	Query       url.Values          `json:"query,omitempty"`
+	RequestBody string              `json:"requestBody,omitempty"`
+	StatusCode  int                 `json:"status"`
+	Header      map[string][]string `json:"header,omitempty"`
+	Body        string              `json:"body,omitempty"`
+	BodyBytes   []byte              `json:"bodyBytes,omitempty"`   // the body which is not valid utf8, e.g. the multiplexed logs
+	Interrupted bool                `json:"interrupted,omitempty"` // the client closed the stream before EOF, like the monitors do
+}
+
+var (
+	kRecordIdRegexp      = regexp.MustCompile(`\b[0-9a-f]{64}\b`)
+	kRecordVersionRegexp = regexp.MustCompile(`^/v[0-9]+\.[0-9]+/`)
+	kRecordTimeKeys      = []string{"time", "timeNano", "Created", "StartedAt", "FinishedAt", "SystemTime", "read", "preread", "LastTagTime"}
+	kRecordSecretKeys    = []string{"Authorization", "X-Registry-Auth", "X-Registry-Config", "password", "Password", "identitytoken", "IdentityToken"}
+	kRecordTimeValue     = "2000-01-01T00:00:00Z"
+)
+
+// Recorder writes the recordings as JSONL, the volatile fields are normalized before writing:
+// the 64 hex ids are mapped to stable fake ids, the timestamps are set to a fixed time and the
+// secrets in the headers and the JSON bodies are redacted.
+type Recorder struct {
+	// TimeKeys are the JSON keys of the timestamps to normalize
+	TimeKeys []string
+	// SecretKeys are the header names and the JSON keys to redact
+	SecretKeys []string
+	// Redact is called on every recording after the default normalization if not nil
+	Redact func(r *Recording)
+
+	lock    sync.Mutex
+	w       io.Writer
+	encoder *json.Encoder
+	ids     map[string]string
+}
+
+func NewRecorder(w io.Writer) *Recorder {
+	return &Recorder{
+		TimeKeys:   kRecordTimeKeys,
+		SecretKeys: kRecordSecretKeys,
+		w:          w,
+		encoder:    json.NewEncoder(w),
+		ids:        make(map[string]string),
+	}
+}
+
+// RecordMiddleware records every round trip into the recorder, the recording is written
+// after the response body is closed or fully read.
+func RecordMiddleware(recorder *Recorder) Middleware {
+	return func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			var reqBody []byte
+			if req.Body != nil {
+				var err error
+				if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+					return nil, err
+				}
+				req.Body.Close()
+				req = req.Clone(req.Context())
+				req.Body = ioutil.NopCloser(bytes.NewReader(reqBody))
+			}
+			resp, err := next.RoundTrip(req)
+			if err != nil {
+				return resp, err
+			}
+			r := &Recording{
+				Method:      req.Method,
+				Path:        stripApiVersion(req.URL.Path),
+				Query:       req.URL.Query(),
+				RequestBody: string(reqBody),
+				StatusCode:  resp.StatusCode,
+				Header:      resp.Header.Clone(),
+			}
+			if len(r.Query) == 0 {
+				r.Query = nil
+			}
+			resp.Body = &recordingBody{ReadCloser: resp.Body, recorder: recorder, recording: r}
+			return resp, nil
+		})
+	}
+}
+
+type recordingBody struct {
+	io.ReadCloser
+	recorder  *Recorder
+	recording *Recording
+	buffer    bytes.Buffer
+	once      sync.Once
+}
+
+func (b *recordingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.buffer.Write(p[:n])
+	if err == io.EOF {
+		b.finish(false)
+	}
+	return n, err
+}
+
+func (b *recordingBody) Close() error {
+	b.finish(true)
+	return b.ReadCloser.Close()
+}
+
+func (b *recordingBody) finish(interrupted bool) {
+	b.once.Do(func() {
+		b.recording.Interrupted = interrupted
+		if body := b.buffer.Bytes(); utf8.Valid(body) {
+			b.recording.Body = string(body)
+		} else {
+			b.recording.BodyBytes = body
+		}
+		b.recorder.write(b.recording)
+	})
+}
+
+func (recorder *Recorder) write(r *Recording) {
+	recorder.lock.Lock()
+	defer recorder.lock.Unlock()
+	recorder.normalize(r)
+	if recorder.Redact != nil {
+		recorder.Redact(r)
+	}
+	if err := recorder.encoder.Encode(r); err != nil {
+		getDefaultLogger().Warn("Cannot write the recording", "method", r.Method, "path", r.Path, "error", err)
+	}
+}
+
+// normalize applies the default redaction, the lock should be held
+func (recorder *Recorder) normalize(r *Recording) {
+	r.Path = recorder.replaceIds(r.Path)
+	for key, values := range r.Query {
+		for i := range values {
+			values[i] = recorder.replaceIds(values[i])
+		}
+		r.Query[key] = values
+	}
+	for key := range r.Header {
+		if containsKey(recorder.SecretKeys, key) {
+			r.Header[key] = []string{"REDACTED"}
+		}
+	}
+	// the content length would be wrong after the redaction
+	delete(r.Header, "Content-Length")
+	delete(r.Header, "Date")
+
+	r.RequestBody = recorder.normalizeBody(r.RequestBody)
+	r.Body = recorder.normalizeBody(r.Body)
+	// keep the same length for the framed bodies
+	r.BodyBytes = []byte(recorder.replaceIds(string(r.BodyBytes)))
+	if len(r.BodyBytes) == 0 {
+		r.BodyBytes = nil
+	}
+}
+
+func (recorder *Recorder) replaceIds(value string) string {
+	return kRecordIdRegexp.ReplaceAllStringFunc(value, func(id string) string {
+		fake, ok := recorder.ids[id]
+		if !ok {
+			fake = fmt.Sprintf("%064x", len(recorder.ids)+1)
+			recorder.ids[id] = fake
+		}
+		return fake
+	})
+}
+
+// normalizeBody redacts the JSON body line by line, the streams are JSON lines as well
+func (recorder *Recorder) normalizeBody(body string) string {
+	if body == "" {
+		return body
+	}
+	lines := strings.SplitAfter(body, "\n")
+	for i, line := range lines {
+		trimmed := strings.TrimSpace(line)
+		var value interface{}
+		if trimmed == "" || json.Unmarshal([]byte(trimmed), &value) != nil {
+			lines[i] = recorder.replaceIds(line)
+			continue
+		}
+		value = recorder.redactValue(value)
+		data, _ := json.Marshal(value)
+		lines[i] = recorder.replaceIds(string(data)) + line[len(strings.TrimRight(line, " \r\n")):]
+	}
+	return strings.Join(lines, "")
+}
+
+func (recorder *Recorder) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			switch {
+			case containsKey(recorder.SecretKeys, key):
+				v[key] = "REDACTED"
+			case containsKey(recorder.TimeKeys, key):
+				v[key] = normalizedTime(key, field)
+			default:
+				v[key] = recorder.redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = recorder.redactValue(v[i])
+		}
+	}
+	return value
+}
+
+func normalizedTime(key string, value interface{}) interface{} {
+	switch value.(type) {
+	case string:
+		return kRecordTimeValue
+	case float64:
+		if strings.HasSuffix(key, "Nano") {
+			return 946684800000000000
+		}
+		return 946684800
+	}
+	return value
+}
+
+func containsKey(keys []string, key string) bool {
+	for _, k := range keys {
+		if strings.EqualFold(k, key) {
+			return true
+		}
+	}
+	return false
+}
+
+func stripApiVersion(path string) string {
+	if loc := kRecordVersionRegexp.FindStringIndex(path); loc != nil {
+		return path[loc[1]-1:]
+	}
+	return path
+}
+
+// MatchRule decides which parts of the request should equal the recording when replaying
+type MatchRule struct {
+	IgnoreQuery bool
+	IgnoreBody  bool
+}
+
+// Replayer serves the recorded responses as a http.RoundTripper. The requests are matched by
+// method, path, query and body (the JSON bodies are compared by value), the api version in the
+// path is ignored. The request bodies are normalized like the Recorder before comparing, so the
+// TimeKeys and SecretKeys should be the same as the recording ones. The matched recordings are
+// served in the recorded order, the last one is served again when they are used up, so the
+// polling calls keep working.
+type Replayer struct {
+	Rule       MatchRule
+	TimeKeys   []string
+	SecretKeys []string
+
+	lock       sync.Mutex
+	recordings []*Recording
+	served     map[*Recording]bool
+	ids        map[string]string
+}
+
+// NewReplayer loads the recordings from the JSONL written by the Recorder
+func NewReplayer(r io.Reader) (*Replayer, error) {
+	replayer := &Replayer{
+		TimeKeys:   kRecordTimeKeys,
+		SecretKeys: kRecordSecretKeys,
+		served:     make(map[*Recording]bool),
+		ids:        make(map[string]string),
+	}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line += 1
+		if len(bytes.TrimSpace(scanner.Bytes())) == 0 {
+			continue
+		}
+		var recording Recording
+		if err := json.Unmarshal(scanner.Bytes(), &recording); err != nil {
+			return nil, fmt.Errorf("Invalid recording at line %d, %s", line, err)
+		}
+		replayer.recordings = append(replayer.recordings, &recording)
+		// the client only sees the normalized ids, they are kept as they are
+		for _, id := range kRecordIdRegexp.FindAllString(scanner.Text(), -1) {
+			replayer.ids[id] = id
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return replayer, nil
+}
+
+func (replayer *Replayer) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = ioutil.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+	}
+	path := stripApiVersion(req.URL.Path)
+	recording := replayer.match(req.Method, path, req.URL.Query(), reqBody)
+	if recording == nil {
+		return nil, fmt.Errorf("No recorded response for %s %s", req.Method, req.URL.RequestURI())
+	}
+
+	body := []byte(recording.Body)
+	if recording.BodyBytes != nil {
+		body = recording.BodyBytes
+	}
+	var reader io.ReadCloser = ioutil.NopCloser(bytes.NewReader(body))
+	if recording.Interrupted {
+		// keep the stream open like the daemon until the client goes away
+		reader = newBlockingBody(body, req.Context().Done())
+	}
+	header := http.Header(recording.Header).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recording.StatusCode, http.StatusText(recording.StatusCode)),
+		StatusCode:    recording.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          reader,
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+func (replayer *Replayer) match(method string, path string, query url.Values, body []byte) *Recording {
+	replayer.lock.Lock()
+	defer replayer.lock.Unlock()
+	normalizer := &Recorder{TimeKeys: replayer.TimeKeys, SecretKeys: replayer.SecretKeys, ids: replayer.ids}
+	body = []byte(normalizer.normalizeBody(string(body)))
+	var last *Recording
+	for _, r := range replayer.recordings {
+		if r.Method != method || r.Path != path {
+			continue
+		}
+		if !replayer.Rule.IgnoreQuery && !sameQuery(r.Query, query) {
+			continue
+		}
+		if !replayer.Rule.IgnoreBody && !sameBody(r.RequestBody, body) {
+			continue
+		}
+		if !replayer.served[r] {
+			replayer.served[r] = true
+			return r
+		}
+		last = r
+	}
+	return last
+}
+
+func sameQuery(a url.Values, b url.Values) bool {
+	if len(a) == 0 && len(b) == 0 {
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func sameBody(recorded string, body []byte) bool {
+	if recorded == string(body) {
+		return true
+	}
+	var a, b interface{}
+	if json.Unmarshal([]byte(recorded), &a) != nil || json.Unmarshal(body, &b) != nil {
+		return false
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+type blockingBody struct {
+	*bytes.Reader
+	done   <-chan struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+func newBlockingBody(body []byte, done <-chan struct{}) *blockingBody {
+	return &blockingBody{Reader: bytes.NewReader(body), done: done, closed: make(chan struct{})}
+}
+
+func (b *blockingBody) Read(p []byte) (int, error) {
+	if b.Reader.Len() > 0 {
+		return b.Reader.Read(p)
+	}
+	select {
+	case <-b.done:
+	case <-b.closed:
+	}
+	return 0, io.EOF
+}
+
+func (b *blockingBody) Close() error {
+	b.once.Do(func() { close(b.closed) })
+	return nil
+}
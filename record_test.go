@@ -0,0 +1,132 @@
+package adoc
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	server.SetBehavior("busybox", adoctest.Behavior{Stdout: "hello\nworld\n"})
+
+	var buffer bytes.Buffer
+	recorder := NewRecorder(&buffer)
+	client, _ := NewClient(server.URL, WithMiddleware(RecordMiddleware(recorder)))
+
+	events := make(chan Event, 10)
+	monitorId := client.MonitorEvents("", func(event Event, err error) {
+		if err == nil {
+			events <- event
+		}
+	})
+	waitForWatchers(t, server, 1)
+	id, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{})
+	if err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	if err := client.StartContainer(id); err != nil {
+		t.Fatalf("Cannot start the container, %s", err)
+	}
+	<-events
+	<-events
+	client.StopMonitor(monitorId)
+	logs, err := client.ContainerLogs(id, true, true, false)
+	if err != nil || len(logs) != 2 {
+		t.Fatalf("Cannot get the logs, %+v, %v", logs, err)
+	}
+	if _, err := client.InspectContainer(id); err != nil {
+		t.Fatalf("Cannot inspect the container, %s", err)
+	}
+	client.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	recorded := buffer.String()
+	if strings.Contains(recorded, id) {
+		t.Errorf("The container id should be normalized in the recordings")
+	}
+	if !strings.Contains(recorded, `"interrupted":true`) {
+		t.Errorf("The events stream should be recorded as interrupted")
+	}
+
+	replayer, err := NewReplayer(strings.NewReader(recorded))
+	if err != nil {
+		t.Fatalf("Cannot load the recordings, %s", err)
+	}
+	offline, _ := NewClient("tcp://replay:2375", WithTransport(replayer))
+	defer offline.Close()
+
+	replayed := make(chan Event, 10)
+	monitorId = offline.MonitorEvents("", func(event Event, err error) {
+		if err == nil {
+			replayed <- event
+		}
+	})
+	replayedId, err := offline.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{})
+	if err != nil || len(replayedId) != 64 || replayedId == id {
+		t.Fatalf("Should replay the normalized container id, %q, %v", replayedId, err)
+	}
+	if err := offline.StartContainer(replayedId); err != nil {
+		t.Fatalf("Cannot replay the start, %s", err)
+	}
+	for _, status := range []string{DockerEventCreate, DockerEventStart} {
+		select {
+		case event := <-replayed:
+			if event.Status != status || event.ID != replayedId {
+				t.Errorf("Wrong replayed event, need=%s, got=%+v", status, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("Timeout when waiting for the replayed %s event", status)
+		}
+	}
+	offline.StopMonitor(monitorId)
+
+	replayedLogs, err := offline.ContainerLogs(replayedId, true, true, false)
+	if err != nil || len(replayedLogs) != 2 || replayedLogs[1].Content != "world" {
+		t.Errorf("Cannot replay the logs, %+v, %v", replayedLogs, err)
+	}
+	container, err := offline.InspectContainer(replayedId)
+	if err != nil || container.State.StartedAt.Year() != 2000 {
+		t.Errorf("The timestamps should be normalized, %+v, %v", container.State, err)
+	}
+	if _, err := offline.InspectContainer("not_recorded"); err == nil {
+		t.Errorf("Should fail on the request which is not recorded")
+	}
+}
+
+func TestReplayNormalizedBody(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+
+	var buffer bytes.Buffer
+	client, _ := NewClient(server.URL, WithMiddleware(RecordMiddleware(NewRecorder(&buffer))))
+	config := ContainerConfig{Image: "busybox", Labels: map[string]string{"password": "s3cret", "time": "2021-06-01T10:00:00Z"}}
+	if _, err := client.CreateContainer(config, HostConfig{}, NetworkingConfig{}); err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	client.Close()
+	if strings.Contains(buffer.String(), "s3cret") || strings.Contains(buffer.String(), "2021-06-01") {
+		t.Fatalf("The request body should be normalized in the recordings, %s", buffer.String())
+	}
+
+	// the same request with the secret and the time should still match the recording
+	replayer, err := NewReplayer(strings.NewReader(buffer.String()))
+	if err != nil {
+		t.Fatalf("Cannot load the recordings, %s", err)
+	}
+	offline, _ := NewClient("tcp://replay:2375", WithTransport(replayer))
+	defer offline.Close()
+	if _, err := offline.CreateContainer(config, HostConfig{}, NetworkingConfig{}); err != nil {
+		t.Errorf("Should match the normalized request body, %s", err)
+	}
+	config.Labels["app"] = "web"
+	if _, err := offline.CreateContainer(config, HostConfig{}, NetworkingConfig{}); err == nil {
+		t.Errorf("Should not match the different request body")
+	}
+}
@@ -0,0 +1,126 @@
+package adoc
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// This part contains the parsers of the resources in the docker cli format, e.g.
+//   ulimit, err := ParseUlimit("nofile=1024:2048")
+//   device, err := ParseDevice("/dev/sda:/dev/xvda:rwm")
+//   nanoCPUs, err := ParseCPUs("1.5")
+// They are validated as the kernel would, so the config files fail early instead of on the container start.
+
+var kUlimitNames = []string{
+	"core", "cpu", "data", "fsize", "locks", "memlock", "msgqueue", "nice",
+	"nofile", "nproc", "rss", "rtprio", "rttime", "sigpending", "stack",
+}
+
+// ParseUlimit parses the ulimit like nofile=1024:2048, the hard limit defaults to the soft one,
+// and -1 means unlimited
+func ParseUlimit(value string) (*Ulimit, error) {
+	ulimit, err := parseUlimit(value)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ulimit %q, %s", value, err)
+	}
+	return ulimit, nil
+}
+
+// ParseDevice parses the device like /dev/sda[:/dev/xvda[:rwm]], the permissions default to rwm
+func ParseDevice(value string) (Device, error) {
+	device, err := parseDevice(value)
+	if err != nil {
+		return Device{}, fmt.Errorf("Invalid device %q, %s", value, err)
+	}
+	return device, nil
+}
+
+// ParseCPUs parses the number of CPUs like 1.5 into the NanoCPUs
+func ParseCPUs(value string) (int64, error) {
+	nanoCPUs, err := parseCPUs(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid cpus %q, %s", value, err)
+	}
+	return nanoCPUs, nil
+}
+
+// parseUlimit parses the name=soft[:hard]
+func parseUlimit(value string) (*Ulimit, error) {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return nil, fmt.Errorf("should be name=soft[:hard]")
+	}
+	if !containsString(kUlimitNames, parts[0]) {
+		return nil, fmt.Errorf("unknown ulimit %q", parts[0])
+	}
+	limits := strings.SplitN(parts[1], ":", 2)
+	soft, err := strconv.ParseInt(limits[0], 10, 64)
+	if err != nil || soft < -1 {
+		return nil, fmt.Errorf("invalid soft limit %q", limits[0])
+	}
+	hard := soft
+	if len(limits) == 2 {
+		if hard, err = strconv.ParseInt(limits[1], 10, 64); err != nil || hard < -1 {
+			return nil, fmt.Errorf("invalid hard limit %q", limits[1])
+		}
+	}
+	// the kernel rejects the soft limit above the hard one, -1 is the unlimited
+	if hard != -1 && (soft == -1 || soft > hard) {
+		return nil, fmt.Errorf("the soft limit %d should not be greater than the hard limit %d", soft, hard)
+	}
+	return &Ulimit{Name: parts[0], Soft: soft, Hard: hard}, nil
+}
+
+// parseDevice parses the host[:container[:permissions]]
+func parseDevice(value string) (Device, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) > 3 || parts[0] == "" {
+		return Device{}, fmt.Errorf("should be host-path[:container-path][:permissions]")
+	}
+	device := Device{PathOnHost: parts[0], PathInContainer: parts[0], CgroupPermissions: "rwm"}
+	switch {
+	case len(parts) == 2 && isDevicePermissions(parts[1]):
+		// the docker cli takes /dev/sda:rw as the permissions
+		device.CgroupPermissions = parts[1]
+	case len(parts) >= 2 && parts[1] != "":
+		device.PathInContainer = parts[1]
+	}
+	if len(parts) == 3 {
+		if !isDevicePermissions(parts[2]) {
+			return Device{}, fmt.Errorf("invalid permissions %q, should be a combination of r, w and m", parts[2])
+		}
+		device.CgroupPermissions = parts[2]
+	}
+	if !strings.HasPrefix(device.PathInContainer, "/") {
+		return Device{}, fmt.Errorf("the container path %q should be absolute", device.PathInContainer)
+	}
+	return device, nil
+}
+
+// isDevicePermissions checks the cgroup permissions, each of r, w and m at most once
+func isDevicePermissions(value string) bool {
+	if value == "" || len(value) > 3 {
+		return false
+	}
+	for i, r := range value {
+		if !strings.ContainsRune("rwm", r) || strings.ContainsRune(value[i+1:], r) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseCPUs parses the number of CPUs like 1.5 into the NanoCPUs
+func parseCPUs(value string) (int64, error) {
+	cpus, err := strconv.ParseFloat(value, 64)
+	if err != nil || cpus <= 0 || math.IsInf(cpus, 0) || math.IsNaN(cpus) {
+		return 0, fmt.Errorf("should be a positive number")
+	}
+	// the kernel takes the cpu quota in microseconds
+	if cpus < 0.01 {
+		return 0, fmt.Errorf("should be at least 0.01")
+	}
+	return int64(math.Round(cpus * 1e9)), nil
+}
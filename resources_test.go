@@ -0,0 +1,112 @@
+package adoc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseUlimit(t *testing.T) {
+	for value, need := range map[string]Ulimit{
+		"nofile=1024:2048": {Name: "nofile", Soft: 1024, Hard: 2048},
+		"nproc=512":        {Name: "nproc", Soft: 512, Hard: 512},
+		"memlock=-1:-1":    {Name: "memlock", Soft: -1, Hard: -1},
+		"core=0:-1":        {Name: "core", Soft: 0, Hard: -1},
+	} {
+		if ulimit, err := ParseUlimit(value); err != nil || *ulimit != need {
+			t.Errorf("Wrong ulimit of %q, %+v, %v", value, ulimit, err)
+		}
+	}
+	for _, value := range []string{"nofile", "=1024", "files=1024", "nofile=lots", "nofile=2048:1024", "nofile=-1:1024", "nofile=-2"} {
+		if _, err := ParseUlimit(value); err == nil || !strings.Contains(err.Error(), value) {
+			t.Errorf("Should reject the ulimit %q, %v", value, err)
+		}
+	}
+}
+
+func TestParseDevice(t *testing.T) {
+	for value, need := range map[string]Device{
+		"/dev/fuse":               {"/dev/fuse", "/dev/fuse", "rwm"},
+		"/dev/sda:/dev/xvda":      {"/dev/sda", "/dev/xvda", "rwm"},
+		"/dev/sda:/dev/xvda:r":    {"/dev/sda", "/dev/xvda", "r"},
+		"/dev/sda:rw":             {"/dev/sda", "/dev/sda", "rw"},
+		"/dev/sda::mr":            {"/dev/sda", "/dev/sda", "mr"},
+		"/dev/nvidia0:/dev/gpu:m": {"/dev/nvidia0", "/dev/gpu", "m"},
+	} {
+		if device, err := ParseDevice(value); err != nil || device != need {
+			t.Errorf("Wrong device of %q, %+v, %v", value, device, err)
+		}
+	}
+	for _, value := range []string{"", ":/dev/sda", "/dev/sda:/dev/xvda:rwx", "/dev/sda:/dev/xvda:rr", "/dev/sda:xvda", "/a:/b:r:w"} {
+		if _, err := ParseDevice(value); err == nil {
+			t.Errorf("Should reject the device %q", value)
+		}
+	}
+}
+
+func TestParseCPUs(t *testing.T) {
+	if nanoCPUs, err := ParseCPUs("1.5"); err != nil || nanoCPUs != 1500000000 {
+		t.Errorf("Wrong cpus, %d, %v", nanoCPUs, err)
+	}
+	if nanoCPUs, err := ParseCPUs("0.333"); err != nil || nanoCPUs != 333000000 {
+		t.Errorf("Wrong cpus, %d, %v", nanoCPUs, err)
+	}
+	for _, value := range []string{"0", "-1", "lots", "0.001", "NaN", "Inf"} {
+		if _, err := ParseCPUs(value); err == nil {
+			t.Errorf("Should reject the cpus %q", value)
+		}
+	}
+}
+
+func TestParseBlkio(t *testing.T) {
+	if weight, err := ParseBlkioWeight("500"); err != nil || weight != 500 {
+		t.Errorf("Wrong blkio weight, %d, %v", weight, err)
+	}
+	for _, value := range []string{"5", "1001", "-10", "heavy"} {
+		if _, err := ParseBlkioWeight(value); err == nil {
+			t.Errorf("Should reject the blkio weight %q", value)
+		}
+	}
+
+	if device, err := ParseWeightDevice("/dev/sda:200"); err != nil || device.String() != "/dev/sda:200" {
+		t.Errorf("Wrong weight device, %v, %v", device, err)
+	}
+	for _, value := range []string{"/dev/sda", "/dev/sda:0", "/dev/sda:9", "/dev/sda:1001", "sda:200", "/tmp/sda:200"} {
+		if _, err := ParseWeightDevice(value); err == nil || !strings.Contains(err.Error(), value) {
+			t.Errorf("Should reject the weight device %q, %v", value, err)
+		}
+	}
+
+	if device, err := ParseThrottleDevice("/dev/sda:10mb"); err != nil || *device != (ThrottleDevice{"/dev/sda", 10 * MiB}) {
+		t.Errorf("Wrong throttle device, %v, %v", device, err)
+	}
+	if device, err := ParseThrottleDevice("/dev/sda:1024"); err != nil || device.Rate != 1024 {
+		t.Errorf("Wrong throttle device, %v, %v", device, err)
+	}
+	if device, err := ParseThrottleIOpsDevice("/dev/sda:1000"); err != nil || device.Rate != 1000 {
+		t.Errorf("Wrong throttle iops device, %v, %v", device, err)
+	}
+	for _, value := range []string{"/dev/sda", "/dev/sda:fast", "/dev/sda:-1", "sda:10mb"} {
+		if _, err := ParseThrottleDevice(value); err == nil {
+			t.Errorf("Should reject the throttle device %q", value)
+		}
+	}
+	if _, err := ParseThrottleIOpsDevice("/dev/sda:10mb"); err == nil {
+		t.Errorf("Should reject the size as the iops")
+	}
+
+	spec, err := ParseRunArgs([]string{"--blkio-weight", "300", "--blkio-weight-device", "/dev/sda:200",
+		"--device-read-bps", "/dev/sda:1mb", "--device-write-iops", "/dev/sda:100", "busybox"})
+	if err != nil {
+		t.Fatalf("Cannot parse the blkio flags, %s", err)
+	}
+	resources := spec.HostConfig.Resources
+	if resources.BlkioWeight != 300 || len(resources.BlkioWeightDevice) != 1 || resources.BlkioDeviceReadBps[0].Rate != MiB ||
+		resources.BlkioDeviceWriteIOps[0].Rate != 100 {
+		t.Errorf("Wrong blkio resources, %+v", resources)
+	}
+	args := FormatRunArgs(ContainerDetail{Config: spec.Config, HostConfig: spec.HostConfig}, ImageDetail{})
+	need := "--blkio-weight 300 --blkio-weight-device /dev/sda:200 --device-read-bps /dev/sda:1048576 --device-write-iops /dev/sda:100 busybox"
+	if strings.Join(args, " ") != need {
+		t.Errorf("Wrong formatted blkio flags, %q", args)
+	}
+}
@@ -0,0 +1,117 @@
+package adoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// RetryPolicy defines how the failed requests are retried with the exponential backoff. Only
+// the GET and HEAD requests (inspect, list, ping...) are retried, unless RetryReplayable is on,
+// which also retries the POSTs that are safe to replay, like start and stop.
+type RetryPolicy struct {
+	MaxAttempts      int           // including the first attempt, less than 2 means no retry
+	InitialDelay     time.Duration // delay before the second attempt
+	MaxDelay         time.Duration // the upper bound of the delay, zero means no bound
+	Multiplier       float64       // the delay grows by the multiplier after each attempt
+	Jitter           float64       // randomizes the delay by +/- the fraction, 0 to 1
+	RetryStatusCodes []int         // the response status codes to retry
+	RetryReplayable  bool          // retries the replayable POSTs too
+}
+
+// DefaultRetryPolicy retries 4 times at most for the transport errors and the 502/503 responses
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:      4,
+	InitialDelay:     200 * time.Millisecond,
+	MaxDelay:         5 * time.Second,
+	Multiplier:       2,
+	Jitter:           0.2,
+	RetryStatusCodes: []int{502, 503},
+}
+
+// WithRetryPolicy sets the retry policy for all the requests of the client,
+// the RequestConfig.Retry overrides it per request
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(options *clientOptions) {
+		options.retryPolicy = &policy
+	}
+}
+
+// RetryError contains the errors of all the attempts, the last one is unwrapped
+type RetryError struct {
+	Errors []error
+}
+
+func (e *RetryError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = fmt.Sprintf("attempt %d: %s", i+1, err)
+	}
+	return fmt.Sprintf("Request failed after %d attempts, %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+func (e *RetryError) Unwrap() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e.Errors[len(e.Errors)-1]
+}
+
+func (p *RetryPolicy) allows(method string, rc *RequestConfig) bool {
+	if p.MaxAttempts < 2 {
+		return false
+	}
+	switch method {
+	case "GET", "HEAD":
+		return true
+	}
+	return p.RetryReplayable && rc != nil && rc.Replayable
+}
+
+func (p *RetryPolicy) retriable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var adocErr Error
+	if errors.As(err, &adocErr) {
+		for _, code := range p.RetryStatusCodes {
+			if adocErr.StatusCode == code {
+				return true
+			}
+		}
+		return false
+	}
+	// connection refused, reset or the other transport errors
+	return true
+}
+
+// delay returns the backoff after the failed attempt, starts from 1
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	delay := float64(p.InitialDelay) * math.Pow(multiplier, float64(attempt-1))
+	if p.MaxDelay > 0 && delay > float64(p.MaxDelay) {
+		delay = float64(p.MaxDelay)
+	}
+	if p.Jitter > 0 {
+		delay = delay * (1 + p.Jitter*(2*rand.Float64()-1))
+	}
+	return time.Duration(delay)
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
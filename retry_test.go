@@ -0,0 +1,89 @@
+package adoc
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newFlakyServer(failures int32, statusCode int) (*httptest.Server, *int32) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&requests, 1) <= failures {
+			http.Error(w, "swarm manager is not ready", statusCode)
+			return
+		}
+		if r.Method == "GET" {
+			fmt.Fprint(w, "OK")
+		}
+	}))
+	return server, &requests
+}
+
+func TestRetryPolicy(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:      3,
+		InitialDelay:     time.Millisecond,
+		Multiplier:       2,
+		RetryStatusCodes: []int{502, 503},
+	}
+
+	server, requests := newFlakyServer(2, 503)
+	defer server.Close()
+	client, _ := NewClient(server.URL, WithRetryPolicy(policy))
+	if pong, err := client.Ping(); err != nil || !pong {
+		t.Fatalf("Ping should succeed after retries, %v", err)
+	}
+	if *requests != 3 {
+		t.Errorf("Should have 3 attempts, got %d", *requests)
+	}
+
+	// POSTs are not retried by default
+	*requests = 0
+	if err := client.StartContainer("c0"); err == nil || *requests != 1 {
+		t.Errorf("Start should not be retried by default, requests=%d, %v", *requests, err)
+	}
+
+	// opt in the replayable POSTs
+	*requests = 0
+	policy.RetryReplayable = true
+	client, _ = NewClient(server.URL, WithRetryPolicy(policy))
+	if err := client.StartContainer("c0"); err != nil || *requests != 3 {
+		t.Errorf("Start should be retried, requests=%d, %v", *requests, err)
+	}
+	*requests = 0
+	if err := client.KillContainer("c0"); err == nil || *requests != 1 {
+		t.Errorf("Kill should never be retried, requests=%d, %v", *requests, err)
+	}
+}
+
+func TestRetryErrorChain(t *testing.T) {
+	server, requests := newFlakyServer(10, 502)
+	defer server.Close()
+	client, _ := NewClient(server.URL)
+	rc := &RequestConfig{Retry: &RetryPolicy{MaxAttempts: 3, RetryStatusCodes: []int{502}}}
+	_, err := client.sendRequest("GET", "_ping", nil, nil, rc)
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || len(retryErr.Errors) != 3 || *requests != 3 {
+		t.Fatalf("Should get the retry error with 3 attempts, requests=%d, %v", *requests, err)
+	}
+	var adocErr Error
+	if !errors.As(err, &adocErr) || adocErr.StatusCode != 502 {
+		t.Errorf("The last error should be unwrapped, %v", err)
+	}
+}
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second, Multiplier: 2, Jitter: 0.5}
+	for attempt, base := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		base *= time.Millisecond
+		delay := policy.delay(attempt + 1)
+		if delay < base/2 || delay > base*3/2 {
+			t.Errorf("Delay of attempt %d out of range, %s", attempt+1, delay)
+		}
+	}
+}
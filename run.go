@@ -0,0 +1,197 @@
+package adoc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// This part contains the docker run flow for the one-off jobs, e.g.
+//   ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+//   defer cancel()
+//   result, err := docker.RunContainer(ctx, RunSpec{
+//       Config:     ContainerConfig{Image: "busybox", Cmd: []string{"sh", "-c", "echo hello"}},
+//       AutoRemove: true,
+//   })
+//   fmt.Println(result.ExitCode, result.Stdout)
+// The output is attached before the start, so nothing is lost even if the container exits at once.
+
+const (
+	PullMissing = "missing"
+	PullAlways  = "always"
+	PullNever   = "never"
+
+	kDefaultRunStopTimeout = 10
+)
+
+// RunSpec is the container to run, the empty Stdout and Stderr are collected into the RunResult
+type RunSpec struct {
+	Name             string
+	Config           ContainerConfig
+	HostConfig       HostConfig
+	NetworkingConfig NetworkingConfig
+	Pull             string // PullMissing (default), PullAlways or PullNever
+	AuthConfig       *AuthConfig
+	AutoRemove       bool      // removes the container and its volumes after it exits or the run is cancelled
+	Stdout           io.Writer // streams the stdout, all the output goes here for the tty
+	Stderr           io.Writer
+	StopTimeout      int // the seconds to wait before killing the container when the run is cancelled, default to 10
+}
+
+// RunResult is the outcome of the run, the Stdout and Stderr are only collected without the writers
+type RunResult struct {
+	Id        string
+	ExitCode  int
+	OOMKilled bool
+	Duration  time.Duration // from the start to the exit of the container
+	Stdout    string
+	Stderr    string
+}
+
+// RunContainer pulls the image if needed, creates the container, attaches to its output, starts and waits
+// for it. When the ctx is done, the container is stopped (and removed with AutoRemove) and the ctx error
+// is returned with the partial result.
+func (client *DockerClient) RunContainer(ctx context.Context, spec RunSpec) (RunResult, error) {
+	var result RunResult
+	if err := client.ensureImage(spec.Config.Image, spec.Pull, spec.AuthConfig); err != nil {
+		return result, err
+	}
+	var names []string
+	if spec.Name != "" {
+		names = append(names, spec.Name)
+	}
+	id, err := client.CreateContainer(spec.Config, spec.HostConfig, spec.NetworkingConfig, names...)
+	if err != nil {
+		return result, err
+	}
+	result.Id = id
+	if spec.AutoRemove {
+		defer func() {
+			// the ctx could be done, so the removal is not bound to it
+			if err := client.RemoveContainer(id, true, true); err != nil && !IsNotFound(err) {
+				client.logger.Warn("Cannot remove the container after the run", "container", id, "error", err)
+			}
+		}()
+	}
+
+	var stdout, stderr bytes.Buffer
+	outWriter, errWriter := spec.Stdout, spec.Stderr
+	if outWriter == nil {
+		outWriter = &stdout
+	}
+	if errWriter == nil {
+		errWriter = &stderr
+	}
+	attachCtx, cancelAttach := context.WithCancel(ctx)
+	defer cancelAttach()
+	attached := make(chan error, 1)
+	streamed := make(chan error, 1)
+	go func() {
+		streamed <- client.attachContainer(attachCtx, id, spec.Config.Tty, outWriter, errWriter, attached)
+	}()
+	// the attached always gets the result of the attach request, before the stream
+	if err := <-attached; err != nil {
+		return result, err
+	}
+
+	started := time.Now()
+	if err := client.StartContainer(id); err != nil {
+		return result, err
+	}
+	result.ExitCode, err = client.waitContainer(id, &RequestConfig{Context: ctx})
+	if err != nil {
+		if ctx.Err() == nil {
+			return result, err
+		}
+		timeout := spec.StopTimeout
+		if timeout <= 0 {
+			timeout = kDefaultRunStopTimeout
+		}
+		client.logger.Info("Run is cancelled, stopping the container", "container", id, "timeout", timeout)
+		if err := client.StopContainer(id, timeout); err != nil && !IsNotFound(err) {
+			client.logger.Warn("Cannot stop the container after the run is cancelled", "container", id, "error", err)
+		}
+		result.Duration = time.Since(started)
+		return result, ctx.Err()
+	}
+	// the stream is closed by the daemon after the exit, the ctx is checked in case it hangs
+	select {
+	case err = <-streamed:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	result.Duration = time.Since(started)
+	if err != nil {
+		return result, err
+	}
+	result.Stdout, result.Stderr = stdout.String(), stderr.String()
+
+	if client.dryRun == nil {
+		detail, err := client.InspectContainer(id)
+		if err != nil {
+			return result, err
+		}
+		result.OOMKilled = detail.State.OOMKilled
+		if !detail.State.StartedAt.IsZero() && detail.State.FinishedAt.After(detail.State.StartedAt) {
+			result.Duration = detail.State.FinishedAt.Sub(detail.State.StartedAt)
+		}
+	}
+	return result, nil
+}
+
+// ensureImage pulls the image by the pull policy
+func (client *DockerClient) ensureImage(image string, pull string, authConfig *AuthConfig) error {
+	switch pull {
+	case "", PullMissing:
+		if _, err := client.InspectImage(image); err == nil || !IsNotFound(err) {
+			return err
+		}
+	case PullNever:
+		return nil
+	case PullAlways:
+	default:
+		return fmt.Errorf("Invalid pull policy %q, should be one of missing, always, never", pull)
+	}
+	repo, tag := splitImageTag(image)
+	if i := strings.Index(image, "@"); i >= 0 {
+		// the digest is pulled as the tag, just like the docker cli
+		tag = image[i+1:]
+	} else if tag == "" {
+		tag = "latest"
+	}
+	var auths []AuthConfig
+	if authConfig != nil {
+		auths = append(auths, *authConfig)
+	}
+	return client.PullImage(repo, tag, auths...)
+}
+
+// attachContainer streams the stdout and stderr of the container until it exits, the attached
+// is notified when the stream is established, so the container could be started without losing output
+func (client *DockerClient) attachContainer(ctx context.Context, id string, tty bool, stdout io.Writer, stderr io.Writer, attached chan<- error) error {
+	v := url.Values{}
+	v.Set("stream", "1")
+	v.Set("stdout", "1")
+	v.Set("stderr", "1")
+	uri := fmt.Sprintf("containers/%s/attach?%s", id, v.Encode())
+	err := client.sendRequestCallback("POST", uri, nil, nil, func(resp *http.Response) error {
+		attached <- nil
+		if tty {
+			_, err := io.Copy(stdout, resp.Body)
+			return err
+		}
+		return copyDockerStream(resp.Body, stdout, stderr)
+	}, &RequestConfig{Context: ctx}, true)
+	if err != nil {
+		select {
+		case attached <- err:
+		default:
+		}
+	}
+	return err
+}
@@ -0,0 +1,102 @@
+package adoc
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestRunContainer(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.SetBehavior("job", adoctest.Behavior{Stdout: "hello\n", Stderr: "oops\n", Exit: true, Duration: 20 * time.Millisecond, ExitCode: 3})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	result, err := client.RunContainer(context.Background(), RunSpec{
+		Name:       "job",
+		Config:     ContainerConfig{Image: "job"},
+		AutoRemove: true,
+	})
+	if err != nil {
+		t.Fatalf("Cannot run the container, %s", err)
+	}
+	if result.ExitCode != 3 || result.OOMKilled || result.Stdout != "hello\n" || result.Stderr != "oops\n" || result.Duration < 20*time.Millisecond {
+		t.Errorf("Wrong run result, %+v", result)
+	}
+	if _, err := client.InspectContainer(result.Id); !IsNotFound(err) {
+		t.Errorf("The container should be removed, %v", err)
+	}
+	var flow []string
+	for _, request := range server.Requests() {
+		if strings.HasPrefix(request, "POST ") || strings.HasPrefix(request, "DELETE ") {
+			flow = append(flow, strings.Replace(request, result.Id, "id", 1))
+		}
+	}
+	need := []string{"POST images/create", "POST containers/create", "POST containers/id/attach", "POST containers/id/start",
+		"POST containers/id/wait", "DELETE containers/id"}
+	if strings.Join(flow, ", ") != strings.Join(need, ", ") {
+		t.Errorf("Wrong run flow, %v", flow)
+	}
+
+	// the image is there now, and the output is streamed into the writers
+	server.SetBehavior("job", adoctest.Behavior{Stdout: "killed\n", Exit: true, ExitCode: 137, OOMKilled: true})
+	var stdout bytes.Buffer
+	result, err = client.RunContainer(context.Background(), RunSpec{Config: ContainerConfig{Image: "job", Tty: true}, Stdout: &stdout})
+	if err != nil || result.ExitCode != 137 || !result.OOMKilled || stdout.String() != "killed\n" || result.Stdout != "" {
+		t.Fatalf("Wrong run result, %+v, %q, %v", result, stdout.String(), err)
+	}
+	if _, err := client.InspectContainer(result.Id); err != nil {
+		t.Errorf("The container should be kept without the auto remove, %v", err)
+	}
+
+	// the digest reference is pulled by the digest, not the latest tag
+	digested := "busybox@sha256:" + strings.Repeat("ab", 32)
+	server.SetBehavior(digested, adoctest.Behavior{Stdout: "pinned\n", Exit: true})
+	if result, err := client.RunContainer(context.Background(), RunSpec{Config: ContainerConfig{Image: digested}}); err != nil || result.Stdout != "pinned\n" {
+		t.Fatalf("Cannot run the digest reference, %+v, %v", result, err)
+	}
+	if _, err := client.InspectImage("busybox:latest"); !IsNotFound(err) {
+		t.Errorf("Should not pull the latest tag for the digest, %v", err)
+	}
+
+	if _, err := client.RunContainer(context.Background(), RunSpec{Config: ContainerConfig{Image: "missing"}, Pull: PullNever}); !IsNotFound(err) {
+		t.Errorf("Should not pull the missing image, %v", err)
+	}
+	if _, err := client.RunContainer(context.Background(), RunSpec{Config: ContainerConfig{Image: "job"}, Pull: "sometimes"}); err == nil {
+		t.Errorf("Should reject the invalid pull policy")
+	}
+}
+
+func TestRunContainerCancel(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "server"})
+	client, _ := NewClient(server.URL)
+	defer client.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err := client.RunContainer(ctx, RunSpec{Config: ContainerConfig{Image: "server"}, StopTimeout: 1})
+	if err != context.DeadlineExceeded || result.Id == "" {
+		t.Fatalf("Should return the ctx error, %+v, %v", result, err)
+	}
+	detail, err := client.InspectContainer(result.Id)
+	if err != nil || detail.State.Running {
+		t.Errorf("The container should be stopped, %+v, %v", detail.State, err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	result, err = client.RunContainer(ctx, RunSpec{Config: ContainerConfig{Image: "server"}, AutoRemove: true})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("Should return the ctx error, %v", err)
+	}
+	if _, err := client.InspectContainer(result.Id); !IsNotFound(err) {
+		t.Errorf("The container should be removed, %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package adoc
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This part contains the reverse of the docker run parser, it generates the docker run command
+// of an inspected container, e.g.
+//   command, err := docker.ContainerRunCommand("web")
+//   // docker run --name web -p 8080:80 -e MODE=prod --memory 512m nginx:1.19
+// The values equal to the image defaults or the daemon defaults are omitted, so the command is close
+// to what was typed, and ParseRunCommand on it gives back the same container config.
+
+const kDefaultCPUShares = 1024
+
+// ContainerRunCommand inspects the container and its image, returns the docker run command line
+func (client *DockerClient) ContainerRunCommand(id string) (string, error) {
+	container, err := client.InspectContainer(id)
+	if err != nil {
+		return "", err
+	}
+	image, err := client.InspectImage(container.Image)
+	if err != nil && !IsNotFound(err) {
+		return "", err
+	}
+	return FormatRunCommand(container, image), nil
+}
+
+// FormatRunCommand returns the docker run command line with the arguments quoted for the shell
+func FormatRunCommand(container ContainerDetail, image ImageDetail) string {
+	args := append([]string{"docker", "run"}, FormatRunArgs(container, image)...)
+	for i, arg := range args {
+		args[i] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// FormatRunArgs returns the docker run arguments of the inspected container, the image is for omitting
+// its defaults, it could be the zero ImageDetail if the image is gone
+func FormatRunArgs(container ContainerDetail, image ImageDetail) []string {
+	var args []string
+	flag := func(name string, value string) {
+		args = append(args, "--"+name, value)
+	}
+	config, host, defaults := container.Config, container.HostConfig, image.Config
+
+	if name := strings.TrimPrefix(container.Name, "/"); name != "" {
+		flag("name", name)
+	}
+	// the docker run attaches the stdout and stderr by default, and the stdin with the --interactive
+	explicitStdin := config.AttachStdin && !config.OpenStdin
+	if !config.AttachStdin && !config.AttachStdout && !config.AttachStderr {
+		args = append(args, "--detach")
+	} else if explicitStdin || !config.AttachStdout || !config.AttachStderr {
+		if explicitStdin {
+			flag("attach", "stdin")
+		}
+		if config.AttachStdout {
+			flag("attach", "stdout")
+		}
+		if config.AttachStderr {
+			flag("attach", "stderr")
+		}
+	}
+	if config.Tty {
+		args = append(args, "--tty")
+	}
+	if config.OpenStdin {
+		args = append(args, "--interactive")
+	}
+	if config.Hostname != "" && !strings.HasPrefix(container.Id, config.Hostname) {
+		flag("hostname", config.Hostname)
+	}
+	if config.Domainname != "" {
+		flag("domainname", config.Domainname)
+	}
+	if config.User != defaults.User {
+		flag("user", config.User)
+	}
+	if config.WorkingDir != defaults.WorkingDir {
+		flag("workdir", config.WorkingDir)
+	}
+	if config.StopSignal != "" && config.StopSignal != defaults.StopSignal {
+		flag("stop-signal", config.StopSignal)
+	}
+	if config.MacAddress != "" {
+		flag("mac-address", config.MacAddress)
+	}
+	for _, env := range config.Env {
+		if !containsString(defaults.Env, env) {
+			flag("env", env)
+		}
+	}
+	for _, key := range sortedStringKeys(config.Labels) {
+		if value, ok := defaults.Labels[key]; !ok || value != config.Labels[key] {
+			flag("label", key+"="+config.Labels[key])
+		}
+	}
+
+	// ports
+	for _, port := range sortedPortKeys(host.PortBindings) {
+		for _, binding := range host.PortBindings[port] {
+			flag("publish", formatPortBinding(port, binding))
+		}
+	}
+	for _, port := range sortedSetKeys(config.ExposedPorts) {
+		if _, ok := defaults.ExposedPorts[port]; ok {
+			continue
+		}
+		if _, ok := host.PortBindings[port]; !ok {
+			flag("expose", strings.TrimSuffix(port, "/tcp"))
+		}
+	}
+	if host.PublishAllPorts {
+		args = append(args, "--publish-all")
+	}
+
+	// volumes and mounts
+	for _, bind := range host.Binds {
+		flag("volume", bind)
+	}
+	mounted := make(map[string]bool)
+	for _, bind := range host.Binds {
+		if parts := strings.Split(bind, ":"); len(parts) >= 2 {
+			mounted[parts[1]] = true
+		}
+	}
+	for _, mount := range host.Mounts {
+		mounted[mount.Target] = true
+	}
+	for _, volume := range sortedSetKeys(config.Volumes) {
+		if _, ok := defaults.Volumes[volume]; !ok && !mounted[volume] {
+			flag("volume", volume)
+		}
+	}
+	for _, mount := range host.Mounts {
+		flag("mount", formatMount(mount))
+	}
+	for _, path := range sortedStringKeys(host.Tmpfs) {
+		if options := host.Tmpfs[path]; options != "" {
+			flag("tmpfs", path+":"+options)
+		} else {
+			flag("tmpfs", path)
+		}
+	}
+	for _, from := range host.VolumesFrom {
+		flag("volumes-from", from)
+	}
+	if config.VolumeDriver != "" {
+		flag("volume-driver", config.VolumeDriver)
+	}
+
+	// restart policy and resources
+	switch policy := host.RestartPolicy; {
+	case policy.Name == "" || policy.Name == "no":
+	case policy.Name == "on-failure" && policy.MaximumRetryCount > 0:
+		flag("restart", fmt.Sprintf("on-failure:%d", policy.MaximumRetryCount))
+	default:
+		flag("restart", policy.Name)
+	}
+	if host.Memory > 0 {
+		flag("memory", formatBytes(host.Memory))
+	}
+	// the daemon makes the swap twice the memory by default
+	if host.MemorySwap == -1 {
+		flag("memory-swap", "-1")
+	} else if host.MemorySwap > 0 && host.MemorySwap != 2*host.Memory {
+		flag("memory-swap", formatBytes(host.MemorySwap))
+	}
+	if host.MemoryReservation > 0 {
+		flag("memory-reservation", formatBytes(host.MemoryReservation))
+	}
+	if host.KernelMemory > 0 {
+		flag("kernel-memory", formatBytes(host.KernelMemory))
+	}
+	if host.MemorySwappiness != nil && *host.MemorySwappiness >= 0 {
+		flag("memory-swappiness", strconv.FormatInt(*host.MemorySwappiness, 10))
+	}
+	if host.OomKillDisable != nil && *host.OomKillDisable {
+		args = append(args, "--oom-kill-disable")
+	}
+	if host.NanoCPUs > 0 {
+		flag("cpus", strconv.FormatFloat(float64(host.NanoCPUs)/1e9, 'f', -1, 64))
+	}
+	if host.CPUShares > 0 && host.CPUShares != kDefaultCPUShares {
+		flag("cpu-shares", strconv.FormatInt(host.CPUShares, 10))
+	}
+	if host.CPUPeriod > 0 {
+		flag("cpu-period", strconv.FormatInt(host.CPUPeriod, 10))
+	}
+	if host.CPUQuota > 0 {
+		flag("cpu-quota", strconv.FormatInt(host.CPUQuota, 10))
+	}
+	if host.CpusetCpus != "" {
+		flag("cpuset-cpus", host.CpusetCpus)
+	}
+	if host.CpusetMems != "" {
+		flag("cpuset-mems", host.CpusetMems)
+	}
+	if host.PidsLimit > 0 {
+		flag("pids-limit", strconv.FormatInt(host.PidsLimit, 10))
+	}
+	if host.CgroupParent != "" {
+		flag("cgroup-parent", host.CgroupParent)
+	}
+	for _, ulimit := range host.Ulimits {
+		flag("ulimit", fmt.Sprintf("%s=%d:%d", ulimit.Name, ulimit.Soft, ulimit.Hard))
+	}
+	for _, device := range host.Devices {
+		value := device.PathOnHost
+		if device.PathInContainer != device.PathOnHost || (device.CgroupPermissions != "" && device.CgroupPermissions != "rwm") {
+			value += ":" + device.PathInContainer
+		}
+		if device.CgroupPermissions != "" && device.CgroupPermissions != "rwm" {
+			value += ":" + device.CgroupPermissions
+		}
+		flag("device", value)
+	}
+	if host.BlkioWeight > 0 {
+		flag("blkio-weight", strconv.Itoa(int(host.BlkioWeight)))
+	}
+	for _, device := range host.BlkioWeightDevice {
+		flag("blkio-weight-device", device.String())
+	}
+	throttles := []struct {
+		name    string
+		devices []*ThrottleDevice
+	}{
+		{"device-read-bps", host.BlkioDeviceReadBps},
+		{"device-write-bps", host.BlkioDeviceWriteBps},
+		{"device-read-iops", host.BlkioDeviceReadIOps},
+		{"device-write-iops", host.BlkioDeviceWriteIOps},
+	}
+	for _, throttle := range throttles {
+		for _, device := range throttle.devices {
+			flag(throttle.name, device.String())
+		}
+	}
+
+	// security
+	if host.Privileged {
+		args = append(args, "--privileged")
+	}
+	if host.ReadonlyRootfs {
+		args = append(args, "--read-only")
+	}
+	for _, capability := range host.CapAdd {
+		flag("cap-add", capability)
+	}
+	for _, capability := range host.CapDrop {
+		flag("cap-drop", capability)
+	}
+	for _, option := range host.SecurityOpt {
+		flag("security-opt", option)
+	}
+	if host.IpcMode != "" && host.IpcMode != "private" && host.IpcMode != "shareable" {
+		flag("ipc", host.IpcMode)
+	}
+	if host.PidMode != "" {
+		flag("pid", host.PidMode)
+	}
+
+	// healthcheck
+	if health := config.Healthcheck; health != nil && !reflect.DeepEqual(health, defaults.Healthcheck) {
+		var base HealthConfig
+		if defaults.Healthcheck != nil {
+			base = *defaults.Healthcheck
+		}
+		switch {
+		case len(health.Test) > 0 && health.Test[0] == "NONE":
+			args = append(args, "--no-healthcheck")
+		case len(health.Test) > 1 && !reflect.DeepEqual(health.Test, base.Test):
+			if health.Test[0] == "CMD-SHELL" {
+				flag("health-cmd", health.Test[1])
+			} else {
+				quoted := make([]string, len(health.Test)-1)
+				for i, arg := range health.Test[1:] {
+					quoted[i] = shellQuote(arg)
+				}
+				flag("health-cmd", strings.Join(quoted, " "))
+			}
+		}
+		if len(health.Test) == 0 || health.Test[0] != "NONE" {
+			durations := []struct {
+				name  string
+				value time.Duration
+				base  time.Duration
+			}{
+				{"health-interval", health.Interval, base.Interval},
+				{"health-timeout", health.Timeout, base.Timeout},
+				{"health-start-period", health.StartPeriod, base.StartPeriod},
+			}
+			for _, d := range durations {
+				if d.value > 0 && d.value != d.base {
+					flag(d.name, d.value.String())
+				}
+			}
+			if health.Retries > 0 && health.Retries != base.Retries {
+				flag("health-retries", strconv.Itoa(health.Retries))
+			}
+		}
+	}
+
+	// logging
+	if host.LogConfig.Type != "" && host.LogConfig.Type != "json-file" {
+		flag("log-driver", host.LogConfig.Type)
+	}
+	for _, key := range sortedStringKeys(host.LogConfig.Config) {
+		flag("log-opt", key+"="+host.LogConfig.Config[key])
+	}
+
+	// networking
+	if network := host.NetworkMode; network != "" && network != "default" && network != "bridge" {
+		flag("network", network)
+		if endpoint, ok := container.NetworkSettings.Networks[network]; ok && isUserDefinedNetwork(network) {
+			if endpoint.IPAMConfig != nil && endpoint.IPAMConfig.IPv4Address != "" {
+				flag("ip", endpoint.IPAMConfig.IPv4Address)
+			}
+			if endpoint.IPAMConfig != nil && endpoint.IPAMConfig.IPv6Address != "" {
+				flag("ip6", endpoint.IPAMConfig.IPv6Address)
+			}
+			for _, alias := range endpoint.Aliases {
+				// the daemon adds the short id
+				if !strings.HasPrefix(container.Id, alias) {
+					flag("network-alias", alias)
+				}
+			}
+		}
+	}
+	for _, dns := range host.Dns {
+		flag("dns", dns)
+	}
+	for _, search := range host.DnsSearch {
+		flag("dns-search", search)
+	}
+	for _, extraHost := range host.ExtraHosts {
+		flag("add-host", extraHost)
+	}
+	for _, link := range host.Links {
+		flag("link", formatLink(link))
+	}
+
+	// the entrypoint could only be overridden by one argument, the rest goes before the cmd
+	var cmd []string
+	entrypointChanged := !reflect.DeepEqual(config.Entrypoint, defaults.Entrypoint)
+	if entrypointChanged {
+		if len(config.Entrypoint) == 0 {
+			flag("entrypoint", "")
+		} else {
+			flag("entrypoint", config.Entrypoint[0])
+			cmd = append(cmd, config.Entrypoint[1:]...)
+		}
+	}
+	if entrypointChanged || !reflect.DeepEqual(config.Cmd, defaults.Cmd) {
+		cmd = append(cmd, config.Cmd...)
+	}
+	imageName := config.Image
+	if imageName == "" {
+		imageName = container.Image
+	}
+	args = append(args, imageName)
+	return append(args, cmd...)
+}
+
+func formatPortBinding(port string, binding PortBinding) string {
+	port = strings.TrimSuffix(port, "/tcp")
+	ip := binding.HostIp
+	if strings.Contains(ip, ":") {
+		ip = "[" + ip + "]"
+	}
+	switch {
+	case ip != "" && ip != "0.0.0.0":
+		return ip + ":" + binding.HostPort + ":" + port
+	case binding.HostPort != "":
+		return binding.HostPort + ":" + port
+	}
+	return port
+}
+
+func formatMount(mount Mount) string {
+	fields := []string{"type=" + mount.Type}
+	if mount.Source != "" {
+		fields = append(fields, "source="+mount.Source)
+	}
+	fields = append(fields, "target="+mount.Target)
+	if mount.ReadOnly {
+		fields = append(fields, "readonly")
+	}
+	if mount.Consistency != "" {
+		fields = append(fields, "consistency="+mount.Consistency)
+	}
+	if options := mount.BindOptions; options != nil && options.Propagation != "" {
+		fields = append(fields, "bind-propagation="+options.Propagation)
+	}
+	if options := mount.VolumeOptions; options != nil {
+		if options.NoCopy {
+			fields = append(fields, "volume-nocopy")
+		}
+		for _, key := range sortedStringKeys(options.Labels) {
+			fields = append(fields, "volume-label="+key+"="+options.Labels[key])
+		}
+		if driver := options.DriverConfig; driver != nil {
+			if driver.Name != "" {
+				fields = append(fields, "volume-driver="+driver.Name)
+			}
+			for _, key := range sortedStringKeys(driver.Options) {
+				fields = append(fields, "volume-opt="+key+"="+driver.Options[key])
+			}
+		}
+	}
+	if options := mount.TmpfsOptions; options != nil {
+		if options.SizeBytes > 0 {
+			fields = append(fields, "tmpfs-size="+formatBytes(options.SizeBytes))
+		}
+		if options.Mode != 0 {
+			fields = append(fields, "tmpfs-mode="+strconv.FormatUint(uint64(options.Mode), 8))
+		}
+	}
+	return strings.Join(fields, ",")
+}
+
+// formatLink turns the inspected link like /db:/web/database into db:database
+func formatLink(link string) string {
+	parts := strings.SplitN(link, ":", 2)
+	name := strings.TrimPrefix(parts[0], "/")
+	if len(parts) == 1 {
+		return name
+	}
+	alias := parts[1]
+	if i := strings.LastIndex(alias, "/"); i >= 0 {
+		alias = alias[i+1:]
+	}
+	return name + ":" + alias
+}
+
+// formatBytes formats the bytes in the largest binary unit which divides it, so RAMInBytes gives it back
+func formatBytes(size int64) string {
+	for _, unit := range []struct {
+		suffix string
+		size   int64
+	}{{"g", GiB}, {"m", MiB}, {"k", KiB}} {
+		if size%unit.size == 0 {
+			return strconv.FormatInt(size/unit.size, 10) + unit.suffix
+		}
+	}
+	return strconv.FormatInt(size, 10)
+}
+
+// shellQuote quotes the argument with the single quotes if it has the special characters
+func shellQuote(arg string) string {
+	if arg == "" {
+		return "''"
+	}
+	if strings.IndexFunc(arg, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./:=,@%+", r))
+	}) < 0 {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedSetKeys(m map[string]struct{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedPortKeys(m map[string][]PortBinding) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,124 @@
+package adoc
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestContainerRunCommand(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "nginx:1.19", Config: map[string]interface{}{
+		"Cmd":          []string{"nginx", "-g", "daemon off;"},
+		"Env":          []string{"PATH=/usr/bin:/bin", "NGINX_VERSION=1.19"},
+		"ExposedPorts": map[string]interface{}{"80/tcp": struct{}{}},
+		"Labels":       map[string]string{"maintainer": "nginx"},
+		"StopSignal":   "SIGQUIT",
+	}})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.25"))
+	defer client.Close()
+
+	line := `docker run --name web -t -p 127.0.0.1:8080:80 -p 53/udp --expose 9000 -v /srv/data:/data:ro -v /cache ` +
+		`-e 'GREETING=hello world' -l app=web --restart on-failure:3 --memory 512m --cpus 1.5 --cpu-shares 512 ` +
+		`--ulimit nofile=1024:2048 --device /dev/fuse:/dev/f:r --cap-add SYS_ADMIN --health-cmd 'curl -f localhost' ` +
+		`--health-interval 30s --log-driver syslog --log-opt tag=web --network backend --ip 10.0.0.5 --network-alias api ` +
+		`--mount type=volume,source=logs,target=/logs --tmpfs /run:size=64m --add-host db:10.0.0.2 ` +
+		`--entrypoint /docker-entrypoint.sh nginx:1.19 nginx -c /etc/nginx/web.conf`
+	spec, err := ParseRunCommand(line)
+	if err != nil {
+		t.Fatalf("Cannot parse the docker run command, %s", err)
+	}
+	id, err := client.CreateContainer(spec.Config, spec.HostConfig, spec.NetworkingConfig, spec.Name)
+	if err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	command, err := client.ContainerRunCommand(id)
+	if err != nil {
+		t.Fatalf("Cannot generate the docker run command, %s", err)
+	}
+	for _, omitted := range []string{"NGINX_VERSION", "maintainer", "SIGQUIT", "--hostname", "--memory-swap", "--expose 80", "daemon off"} {
+		if strings.Contains(command, omitted) {
+			t.Errorf("The default %q should be omitted, %s", omitted, command)
+		}
+	}
+
+	// the generated command gives back the same container
+	again, err := ParseRunCommand(command)
+	if err != nil {
+		t.Fatalf("Cannot parse the generated command, %s, %s", err, command)
+	}
+	if !reflect.DeepEqual(spec.Config, again.Config) {
+		t.Errorf("Wrong round trip config, %+v, %+v", spec.Config, again.Config)
+	}
+	if !reflect.DeepEqual(spec.HostConfig, again.HostConfig) {
+		t.Errorf("Wrong round trip host config, %+v, %+v", spec.HostConfig, again.HostConfig)
+	}
+	if !reflect.DeepEqual(spec.NetworkingConfig, again.NetworkingConfig) || again.Name != "web" {
+		t.Errorf("Wrong round trip networking config, %+v, %+v", spec.NetworkingConfig, again.NetworkingConfig)
+	}
+
+	// the container with only the image defaults, it is not attached
+	id, _ = client.CreateContainer(ContainerConfig{Image: "nginx:1.19"}, HostConfig{}, NetworkingConfig{}, "plain")
+	if command, err := client.ContainerRunCommand(id); err != nil || command != "docker run --name plain --detach nginx:1.19" {
+		t.Errorf("Should omit all the defaults, %q, %v", command, err)
+	}
+
+	// the attached streams are kept by the round trip
+	for _, line := range []string{"docker run -d -i nginx:1.19", "docker run -a stdout nginx:1.19", "docker run -it nginx:1.19"} {
+		spec, err := ParseRunCommand(line)
+		if err != nil {
+			t.Fatalf("Cannot parse the docker run command, %s", err)
+		}
+		again, err := ParseRunCommand(FormatRunCommand(ContainerDetail{Config: spec.Config}, ImageDetail{}))
+		if err != nil || !reflect.DeepEqual(spec.Config, again.Config) {
+			t.Errorf("Wrong round trip of %q, %+v, %+v, %v", line, spec.Config, again.Config, err)
+		}
+	}
+}
+
+func TestFormatRunArgs(t *testing.T) {
+	container := ContainerDetail{
+		Id:   "4f2a1c9b8d7e6f5a4b3c2d1e",
+		Name: "/web",
+		Config: ContainerConfig{
+			Hostname:     "4f2a1c9b8d7e",
+			Image:        "busybox",
+			Entrypoint:   []string{"sh", "-c"},
+			Cmd:          []string{"echo $HOME"},
+			AttachStdout: true,
+			AttachStderr: true,
+		},
+		HostConfig: HostConfig{
+			Links:     []string{"/db:/web/database"},
+			Resources: Resources{MemorySwap: -1, CPUShares: kDefaultCPUShares, PidsLimit: -1},
+		},
+	}
+	need := "docker run --name web --memory-swap -1 --link db:database --entrypoint sh busybox -c 'echo $HOME'"
+	if command := FormatRunCommand(container, ImageDetail{}); command != need {
+		t.Errorf("Wrong docker run command, %s", command)
+	}
+	if args, _ := splitCommandLine(need); !reflect.DeepEqual(args[2:], FormatRunArgs(container, ImageDetail{})) {
+		t.Errorf("The quoting should be split back, %q", args)
+	}
+}
+
+func TestFormatRunArgsAttach(t *testing.T) {
+	for _, c := range []struct {
+		config ContainerConfig
+		need   string
+	}{
+		{ContainerConfig{Image: "busybox"}, "--detach busybox"},
+		{ContainerConfig{Image: "busybox", OpenStdin: true}, "--detach --interactive busybox"},
+		{ContainerConfig{Image: "busybox", AttachStdout: true, AttachStderr: true}, "busybox"},
+		{ContainerConfig{Image: "busybox", AttachStderr: true}, "--attach stderr busybox"},
+		{ContainerConfig{Image: "busybox", AttachStdin: true, AttachStdout: true, AttachStderr: true}, "--attach stdin --attach stdout --attach stderr busybox"},
+		{ContainerConfig{Image: "busybox", AttachStdin: true, AttachStdout: true, AttachStderr: true, OpenStdin: true, StdinOnce: true}, "--interactive busybox"},
+	} {
+		if args := strings.Join(FormatRunArgs(ContainerDetail{Config: c.config}, ImageDetail{}), " "); args != c.need {
+			t.Errorf("Wrong attach flags of %+v, %s", c.config, args)
+		}
+	}
+}
@@ -0,0 +1,895 @@
+package adoc
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// This part contains the parser of the `docker run` command line, e.g.
+//   spec, err := ParseRunCommand(`docker run -d --name web -p 8080:80 -e MODE=prod --memory 512m nginx:1.19`)
+//   result, err := docker.RunContainer(ctx, spec)
+// All the invalid flags are reported together in the RunArgsError. The command lines could be pasted
+// by the users, so the local environment and files are not touched unless the ParseRunOptions allow.
+
+var kContainerNameRegex = regexp.MustCompile(`^/?[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// FlagError is the error of one flag in the docker run arguments
+type FlagError struct {
+	Flag  string
+	Value string
+	Err   error
+}
+
+func (e *FlagError) Error() string {
+	if e.Value == "" {
+		return fmt.Sprintf("--%s: %s", e.Flag, e.Err)
+	}
+	return fmt.Sprintf("--%s %q: %s", e.Flag, e.Value, e.Err)
+}
+
+func (e *FlagError) Unwrap() error {
+	return e.Err
+}
+
+// RunArgsError contains the errors of all the invalid flags
+type RunArgsError struct {
+	Errors []*FlagError
+}
+
+func (e *RunArgsError) Error() string {
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("Invalid docker run arguments, %s", strings.Join(msgs, "; "))
+}
+
+// ParseRunOptions allows the parser to read the local environment and files
+type ParseRunOptions struct {
+	LookupEnv func(string) (string, bool)  // for the bare -e KEY, nil drops the variable
+	ReadFile  func(string) ([]byte, error) // for the --env-file, nil rejects the flag
+}
+
+// runArgsParser keeps the flags which are applied after all the flags are parsed
+type runArgsParser struct {
+	opts        ParseRunOptions
+	spec        RunSpec
+	ip          string
+	ip6         string
+	aliases     []string
+	health      HealthConfig
+	healthSet   bool
+	noHealth    bool
+	interactive bool
+	detach      bool
+	attached    bool
+}
+
+type runFlag struct {
+	boolean bool
+	apply   func(p *runArgsParser, value string) error
+}
+
+func boolRunFlag(apply func(p *runArgsParser, on bool)) *runFlag {
+	return &runFlag{boolean: true, apply: func(p *runArgsParser, value string) error {
+		on, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("should be true or false")
+		}
+		apply(p, on)
+		return nil
+	}}
+}
+
+func stringRunFlag(apply func(p *runArgsParser, value string)) *runFlag {
+	return &runFlag{apply: func(p *runArgsParser, value string) error {
+		apply(p, value)
+		return nil
+	}}
+}
+
+func sizeRunFlag(apply func(p *runArgsParser, size int64)) *runFlag {
+	return &runFlag{apply: func(p *runArgsParser, value string) error {
+		size, err := RAMInBytes(value)
+		if err != nil {
+			return err
+		}
+		apply(p, size)
+		return nil
+	}}
+}
+
+func durationRunFlag(apply func(p *runArgsParser, d time.Duration)) *runFlag {
+	return &runFlag{apply: func(p *runArgsParser, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		if d < 0 {
+			return fmt.Errorf("should not be negative")
+		}
+		apply(p, d)
+		return nil
+	}}
+}
+
+func intRunFlag(apply func(p *runArgsParser, n int64) error) *runFlag {
+	return &runFlag{apply: func(p *runArgsParser, value string) error {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("should be a number")
+		}
+		return apply(p, n)
+	}}
+}
+
+// throttleRunFlag appends the device rate to the blkio list, in IO per second or in bytes per second
+func throttleRunFlag(iops bool, list func(r *Resources) *[]*ThrottleDevice) *runFlag {
+	return &runFlag{apply: func(p *runArgsParser, value string) error {
+		device, err := parseThrottleDevice(value, iops)
+		if err != nil {
+			return err
+		}
+		devices := list(&p.spec.HostConfig.Resources)
+		*devices = append(*devices, device)
+		return nil
+	}}
+}
+
+var kRunFlags map[string]*runFlag
+
+var kRunShortFlags = map[byte]string{
+	'a': "attach",
+	'c': "cpu-shares",
+	'd': "detach",
+	'e': "env",
+	'h': "hostname",
+	'i': "interactive",
+	'l': "label",
+	'm': "memory",
+	'p': "publish",
+	'P': "publish-all",
+	't': "tty",
+	'u': "user",
+	'v': "volume",
+	'w': "workdir",
+}
+
+func init() {
+	kRunFlags = map[string]*runFlag{
+		"detach": boolRunFlag(func(p *runArgsParser, on bool) { p.detach = on }),
+		"attach": {apply: func(p *runArgsParser, value string) error {
+			p.attached = true
+			switch strings.ToLower(value) {
+			case "stdin":
+				p.spec.Config.AttachStdin = true
+			case "stdout":
+				p.spec.Config.AttachStdout = true
+			case "stderr":
+				p.spec.Config.AttachStderr = true
+			default:
+				return fmt.Errorf("should be one of stdin, stdout, stderr")
+			}
+			return nil
+		}},
+		"interactive": boolRunFlag(func(p *runArgsParser, on bool) { p.interactive = on }),
+		"tty":         boolRunFlag(func(p *runArgsParser, on bool) { p.spec.Config.Tty = on }),
+		"rm":          boolRunFlag(func(p *runArgsParser, on bool) { p.spec.AutoRemove = on }),
+		"privileged":  boolRunFlag(func(p *runArgsParser, on bool) { p.spec.HostConfig.Privileged = on }),
+		"read-only":   boolRunFlag(func(p *runArgsParser, on bool) { p.spec.HostConfig.ReadonlyRootfs = on }),
+		"publish-all": boolRunFlag(func(p *runArgsParser, on bool) { p.spec.HostConfig.PublishAllPorts = on }),
+		"oom-kill-disable": boolRunFlag(func(p *runArgsParser, on bool) {
+			p.spec.HostConfig.OomKillDisable = &on
+		}),
+		"no-healthcheck": boolRunFlag(func(p *runArgsParser, on bool) { p.noHealth = on }),
+
+		"name": {apply: func(p *runArgsParser, value string) error {
+			if !kContainerNameRegex.MatchString(value) {
+				return fmt.Errorf("should match %s", kContainerNameRegex)
+			}
+			p.spec.Name = value
+			return nil
+		}},
+		"pull": {apply: func(p *runArgsParser, value string) error {
+			if value != PullMissing && value != PullAlways && value != PullNever {
+				return fmt.Errorf("should be one of missing, always, never")
+			}
+			p.spec.Pull = value
+			return nil
+		}},
+		"hostname":    stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.Hostname = value }),
+		"domainname":  stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.Domainname = value }),
+		"user":        stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.User = value }),
+		"workdir":     stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.WorkingDir = value }),
+		"stop-signal": stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.StopSignal = value }),
+		"mac-address": stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.MacAddress = value }),
+		"entrypoint": stringRunFlag(func(p *runArgsParser, value string) {
+			// the empty entrypoint resets the image one
+			p.spec.Config.Entrypoint = []string{value}
+		}),
+		"env": {apply: func(p *runArgsParser, value string) error {
+			return p.addEnv(value)
+		}},
+		"env-file": {apply: func(p *runArgsParser, value string) error {
+			return p.addEnvFile(value)
+		}},
+		"label": {apply: func(p *runArgsParser, value string) error {
+			parts := strings.SplitN(value, "=", 2)
+			if parts[0] == "" {
+				return fmt.Errorf("the label key should not be empty")
+			}
+			if p.spec.Config.Labels == nil {
+				p.spec.Config.Labels = make(map[string]string)
+			}
+			if len(parts) == 2 {
+				p.spec.Config.Labels[parts[0]] = parts[1]
+			} else {
+				p.spec.Config.Labels[parts[0]] = ""
+			}
+			return nil
+		}},
+
+		"publish": {apply: func(p *runArgsParser, value string) error {
+			exposed, bindings, err := parsePortSpec(value)
+			if err != nil {
+				return err
+			}
+			p.expose(exposed)
+			if p.spec.HostConfig.PortBindings == nil {
+				p.spec.HostConfig.PortBindings = make(map[string][]PortBinding)
+			}
+			for port, binding := range bindings {
+				p.spec.HostConfig.PortBindings[port] = append(p.spec.HostConfig.PortBindings[port], binding...)
+			}
+			return nil
+		}},
+		"expose": {apply: func(p *runArgsParser, value string) error {
+			exposed, _, err := parsePortSpec(value)
+			if err == nil && strings.Contains(value, ":") {
+				err = fmt.Errorf("should not have the host port")
+			}
+			if err != nil {
+				return err
+			}
+			p.expose(exposed)
+			return nil
+		}},
+
+		"volume": {apply: func(p *runArgsParser, value string) error {
+			return p.addVolume(value)
+		}},
+		"volumes-from": stringRunFlag(func(p *runArgsParser, value string) {
+			p.spec.HostConfig.VolumesFrom = append(p.spec.HostConfig.VolumesFrom, value)
+		}),
+		"volume-driver": stringRunFlag(func(p *runArgsParser, value string) { p.spec.Config.VolumeDriver = value }),
+		"mount": {apply: func(p *runArgsParser, value string) error {
+			mount, err := parseMount(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.Mounts = append(p.spec.HostConfig.Mounts, mount)
+			return nil
+		}},
+		"tmpfs": {apply: func(p *runArgsParser, value string) error {
+			parts := strings.SplitN(value, ":", 2)
+			if !strings.HasPrefix(parts[0], "/") {
+				return fmt.Errorf("the path should be absolute")
+			}
+			if p.spec.HostConfig.Tmpfs == nil {
+				p.spec.HostConfig.Tmpfs = make(map[string]string)
+			}
+			if len(parts) == 2 {
+				p.spec.HostConfig.Tmpfs[parts[0]] = parts[1]
+			} else {
+				p.spec.HostConfig.Tmpfs[parts[0]] = ""
+			}
+			return nil
+		}},
+
+		"restart": {apply: func(p *runArgsParser, value string) error {
+			policy, err := parseRestartPolicy(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.RestartPolicy = policy
+			return nil
+		}},
+		"memory":             sizeRunFlag(func(p *runArgsParser, size int64) { p.spec.HostConfig.Memory = size }),
+		"memory-reservation": sizeRunFlag(func(p *runArgsParser, size int64) { p.spec.HostConfig.MemoryReservation = size }),
+		"kernel-memory":      sizeRunFlag(func(p *runArgsParser, size int64) { p.spec.HostConfig.KernelMemory = size }),
+		"memory-swap": {apply: func(p *runArgsParser, value string) error {
+			if value == "-1" {
+				p.spec.HostConfig.MemorySwap = -1
+				return nil
+			}
+			size, err := RAMInBytes(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.MemorySwap = size
+			return nil
+		}},
+		"memory-swappiness": intRunFlag(func(p *runArgsParser, n int64) error {
+			if n < -1 || n > 100 {
+				return fmt.Errorf("should be between 0 and 100, or -1 for the default")
+			}
+			p.spec.HostConfig.MemorySwappiness = &n
+			return nil
+		}),
+		"cpus": {apply: func(p *runArgsParser, value string) error {
+			nanoCPUs, err := parseCPUs(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.NanoCPUs = nanoCPUs
+			return nil
+		}},
+		"cpu-shares": intRunFlag(func(p *runArgsParser, n int64) error {
+			p.spec.HostConfig.CPUShares = n
+			return nil
+		}),
+		"cpu-period": intRunFlag(func(p *runArgsParser, n int64) error {
+			p.spec.HostConfig.CPUPeriod = n
+			return nil
+		}),
+		"cpu-quota": intRunFlag(func(p *runArgsParser, n int64) error {
+			p.spec.HostConfig.CPUQuota = n
+			return nil
+		}),
+		"cpuset-cpus": stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.CpusetCpus = value }),
+		"cpuset-mems": stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.CpusetMems = value }),
+		"pids-limit": intRunFlag(func(p *runArgsParser, n int64) error {
+			p.spec.HostConfig.PidsLimit = n
+			return nil
+		}),
+		"cgroup-parent": stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.CgroupParent = value }),
+		"ulimit": {apply: func(p *runArgsParser, value string) error {
+			ulimit, err := parseUlimit(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.Ulimits = append(p.spec.HostConfig.Ulimits, ulimit)
+			return nil
+		}},
+		"device": {apply: func(p *runArgsParser, value string) error {
+			device, err := parseDevice(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.Devices = append(p.spec.HostConfig.Devices, device)
+			return nil
+		}},
+		"blkio-weight": {apply: func(p *runArgsParser, value string) error {
+			weight, err := parseBlkioWeight(value)
+			p.spec.HostConfig.BlkioWeight = weight
+			return err
+		}},
+		"blkio-weight-device": {apply: func(p *runArgsParser, value string) error {
+			device, err := parseWeightDevice(value)
+			if err != nil {
+				return err
+			}
+			p.spec.HostConfig.BlkioWeightDevice = append(p.spec.HostConfig.BlkioWeightDevice, device)
+			return nil
+		}},
+		"device-read-bps":   throttleRunFlag(false, func(r *Resources) *[]*ThrottleDevice { return &r.BlkioDeviceReadBps }),
+		"device-write-bps":  throttleRunFlag(false, func(r *Resources) *[]*ThrottleDevice { return &r.BlkioDeviceWriteBps }),
+		"device-read-iops":  throttleRunFlag(true, func(r *Resources) *[]*ThrottleDevice { return &r.BlkioDeviceReadIOps }),
+		"device-write-iops": throttleRunFlag(true, func(r *Resources) *[]*ThrottleDevice { return &r.BlkioDeviceWriteIOps }),
+
+		"cap-add": stringRunFlag(func(p *runArgsParser, value string) {
+			p.spec.HostConfig.CapAdd = append(p.spec.HostConfig.CapAdd, value)
+		}),
+		"cap-drop": stringRunFlag(func(p *runArgsParser, value string) {
+			p.spec.HostConfig.CapDrop = append(p.spec.HostConfig.CapDrop, value)
+		}),
+		"security-opt": stringRunFlag(func(p *runArgsParser, value string) {
+			p.spec.HostConfig.SecurityOpt = append(p.spec.HostConfig.SecurityOpt, value)
+		}),
+		"ipc": stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.IpcMode = value }),
+		"pid": stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.PidMode = value }),
+
+		"health-cmd": stringRunFlag(func(p *runArgsParser, value string) {
+			p.health.Test = []string{"CMD-SHELL", value}
+			p.healthSet = true
+		}),
+		"health-interval": durationRunFlag(func(p *runArgsParser, d time.Duration) {
+			p.health.Interval, p.healthSet = d, true
+		}),
+		"health-timeout": durationRunFlag(func(p *runArgsParser, d time.Duration) {
+			p.health.Timeout, p.healthSet = d, true
+		}),
+		"health-start-period": durationRunFlag(func(p *runArgsParser, d time.Duration) {
+			p.health.StartPeriod, p.healthSet = d, true
+		}),
+		"health-retries": intRunFlag(func(p *runArgsParser, n int64) error {
+			if n < 0 {
+				return fmt.Errorf("should not be negative")
+			}
+			p.health.Retries, p.healthSet = int(n), true
+			return nil
+		}),
+
+		"log-driver": stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.LogConfig.Type = value }),
+		"log-opt": {apply: func(p *runArgsParser, value string) error {
+			parts := strings.SplitN(value, "=", 2)
+			if len(parts) != 2 || parts[0] == "" {
+				return fmt.Errorf("should be key=value")
+			}
+			if p.spec.HostConfig.LogConfig.Config == nil {
+				p.spec.HostConfig.LogConfig.Config = make(map[string]string)
+			}
+			p.spec.HostConfig.LogConfig.Config[parts[0]] = parts[1]
+			return nil
+		}},
+
+		"network":       stringRunFlag(func(p *runArgsParser, value string) { p.spec.HostConfig.NetworkMode = value }),
+		"ip":            stringRunFlag(func(p *runArgsParser, value string) { p.ip = value }),
+		"ip6":           stringRunFlag(func(p *runArgsParser, value string) { p.ip6 = value }),
+		"network-alias": stringRunFlag(func(p *runArgsParser, value string) { p.aliases = append(p.aliases, value) }),
+		"dns": stringRunFlag(func(p *runArgsParser, value string) {
+			p.spec.HostConfig.Dns = append(p.spec.HostConfig.Dns, value)
+		}),
+		"dns-search": stringRunFlag(func(p *runArgsParser, value string) {
+			p.spec.HostConfig.DnsSearch = append(p.spec.HostConfig.DnsSearch, value)
+		}),
+		"add-host": {apply: func(p *runArgsParser, value string) error {
+			parts := strings.SplitN(value, ":", 2)
+			if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+				return fmt.Errorf("should be host:ip")
+			}
+			p.spec.HostConfig.ExtraHosts = append(p.spec.HostConfig.ExtraHosts, value)
+			return nil
+		}},
+		"link": stringRunFlag(func(p *runArgsParser, value string) {
+			if !strings.Contains(value, ":") {
+				value = value + ":" + value
+			}
+			p.spec.HostConfig.Links = append(p.spec.HostConfig.Links, value)
+		}),
+	}
+	kRunFlags["net"] = kRunFlags["network"]
+	kRunFlags["net-alias"] = kRunFlags["network-alias"]
+}
+
+// ParseRunCommand splits the command line like the shell and parses the docker run arguments,
+// the quotes and the backslash line continuations are supported
+func ParseRunCommand(line string, opts ...ParseRunOptions) (RunSpec, error) {
+	args, err := splitCommandLine(line)
+	if err != nil {
+		return RunSpec{}, err
+	}
+	return ParseRunArgs(args, opts...)
+}
+
+// ParseRunArgs parses the docker run arguments into the RunSpec, the leading "docker run" or
+// "docker container run" is optional. The arguments after the image are the Cmd.
+func ParseRunArgs(args []string, opts ...ParseRunOptions) (RunSpec, error) {
+	if len(args) > 0 && args[0] == "docker" {
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "container" {
+		args = args[1:]
+	}
+	if len(args) > 0 && args[0] == "run" {
+		args = args[1:]
+	}
+
+	p := &runArgsParser{}
+	if len(opts) > 0 {
+		p.opts = opts[0]
+	}
+	errs := &RunArgsError{}
+	fail := func(flag string, value string, err error) {
+		errs.Errors = append(errs.Errors, &FlagError{Flag: flag, Value: value, Err: err})
+	}
+	apply := func(name string, value string, hasValue bool, next func() (string, bool)) {
+		flag, ok := kRunFlags[name]
+		if !ok {
+			fail(name, "", fmt.Errorf("unknown flag"))
+			return
+		}
+		if flag.boolean && !hasValue {
+			value, hasValue = "true", true
+		}
+		if !hasValue {
+			if value, hasValue = next(); !hasValue {
+				fail(name, "", fmt.Errorf("flag needs an argument"))
+				return
+			}
+		}
+		if err := flag.apply(p, value); err != nil {
+			fail(name, value, err)
+		}
+	}
+
+	i := 0
+	next := func() (string, bool) {
+		if i+1 < len(args) {
+			i += 1
+			return args[i], true
+		}
+		return "", false
+	}
+	for ; i < len(args); i += 1 {
+		arg := args[i]
+		if arg == "--" {
+			i += 1
+			break
+		}
+		if !strings.HasPrefix(arg, "-") || arg == "-" {
+			break
+		}
+		if strings.HasPrefix(arg, "--") {
+			name, value := arg[2:], ""
+			hasValue := false
+			if j := strings.Index(name, "="); j >= 0 {
+				name, value, hasValue = name[:j], name[j+1:], true
+			}
+			apply(name, value, hasValue, next)
+			continue
+		}
+		// the short flags could be combined like -it, the last one could take the value like -p80:80
+		shorts := arg[1:]
+		for j := 0; j < len(shorts); j += 1 {
+			name, ok := kRunShortFlags[shorts[j]]
+			if !ok {
+				fail(string(shorts[j]), "", fmt.Errorf("unknown shorthand flag"))
+				break
+			}
+			if rest := shorts[j+1:]; !kRunFlags[name].boolean && rest != "" {
+				apply(name, strings.TrimPrefix(rest, "="), true, next)
+				break
+			}
+			apply(name, "", false, next)
+		}
+	}
+
+	if i < len(args) {
+		p.spec.Config.Image = args[i]
+		if len(args) > i+1 {
+			p.spec.Config.Cmd = append([]string(nil), args[i+1:]...)
+		}
+	} else {
+		fail("image", "", fmt.Errorf("the image is required"))
+	}
+	p.finish(fail)
+	if len(errs.Errors) > 0 {
+		return p.spec, errs
+	}
+	return p.spec, nil
+}
+
+// finish applies the flags depending on the others
+func (p *runArgsParser) finish(fail func(flag string, value string, err error)) {
+	// like the docker cli, the stdout and stderr are attached unless detached or the --attach is given
+	if p.detach && p.attached {
+		fail("detach", "", fmt.Errorf("conflicts with the --attach"))
+	}
+	if p.interactive {
+		p.spec.Config.OpenStdin = true
+		if !p.detach {
+			p.spec.Config.StdinOnce = true
+			p.spec.Config.AttachStdin = true
+		}
+	}
+	if !p.detach && !p.attached {
+		p.spec.Config.AttachStdout = true
+		p.spec.Config.AttachStderr = true
+	}
+	if p.noHealth {
+		if p.healthSet {
+			fail("no-healthcheck", "", fmt.Errorf("conflicts with the --health-* flags"))
+		}
+		p.spec.Config.Healthcheck = &HealthConfig{Test: []string{"NONE"}}
+	} else if p.healthSet {
+		health := p.health
+		p.spec.Config.Healthcheck = &health
+	}
+
+	network := p.spec.HostConfig.NetworkMode
+	if p.ip != "" || p.ip6 != "" || len(p.aliases) > 0 {
+		if !isUserDefinedNetwork(network) {
+			fail("network", network, fmt.Errorf("the --ip and --network-alias are only supported on the user defined networks"))
+			return
+		}
+		endpoint := EndpointConfig{
+			IPAMConfig: IPAMConfig{IPv4Address: p.ip, IPv6Address: p.ip6},
+			Aliases:    p.aliases,
+		}
+		p.spec.NetworkingConfig.EndpointsConfig = map[string]EndpointConfig{network: endpoint}
+	}
+}
+
+func isUserDefinedNetwork(network string) bool {
+	switch network {
+	case "", "default", "bridge", "host", "none":
+		return false
+	}
+	return !strings.HasPrefix(network, "container:")
+}
+
+func (p *runArgsParser) expose(ports []string) {
+	if p.spec.Config.ExposedPorts == nil {
+		p.spec.Config.ExposedPorts = make(map[string]struct{})
+	}
+	for _, port := range ports {
+		p.spec.Config.ExposedPorts[port] = struct{}{}
+	}
+}
+
+// addEnv adds the KEY=value, or the KEY from the LookupEnv like the docker cli
+func (p *runArgsParser) addEnv(value string) error {
+	if value == "" || strings.HasPrefix(value, "=") {
+		return fmt.Errorf("the variable name should not be empty")
+	}
+	if !strings.Contains(value, "=") {
+		if p.opts.LookupEnv == nil {
+			return nil
+		}
+		local, ok := p.opts.LookupEnv(value)
+		if !ok {
+			return nil
+		}
+		value = value + "=" + local
+	}
+	p.spec.Config.Env = append(p.spec.Config.Env, value)
+	return nil
+}
+
+func (p *runArgsParser) addEnvFile(path string) error {
+	if p.opts.ReadFile == nil {
+		return fmt.Errorf("reading the env files is not allowed")
+	}
+	data, err := p.opts.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for lineNo := 1; scanner.Scan(); lineNo += 1 {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.ContainsAny(strings.SplitN(line, "=", 2)[0], " \t") {
+			return fmt.Errorf("line %d: the variable name should not contain whitespaces", lineNo)
+		}
+		if err := p.addEnv(line); err != nil {
+			return fmt.Errorf("line %d: %s", lineNo, err)
+		}
+	}
+	return scanner.Err()
+}
+
+// addVolume adds the bind like /host:/container:ro, the named volume like data:/data,
+// or the anonymous volume like /data
+func (p *runArgsParser) addVolume(value string) error {
+	parts := strings.Split(value, ":")
+	switch len(parts) {
+	case 1:
+		if !strings.HasPrefix(parts[0], "/") {
+			return fmt.Errorf("the container path should be absolute")
+		}
+		if p.spec.Config.Volumes == nil {
+			p.spec.Config.Volumes = make(map[string]struct{})
+		}
+		p.spec.Config.Volumes[parts[0]] = struct{}{}
+		return nil
+	case 2, 3:
+		if parts[0] == "" {
+			return fmt.Errorf("the source should not be empty")
+		}
+		if !strings.HasPrefix(parts[1], "/") {
+			return fmt.Errorf("the container path should be absolute")
+		}
+		if len(parts) == 3 {
+			for _, option := range strings.Split(parts[2], ",") {
+				switch option {
+				case "ro", "rw", "z", "Z", "nocopy", "consistent", "cached", "delegated",
+					"shared", "rshared", "slave", "rslave", "private", "rprivate":
+				default:
+					return fmt.Errorf("unknown option %q", option)
+				}
+			}
+		}
+		p.spec.HostConfig.Binds = append(p.spec.HostConfig.Binds, value)
+		return nil
+	}
+	return fmt.Errorf("should be [source:]container-path[:options]")
+}
+
+func parseRestartPolicy(value string) (RestartPolicy, error) {
+	var policy RestartPolicy
+	parts := strings.SplitN(value, ":", 2)
+	policy.Name = parts[0]
+	if !containsString(kRestartPolicies, policy.Name) || policy.Name == "" {
+		return policy, fmt.Errorf("should be no, always, unless-stopped or on-failure[:max-retries]")
+	}
+	if len(parts) == 2 {
+		if policy.Name != "on-failure" {
+			return policy, fmt.Errorf("the maximum retry count is only valid for on-failure")
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err != nil || count < 0 {
+			return policy, fmt.Errorf("the maximum retry count should be a positive number")
+		}
+		policy.MaximumRetryCount = count
+	}
+	return policy, nil
+}
+
+// parseMount parses the --mount like type=bind,source=/data,target=/data,readonly
+func parseMount(value string) (Mount, error) {
+	mount := Mount{Type: "volume"}
+	for _, field := range strings.Split(value, ",") {
+		parts := strings.SplitN(field, "=", 2)
+		key := strings.ToLower(strings.TrimSpace(parts[0]))
+		if len(parts) == 1 {
+			switch key {
+			case "readonly", "ro":
+				mount.ReadOnly = true
+				continue
+			case "volume-nocopy":
+				mount.volumeOptions().NoCopy = true
+				continue
+			}
+			return mount, fmt.Errorf("invalid field %q, should be key=value", field)
+		}
+		value := parts[1]
+		switch key {
+		case "type":
+			mount.Type = value
+		case "source", "src":
+			mount.Source = value
+		case "target", "destination", "dst":
+			mount.Target = value
+		case "readonly", "ro", "volume-nocopy":
+			on, err := strconv.ParseBool(value)
+			if err != nil {
+				return mount, fmt.Errorf("invalid value for %s: %s", key, value)
+			}
+			if key == "volume-nocopy" {
+				mount.volumeOptions().NoCopy = on
+			} else {
+				mount.ReadOnly = on
+			}
+		case "consistency":
+			mount.Consistency = value
+		case "bind-propagation":
+			mount.BindOptions = &BindOptions{Propagation: value}
+		case "volume-driver":
+			options := mount.volumeOptions()
+			if options.DriverConfig == nil {
+				options.DriverConfig = &VolumeDriver{}
+			}
+			options.DriverConfig.Name = value
+		case "volume-label", "volume-opt":
+			kv := strings.SplitN(value, "=", 2)
+			if len(kv) != 2 {
+				return mount, fmt.Errorf("invalid %s %q, should be key=value", key, value)
+			}
+			options := mount.volumeOptions()
+			if key == "volume-label" {
+				if options.Labels == nil {
+					options.Labels = make(map[string]string)
+				}
+				options.Labels[kv[0]] = kv[1]
+			} else {
+				if options.DriverConfig == nil {
+					options.DriverConfig = &VolumeDriver{}
+				}
+				if options.DriverConfig.Options == nil {
+					options.DriverConfig.Options = make(map[string]string)
+				}
+				options.DriverConfig.Options[kv[0]] = kv[1]
+			}
+		case "tmpfs-size":
+			size, err := RAMInBytes(value)
+			if err != nil {
+				return mount, err
+			}
+			mount.tmpfsOptions().SizeBytes = size
+		case "tmpfs-mode":
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return mount, fmt.Errorf("invalid tmpfs-mode %q, should be octal", value)
+			}
+			mount.tmpfsOptions().Mode = uint32(mode)
+		default:
+			return mount, fmt.Errorf("unknown field %q", key)
+		}
+	}
+	switch mount.Type {
+	case "bind", "volume", "tmpfs":
+	default:
+		return mount, fmt.Errorf("invalid type %q, should be bind, volume or tmpfs", mount.Type)
+	}
+	if mount.Target == "" {
+		return mount, fmt.Errorf("the target is required")
+	}
+	if mount.Type == "bind" && mount.Source == "" {
+		return mount, fmt.Errorf("the source is required for the bind")
+	}
+	if mount.Type == "tmpfs" && mount.Source != "" {
+		return mount, fmt.Errorf("the source is not allowed for the tmpfs")
+	}
+	if (mount.VolumeOptions != nil && mount.Type != "volume") || (mount.TmpfsOptions != nil && mount.Type != "tmpfs") ||
+		(mount.BindOptions != nil && mount.Type != "bind") {
+		return mount, fmt.Errorf("the options do not match the type %s", mount.Type)
+	}
+	return mount, nil
+}
+
+func (m *Mount) volumeOptions() *VolumeOptions {
+	if m.VolumeOptions == nil {
+		m.VolumeOptions = &VolumeOptions{}
+	}
+	return m.VolumeOptions
+}
+
+func (m *Mount) tmpfsOptions() *TmpfsOptions {
+	if m.TmpfsOptions == nil {
+		m.TmpfsOptions = &TmpfsOptions{}
+	}
+	return m.TmpfsOptions
+}
+
+// splitCommandLine splits the line into the arguments like the shell, without the expansions
+func splitCommandLine(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	inArg := false
+	var quote rune
+	runes := []rune(line)
+	for i := 0; i < len(runes); i += 1 {
+		r := runes[i]
+		switch {
+		case quote == '\'':
+			if r == '\'' {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case quote == '"':
+			if r == '"' {
+				quote = 0
+			} else if r == '\\' && i+1 < len(runes) && strings.ContainsRune(`"\$`+"`", runes[i+1]) {
+				i += 1
+				current.WriteRune(runes[i])
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '\\':
+			if i+1 < len(runes) {
+				i += 1
+				if runes[i] != '\n' {
+					current.WriteRune(runes[i])
+					inArg = true
+				}
+			}
+		case r == '\'' || r == '"':
+			quote, inArg = r, true
+		case r == ' ' || r == '\t' || r == '\n' || r == '\r':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("Unterminated quote %c in the command line", quote)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,164 @@
+package adoc
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRunCommand(t *testing.T) {
+	dir, _ := ioutil.TempDir("", "adoc")
+	defer os.RemoveAll(dir)
+	envFile := filepath.Join(dir, "web.env")
+	ioutil.WriteFile(envFile, []byte("# the web env\nMODE=prod\n\nWORKERS=4\n"), 0644)
+	os.Setenv("ADOC_TEST_TOKEN", "secret")
+	defer os.Unsetenv("ADOC_TEST_TOKEN")
+
+	spec, err := ParseRunCommand(`docker run -d --rm -it --name web \
+		-p 8080:80 -p 127.0.0.1::53/udp -p 3000-3001:3000-3001 --expose 9000 \
+		-v /srv/data:/data:ro -v cache:/cache -v /tmp/anon \
+		-e "GREETING=hello world" -e ADOC_TEST_TOKEN --env-file `+envFile+` \
+		--label app=web -l tier \
+		--restart on-failure:3 --memory 512m --memory-swap=-1 --cpus 1.5 \
+		--ulimit nofile=1024:2048 --device /dev/fuse --cap-add SYS_ADMIN \
+		--health-cmd 'curl -f http://localhost/' --health-interval 30s --health-retries 3 \
+		--log-driver json-file --log-opt max-size=10m \
+		--network backend --ip 10.0.0.5 --network-alias api \
+		--mount type=volume,source=logs,target=/logs,volume-label=env=prod \
+		--tmpfs /run:rw,size=64m \
+		nginx:1.19 nginx -g 'daemon off;'`, ParseRunOptions{LookupEnv: os.LookupEnv, ReadFile: ioutil.ReadFile})
+	if err != nil {
+		t.Fatalf("Cannot parse the docker run command, %s", err)
+	}
+	config, host := spec.Config, spec.HostConfig
+	if spec.Name != "web" || !spec.AutoRemove || !config.Tty || !config.OpenStdin || config.Image != "nginx:1.19" ||
+		!reflect.DeepEqual(config.Cmd, []string{"nginx", "-g", "daemon off;"}) {
+		t.Errorf("Wrong basic flags, %+v", spec)
+	}
+	needPorts := map[string][]PortBinding{
+		"80/tcp":   {{HostPort: "8080"}},
+		"53/udp":   {{HostIp: "127.0.0.1"}},
+		"3000/tcp": {{HostPort: "3000"}},
+		"3001/tcp": {{HostPort: "3001"}},
+	}
+	if !reflect.DeepEqual(host.PortBindings, needPorts) || len(config.ExposedPorts) != 5 {
+		t.Errorf("Wrong ports, %+v, %+v", host.PortBindings, config.ExposedPorts)
+	}
+	if !reflect.DeepEqual(host.Binds, []string{"/srv/data:/data:ro", "cache:/cache"}) || len(config.Volumes) != 1 {
+		t.Errorf("Wrong volumes, %+v, %+v", host.Binds, config.Volumes)
+	}
+	needEnv := []string{"GREETING=hello world", "ADOC_TEST_TOKEN=secret", "MODE=prod", "WORKERS=4"}
+	if !reflect.DeepEqual(config.Env, needEnv) {
+		t.Errorf("Wrong env, %q", config.Env)
+	}
+	if !reflect.DeepEqual(config.Labels, map[string]string{"app": "web", "tier": ""}) {
+		t.Errorf("Wrong labels, %+v", config.Labels)
+	}
+	if host.RestartPolicy != (RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}) || host.Memory != 512*1024*1024 ||
+		host.MemorySwap != -1 || host.NanoCPUs != 1500000000 {
+		t.Errorf("Wrong resources, %+v", host.Resources)
+	}
+	if len(host.Ulimits) != 1 || *host.Ulimits[0] != (Ulimit{Name: "nofile", Soft: 1024, Hard: 2048}) ||
+		!reflect.DeepEqual(host.Devices, []Device{{"/dev/fuse", "/dev/fuse", "rwm"}}) ||
+		!reflect.DeepEqual(host.CapAdd, []string{"SYS_ADMIN"}) {
+		t.Errorf("Wrong ulimits and devices, %+v, %+v, %+v", host.Ulimits, host.Devices, host.CapAdd)
+	}
+	needHealth := &HealthConfig{Test: []string{"CMD-SHELL", "curl -f http://localhost/"}, Interval: 30 * time.Second, Retries: 3}
+	if !reflect.DeepEqual(config.Healthcheck, needHealth) {
+		t.Errorf("Wrong healthcheck, %+v", config.Healthcheck)
+	}
+	if host.LogConfig.Type != "json-file" || host.LogConfig.Config["max-size"] != "10m" {
+		t.Errorf("Wrong log config, %+v", host.LogConfig)
+	}
+	endpoint := spec.NetworkingConfig.EndpointsConfig["backend"]
+	if host.NetworkMode != "backend" || endpoint.IPAMConfig.IPv4Address != "10.0.0.5" || !reflect.DeepEqual(endpoint.Aliases, []string{"api"}) {
+		t.Errorf("Wrong network, %s, %+v", host.NetworkMode, spec.NetworkingConfig)
+	}
+	needMount := Mount{Type: "volume", Source: "logs", Target: "/logs", VolumeOptions: &VolumeOptions{Labels: map[string]string{"env": "prod"}}}
+	if len(host.Mounts) != 1 || !reflect.DeepEqual(host.Mounts[0], needMount) || host.Tmpfs["/run"] != "rw,size=64m" {
+		t.Errorf("Wrong mounts, %+v, %+v", host.Mounts, host.Tmpfs)
+	}
+}
+
+func TestParseRunArgsShortFlags(t *testing.T) {
+	spec, err := ParseRunArgs([]string{"-itp80:80", "-m", "1g", "-eA=1", "--", "busybox"})
+	if err != nil {
+		t.Fatalf("Cannot parse the short flags, %s", err)
+	}
+	if !spec.Config.Tty || !spec.Config.OpenStdin || spec.HostConfig.PortBindings["80/tcp"][0].HostPort != "80" ||
+		spec.HostConfig.Memory != 1024*1024*1024 || spec.Config.Env[0] != "A=1" || spec.Config.Image != "busybox" {
+		t.Errorf("Wrong short flags, %+v", spec)
+	}
+}
+
+func TestParseRunArgsLocalAccess(t *testing.T) {
+	os.Setenv("ADOC_TEST_TOKEN", "secret")
+	defer os.Unsetenv("ADOC_TEST_TOKEN")
+
+	// the pasted command line should not read the host environment and files by default
+	spec, err := ParseRunArgs([]string{"-e", "ADOC_TEST_TOKEN", "-e", "MODE=prod", "busybox"})
+	if err != nil || !reflect.DeepEqual(spec.Config.Env, []string{"MODE=prod"}) {
+		t.Errorf("Should drop the variable from the host environment, %q, %v", spec.Config.Env, err)
+	}
+	_, err = ParseRunArgs([]string{"--env-file", "/etc/hostname", "busybox"})
+	var argsErr *RunArgsError
+	if !errors.As(err, &argsErr) || len(argsErr.Errors) != 1 || argsErr.Errors[0].Flag != "env-file" || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Should reject the env file by default, %v", err)
+	}
+
+	var read []string
+	opts := ParseRunOptions{
+		LookupEnv: func(key string) (string, bool) { return "from-" + key, key == "TOKEN" },
+		ReadFile: func(path string) ([]byte, error) {
+			read = append(read, path)
+			return []byte("WORKERS=4\nTOKEN\n"), nil
+		},
+	}
+	spec, err = ParseRunArgs([]string{"-e", "TOKEN", "-e", "MISSING", "--env-file", "web.env", "busybox"}, opts)
+	if err != nil || !reflect.DeepEqual(spec.Config.Env, []string{"TOKEN=from-TOKEN", "WORKERS=4", "TOKEN=from-TOKEN"}) ||
+		!reflect.DeepEqual(read, []string{"web.env"}) {
+		t.Errorf("Wrong env from the options, %q, %v, %v", spec.Config.Env, read, err)
+	}
+}
+
+func TestParseRunArgsErrors(t *testing.T) {
+	_, err := ParseRunArgs([]string{"run", "--memory", "lots", "-p", "80:80/xtp", "--restart", "sometimes",
+		"--cpus", "0", "--ulimit", "nofile", "--device", "", "--mount", "type=bind,target=/data",
+		"--ip", "10.0.0.5", "-a", "stdot", "--memory-swappiness", "101", "--bogus", "busybox"})
+	var argsErr *RunArgsError
+	if !errors.As(err, &argsErr) {
+		t.Fatalf("Should return the RunArgsError, %v", err)
+	}
+	var flags []string
+	for _, flagErr := range argsErr.Errors {
+		flags = append(flags, flagErr.Flag)
+	}
+	need := []string{"memory", "publish", "restart", "cpus", "ulimit", "device", "mount", "attach", "memory-swappiness", "bogus", "network"}
+	if strings.Join(flags, ",") != strings.Join(need, ",") {
+		t.Errorf("Wrong flag errors, %s", err)
+	}
+	if spec, err := ParseRunArgs([]string{"-a", "STDOUT", "--memory-swappiness", "-1", "busybox"}); err != nil ||
+		!spec.Config.AttachStdout || *spec.HostConfig.MemorySwappiness != -1 {
+		t.Errorf("Should accept the attach and the default swappiness, %+v, %v", spec, err)
+	}
+	if _, err := ParseRunArgs([]string{"-d", "-a", "stdout", "busybox"}); err == nil || !strings.Contains(err.Error(), "conflicts with the --attach") {
+		t.Errorf("Should reject the detach with the attach, %v", err)
+	}
+	if spec, _ := ParseRunArgs([]string{"busybox"}); !spec.Config.AttachStdout || !spec.Config.AttachStderr || spec.Config.AttachStdin {
+		t.Errorf("Should attach the stdout and stderr by default, %+v", spec.Config)
+	}
+	if _, err := ParseRunArgs([]string{"docker", "run", "--rm"}); err == nil || !strings.Contains(err.Error(), "image is required") {
+		t.Errorf("Should require the image, %v", err)
+	}
+	if _, err := ParseRunArgs([]string{"--name"}); err == nil || !strings.Contains(err.Error(), "needs an argument") {
+		t.Errorf("Should require the flag value, %v", err)
+	}
+	if _, err := ParseRunCommand(`docker run -e "A=1 busybox`); err == nil {
+		t.Errorf("Should reject the unterminated quote")
+	}
+}
@@ -0,0 +1,617 @@
+package adoc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// This part contains the parser of the spec documents, the JSON and the block style YAML subset are
+// parsed into the nodes with their lines and columns, e.g.
+//   name: web
+//   config:
+//     Image: nginx:1.19
+//     Env: [MODE=prod, "GREETING=hello world"]
+//     Cmd: |
+//       nginx -g 'daemon off;'
+// The anchors, aliases, tags, multiple documents and the multi-line plain scalars are not supported.
+
+type specNodeKind int
+
+const (
+	kSpecScalar specNodeKind = iota
+	kSpecMap
+	kSpecSeq
+)
+
+type specNode struct {
+	kind   specNodeKind
+	value  string
+	quoted bool        // the quoted and the block scalars are always the strings
+	keys   []*specNode // the keys of the map in the document order
+	items  []*specNode // the values of the map or the items of the seq
+	line   int
+	column int
+}
+
+func (n *specNode) isNull() bool {
+	return n.kind == kSpecScalar && !n.quoted && (n.value == "" || n.value == "~" || n.value == "null")
+}
+
+func (n *specNode) kindName() string {
+	switch n.kind {
+	case kSpecMap:
+		return "map"
+	case kSpecSeq:
+		return "list"
+	}
+	return "scalar"
+}
+
+// lookup returns the value of the map key, the key is case insensitive
+func (n *specNode) lookup(key string) *specNode {
+	if n.kind != kSpecMap {
+		return nil
+	}
+	for i, k := range n.keys {
+		if strings.EqualFold(k.value, key) {
+			return n.items[i]
+		}
+	}
+	return nil
+}
+
+func (n *specNode) addEntry(key *specNode, value *specNode) error {
+	for _, k := range n.keys {
+		if k.value == key.value {
+			return specErrorAt(key.line, key.column, "duplicate key %q", key.value)
+		}
+	}
+	n.keys = append(n.keys, key)
+	n.items = append(n.items, value)
+	return nil
+}
+
+func specErrorAt(line int, column int, format string, args ...interface{}) *SpecError {
+	return &SpecError{Line: line, Column: column, Err: fmt.Errorf(format, args...)}
+}
+
+// parseSpecDocument parses the JSON document if it starts with the {, or the YAML one
+func parseSpecDocument(data []byte) (*specNode, error) {
+	text := strings.TrimPrefix(string(data), "\uFEFF")
+	if !utf8.ValidString(text) {
+		return nil, specErrorAt(1, 1, "the document should be utf-8")
+	}
+	if strings.HasPrefix(strings.TrimSpace(text), "{") {
+		return parseJSONNode(text)
+	}
+	return parseYAMLNode(text)
+}
+
+func parseJSONNode(text string) (*specNode, error) {
+	p := &flowParser{text: text, line: 1, column: 1, json: true}
+	p.skipSpaces()
+	node, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.text) {
+		return nil, specErrorAt(p.line, p.column, "unexpected %q after the document", p.text[p.pos])
+	}
+	return node, nil
+}
+
+type yamlLine struct {
+	number int
+	indent int
+	text   string // without the indent, the comment and the trailing spaces, empty for the blank line
+	raw    string
+}
+
+type yamlParser struct {
+	lines []*yamlLine
+	pos   int
+	end   int // the lines after the end of the document
+}
+
+func parseYAMLNode(text string) (*specNode, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(text, "\n") {
+		raw = strings.TrimSuffix(raw, "\r")
+		line := &yamlLine{number: i + 1, raw: raw}
+		content := strings.TrimLeft(raw, " ")
+		line.indent = len(raw) - len(content)
+		line.text = strings.TrimRight(stripYAMLComment(content), " \t")
+		if strings.HasPrefix(line.text, "\t") {
+			return nil, specErrorAt(line.number, line.indent+1, "the tabs are not allowed in the indentation")
+		}
+		p.lines = append(p.lines, line)
+	}
+
+	p.end = len(p.lines)
+	if line := p.peek(); line != nil && line.indent == 0 && (line.text == "---" || strings.HasPrefix(line.text, "--- ")) {
+		if rest := strings.TrimSpace(line.text[3:]); rest != "" {
+			line.text, line.indent = rest, 4
+		} else {
+			p.pos += 1
+		}
+	}
+	if line := p.peek(); line != nil && line.indent == 0 && strings.HasPrefix(line.text, "%") {
+		return nil, specErrorAt(line.number, 1, "the yaml directives are not supported")
+	}
+	// the document ends at the ... or the next ---
+	p.end = len(p.lines)
+	for i := p.pos + 1; i < len(p.lines); i += 1 {
+		if line := p.lines[i]; line.indent == 0 && (line.text == "..." || line.text == "---" || strings.HasPrefix(line.text, "--- ")) {
+			p.end = i
+			break
+		}
+	}
+	node, err := p.parseBlock(0)
+	if err != nil {
+		return nil, err
+	}
+	if line := p.peek(); line != nil {
+		return nil, specErrorAt(line.number, line.indent+1, "bad indentation")
+	}
+	if p.end < len(p.lines) {
+		marker := p.lines[p.end]
+		p.pos, p.end = p.end+1, len(p.lines)
+		if line := p.peek(); line != nil || marker.text != "---" && marker.text != "..." {
+			if line == nil {
+				line = marker
+			}
+			return nil, specErrorAt(line.number, line.indent+1, "only one document is supported")
+		}
+	}
+	return node, nil
+}
+
+// stripYAMLComment removes the # comment which is not in the quotes
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i += 1 {
+		c := text[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i += 1
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || strings.IndexByte(" \t[{,:-", text[i-1]) >= 0):
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t'):
+			return text[:i]
+		}
+	}
+	return text
+}
+
+// peek returns the next line which is not blank
+func (p *yamlParser) peek() *yamlLine {
+	for p.pos < p.end && p.lines[p.pos].text == "" {
+		p.pos += 1
+	}
+	if p.pos < p.end {
+		return p.lines[p.pos]
+	}
+	return nil
+}
+
+func isYAMLSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// splitYAMLKey splits the key: value, the offset is where the value starts in the text
+func splitYAMLKey(text string, line int, column int) (*specNode, string, int, bool, error) {
+	if text == "" || strings.IndexByte("[{", text[0]) >= 0 {
+		return nil, "", 0, false, nil
+	}
+	key := &specNode{line: line, column: column}
+	var end int
+	if text[0] == '"' || text[0] == '\'' {
+		p := &flowParser{text: text, line: line, column: column}
+		value, err := p.parseQuoted()
+		if err != nil {
+			return nil, "", 0, false, err
+		}
+		end = p.pos
+		for end < len(text) && text[end] == ' ' {
+			end += 1
+		}
+		if end >= len(text) || text[end] != ':' {
+			return nil, "", 0, false, nil
+		}
+		key.value, key.quoted = value, true
+	} else {
+		for end = 0; end < len(text); end += 1 {
+			if text[end] == ':' && (end+1 == len(text) || text[end+1] == ' ') {
+				break
+			}
+		}
+		if end == len(text) {
+			return nil, "", 0, false, nil
+		}
+		key.value = strings.TrimRight(text[:end], " ")
+	}
+	if end+1 < len(text) && text[end+1] != ' ' {
+		return nil, "", 0, false, nil
+	}
+	offset := end + 1
+	for offset < len(text) && text[offset] == ' ' {
+		offset += 1
+	}
+	return key, text[offset:], offset, true, nil
+}
+
+// parseBlock parses the block which starts from the next line, its indent should be at least the minIndent
+func (p *yamlParser) parseBlock(minIndent int) (*specNode, error) {
+	line := p.peek()
+	if line == nil || line.indent < minIndent {
+		return &specNode{line: len(p.lines), column: 1}, nil
+	}
+	if isYAMLSeqItem(line.text) {
+		return p.parseSeq(line.indent)
+	}
+	if _, _, _, ok, err := splitYAMLKey(line.text, line.number, line.indent+1); err != nil {
+		return nil, err
+	} else if ok {
+		return p.parseMap(line.indent)
+	}
+	p.pos += 1
+	return parseYAMLInline(line.text, line.number, line.indent+1)
+}
+
+func (p *yamlParser) parseMap(indent int) (*specNode, error) {
+	first := p.peek()
+	node := &specNode{kind: kSpecMap, line: first.number, column: indent + 1}
+	for line := p.peek(); line != nil && line.indent == indent; line = p.peek() {
+		key, rest, offset, ok, err := splitYAMLKey(line.text, line.number, indent+1)
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if isYAMLSeqItem(line.text) {
+				return nil, specErrorAt(line.number, indent+1, "the list item is not expected in the map")
+			}
+			return nil, specErrorAt(line.number, indent+1, "should be the key: value")
+		}
+		p.pos += 1
+		value, err := p.parseValue(indent, rest, line.number, indent+offset+1, true)
+		if err != nil {
+			return nil, err
+		}
+		if err := node.addEntry(key, value); err != nil {
+			return nil, err
+		}
+		if next := p.peek(); next != nil && next.indent > indent {
+			return nil, specErrorAt(next.number, next.indent+1, "bad indentation, the multi-line plain scalars are not supported")
+		}
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseSeq(indent int) (*specNode, error) {
+	first := p.peek()
+	node := &specNode{kind: kSpecSeq, line: first.number, column: indent + 1}
+	for line := p.peek(); line != nil && line.indent == indent && isYAMLSeqItem(line.text); line = p.peek() {
+		rest := strings.TrimLeft(line.text[1:], " ")
+		offset := len(line.text) - len(rest)
+		var item *specNode
+		var err error
+		_, _, _, isKey, keyErr := splitYAMLKey(rest, line.number, indent+offset+1)
+		switch {
+		case keyErr != nil:
+			return nil, keyErr
+		case rest != "" && (isYAMLSeqItem(rest) || isKey):
+			// the nested block starts in the item line
+			line.indent, line.text = indent+offset, rest
+			item, err = p.parseBlock(line.indent)
+		default:
+			p.pos += 1
+			item, err = p.parseValue(indent, rest, line.number, indent+offset+1, false)
+		}
+		if err != nil {
+			return nil, err
+		}
+		node.items = append(node.items, item)
+		if next := p.peek(); next != nil && next.indent > indent {
+			return nil, specErrorAt(next.number, next.indent+1, "bad indentation, the multi-line plain scalars are not supported")
+		}
+	}
+	return node, nil
+}
+
+// parseValue parses the value after the key or the list item marker, it could be in the next lines
+func (p *yamlParser) parseValue(indent int, rest string, line int, column int, inMap bool) (*specNode, error) {
+	switch {
+	case rest == "":
+		next := p.peek()
+		if next != nil && (next.indent > indent || (inMap && next.indent == indent && isYAMLSeqItem(next.text))) {
+			if next.indent == indent {
+				return p.parseSeq(indent)
+			}
+			return p.parseBlock(indent + 1)
+		}
+		return &specNode{line: line, column: column}, nil
+	case rest[0] == '|' || rest[0] == '>':
+		return p.parseBlockScalar(indent, rest, line, column)
+	}
+	return parseYAMLInline(rest, line, column)
+}
+
+// parseBlockScalar parses the literal | or the folded > scalar with the optional chomping - or +
+func (p *yamlParser) parseBlockScalar(indent int, header string, line int, column int) (*specNode, error) {
+	chomping := header[1:]
+	if chomping != "" && chomping != "-" && chomping != "+" {
+		return nil, specErrorAt(line, column, "unsupported block scalar header %q", header)
+	}
+	var lines []string
+	blockIndent := -1
+	for p.pos < p.end {
+		l := p.lines[p.pos]
+		content := strings.TrimLeft(l.raw, " ")
+		if content != "" {
+			if l.indent <= indent || (blockIndent >= 0 && l.indent < blockIndent) {
+				break
+			}
+			if blockIndent < 0 {
+				blockIndent = l.indent
+			}
+			lines = append(lines, l.raw[blockIndent:])
+		} else {
+			lines = append(lines, "")
+		}
+		p.pos += 1
+	}
+	// the trailing blank lines are only kept by the + chomping
+	trailing := 0
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+		trailing += 1
+	}
+	var value string
+	if header[0] == '|' {
+		value = strings.Join(lines, "\n")
+	} else {
+		var b strings.Builder
+		for i, l := range lines {
+			switch {
+			case i == 0:
+			case l == "" || lines[i-1] == "":
+				b.WriteString("\n")
+			case strings.HasPrefix(l, " ") || strings.HasPrefix(lines[i-1], " "):
+				// the more indented lines are not folded
+				b.WriteString("\n")
+			default:
+				b.WriteString(" ")
+			}
+			b.WriteString(l)
+		}
+		value = b.String()
+	}
+	switch {
+	case len(lines) == 0:
+	case chomping == "":
+		value += "\n"
+	case chomping == "+":
+		value += strings.Repeat("\n", trailing+1)
+	}
+	return &specNode{value: value, quoted: true, line: line, column: column}, nil
+}
+
+// parseYAMLInline parses the scalar or the flow collection in one line
+func parseYAMLInline(text string, line int, column int) (*specNode, error) {
+	switch text[0] {
+	case '[', '{', '"', '\'':
+		p := &flowParser{text: text, line: line, column: column}
+		node, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos < len(p.text) {
+			return nil, specErrorAt(p.line, p.column, "unexpected %q after the value", p.text[p.pos:])
+		}
+		return node, nil
+	case '&', '*', '!':
+		return nil, specErrorAt(line, column, "the anchors, aliases and tags are not supported")
+	case '@', '`':
+		return nil, specErrorAt(line, column, "the plain scalar should not start with %q", text[0])
+	}
+	if strings.Contains(text, ": ") {
+		return nil, specErrorAt(line, column, "the nested map should be in the next lines, or quote the value")
+	}
+	return &specNode{value: text, line: line, column: column}, nil
+}
+
+// flowParser parses the JSON values and the YAML flow collections, which are like the JSON
+// but the strings could be plain or single quoted
+type flowParser struct {
+	text   string
+	pos    int
+	line   int
+	column int
+	json   bool
+}
+
+func (p *flowParser) advance(n int) {
+	for i := 0; i < n && p.pos < len(p.text); i += 1 {
+		if p.text[p.pos] == '\n' {
+			p.line, p.column = p.line+1, 1
+		} else if p.text[p.pos] < 0x80 || p.text[p.pos] >= 0xC0 {
+			p.column += 1
+		}
+		p.pos += 1
+	}
+}
+
+func (p *flowParser) skipSpaces() {
+	for p.pos < len(p.text) && strings.IndexByte(" \t\r\n", p.text[p.pos]) >= 0 {
+		p.advance(1)
+	}
+}
+
+func (p *flowParser) parseValue() (*specNode, error) {
+	if p.pos >= len(p.text) {
+		return nil, specErrorAt(p.line, p.column, "unexpected end of the value")
+	}
+	switch p.text[p.pos] {
+	case '[':
+		return p.parseCollection(']')
+	case '{':
+		return p.parseCollection('}')
+	case '"', '\'':
+		node := &specNode{quoted: true, line: p.line, column: p.column}
+		value, err := p.parseQuoted()
+		node.value = value
+		return node, err
+	}
+	return p.parsePlain()
+}
+
+func (p *flowParser) parseCollection(end byte) (*specNode, error) {
+	node := &specNode{kind: kSpecSeq, line: p.line, column: p.column}
+	if end == '}' {
+		node.kind = kSpecMap
+	}
+	p.advance(1)
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.text) {
+			return nil, specErrorAt(p.line, p.column, "the %s is not closed by %q", node.kindName(), end)
+		}
+		if p.text[p.pos] == end {
+			p.advance(1)
+			return node, nil
+		}
+		if node.kind == kSpecMap {
+			key, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if key.kind != kSpecScalar || (p.json && !key.quoted) {
+				return nil, specErrorAt(key.line, key.column, "the key should be a string")
+			}
+			p.skipSpaces()
+			if p.pos >= len(p.text) || p.text[p.pos] != ':' {
+				return nil, specErrorAt(p.line, p.column, "should be the key: value")
+			}
+			p.advance(1)
+			p.skipSpaces()
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			if err := node.addEntry(key, value); err != nil {
+				return nil, err
+			}
+		} else {
+			item, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			node.items = append(node.items, item)
+		}
+		p.skipSpaces()
+		if p.pos < len(p.text) && p.text[p.pos] == ',' {
+			p.advance(1)
+			if p.json {
+				// no trailing comma in the json
+				p.skipSpaces()
+				if p.pos < len(p.text) && p.text[p.pos] == end {
+					return nil, specErrorAt(p.line, p.column, "unexpected %q", end)
+				}
+			}
+		} else if p.pos < len(p.text) && p.text[p.pos] != end {
+			return nil, specErrorAt(p.line, p.column, "should be , or %q", end)
+		}
+	}
+}
+
+func (p *flowParser) parsePlain() (*specNode, error) {
+	node := &specNode{line: p.line, column: p.column}
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if strings.IndexByte(",[]{}\n", c) >= 0 || (c == ':' && (p.pos+1 == len(p.text) || strings.IndexByte(" \t\r\n,", p.text[p.pos+1]) >= 0)) {
+			break
+		}
+		p.advance(1)
+	}
+	node.value = strings.TrimRight(p.text[start:p.pos], " \t\r")
+	if node.value == "" {
+		return nil, specErrorAt(node.line, node.column, "unexpected %q", p.text[p.pos:p.pos+1])
+	}
+	if p.json {
+		if _, err := strconv.ParseFloat(node.value, 64); err != nil && node.value != "true" && node.value != "false" && node.value != "null" {
+			return nil, specErrorAt(node.line, node.column, "invalid json value %q", node.value)
+		}
+	}
+	return node, nil
+}
+
+// parseQuoted parses the double quoted string with the escapes, or the single quoted one with the escaped quote
+func (p *flowParser) parseQuoted() (string, error) {
+	line, column := p.line, p.column
+	quote := p.text[p.pos]
+	if p.json && quote == '\'' {
+		return "", specErrorAt(line, column, "the json string should be double quoted")
+	}
+	p.advance(1)
+	var b strings.Builder
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		switch {
+		case c == quote && quote == '\'' && p.pos+1 < len(p.text) && p.text[p.pos+1] == '\'':
+			b.WriteByte('\'')
+			p.advance(2)
+		case c == quote:
+			p.advance(1)
+			return b.String(), nil
+		case c == '\\' && quote == '"':
+			if p.pos+1 >= len(p.text) {
+				return "", specErrorAt(p.line, p.column, "unexpected end of the escape")
+			}
+			escape := p.text[p.pos+1]
+			switch escape {
+			case 'n':
+				b.WriteByte('\n')
+			case 't':
+				b.WriteByte('\t')
+			case 'r':
+				b.WriteByte('\r')
+			case 'b':
+				b.WriteByte('\b')
+			case 'f':
+				b.WriteByte('\f')
+			case '0':
+				b.WriteByte(0)
+			case '"', '\\', '/':
+				b.WriteByte(escape)
+			case 'u':
+				if p.pos+6 > len(p.text) {
+					return "", specErrorAt(p.line, p.column, "invalid unicode escape")
+				}
+				r, err := strconv.ParseUint(p.text[p.pos+2:p.pos+6], 16, 32)
+				if err != nil {
+					return "", specErrorAt(p.line, p.column, "invalid unicode escape %q", p.text[p.pos:p.pos+6])
+				}
+				b.WriteRune(rune(r))
+				p.advance(4)
+			default:
+				return "", specErrorAt(p.line, p.column, "invalid escape \\%c", escape)
+			}
+			p.advance(2)
+		case c == '\n' && p.json:
+			return "", specErrorAt(p.line, p.column, "the json string should not have the new line")
+		default:
+			b.WriteByte(c)
+			p.advance(1)
+		}
+	}
+	return "", specErrorAt(line, column, "the string is not closed by %c", quote)
+}
@@ -0,0 +1,282 @@
+package adoc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+)
+
+// This part contains the ssh transport for the remote daemons, the daemon url looks like
+//   ssh://user@host:port
+//   ssh://user@host:port/var/run/docker.sock?identity=/path/to/key&known_hosts=/path/to/known_hosts
+// Every connection is a child process of the system ssh client, so the key, agent auth and
+// known_hosts verification all follow the openssh behaviours and the ~/.ssh/config.
+// Without a path, the remote end runs `docker system dial-stdio`; with a path, a direct
+// streamlocal channel is forwarded to the remote unix socket (ssh -W).
+
+// sshCommand is the ssh client binary to run, tests will replace it
+var sshCommand = "ssh"
+
+type sshConfig struct {
+	Host       string
+	Port       string
+	User       string
+	SocketPath string
+	Identity   string
+	KnownHosts string
+}
+
+func parseSSHConfig(u *url.URL) (sshConfig, error) {
+	var config sshConfig
+	if u.Hostname() == "" {
+		return config, fmt.Errorf("No host found in the ssh daemon url %q", u.String())
+	}
+	config.Host = u.Hostname()
+	config.Port = u.Port()
+	if u.User != nil {
+		config.User = u.User.Username()
+		if _, ok := u.User.Password(); ok {
+			return config, fmt.Errorf("Password is not supported in the ssh daemon url, please use key or agent auth")
+		}
+	}
+	if u.Path != "" && u.Path != "/" {
+		config.SocketPath = u.Path
+	}
+	query := u.Query()
+	config.Identity = query.Get("identity")
+	config.KnownHosts = query.Get("known_hosts")
+	return config, nil
+}
+
+func (config sshConfig) args(timeout time.Duration) []string {
+	args := []string{"-o", "BatchMode=yes", "-o", "StrictHostKeyChecking=yes"}
+	if timeout > 0 {
+		secs := int(timeout / time.Second)
+		if secs < 1 {
+			secs = 1
+		}
+		args = append(args, "-o", fmt.Sprintf("ConnectTimeout=%d", secs))
+	}
+	if config.KnownHosts != "" {
+		args = append(args, "-o", "UserKnownHostsFile="+config.KnownHosts)
+	}
+	if config.Identity != "" {
+		args = append(args, "-i", config.Identity)
+	}
+	if config.User != "" {
+		args = append(args, "-l", config.User)
+	}
+	if config.Port != "" {
+		args = append(args, "-p", config.Port)
+	}
+	if config.SocketPath != "" {
+		return append(args, "-W", config.SocketPath, "--", config.Host)
+	}
+	return append(args, "--", config.Host, "docker", "system", "dial-stdio")
+}
+
+func dialSSH(ctx context.Context, config sshConfig, timeout time.Duration) (net.Conn, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(sshCommand, config.args(timeout)...)
+	conn := &sshConn{
+		cmd:         cmd,
+		remoteAddr:  sshAddr(config.Host),
+		established: make(chan struct{}),
+	}
+	var err error
+	if conn.stdin, err = cmd.StdinPipe(); err != nil {
+		return nil, err
+	}
+	if conn.stdout, err = cmd.StdoutPipe(); err != nil {
+		return nil, err
+	}
+	cmd.Stderr = &conn.stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("Cannot start the ssh client %q, %s", sshCommand, err)
+	}
+	// the handshake happens on the first round trip, so the dial context still governs the
+	// process until the first byte arrives, the pooled conn outlives the context after that
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.lock.Lock()
+			conn.dialErr = ctx.Err()
+			conn.lock.Unlock()
+			conn.Close()
+		case <-conn.established:
+		}
+	}()
+	return conn, nil
+}
+
+type sshAddr string
+
+func (a sshAddr) Network() string { return "ssh" }
+func (a sshAddr) String() string  { return string(a) }
+
+// sshConn wraps the stdin/stdout of the ssh process as a net.Conn, it is full duplex
+// so the longpoll monitors and the hijacked streams are working just as unix sockets.
+type sshConn struct {
+	cmd        *exec.Cmd
+	stdin      io.WriteCloser
+	stdout     io.ReadCloser
+	stderr     lockedBuffer
+	remoteAddr net.Addr
+
+	closeOnce       sync.Once
+	waitOnce        sync.Once
+	establishedOnce sync.Once
+	established     chan struct{}
+	gotData         bool
+
+	lock       sync.Mutex
+	readTimer  *time.Timer
+	writeTimer *time.Timer
+	dialErr    error
+}
+
+func (c *sshConn) Read(b []byte) (int, error) {
+	n, err := c.stdout.Read(b)
+	if n > 0 && !c.gotData {
+		c.gotData = true
+		c.establish()
+	}
+	if err == nil || errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, err
+	}
+	if dialErr := c.getDialErr(); dialErr != nil {
+		return n, dialErr
+	}
+	if err == io.EOF && !c.gotData {
+		return n, c.exitError(err)
+	}
+	return n, err
+}
+
+func (c *sshConn) Write(b []byte) (int, error) {
+	n, err := c.stdin.Write(b)
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return n, err
+	}
+	if err != nil {
+		if dialErr := c.getDialErr(); dialErr != nil {
+			return n, dialErr
+		}
+		return n, c.exitError(err)
+	}
+	return n, nil
+}
+
+// establish stops the dial context from killing the ssh process
+func (c *sshConn) establish() {
+	c.establishedOnce.Do(func() { close(c.established) })
+}
+
+// getDialErr returns the error of the dial context if the conn is closed by it
+func (c *sshConn) getDialErr() error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.dialErr
+}
+
+// exitError returns the reason inside the stderr when the ssh client quits, e.g. the host key
+// verification failed, it waits for the process so the stderr is fully copied
+func (c *sshConn) exitError(err error) error {
+	c.wait()
+	if msg := strings.TrimSpace(c.stderr.String()); msg != "" {
+		return fmt.Errorf("ssh: %s", msg)
+	}
+	return err
+}
+
+func (c *sshConn) Close() error {
+	c.closeOnce.Do(func() {
+		c.establish()
+		c.closeAt(&c.readTimer, time.Time{})
+		c.closeAt(&c.writeTimer, time.Time{})
+		c.stdin.Close()
+		if c.cmd.Process != nil {
+			c.cmd.Process.Kill()
+		}
+		c.wait()
+	})
+	return nil
+}
+
+func (c *sshConn) wait() {
+	c.waitOnce.Do(func() { c.cmd.Wait() })
+}
+
+func (c *sshConn) LocalAddr() net.Addr  { return sshAddr("localhost") }
+func (c *sshConn) RemoteAddr() net.Addr { return c.remoteAddr }
+
+func (c *sshConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// SetReadDeadline sets the deadline on the stdout pipe of the ssh process, if the pipe doesn't
+// support the deadlines on the platform, the conn is closed when the deadline is passed instead
+func (c *sshConn) SetReadDeadline(t time.Time) error {
+	if pipe, ok := c.stdout.(interface{ SetReadDeadline(time.Time) error }); ok {
+		if err := pipe.SetReadDeadline(t); err == nil {
+			return nil
+		}
+	}
+	c.closeAt(&c.readTimer, t)
+	return nil
+}
+
+// SetWriteDeadline is like SetReadDeadline for the stdin pipe
+func (c *sshConn) SetWriteDeadline(t time.Time) error {
+	if pipe, ok := c.stdin.(interface{ SetWriteDeadline(time.Time) error }); ok {
+		if err := pipe.SetWriteDeadline(t); err == nil {
+			return nil
+		}
+	}
+	c.closeAt(&c.writeTimer, t)
+	return nil
+}
+
+// closeAt resets the timer to close the conn at the time, the zero time stops the timer
+func (c *sshConn) closeAt(timer **time.Timer, t time.Time) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if *timer != nil {
+		(*timer).Stop()
+		*timer = nil
+	}
+	if !t.IsZero() {
+		*timer = time.AfterFunc(time.Until(t), func() { c.Close() })
+	}
+}
+
+type lockedBuffer struct {
+	lock sync.Mutex
+	buf  bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	return b.buf.String()
+}
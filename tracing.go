@@ -0,0 +1,157 @@
+package adoc
+
+import (
+	"context"
+	"strings"
+)
+
+// This part contains the optional tracing of the api calls. Each call produces a span named after
+// the operation, e.g. docker.containers.create, docker.images.pull. The Tracer and Span are shaped
+// after the OpenTelemetry ones, so an adapter over go.opentelemetry.io/otel/trace is a few lines,
+// and the context returned by Tracer.Start is carried by the requests through the middlewares.
+
+const (
+	kTraceApiVersion  = "docker.api_version"
+	kTraceContainerId = "docker.container.id"
+	kTraceImageName   = "docker.image.name"
+	kTraceExecId      = "docker.exec.id"
+	kTraceNetwork     = "docker.network.name"
+	kTraceVolume      = "docker.volume.name"
+	kTraceSwarmNode   = "docker.swarm.node"
+	kTraceMethod      = "http.method"
+	kTraceStatusCode  = "http.status_code"
+)
+
+// Tracer starts the span for an api call, the returned context carries the span
+type Tracer interface {
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span is one traced api call
+type Span interface {
+	SetAttribute(key string, value interface{})
+	AddEvent(name string, attributes map[string]interface{})
+	RecordError(err error)
+	End()
+}
+
+// WithTracer turns on the tracing of the api calls
+func WithTracer(tracer Tracer) ClientOption {
+	return func(options *clientOptions) {
+		options.tracer = tracer
+	}
+}
+
+type spanContextKey struct{}
+
+// SpanFromContext returns the span of the api call from the request context, e.g. inside a
+// middleware, or a no-op span when the tracing is off
+func SpanFromContext(ctx context.Context) Span {
+	if span, ok := ctx.Value(spanContextKey{}).(Span); ok {
+		return span
+	}
+	return noopSpan{}
+}
+
+type noopSpan struct{}
+
+func (noopSpan) SetAttribute(key string, value interface{})              {}
+func (noopSpan) AddEvent(name string, attributes map[string]interface{}) {}
+func (noopSpan) RecordError(err error)                                   {}
+func (noopSpan) End()                                                    {}
+
+func (client *DockerClient) startSpan(ctx context.Context, method string, path string) (context.Context, Span) {
+	name, attributes := traceOperation(method, path)
+	ctx, span := client.tracer.Start(ctx, name)
+	span.SetAttribute(kTraceMethod, method)
+	span.SetAttribute(kTraceApiVersion, client.apiVersion)
+	for key, value := range attributes {
+		span.SetAttribute(key, value)
+	}
+	return context.WithValue(ctx, spanContextKey{}, span), span
+}
+
+// traceOperation names the span by the api path, e.g.
+//
+//	POST containers/create        => docker.containers.create
+//	GET  containers/(id)/json     => docker.containers.inspect
+//	DELETE images/(name)          => docker.images.remove
+func traceOperation(method string, path string) (string, map[string]string) {
+	if i := strings.Index(path, "?"); i >= 0 {
+		path = path[:i]
+	}
+	attributes := make(map[string]string)
+	segs := strings.Split(strings.Trim(path, "/"), "/")
+	switch segs[0] {
+	case "containers":
+		switch {
+		case len(segs) == 2 && segs[1] == "json":
+			return "docker.containers.list", attributes
+		case len(segs) == 2 && segs[1] == "create":
+			return "docker.containers.create", attributes
+		case len(segs) == 2 && method == "DELETE":
+			attributes[kTraceContainerId] = segs[1]
+			return "docker.containers.remove", attributes
+		case len(segs) >= 3:
+			attributes[kTraceContainerId] = segs[1]
+			if segs[2] == "json" {
+				return "docker.containers.inspect", attributes
+			}
+			return "docker.containers." + segs[2], attributes
+		}
+	case "images":
+		switch {
+		case len(segs) == 2 && segs[1] == "json":
+			return "docker.images.list", attributes
+		case len(segs) == 2 && segs[1] == "create":
+			return "docker.images.pull", attributes
+		case len(segs) == 2 && segs[1] == "search":
+			return "docker.images.search", attributes
+		case len(segs) >= 2 && method == "DELETE":
+			attributes[kTraceImageName] = strings.Join(segs[1:], "/")
+			return "docker.images.remove", attributes
+		case len(segs) >= 3:
+			action := segs[len(segs)-1]
+			attributes[kTraceImageName] = strings.Join(segs[1:len(segs)-1], "/")
+			if action == "json" {
+				return "docker.images.inspect", attributes
+			}
+			return "docker.images." + action, attributes
+		}
+	case "exec":
+		if len(segs) >= 3 {
+			attributes[kTraceExecId] = segs[1]
+			return "docker.exec." + segs[2], attributes
+		}
+	case "networks", "volumes":
+		key := kTraceNetwork
+		if segs[0] == "volumes" {
+			key = kTraceVolume
+		}
+		switch {
+		case len(segs) == 1:
+			return "docker." + segs[0] + ".list", attributes
+		case len(segs) == 2 && (segs[1] == "create" || segs[1] == "prune"):
+			return "docker." + segs[0] + "." + segs[1], attributes
+		case len(segs) == 2:
+			attributes[key] = segs[1]
+			if method == "DELETE" {
+				return "docker." + segs[0] + ".remove", attributes
+			}
+			return "docker." + segs[0] + ".inspect", attributes
+		case len(segs) >= 3:
+			attributes[key] = segs[1]
+			return "docker." + segs[0] + "." + segs[2], attributes
+		}
+	case "distribution":
+		if len(segs) >= 3 {
+			attributes[kTraceImageName] = strings.Join(segs[1:len(segs)-1], "/")
+			return "docker.distribution.inspect", attributes
+		}
+	case "_ping":
+		return "docker.system.ping", attributes
+	case "version", "info", "events":
+		return "docker.system." + segs[0], attributes
+	}
+	return "docker." + strings.Join(segs, "."), attributes
+}
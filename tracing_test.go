@@ -0,0 +1,127 @@
+package adoc
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type recordedSpan struct {
+	name       string
+	attributes map[string]interface{}
+	events     []string
+	err        error
+	ended      bool
+}
+
+func (s *recordedSpan) SetAttribute(key string, value interface{}) { s.attributes[key] = value }
+func (s *recordedSpan) AddEvent(name string, attributes map[string]interface{}) {
+	s.events = append(s.events, name)
+}
+func (s *recordedSpan) RecordError(err error) { s.err = err }
+func (s *recordedSpan) End()                  { s.ended = true }
+
+// memoryTracer records all the spans in memory
+type memoryTracer struct {
+	lock  sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *memoryTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	span := &recordedSpan{name: spanName, attributes: make(map[string]interface{})}
+	t.spans = append(t.spans, span)
+	return ctx, span
+}
+
+func TestTracingSpans(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1.18/containers/create":
+			fmt.Fprint(w, `{"Id":"c0"}`)
+		case "/v1.18/containers/c0/json":
+			fmt.Fprint(w, `{"Id":"c0","Node":{"Name":"node-1"}}`)
+		case "/v1.18/images/create":
+			fmt.Fprintln(w, `{"status":"Pulling fs layer","id":"l1"}`)
+			fmt.Fprintln(w, `{"status":"Downloading","id":"l1","progress":"[==>  ]"}`)
+			fmt.Fprintln(w, `{"status":"Pull complete","id":"l1"}`)
+		default:
+			http.Error(w, "no such image", 404)
+		}
+	}))
+	defer server.Close()
+
+	tracer := &memoryTracer{}
+	var traced bool
+	client, _ := NewClient(server.URL, WithAPIVersion("1.18"), WithTracer(tracer), WithMiddleware(
+		func(next http.RoundTripper) http.RoundTripper {
+			return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+				_, traced = SpanFromContext(req.Context()).(*recordedSpan)
+				return next.RoundTrip(req)
+			})
+		}))
+	if _, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{}, NetworkingConfig{}); err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	if !traced {
+		t.Errorf("The span should be carried through the middlewares")
+	}
+	if _, err := client.InspectContainer("c0"); err != nil {
+		t.Fatalf("Cannot inspect the container, %s", err)
+	}
+	if err := client.PullImage("busybox", "latest"); err != nil {
+		t.Fatalf("Cannot pull the image, %s", err)
+	}
+	if _, err := client.InspectImage("missing"); err == nil {
+		t.Fatalf("Inspect should fail")
+	}
+
+	if len(tracer.spans) != 4 {
+		t.Fatalf("Should have 4 spans, got %d", len(tracer.spans))
+	}
+	create, inspect, pull, missing := tracer.spans[0], tracer.spans[1], tracer.spans[2], tracer.spans[3]
+	if create.name != "docker.containers.create" || create.attributes[kTraceContainerId] != "c0" ||
+		create.attributes[kTraceImageName] != "busybox" || create.attributes[kTraceApiVersion] != "v1.18" ||
+		create.attributes[kTraceStatusCode] != 200 || !create.ended {
+		t.Errorf("Wrong create span, %+v", create)
+	}
+	if inspect.name != "docker.containers.inspect" || inspect.attributes[kTraceSwarmNode] != "node-1" {
+		t.Errorf("Wrong inspect span, %+v", inspect)
+	}
+	if pull.name != "docker.images.pull" || len(pull.events) != 2 || pull.events[1] != "Pull complete" {
+		t.Errorf("Wrong pull span, %+v", pull)
+	}
+	if missing.name != "docker.images.inspect" || missing.attributes[kTraceImageName] != "missing" ||
+		missing.attributes[kTraceStatusCode] != 404 || missing.err == nil {
+		t.Errorf("Wrong failed span, %+v", missing)
+	}
+}
+
+func TestTraceOperation(t *testing.T) {
+	cases := []struct {
+		method, path, name string
+	}{
+		{"GET", "containers/json?all=1", "docker.containers.list"},
+		{"DELETE", "containers/c0?force=1", "docker.containers.remove"},
+		{"POST", "containers/c0/wait", "docker.containers.wait"},
+		{"POST", "images/library/busybox/tag?repo=x", "docker.images.tag"},
+		{"DELETE", "images/library/busybox", "docker.images.remove"},
+		{"POST", "exec/e0/start", "docker.exec.start"},
+		{"GET", "networks?filters=x", "docker.networks.list"},
+		{"POST", "networks/create", "docker.networks.create"},
+		{"POST", "networks/backend/connect", "docker.networks.connect"},
+		{"DELETE", "networks/backend", "docker.networks.remove"},
+		{"GET", "volumes/data", "docker.volumes.inspect"},
+		{"POST", "volumes/prune", "docker.volumes.prune"},
+		{"GET", "_ping", "docker.system.ping"},
+	}
+	for _, c := range cases {
+		if name, _ := traceOperation(c.method, c.path); name != c.name {
+			t.Errorf("Wrong operation for %s %s, need=%s, got=%s", c.method, c.path, c.name, name)
+		}
+	}
+}
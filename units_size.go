@@ -93,7 +93,6 @@ func RAMInBytes(size string) (int64, error) {
 // Parses the human-readable size string into the amount it represents
 func parseSize(sizeStr string, uMap unitMap) (int64, error) {
 	matches := sizeRegex.FindStringSubmatch(sizeStr)
-	fmt.Println(matches)
 	if len(matches) != 3 {
 		return -1, fmt.Errorf("invalid size: '%s'", sizeStr)
 	}
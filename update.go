@@ -0,0 +1,222 @@
+package adoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// This part contains the live update of the container resources, e.g.
+//   detail, _ := docker.InspectContainer(id)
+//   if update, changed := DiffUpdateConfig(detail.HostConfig, Resources{Memory: 512 * MiB, CPUShares: 512}); changed {
+//       warnings, err := docker.UpdateContainer(id, update)
+//   }
+// The zero values are not sent to the daemon, set the PidsLimit to -1 for unlimited.
+
+const (
+	kUpdateApiVersion        = "v1.22"
+	kUpdateRestartApiVersion = "v1.23"
+	kNanoCPUsApiVersion      = "v1.25"
+	kMinMemoryLimit          = 6 * 1024 * 1024 // the minimum memory limit allowed by the daemon
+	kMinCPUPeriod            = 1000
+	kMaxCPUPeriod            = 1000000
+)
+
+var kRestartPolicies = []string{"", "no", "always", "unless-stopped", "on-failure"}
+
+// UpdateConfig holds the resources and the restart policy which could be updated on a running container
+type UpdateConfig struct {
+	Resources
+	RestartPolicy RestartPolicy
+}
+
+// Validate checks the update against the api version, the resources which cannot be changed
+// on a live container are rejected instead of being silently ignored by the daemon.
+func (config UpdateConfig) Validate(apiVersion string) error {
+	if compareApiVersion(apiVersion, kUpdateApiVersion) < 0 {
+		return fmt.Errorf("Container update is not supported by api %s, need %s", apiVersion, kUpdateApiVersion)
+	}
+	r := config.Resources
+	var fixed []string
+	if r.CgroupParent != "" {
+		fixed = append(fixed, "CgroupParent")
+	}
+	if len(r.BlkioWeightDevice) > 0 || len(r.BlkioDeviceReadBps) > 0 || len(r.BlkioDeviceWriteBps) > 0 ||
+		len(r.BlkioDeviceReadIOps) > 0 || len(r.BlkioDeviceWriteIOps) > 0 {
+		fixed = append(fixed, "BlkioDevice")
+	}
+	if len(r.Devices) > 0 {
+		fixed = append(fixed, "Devices")
+	}
+	if r.DiskQuota != 0 {
+		fixed = append(fixed, "DiskQuota")
+	}
+	if r.MemorySwappiness != nil {
+		fixed = append(fixed, "MemorySwappiness")
+	}
+	if r.OomKillDisable != nil {
+		fixed = append(fixed, "OomKillDisable")
+	}
+	if len(r.Ulimits) > 0 {
+		fixed = append(fixed, "Ulimits")
+	}
+	if r.CPUCount != 0 || r.CPUPercent != 0 || r.IOMaximumIOps != 0 || r.IOMaximumBandwidth != 0 {
+		fixed = append(fixed, "Windows resources")
+	}
+	if len(fixed) > 0 {
+		return fmt.Errorf("Cannot update %s on a live container", strings.Join(fixed, ", "))
+	}
+
+	if r.Memory < 0 || r.MemoryReservation < 0 || r.KernelMemory < 0 || r.CPUShares < 0 || r.NanoCPUs < 0 || r.PidsLimit < -1 {
+		return fmt.Errorf("Invalid negative resources, %+v", r)
+	}
+	if r.Memory > 0 && r.Memory < kMinMemoryLimit {
+		return fmt.Errorf("Minimum memory limit allowed is 6MB, got %d", r.Memory)
+	}
+	if r.Memory > 0 && r.MemorySwap > 0 && r.MemorySwap < r.Memory {
+		return fmt.Errorf("Minimum memoryswap limit should be larger than memory limit, got %d < %d", r.MemorySwap, r.Memory)
+	}
+	if r.Memory > 0 && r.MemoryReservation > r.Memory {
+		return fmt.Errorf("Minimum memory limit should be larger than memory reservation limit, got %d < %d", r.Memory, r.MemoryReservation)
+	}
+	if r.CPUPeriod != 0 && (r.CPUPeriod < kMinCPUPeriod || r.CPUPeriod > kMaxCPUPeriod) {
+		return fmt.Errorf("CPU cfs period should be between 1ms and 1s, got %d", r.CPUPeriod)
+	}
+	if r.CPUQuota != 0 && r.CPUQuota < kMinCPUPeriod && r.CPUQuota != -1 {
+		return fmt.Errorf("CPU cfs quota should not be less than 1ms, got %d", r.CPUQuota)
+	}
+	if r.NanoCPUs > 0 {
+		if compareApiVersion(apiVersion, kNanoCPUsApiVersion) < 0 {
+			return fmt.Errorf("NanoCPUs is not supported by api %s, need %s", apiVersion, kNanoCPUsApiVersion)
+		}
+		if r.CPUQuota > 0 || r.CPUPeriod > 0 {
+			return fmt.Errorf("Conflicting options: NanoCPUs and CPUPeriod/CPUQuota cannot both be set")
+		}
+	}
+
+	policy := config.RestartPolicy
+	if policy.Name != "" || policy.MaximumRetryCount != 0 {
+		if compareApiVersion(apiVersion, kUpdateRestartApiVersion) < 0 {
+			return fmt.Errorf("Restart policy update is not supported by api %s, need %s", apiVersion, kUpdateRestartApiVersion)
+		}
+		if !containsString(kRestartPolicies, policy.Name) {
+			return fmt.Errorf("Invalid restart policy %q", policy.Name)
+		}
+		if policy.MaximumRetryCount < 0 || (policy.MaximumRetryCount > 0 && policy.Name != "on-failure") {
+			return fmt.Errorf("Maximum retry count %d is only valid for the on-failure restart policy", policy.MaximumRetryCount)
+		}
+	}
+	return nil
+}
+
+// UpdateContainer updates the resources and the restart policy of the container, returns the warnings from the daemon
+func (client *DockerClient) UpdateContainer(id string, config UpdateConfig) ([]string, error) {
+	if err := config.Validate(client.apiVersion); err != nil {
+		return nil, err
+	}
+	body, err := json.Marshal(newUpdateBody(config))
+	if err != nil {
+		return nil, err
+	}
+	uri := fmt.Sprintf("containers/%s/update", id)
+	data, err := client.sendRequest("POST", uri, body, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret struct {
+		Warnings []string
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &ret); err != nil {
+			return nil, err
+		}
+	}
+	for _, warning := range ret.Warnings {
+		client.logger.Warn("Container update warning", "container", id, "warning", warning)
+	}
+	return ret.Warnings, nil
+}
+
+// updateBody is the request body of the update, only the fields set by the caller are sent, since
+// the zero values of some fields like the PidsLimit mean unlimited for the daemon.
+type updateBody struct {
+	CPUShares         int64          `json:"CpuShares,omitempty"`
+	Memory            int64          `json:",omitempty"`
+	NanoCPUs          int64          `json:"NanoCpus,omitempty"`
+	BlkioWeight       uint16         `json:",omitempty"`
+	CPUPeriod         int64          `json:"CpuPeriod,omitempty"`
+	CPUQuota          int64          `json:"CpuQuota,omitempty"`
+	CpusetCpus        string         `json:",omitempty"`
+	CpusetMems        string         `json:",omitempty"`
+	KernelMemory      int64          `json:",omitempty"`
+	MemoryReservation int64          `json:",omitempty"`
+	MemorySwap        int64          `json:",omitempty"`
+	PidsLimit         *int64         `json:",omitempty"`
+	RestartPolicy     *RestartPolicy `json:",omitempty"`
+}
+
+func newUpdateBody(config UpdateConfig) updateBody {
+	r := config.Resources
+	body := updateBody{
+		CPUShares:         r.CPUShares,
+		Memory:            r.Memory,
+		NanoCPUs:          r.NanoCPUs,
+		BlkioWeight:       r.BlkioWeight,
+		CPUPeriod:         r.CPUPeriod,
+		CPUQuota:          r.CPUQuota,
+		CpusetCpus:        r.CpusetCpus,
+		CpusetMems:        r.CpusetMems,
+		KernelMemory:      r.KernelMemory,
+		MemoryReservation: r.MemoryReservation,
+		MemorySwap:        r.MemorySwap,
+	}
+	if r.PidsLimit != 0 {
+		pidsLimit := r.PidsLimit
+		body.PidsLimit = &pidsLimit
+	}
+	if policy := config.RestartPolicy; policy.Name != "" || policy.MaximumRetryCount != 0 {
+		body.RestartPolicy = &policy
+	}
+	return body
+}
+
+// DiffUpdateConfig derives the update from the current host config to the desired resources, only the
+// changed updatable resources are set, the zero values in the desired resources mean keeping the current.
+// When the memory limit is raised over the current memoryswap limit, the memoryswap is raised to keep the
+// same size of swap, otherwise the daemon rejects the update.
+func DiffUpdateConfig(current HostConfig, desired Resources) (UpdateConfig, bool) {
+	var update UpdateConfig
+	changed := false
+	diff := func(target *int64, current int64, desired int64) {
+		if desired != 0 && desired != current {
+			*target = desired
+			changed = true
+		}
+	}
+	cur := current.Resources
+	diff(&update.CPUShares, cur.CPUShares, desired.CPUShares)
+	diff(&update.Memory, cur.Memory, desired.Memory)
+	diff(&update.NanoCPUs, cur.NanoCPUs, desired.NanoCPUs)
+	diff(&update.CPUPeriod, cur.CPUPeriod, desired.CPUPeriod)
+	diff(&update.CPUQuota, cur.CPUQuota, desired.CPUQuota)
+	diff(&update.KernelMemory, cur.KernelMemory, desired.KernelMemory)
+	diff(&update.MemoryReservation, cur.MemoryReservation, desired.MemoryReservation)
+	diff(&update.MemorySwap, cur.MemorySwap, desired.MemorySwap)
+	diff(&update.PidsLimit, cur.PidsLimit, desired.PidsLimit)
+	if desired.BlkioWeight != 0 && desired.BlkioWeight != cur.BlkioWeight {
+		update.BlkioWeight = desired.BlkioWeight
+		changed = true
+	}
+	if desired.CpusetCpus != "" && desired.CpusetCpus != cur.CpusetCpus {
+		update.CpusetCpus = desired.CpusetCpus
+		changed = true
+	}
+	if desired.CpusetMems != "" && desired.CpusetMems != cur.CpusetMems {
+		update.CpusetMems = desired.CpusetMems
+		changed = true
+	}
+	if update.Memory > 0 && update.MemorySwap == 0 && cur.MemorySwap > 0 && update.Memory > cur.MemorySwap {
+		update.MemorySwap = update.Memory + (cur.MemorySwap - cur.Memory)
+	}
+	return update, changed
+}
@@ -0,0 +1,129 @@
+package adoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mijia/adoc/adoctest"
+)
+
+func TestUpdateConfigValidate(t *testing.T) {
+	swappiness := int64(10)
+	cases := []struct {
+		apiVersion string
+		config     UpdateConfig
+		err        string
+	}{
+		{"v1.24", UpdateConfig{Resources: Resources{Memory: 512 * MiB, CPUShares: 512}}, ""},
+		{"v1.17", UpdateConfig{Resources: Resources{Memory: 512 * MiB}}, "not supported"},
+		{"v1.24", UpdateConfig{Resources: Resources{Memory: MiB}}, "Minimum memory limit"},
+		{"v1.24", UpdateConfig{Resources: Resources{Memory: 512 * MiB, MemorySwap: 256 * MiB}}, "memoryswap"},
+		{"v1.24", UpdateConfig{Resources: Resources{CPUPeriod: 10}}, "period"},
+		{"v1.24", UpdateConfig{Resources: Resources{NanoCPUs: 1e9}}, "NanoCPUs is not supported"},
+		{"v1.25", UpdateConfig{Resources: Resources{NanoCPUs: 1e9, CPUQuota: 50000}}, "Conflicting"},
+		{"v1.24", UpdateConfig{Resources: Resources{MemorySwappiness: &swappiness, CgroupParent: "/docker"}}, "Cannot update CgroupParent, MemorySwappiness"},
+		{"v1.22", UpdateConfig{RestartPolicy: RestartPolicy{Name: "always"}}, "Restart policy update"},
+		{"v1.24", UpdateConfig{RestartPolicy: RestartPolicy{Name: "sometimes"}}, "Invalid restart policy"},
+		{"v1.24", UpdateConfig{RestartPolicy: RestartPolicy{Name: "always", MaximumRetryCount: 3}}, "on-failure"},
+		{"v1.24", UpdateConfig{RestartPolicy: RestartPolicy{Name: "on-failure", MaximumRetryCount: 3}}, ""},
+	}
+	for _, c := range cases {
+		err := c.config.Validate(c.apiVersion)
+		if c.err == "" && err != nil {
+			t.Errorf("Update %+v should be valid with %s, %s", c.config, c.apiVersion, err)
+		}
+		if c.err != "" && (err == nil || !strings.Contains(err.Error(), c.err)) {
+			t.Errorf("Update %+v should fail with %q on %s, got %v", c.config, c.err, c.apiVersion, err)
+		}
+	}
+}
+
+func TestDiffUpdateConfig(t *testing.T) {
+	current := HostConfig{Resources: Resources{Memory: 256 * MiB, MemorySwap: 512 * MiB, CPUShares: 1024, CpusetCpus: "0,1"}}
+	if _, changed := DiffUpdateConfig(current, Resources{Memory: 256 * MiB, CPUShares: 1024}); changed {
+		t.Errorf("Should not change with the same resources")
+	}
+	update, changed := DiffUpdateConfig(current, Resources{Memory: 768 * MiB, CPUShares: 1024, CpusetCpus: "0-3"})
+	if !changed || update.Memory != 768*MiB || update.CPUShares != 0 || update.CpusetCpus != "0-3" {
+		t.Errorf("Wrong update, %+v", update)
+	}
+	if update.MemorySwap != 1024*MiB {
+		t.Errorf("The memoryswap should be raised to keep the swap size, %d", update.MemorySwap)
+	}
+}
+
+func TestUpdateContainer(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.24"))
+	defer client.Close()
+
+	hostConf := HostConfig{Resources: Resources{Memory: 256 * MiB, MemorySwap: 512 * MiB, CPUShares: 512}}
+	id, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, hostConf, NetworkingConfig{})
+	if err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+	detail, _ := client.InspectContainer(id)
+	update, _ := DiffUpdateConfig(detail.HostConfig, Resources{Memory: 768 * MiB, CPUShares: 1024})
+	update.RestartPolicy = RestartPolicy{Name: "unless-stopped"}
+	warnings, err := client.UpdateContainer(id, update)
+	if err != nil || len(warnings) != 1 || !strings.Contains(warnings[0], "swap limit") {
+		t.Fatalf("Cannot update the container, %v, %v", warnings, err)
+	}
+	detail, _ = client.InspectContainer(id)
+	resources := detail.HostConfig.Resources
+	if resources.Memory != 768*MiB || resources.MemorySwap != 1024*MiB || resources.CPUShares != 1024 ||
+		detail.HostConfig.RestartPolicy.Name != "unless-stopped" {
+		t.Errorf("Wrong updated host config, %+v", detail.HostConfig)
+	}
+
+	if _, err := client.UpdateContainer(id, UpdateConfig{Resources: Resources{Memory: MiB}}); err == nil {
+		t.Errorf("Should reject the invalid update")
+	}
+	if len(server.Requests()) != 4 {
+		t.Errorf("The invalid update should not be sent, %v", server.Requests())
+	}
+}
+
+func TestUpdateContainerBody(t *testing.T) {
+	server := adoctest.NewServer()
+	defer server.Close()
+	server.AddImage(adoctest.ImageSpec{Name: "busybox"})
+	var lastBody map[string]interface{}
+	capture := func(next http.RoundTripper) http.RoundTripper {
+		return RoundTripperFunc(func(req *http.Request) (*http.Response, error) {
+			if strings.HasSuffix(req.URL.Path, "/update") {
+				data, _ := ioutil.ReadAll(req.Body)
+				req.Body = ioutil.NopCloser(bytes.NewReader(data))
+				lastBody = nil
+				json.Unmarshal(data, &lastBody)
+			}
+			return next.RoundTrip(req)
+		})
+	}
+	client, _ := NewClient(server.URL, WithAPIVersion("v1.40"), WithMiddleware(capture))
+	defer client.Close()
+	id, err := client.CreateContainer(ContainerConfig{Image: "busybox"}, HostConfig{Resources: Resources{PidsLimit: 100}}, NetworkingConfig{})
+	if err != nil {
+		t.Fatalf("Cannot create the container, %s", err)
+	}
+
+	// the cpu only update should not reset the pids limit
+	if _, err := client.UpdateContainer(id, UpdateConfig{Resources: Resources{CPUShares: 512}}); err != nil {
+		t.Fatalf("Cannot update the container, %s", err)
+	}
+	if len(lastBody) != 1 || lastBody["CpuShares"] != float64(512) {
+		t.Errorf("Only the set fields should be sent, %v", lastBody)
+	}
+	if _, err := client.UpdateContainer(id, UpdateConfig{Resources: Resources{PidsLimit: -1}, RestartPolicy: RestartPolicy{Name: "always"}}); err != nil {
+		t.Fatalf("Cannot update the container, %s", err)
+	}
+	if len(lastBody) != 2 || lastBody["PidsLimit"] != float64(-1) || lastBody["RestartPolicy"] == nil {
+		t.Errorf("Wrong update body, %v", lastBody)
+	}
+}
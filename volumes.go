@@ -0,0 +1,76 @@
+package adoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// This part contains the apis for the named volumes, v1.21, e.g.
+//   volume, err := docker.CreateVolume(VolumeCreate{Name: "data", Labels: map[string]string{"app": "web"}})
+//   volumes, err := docker.ListVolumes(NewFilters().Dangling(true))
+
+// VolumeCreate is the options to create the volume, the daemon names the volume if the name is empty,
+// the driver is local by default
+type VolumeCreate struct {
+	Name       string            `json:",omitempty"`
+	Driver     string            `json:",omitempty"`
+	DriverOpts map[string]string `json:",omitempty"`
+	Labels     map[string]string `json:",omitempty"`
+}
+
+// ListVolumes returns the volumes, the filters are dangling, driver, label and name
+func (client *DockerClient) ListVolumes(filters Filters) ([]Volume, error) {
+	if err := filters.Validate(); err != nil {
+		return nil, err
+	}
+	uri := "volumes"
+	if encoded := client.EncodeFilters(filters); encoded != "" {
+		uri += "?" + url.Values{"filters": {encoded}}.Encode()
+	}
+	data, err := client.sendRequest("GET", uri, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	var ret struct {
+		Volumes  []Volume
+		Warnings []string
+	}
+	err = json.Unmarshal(data, &ret)
+	return ret.Volumes, err
+}
+
+func (client *DockerClient) InspectVolume(name string) (Volume, error) {
+	var ret Volume
+	uri := fmt.Sprintf("volumes/%s", name)
+	if data, err := client.sendRequest("GET", uri, nil, nil, nil); err != nil {
+		return ret, err
+	} else {
+		err := json.Unmarshal(data, &ret)
+		return ret, err
+	}
+}
+
+// CreateVolume creates the volume, creating an existing volume of the same driver returns the existing one
+func (client *DockerClient) CreateVolume(options VolumeCreate) (Volume, error) {
+	var ret Volume
+	body, err := json.Marshal(options)
+	if err != nil {
+		return ret, err
+	}
+	if data, err := client.sendRequest("POST", "volumes/create", body, nil, nil); err != nil {
+		return ret, err
+	} else {
+		err := json.Unmarshal(data, &ret)
+		return ret, err
+	}
+}
+
+// RemoveVolume removes the volume, the volume in use could not be removed even if forced
+func (client *DockerClient) RemoveVolume(name string, force bool) error {
+	v := url.Values{}
+	v.Set("force", formatBoolToIntString(force))
+	uri := fmt.Sprintf("volumes/%s?%s", name, v.Encode())
+	_, err := client.sendRequest("DELETE", uri, nil, nil, nil)
+	return err
+}